@@ -12,5 +12,7 @@ require (
 	github.com/pmezard/go-difflib v1.0.0
 	github.com/stretchr/testify v1.4.0
 	go.mongodb.org/mongo-driver v1.3.1
+	google.golang.org/genproto v0.0.0-20180817151627-c66870c02cf8
 	google.golang.org/grpc v1.24.0
+	gopkg.in/yaml.v2 v2.2.2
 )
@@ -8,8 +8,11 @@ import (
 	"encoding/json"
 	"github.com/brahma-adshonor/gohook"
 	"github.com/golang/protobuf/proto"
+	spb "google.golang.org/genproto/googleapis/rpc/status"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/connectivity"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
 )
 
 // grpc functions are exposed by interface, which cannot be hooked directly.
@@ -26,7 +29,7 @@ func buildReqKey(cxt context.Context, req interface{}, method string, data []byt
 
 	tag := GlobalMgr.genKey(RegressionGrpcHook, cxt, req)
 	if len(tag) == 0 {
-		tag = string(data)
+		tag = string(hashGrpcKeyData(data))
 	}
 
 	key := fmt.Sprintf("%s@@grpc_hook_key@@%s@@%s", id, method, tag)
@@ -49,26 +52,99 @@ func grpcConnClose(*grpc.ClientConn) error {
 }
 
 type storeValue struct {
-	Err   string `json:"err"`
-	Value []byte `json:"value"`
+	Err     string      `json:"err"`
+	Value   []byte      `json:"value"`
+	Status  []byte      `json:"status,omitempty"`
+	Header  metadata.MD `json:"header,omitempty"`
+	Trailer metadata.MD `json:"trailer,omitempty"`
+}
+
+// marshalGrpcStatus serializes the full status proto of err, including details.
+func marshalGrpcStatus(err error) []byte {
+	d, _ := proto.Marshal(status.Convert(err).Proto())
+	return d
+}
+
+func unmarshalGrpcStatus(d []byte) error {
+	var s spb.Status
+	err := proto.Unmarshal(d, &s)
+	if err != nil {
+		return fmt.Errorf("invalid recorded grpc status, err:%s", err)
+	}
+
+	return status.ErrorProto(&s)
+}
+
+// error recorded before status is stored is replayed as plain error.
+func (v *storeValue) error() error {
+	if len(v.Status) > 0 {
+		return unmarshalGrpcStatus(v.Status)
+	}
+
+	if len(v.Err) > 0 {
+		return fmt.Errorf("%s", v.Err)
+	}
+
+	return nil
+}
+
+// GrpcRecordedCall is the recorded result of an unary call, Err is the error returned to client.
+type GrpcRecordedCall struct {
+	Rsp     []byte
+	Header  metadata.MD
+	Trailer metadata.MD
+	Err     error
+}
+
+// LookupGrpcCall returns the recorded result for method and req, using the same key grpc hook uses.
+// req is the deterministically marshaled request message.
+func LookupGrpcCall(ctx context.Context, method string, req []byte) (*GrpcRecordedCall, error) {
+	key := buildGrpcCallKey(ctx, nil, method, req)
+	value, err := GlobalMgr.GetValue(key)
+	if err != nil {
+		return nil, err
+	}
+
+	var val storeValue
+	err = json.Unmarshal(value, &val)
+	if err != nil {
+		return nil, fmt.Errorf("invalid recorded grpc call, key:%s, err:%s", key, err)
+	}
+
+	return &GrpcRecordedCall{Rsp: val.Value, Header: val.Header, Trailer: val.Trailer, Err: val.error()}, nil
+}
+
+// setGrpcCallMetadata fills header and trailer requested by grpc.Header()/grpc.Trailer() call options.
+func setGrpcCallMetadata(opts []grpc.CallOption, header, trailer metadata.MD) {
+	for _, o := range opts {
+		switch v := o.(type) {
+		case grpc.HeaderCallOption:
+			*v.HeaderAddr = header
+		case grpc.TrailerCallOption:
+			*v.TrailerAddr = trailer
+		}
+	}
 }
 
 func grpcInvokeHook(cc *grpc.ClientConn, ctx context.Context, method string, args, reply interface{}, opts ...grpc.CallOption) error {
-	if GlobalMgr.ShouldRecord() {
-		err := grpcInvokeHookTrampoline(cc, ctx, method, args, reply, opts...)
+	return grpcInvoke(ctx, method, args, reply, opts, func(callOpts ...grpc.CallOption) error {
+		return grpcInvokeHookTrampoline(cc, ctx, method, args, reply, callOpts...)
+	})
+}
 
-		req, ok1 := args.(proto.Message)
-		buff := make([]byte, 256)
-		kb := proto.NewBuffer(buff)
+// grpcInvoke records or replays an unary call, invoke is only called in record mode.
+func grpcInvoke(ctx context.Context, method string, args, reply interface{}, opts []grpc.CallOption, invoke func(...grpc.CallOption) error) error {
+	if GlobalMgr.ShouldRecord() {
+		// always ask for header and trailer, so that they are available in replay.
+		var header, trailer metadata.MD
+		callOpts := append([]grpc.CallOption{}, opts...)
+		callOpts = append(callOpts, grpc.Header(&header), grpc.Trailer(&trailer))
 
-		// by default, serialization of map type can differ from run to run even given the same input.
-		// we need serialization to be consistent.
-		// however we can not change this setting directly from proto.Marshal()
-		// the only way available at this writting is to use proto.Buffer()
-		kb.SetDeterministic(true)
+		err := invoke(callOpts...)
 
-		err1 := kb.Marshal(req)
-		key := buildReqKey(ctx, args, method, kb.Bytes())
+		req, ok1 := args.(proto.Message)
+		reqData, err1 := marshalGrpcKeyMsg(method, req)
+		key := buildGrpcCallKey(ctx, args, method, reqData)
 
 		if err == nil {
 			rsp, ok2 := reply.(proto.Message)
@@ -76,8 +152,10 @@ func grpcInvokeHook(cc *grpc.ClientConn, ctx context.Context, method string, arg
 				rspData, err2 := proto.Marshal(rsp)
 				if err1 == nil && err2 == nil {
 					val := storeValue{
-						Err:   "",
-						Value: rspData,
+						Err:     "",
+						Value:   rspData,
+						Header:  header,
+						Trailer: trailer,
 					}
 
 					d, _ := json.Marshal(val)
@@ -87,8 +165,11 @@ func grpcInvokeHook(cc *grpc.ClientConn, ctx context.Context, method string, arg
 			}
 		} else {
 			val := storeValue{
-				Err:   err.Error(),
-				Value: nil,
+				Err:     err.Error(),
+				Value:   nil,
+				Status:  marshalGrpcStatus(err),
+				Header:  header,
+				Trailer: trailer,
 			}
 
 			d, _ := json.Marshal(val)
@@ -112,20 +193,17 @@ func grpcInvokeHook(cc *grpc.ClientConn, ctx context.Context, method string, arg
 	// fmt.Printf("ok1:%t, ok2:%t\n", ok1, ok2)
 
 	if ok1 && ok2 {
-		buff := make([]byte, 256)
-		kb := proto.NewBuffer(buff)
-		kb.SetDeterministic(true)
-		err1 := kb.Marshal(req)
+		reqData, err1 := marshalGrpcKeyMsg(method, req)
 		if err1 == nil {
-			key := buildReqKey(ctx, args, method, kb.Bytes())
+			key := buildGrpcCallKey(ctx, args, method, reqData)
 			value, err2 := GlobalMgr.GetValue(key)
 			if err2 == nil {
 				var val storeValue
 				err = json.Unmarshal(value, &val)
 				if err == nil {
-					if len(val.Err) > 0 {
-						err = fmt.Errorf("%s", val.Err)
-					} else {
+					setGrpcCallMetadata(opts, val.Header, val.Trailer)
+					err = val.error()
+					if err == nil {
 						err = proto.Unmarshal(val.Value, rsp)
 					}
 				}
@@ -172,10 +250,17 @@ func HookGrpcInvoke() error {
 		return err1
 	}
 
+	err5 := gohook.HookMethod(cc, "NewStream", grpcNewStreamHook, grpcNewStreamHookTrampoline)
+	if err5 != nil {
+		gohook.UnHookMethod(cc, "Invoke")
+		return err5
+	}
+
 	if !GlobalMgr.ShouldRecord() {
 		err2 := gohook.Hook(grpc.DialContext, grpcDialContextHook, nil)
 		if err2 != nil {
 			gohook.UnHookMethod(cc, "Invoke")
+			gohook.UnHookMethod(cc, "NewStream")
 			return err2
 		}
 
@@ -183,6 +268,7 @@ func HookGrpcInvoke() error {
 		if err3 != nil {
 			gohook.UnHook(grpc.DialContext)
 			gohook.UnHookMethod(cc, "Invoke")
+			gohook.UnHookMethod(cc, "NewStream")
 			return err3
 		}
 
@@ -190,6 +276,7 @@ func HookGrpcInvoke() error {
 		if err4 != nil {
 			gohook.UnHook(grpc.DialContext)
 			gohook.UnHookMethod(cc, "Invoke")
+			gohook.UnHookMethod(cc, "NewStream")
 			gohook.UnHookMethod(cc, "GetState")
 			return err4
 		}
@@ -206,5 +293,6 @@ func UnHookGrpcInvoke() error {
 		gohook.UnHookMethod(cc, "GetState")
 	}
 
+	gohook.UnHookMethod(cc, "NewStream")
 	return gohook.UnHookMethod(cc, "Invoke")
 }
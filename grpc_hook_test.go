@@ -8,6 +8,11 @@ import (
 	"github.com/golang/protobuf/proto"
 	"github.com/stretchr/testify/assert"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"net"
 	"testing"
 )
 
@@ -149,3 +154,107 @@ func TestCallSome(t *testing.T) {
 	_, err6 := client.SomeCall(ctx, req11)
 	assert.NotNil(t, err6)
 }
+
+func someCallHandler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	req := &GrpcHookRequest{}
+	err := dec(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if interceptor != nil {
+		info := &grpc.UnaryServerInfo{Server: srv, FullMethod: "/grpc_hook.GrpcHookService/SomeCall"}
+		return interceptor(ctx, req, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+			return someCall(ctx, req.(*GrpcHookRequest))
+		})
+	}
+
+	return someCall(ctx, req)
+}
+
+func someCall(ctx context.Context, req *GrpcHookRequest) (interface{}, error) {
+	grpc.SetHeader(ctx, metadata.Pairs("x-header", "miliao"))
+	grpc.SetTrailer(ctx, metadata.Pairs("x-trailer", fmt.Sprintf("%d", req.ReqId)))
+
+	if req.ReqId == 0 {
+		st, _ := status.New(codes.FailedPrecondition, "invalid req id").WithDetails(&GrpcHookResponse{RspName: "detail"})
+		return nil, st.Err()
+	}
+
+	return &GrpcHookResponse{ReqId: req.ReqId}, nil
+}
+
+var testSomeCallService = grpc.ServiceDesc{
+	ServiceName: "grpc_hook.GrpcHookService",
+	HandlerType: (*interface{})(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "SomeCall",
+			Handler:    someCallHandler,
+		},
+	},
+}
+
+func runSomeCall(t *testing.T, cc *grpc.ClientConn) {
+	client := NewGrpcHookServiceClient(cc)
+
+	var header, trailer metadata.MD
+	rsp, err := client.SomeCall(context.Background(), &GrpcHookRequest{ReqId: 23}, grpc.Header(&header), grpc.Trailer(&trailer))
+	assert.Nil(t, err)
+	assert.Equal(t, int32(23), rsp.GetReqId())
+	assert.Equal(t, []string{"miliao"}, header.Get("x-header"))
+	assert.Equal(t, []string{"23"}, trailer.Get("x-trailer"))
+
+	_, err = client.SomeCall(context.Background(), &GrpcHookRequest{ReqId: 0}, grpc.Trailer(&trailer))
+	st := status.Convert(err)
+	assert.Equal(t, codes.FailedPrecondition, st.Code())
+	assert.Equal(t, "invalid req id", st.Message())
+	assert.Equal(t, 1, len(st.Details()))
+	assert.Equal(t, []string{"0"}, trailer.Get("x-trailer"))
+
+	if len(st.Details()) > 0 {
+		d, _ := st.Details()[0].(*GrpcHookResponse)
+		assert.Equal(t, "detail", d.GetRspName())
+	}
+}
+
+func TestGrpcStatusAndMetadata(t *testing.T) {
+	enableRegressionEngine(RegressionRecord)
+
+	GlobalMgr.SetState(RegressionReplay)
+	UnHookGrpcInvoke()
+
+	GlobalMgr.SetState(RegressionRecord)
+	GlobalMgr.SetStorage(NewMapStorage(100))
+
+	lis := bufconn.Listen(1024 * 1024)
+	srv := grpc.NewServer()
+	srv.RegisterService(&testSomeCallService, struct{}{})
+	go srv.Serve(lis)
+	defer srv.Stop()
+
+	dialer := func(context.Context, string) (net.Conn, error) { return lis.Dial() }
+
+	err := HookGrpcInvoke()
+	assert.Nil(t, err)
+
+	cc, err := grpc.DialContext(context.Background(), "bufnet", grpc.WithContextDialer(dialer), grpc.WithInsecure())
+	assert.Nil(t, err)
+
+	runSomeCall(t, cc)
+	cc.Close()
+
+	UnHookGrpcInvoke()
+	GlobalMgr.SetState(RegressionReplay)
+	srv.Stop()
+
+	err = HookGrpcInvoke()
+	assert.Nil(t, err)
+	defer UnHookGrpcInvoke()
+
+	cc, err = grpc.DialContext(context.Background(), "bufnet")
+	assert.Nil(t, err)
+	runSomeCall(t, cc)
+
+	GlobalMgr.ClearStorage()
+}
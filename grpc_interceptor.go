@@ -0,0 +1,93 @@
+package gorr
+
+import (
+	"context"
+	"net"
+	"sync"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// interceptors do the same record/replay as HookGrpcInvoke(), without binary patching.
+//   conn, err := grpc.DialContext(ctx, target, append(opts, gorr.GrpcDialOptions()...)...)
+// replay connects without transport security, for secure connections, opts must not contain grpc.WithTransportCredentials(),
+// creds are passed to gorr instead, and are dropped in replay mode.
+//   conn, err := grpc.DialContext(ctx, target, append(opts, gorr.GrpcDialOptionsWithCreds(creds)...)...)
+
+var (
+	replayListenerOnce sync.Once
+	replayListener     *bufconn.Listener
+)
+
+// GrpcUnaryClientInterceptor records or replays unary calls through GlobalMgr.
+func GrpcUnaryClientInterceptor() grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		if GlobalMgr == nil {
+			return invoker(ctx, method, req, reply, cc, opts...)
+		}
+
+		return grpcInvoke(ctx, method, req, reply, opts, func(callOpts ...grpc.CallOption) error {
+			return invoker(ctx, method, req, reply, cc, callOpts...)
+		})
+	}
+}
+
+// GrpcStreamClientInterceptor records or replays streaming calls through GlobalMgr.
+func GrpcStreamClientInterceptor() grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		if GlobalMgr == nil {
+			return streamer(ctx, desc, cc, method, opts...)
+		}
+
+		return grpcNewStream(ctx, method, func() (grpc.ClientStream, error) {
+			return streamer(ctx, desc, cc, method, opts...)
+		})
+	}
+}
+
+// GrpcReplayDialer connects to an in-process server, which rejects every call.
+// it is used in replay mode, so that no real connection is attempted.
+func GrpcReplayDialer(ctx context.Context, target string) (net.Conn, error) {
+	replayListenerOnce.Do(func() {
+		replayListener = bufconn.Listen(64 * 1024)
+
+		srv := grpc.NewServer(grpc.UnknownServiceHandler(func(srv interface{}, stream grpc.ServerStream) error {
+			method, _ := grpc.MethodFromServerStream(stream)
+			return status.Errorf(codes.Unavailable, "gorr replay server, call not recorded:%s", method)
+		}))
+
+		go srv.Serve(replayListener)
+	})
+
+	return replayListener.Dial()
+}
+
+// GrpcDialOptions returns dial options installing gorr interceptors.
+// in replay mode, the connection is redirected to GrpcReplayDialer as well, so the state must be set before dialing,
+// grpc.WithInsecure() is included, which conflicts with grpc.WithTransportCredentials(), see GrpcDialOptionsWithCreds().
+func GrpcDialOptions() []grpc.DialOption {
+	opts := []grpc.DialOption{
+		grpc.WithUnaryInterceptor(GrpcUnaryClientInterceptor()),
+		grpc.WithStreamInterceptor(GrpcStreamClientInterceptor()),
+	}
+
+	if GlobalMgr != nil && !GlobalMgr.ShouldRecord() {
+		opts = append(opts, grpc.WithContextDialer(GrpcReplayDialer), grpc.WithInsecure())
+	}
+
+	return opts
+}
+
+// GrpcDialOptionsWithCreds is GrpcDialOptions() for secure connections, creds are used in record mode only.
+func GrpcDialOptionsWithCreds(creds credentials.TransportCredentials) []grpc.DialOption {
+	opts := GrpcDialOptions()
+	if GlobalMgr == nil || GlobalMgr.ShouldRecord() {
+		opts = append(opts, grpc.WithTransportCredentials(creds))
+	}
+
+	return opts
+}
@@ -0,0 +1,74 @@
+package gorr
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+func TestGrpcInterceptor(t *testing.T) {
+	enableRegressionEngine(RegressionRecord)
+
+	// interceptors must work without any hook.
+	GlobalMgr.SetState(RegressionReplay)
+	UnHookGrpcInvoke()
+
+	GlobalMgr.SetState(RegressionRecord)
+	GlobalMgr.SetStorage(NewMapStorage(100))
+
+	lis := bufconn.Listen(1024 * 1024)
+	srv := grpc.NewServer()
+	srv.RegisterService(&testSomeCallService, struct{}{})
+	srv.RegisterService(&testEchoStreamService, struct{}{})
+	go srv.Serve(lis)
+
+	dialer := func(context.Context, string) (net.Conn, error) { return lis.Dial() }
+
+	opts := append(GrpcDialOptions(), grpc.WithContextDialer(dialer), grpc.WithInsecure())
+	cc, err := grpc.DialContext(context.Background(), "bufnet", opts...)
+	assert.Nil(t, err)
+
+	runSomeCall(t, cc)
+	runEchoStream(t, cc)
+
+	cc.Close()
+	srv.Stop()
+
+	GlobalMgr.SetState(RegressionReplay)
+
+	cc, err = grpc.DialContext(context.Background(), "some.host.not.exist:2333", GrpcDialOptions()...)
+	assert.Nil(t, err)
+	defer cc.Close()
+
+	runSomeCall(t, cc)
+	runEchoStream(t, cc)
+
+	// calls not recorded fail in replay.
+	err = cc.Invoke(context.Background(), "/grpc_hook.GrpcHookService/SomeCall", &GrpcHookRequest{ReqId: 24}, &GrpcHookResponse{})
+	assert.NotNil(t, err)
+
+	// transport credentials are dropped in replay.
+	sc, err := grpc.DialContext(context.Background(), "some.host.not.exist:2333", GrpcDialOptionsWithCreds(credentials.NewTLS(&tls.Config{}))...)
+	assert.Nil(t, err)
+	defer sc.Close()
+
+	runSomeCall(t, sc)
+
+	// calls without interceptors reach replay server and get rejected.
+	raw, err := grpc.DialContext(context.Background(), "bufnet", grpc.WithContextDialer(GrpcReplayDialer), grpc.WithInsecure())
+	assert.Nil(t, err)
+	defer raw.Close()
+
+	err = raw.Invoke(context.Background(), "/grpc_hook.GrpcHookService/SomeCall", &GrpcHookRequest{ReqId: 23}, &GrpcHookResponse{})
+	assert.Equal(t, codes.Unavailable, status.Code(err))
+
+	GlobalMgr.ClearStorage()
+}
@@ -0,0 +1,232 @@
+package gorr
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/golang/protobuf/proto"
+)
+
+// request fields like request id, timestamp or nonce differ from run to run, they are cleared before building grpc keys.
+// rules are loaded from a json file, eg:
+//
+//	{
+//		"hash_threshold": 4096,
+//		"methods": {
+//			"/package.Service/Method": ["header.request_id", "items.ts"],
+//			"/package.Service/": ["nonce"]
+//		}
+//	}
+//
+// fields are given by proto field names, "/package.Service/" applies to all methods of the service.
+// requests larger than hash_threshold bytes are hashed, 0 to disable.
+
+var RegressionGrpcKeyConfig = flag.String("gorr_grpc_key_config", "", "json file of fields to ignore when building grpc request keys")
+
+// GrpcKeyConfig holds rules for building grpc request keys.
+type GrpcKeyConfig struct {
+	HashThreshold int                 `json:"hash_threshold"`
+	Methods       map[string][]string `json:"methods"`
+}
+
+var (
+	grpcKeyConfLock sync.Mutex
+	grpcKeyConf     *GrpcKeyConfig
+)
+
+// LoadGrpcKeyConfig reads grpc key rules from file.
+func LoadGrpcKeyConfig(file string) (*GrpcKeyConfig, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("read grpc key config failed, file:%s, err:%s", file, err)
+	}
+
+	var c GrpcKeyConfig
+	err = json.Unmarshal(data, &c)
+	if err != nil {
+		return nil, fmt.Errorf("invalid grpc key config, file:%s, err:%s", file, err)
+	}
+
+	return &c, nil
+}
+
+// SetGrpcKeyConfig replaces rules loaded from -gorr_grpc_key_config, nil to disable.
+func SetGrpcKeyConfig(c *GrpcKeyConfig) {
+	grpcKeyConfLock.Lock()
+	defer grpcKeyConfLock.Unlock()
+
+	if c == nil {
+		c = &GrpcKeyConfig{}
+	}
+
+	grpcKeyConf = c
+}
+
+func getGrpcKeyConfig() *GrpcKeyConfig {
+	grpcKeyConfLock.Lock()
+	defer grpcKeyConfLock.Unlock()
+
+	if grpcKeyConf != nil {
+		return grpcKeyConf
+	}
+
+	grpcKeyConf = &GrpcKeyConfig{}
+	if len(*RegressionGrpcKeyConfig) > 0 {
+		c, err := LoadGrpcKeyConfig(*RegressionGrpcKeyConfig)
+		if err != nil {
+			if GlobalMgr != nil {
+				GlobalMgr.notifier("load grpc key config failed", *RegressionGrpcKeyConfig, []byte(err.Error()))
+			}
+		} else {
+			grpcKeyConf = c
+		}
+	}
+
+	return grpcKeyConf
+}
+
+// IgnoredFields returns fields of method to clear, rules of the service are included.
+func (c *GrpcKeyConfig) IgnoredFields(method string) []string {
+	var ret []string
+	for p, fields := range c.Methods {
+		if p == method || (strings.HasSuffix(p, "/") && strings.HasPrefix(method, p)) {
+			ret = append(ret, fields...)
+		}
+	}
+
+	return ret
+}
+
+// GrpcKeyIgnoredFields returns fields of method to clear before building keys, using current config.
+func GrpcKeyIgnoredFields(method string) []string {
+	return getGrpcKeyConfig().IgnoredFields(method)
+}
+
+// grpcCallKeyPrefixLen is number of zero bytes data of unary call keys starts with.
+// grpc hook used to marshal requests by proto.NewBuffer(make([]byte, 256)), which appends to the buffer
+// instead of overwriting it, the prefix is kept so that existing recordings stay valid.
+const grpcCallKeyPrefixLen = 256
+
+// buildGrpcCallKey builds key of unary call from req, the deterministically marshaled request with ignored fields cleared,
+// see marshalGrpcKeyMsg. the zero prefix is part of data hashed by hashGrpcKeyData as well.
+func buildGrpcCallKey(ctx context.Context, args interface{}, method string, req []byte) string {
+	data := make([]byte, grpcCallKeyPrefixLen, grpcCallKeyPrefixLen+len(req))
+	return buildReqKey(ctx, args, method, append(data, req...))
+}
+
+// marshalGrpcKeyMsg marshals req of method deterministically with ignored fields cleared.
+// by default, serialization of map type can differ from run to run even given the same input.
+func marshalGrpcKeyMsg(method string, req proto.Message) ([]byte, error) {
+	return marshalGrpcMsg(clearGrpcKeyFields(method, req))
+}
+
+// hashGrpcKeyData replaces data larger than the threshold by its sha256 digest.
+func hashGrpcKeyData(data []byte) []byte {
+	n := getGrpcKeyConfig().HashThreshold
+	if n <= 0 || len(data) <= n {
+		return data
+	}
+
+	sum := sha256.Sum256(data)
+	return []byte("sha256:" + hex.EncodeToString(sum[:]))
+}
+
+// clearGrpcKeyFields returns a copy of m with ignored fields of method cleared, m itself is returned if no rule applies.
+func clearGrpcKeyFields(method string, m proto.Message) proto.Message {
+	if m == nil {
+		return m
+	}
+
+	fields := GrpcKeyIgnoredFields(method)
+	if len(fields) == 0 {
+		return m
+	}
+
+	v := reflect.ValueOf(m)
+	if v.Kind() != reflect.Ptr || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		return m
+	}
+
+	c := proto.Clone(m)
+	for _, f := range fields {
+		clearProtoField(reflect.ValueOf(c).Elem(), strings.Split(f, "."))
+	}
+
+	return c
+}
+
+// protoFieldName returns the proto field name in protobuf struct tag, eg: bytes,1,opt,name=req_id,json=reqId,proto3
+func protoFieldName(tag string) string {
+	for _, s := range strings.Split(tag, ",") {
+		if strings.HasPrefix(s, "name=") {
+			return s[len("name="):]
+		}
+	}
+
+	return ""
+}
+
+// clearProtoField clears field at path of generated message struct v, path crosses repeated fields and map values.
+func clearProtoField(v reflect.Value, path []string) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+
+		if len(sf.Tag.Get("protobuf_oneof")) > 0 {
+			fv := v.Field(i)
+			if fv.IsNil() || fv.Elem().Kind() != reflect.Ptr {
+				continue
+			}
+
+			// oneof wrapper struct holds a single field.
+			w := fv.Elem().Elem()
+			if w.Kind() != reflect.Struct || w.NumField() != 1 || protoFieldName(w.Type().Field(0).Tag.Get("protobuf")) != path[0] {
+				continue
+			}
+
+			if len(path) == 1 {
+				fv.Set(reflect.Zero(fv.Type()))
+			} else {
+				clearProtoValue(w.Field(0), path[1:])
+			}
+			return
+		}
+
+		if protoFieldName(sf.Tag.Get("protobuf")) != path[0] {
+			continue
+		}
+
+		fv := v.Field(i)
+		if len(path) == 1 {
+			fv.Set(reflect.Zero(fv.Type()))
+		} else {
+			clearProtoValue(fv, path[1:])
+		}
+		return
+	}
+}
+
+func clearProtoValue(v reflect.Value, path []string) {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if !v.IsNil() && v.Elem().Kind() == reflect.Struct {
+			clearProtoField(v.Elem(), path)
+		}
+	case reflect.Slice:
+		for i := 0; i < v.Len(); i++ {
+			clearProtoValue(v.Index(i), path)
+		}
+	case reflect.Map:
+		for _, k := range v.MapKeys() {
+			clearProtoValue(v.MapIndex(k), path)
+		}
+	}
+}
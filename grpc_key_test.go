@@ -0,0 +1,102 @@
+package gorr
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	descpb "github.com/golang/protobuf/protoc-gen-go/descriptor"
+	structpb "github.com/golang/protobuf/ptypes/struct"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+)
+
+func TestClearGrpcKeyFields(t *testing.T) {
+	SetGrpcKeyConfig(&GrpcKeyConfig{
+		Methods: map[string][]string{
+			"/test.Service/File":   {"name", "message_type.field.json_name", "options.java_package"},
+			"/test.Service/":       {"syntax"},
+			"/test.Service/Struct": {"fields.string_value"},
+		},
+	})
+	defer SetGrpcKeyConfig(nil)
+
+	fd := &descpb.FileDescriptorProto{
+		Name:   proto.String("a.proto"),
+		Syntax: proto.String("proto3"),
+		MessageType: []*descpb.DescriptorProto{
+			{
+				Name:  proto.String("Msg"),
+				Field: []*descpb.FieldDescriptorProto{{Name: proto.String("id"), JsonName: proto.String("id")}},
+			},
+		},
+		Options: &descpb.FileOptions{JavaPackage: proto.String("com.gorr"), GoPackage: proto.String("gorr")},
+	}
+
+	c := clearGrpcKeyFields("/test.Service/File", fd).(*descpb.FileDescriptorProto)
+	assert.Nil(t, c.Name)
+	assert.Nil(t, c.Syntax)
+	assert.Nil(t, c.MessageType[0].Field[0].JsonName)
+	assert.Equal(t, "id", c.MessageType[0].Field[0].GetName())
+	assert.Nil(t, c.Options.JavaPackage)
+	assert.Equal(t, "gorr", c.Options.GetGoPackage())
+	assert.Equal(t, "a.proto", fd.GetName())
+
+	assert.True(t, clearGrpcKeyFields("/test.Other/File", fd) == fd)
+
+	st := &structpb.Struct{
+		Fields: map[string]*structpb.Value{
+			"s": {Kind: &structpb.Value_StringValue{StringValue: "nonce"}},
+			"n": {Kind: &structpb.Value_NumberValue{NumberValue: 1}},
+		},
+	}
+
+	cs := clearGrpcKeyFields("/test.Service/Struct", st).(*structpb.Struct)
+	assert.Nil(t, cs.Fields["s"].Kind)
+	assert.Equal(t, float64(1), cs.Fields["n"].GetNumberValue())
+}
+
+func TestGrpcKeyRules(t *testing.T) {
+	enableRegressionEngine(RegressionRecord)
+	GlobalMgr.SetState(RegressionRecord)
+	GlobalMgr.SetStorage(NewMapStorage(100))
+
+	SetGrpcKeyConfig(&GrpcKeyConfig{
+		HashThreshold: 8,
+		Methods:       map[string][]string{"/grpc_hook.GrpcHookService/": {"req_data"}},
+	})
+	defer SetGrpcKeyConfig(nil)
+
+	method := "/grpc_hook.GrpcHookService/SomeCall"
+	ctx := context.Background()
+
+	invoke := func(opts ...grpc.CallOption) error { return nil }
+	err := grpcInvoke(ctx, method, &GrpcHookRequest{ReqId: 23, ReqName: "miliao", ReqData: "nonce-1"}, &GrpcHookResponse{RspId: 1}, nil, invoke)
+	assert.Nil(t, err)
+
+	GlobalMgr.SetState(RegressionReplay)
+
+	rsp := &GrpcHookResponse{}
+	err = grpcInvoke(ctx, method, &GrpcHookRequest{ReqId: 23, ReqName: "miliao", ReqData: "nonce-2"}, rsp, nil, invoke)
+	assert.Nil(t, err)
+	assert.Equal(t, int32(1), rsp.RspId)
+
+	err = grpcInvoke(ctx, method, &GrpcHookRequest{ReqId: 24, ReqName: "miliao"}, rsp, nil, invoke)
+	assert.NotNil(t, err)
+
+	// keys of lookups by marshaled requests are the same as keys of grpc hook.
+	data, err := marshalGrpcKeyMsg(method, &GrpcHookRequest{ReqId: 23, ReqName: "miliao", ReqData: "nonce-3"})
+	assert.Nil(t, err)
+	call, err := LookupGrpcCall(ctx, method, data)
+	assert.Nil(t, err)
+	assert.Nil(t, proto.Unmarshal(call.Rsp, rsp))
+	assert.Equal(t, int32(1), rsp.RspId)
+
+	key := buildReqKey(ctx, nil, method, []byte("some large request"))
+	idx := strings.Index(key, "@@sha256:")
+	assert.True(t, idx > 0)
+	assert.Equal(t, 64, len(key)-idx-len("@@sha256:"))
+
+	GlobalMgr.ClearStorage()
+}
@@ -0,0 +1,315 @@
+package gorr
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+
+	"gorr/util/pbdesc"
+
+	"github.com/golang/protobuf/descriptor"
+	"github.com/golang/protobuf/jsonpb"
+	"github.com/golang/protobuf/proto"
+	"google.golang.org/grpc"
+)
+
+// descriptors of recorded messages are saved alongside test cases, so that runner is able to
+// encode/decode them without generated code.
+const grpcDescriptorFile = "reg_grpc.desc"
+
+var (
+	grpcDescLock sync.Mutex
+	// proto files already saved, keyed by test suite dir, reg_grpc.desc is rewritten only when a new file shows up.
+	grpcDescSaved = make(map[string]map[string]bool)
+)
+
+// GrpcCallData is an inbound grpc call captured by recorder interceptors.
+type GrpcCallData struct {
+	Method       string // full method name, eg: /package.Service/Method
+	Req          []proto.Message
+	Rsp          []proto.Message
+	ClientStream bool
+	ServerStream bool
+}
+
+// GrpcRecorderFilter selects calls to be recorded by full method name, following HttpRecorderFilter semantics,
+// eg: "/package.Service/" matches all methods of the service.
+type GrpcRecorderFilter struct {
+	Methods    []string
+	SampleRate float64
+}
+
+func (f *GrpcRecorderFilter) accept(method string) bool {
+	hf := &HttpRecorderFilter{Patterns: f.Methods, SampleRate: f.SampleRate}
+	_, ok := hf.match(method)
+	return ok && hf.sampled()
+}
+
+// marshalGrpcMessages serializes msgs in binary or jsonpb form.
+// streams are stored as length delimited messages in binary form, or {"messages":[...]} in json form.
+func marshalGrpcMessages(format int, msgs []proto.Message, stream bool) ([]byte, error) {
+	if !stream && len(msgs) != 1 {
+		return nil, fmt.Errorf("exactly one message expected for unary call, got:%d", len(msgs))
+	}
+
+	if format == RecorderDataTypePbBinary {
+		var out []byte
+		for _, m := range msgs {
+			b := proto.NewBuffer(nil)
+			b.SetDeterministic(true)
+
+			err := b.Marshal(m)
+			if err != nil {
+				return nil, err
+			}
+
+			if !stream {
+				return b.Bytes(), nil
+			}
+
+			out = append(out, proto.EncodeVarint(uint64(len(b.Bytes())))...)
+			out = append(out, b.Bytes()...)
+		}
+		return out, nil
+	}
+
+	if format != RecorderDataTypeJson {
+		return nil, fmt.Errorf("unsupported grpc data format:%d", format)
+	}
+
+	jm := &jsonpb.Marshaler{Indent: "\t"}
+
+	all := make([]json.RawMessage, 0, len(msgs))
+	for _, m := range msgs {
+		var buf bytes.Buffer
+		err := jm.Marshal(&buf, m)
+		if err != nil {
+			return nil, err
+		}
+
+		if !stream {
+			return buf.Bytes(), nil
+		}
+
+		all = append(all, json.RawMessage(buf.Bytes()))
+	}
+
+	return json.MarshalIndent(map[string]interface{}{"messages": all}, "", "\t")
+}
+
+// saveGrpcDescriptors merges descriptors of msgs into dir/reg_grpc.desc.
+// messages not generated by protoc-gen-go have no descriptor, they are reported through notifier and skipped.
+func saveGrpcDescriptors(dir string, msgs ...proto.Message) error {
+	var files []string
+	for _, m := range msgs {
+		dm, ok := m.(descriptor.Message)
+		if !ok {
+			GlobalMgr.notifier("grpc descriptor not available", fmt.Sprintf("%T", m), []byte(dir))
+			continue
+		}
+
+		fd, _ := descriptor.ForMessage(dm)
+		files = append(files, fd.GetName())
+	}
+
+	if len(files) == 0 {
+		return nil
+	}
+
+	grpcDescLock.Lock()
+	defer grpcDescLock.Unlock()
+
+	path := dir + "/" + grpcDescriptorFile
+
+	// dir may be cleaned up and reused.
+	saved := grpcDescSaved[dir]
+	if _, err := os.Stat(path); saved == nil || err != nil {
+		saved = make(map[string]bool)
+		grpcDescSaved[dir] = saved
+	}
+
+	added := files[:0]
+	for _, f := range files {
+		if !saved[f] {
+			added = append(added, f)
+		}
+	}
+
+	if len(added) == 0 {
+		return nil
+	}
+
+	r := pbdesc.NewRegistry()
+	if _, err := os.Stat(path); err == nil {
+		r, err = pbdesc.ReadFileDescriptorSet(path)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, f := range added {
+		err := r.AddRegisteredFile(f)
+		if err != nil {
+			return err
+		}
+	}
+
+	data, err := proto.Marshal(r.Files())
+	if err != nil {
+		return fmt.Errorf("marshal file descriptor set failed, err:%s", err)
+	}
+
+	err = ioutil.WriteFile(path, data, 0644)
+	if err != nil {
+		return err
+	}
+
+	for _, f := range added {
+		saved[f] = true
+	}
+
+	return nil
+}
+
+// RecordGrpcCall records an inbound grpc call as test case, format is RecorderDataTypePbBinary or RecorderDataTypeJson.
+// full method name is used as uri, message type names and descriptors are saved as well.
+func RecordGrpcCall(outDir, desc string, format int, call *GrpcCallData, db []string) (string, error) {
+	if len(call.Req) == 0 || len(call.Rsp) == 0 {
+		return "", fmt.Errorf("invalid grpc call, request and response are required, method:%s", call.Method)
+	}
+
+	req, err := marshalGrpcMessages(format, call.Req, call.ClientStream)
+	if err != nil {
+		return "", fmt.Errorf("marshal grpc request failed, method:%s, err:%s", call.Method, err)
+	}
+
+	rsp, err := marshalGrpcMessages(format, call.Rsp, call.ServerStream)
+	if err != nil {
+		return "", fmt.Errorf("marshal grpc response failed, method:%s, err:%s", call.Method, err)
+	}
+
+	tc := &TestCase{
+		URI:          call.Method,
+		ReqType:      format,
+		RspType:      format,
+		Desc:         desc,
+		ReqMsg:       proto.MessageName(call.Req[0]),
+		RspMsg:       proto.MessageName(call.Rsp[0]),
+		ClientStream: call.ClientStream,
+		ServerStream: call.ServerStream,
+	}
+
+	// descriptors go first, so that no test case is left behind without them.
+	save := func(dir string) error {
+		err := saveGrpcDescriptors(dir, call.Req[0], call.Rsp[0])
+		if err != nil {
+			return fmt.Errorf("save grpc descriptors failed, method:%s, err:%s", call.Method, err)
+		}
+		return nil
+	}
+
+	return recordTestCase(outDir, "grpc", tc, req, rsp, db, save)
+}
+
+func recordGrpcCall(format int, call *GrpcCallData) {
+	dir, err := RecordGrpcCall("", call.Method, format, call, nil)
+	if err != nil {
+		GlobalMgr.notifier("recording grpc test case failed", call.Method, []byte(err.Error()))
+		return
+	}
+
+	GlobalMgr.notifier("recording grpc test case done", call.Method, []byte(dir))
+}
+
+// NewGrpcRecorderUnaryInterceptor returns a server interceptor recording successful inbound unary calls as test cases.
+// calls are passed through untouched unless gorr is in recording state.
+func NewGrpcRecorderUnaryInterceptor(format int, filter GrpcRecorderFilter) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		rsp, err := handler(ctx, req)
+		if err != nil || GlobalMgr == nil || !GlobalMgr.ShouldRecord() || !filter.accept(info.FullMethod) {
+			return rsp, err
+		}
+
+		m1, ok1 := req.(proto.Message)
+		m2, ok2 := rsp.(proto.Message)
+		if !ok1 || !ok2 {
+			GlobalMgr.notifier("recording grpc test case failed", info.FullMethod, []byte("not proto message"))
+			return rsp, err
+		}
+
+		recordGrpcCall(format, &GrpcCallData{
+			Method: info.FullMethod,
+			Req:    []proto.Message{m1},
+			Rsp:    []proto.Message{m2},
+		})
+
+		return rsp, err
+	}
+}
+
+type grpcRecorderServerStream struct {
+	grpc.ServerStream
+
+	mu  sync.Mutex
+	req []proto.Message
+	rsp []proto.Message
+}
+
+func (s *grpcRecorderServerStream) RecvMsg(m interface{}) error {
+	err := s.ServerStream.RecvMsg(m)
+	if err == nil {
+		if msg, ok := m.(proto.Message); ok {
+			s.mu.Lock()
+			s.req = append(s.req, proto.Clone(msg))
+			s.mu.Unlock()
+		}
+	}
+
+	return err
+}
+
+func (s *grpcRecorderServerStream) SendMsg(m interface{}) error {
+	err := s.ServerStream.SendMsg(m)
+	if err == nil {
+		if msg, ok := m.(proto.Message); ok {
+			s.mu.Lock()
+			s.rsp = append(s.rsp, proto.Clone(msg))
+			s.mu.Unlock()
+		}
+	}
+
+	return err
+}
+
+// NewGrpcRecorderStreamInterceptor is the streaming variant of NewGrpcRecorderUnaryInterceptor,
+// all messages received and sent are recorded in order.
+func NewGrpcRecorderStreamInterceptor(format int, filter GrpcRecorderFilter) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if GlobalMgr == nil || !GlobalMgr.ShouldRecord() || !filter.accept(info.FullMethod) {
+			return handler(srv, ss)
+		}
+
+		s := &grpcRecorderServerStream{ServerStream: ss}
+		err := handler(srv, s)
+		if err != nil {
+			return err
+		}
+
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		recordGrpcCall(format, &GrpcCallData{
+			Method:       info.FullMethod,
+			Req:          s.req,
+			Rsp:          s.rsp,
+			ClientStream: info.IsClientStream,
+			ServerStream: info.IsServerStream,
+		})
+
+		return nil
+	}
+}
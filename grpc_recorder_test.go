@@ -0,0 +1,125 @@
+package gorr
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"os"
+	"testing"
+
+	"gorr/util/pbdesc"
+
+	"github.com/golang/protobuf/jsonpb"
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes/wrappers"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+func TestGrpcRecorderInterceptor(t *testing.T) {
+	enableRegressionEngine(RegressionRecord)
+	GlobalMgr.SetState(RegressionReplay)
+	UnHookGrpcInvoke()
+	GlobalMgr.SetState(RegressionRecord)
+	GlobalMgr.SetStorage(NewMapStorage(100))
+
+	dir, err := ioutil.TempDir("", "gorr_grpc_recorder")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	*RegressionOutputDir = dir
+	out := GlobalMgr.ResetTestSuitDir()
+
+	lis := bufconn.Listen(1024 * 1024)
+	srv := grpc.NewServer(
+		grpc.UnaryInterceptor(NewGrpcRecorderUnaryInterceptor(RecorderDataTypeJson, GrpcRecorderFilter{})),
+		grpc.StreamInterceptor(NewGrpcRecorderStreamInterceptor(RecorderDataTypePbBinary, GrpcRecorderFilter{Methods: []string{"/grpc_hook.GrpcHookStreamService/"}})),
+	)
+	srv.RegisterService(&testSomeCallService, struct{}{})
+	srv.RegisterService(&testEchoStreamService, struct{}{})
+	go srv.Serve(lis)
+	defer srv.Stop()
+
+	dialer := func(context.Context, string) (net.Conn, error) { return lis.Dial() }
+	cc, err := grpc.DialContext(context.Background(), "bufnet", grpc.WithContextDialer(dialer), grpc.WithInsecure())
+	assert.Nil(t, err)
+	defer cc.Close()
+
+	// failed calls are not recorded.
+	runSomeCall(t, cc)
+	runEchoStream(t, cc)
+
+	var ti TestItem
+	conf, err := ioutil.ReadFile(out + "/reg_config.json")
+	assert.Nil(t, err)
+	assert.Nil(t, json.Unmarshal(conf, &ti))
+	assert.Equal(t, 2, len(ti.TestCases))
+
+	stream, unary := ti.TestCases[0], ti.TestCases[1]
+
+	assert.Equal(t, "/grpc_hook.GrpcHookService/SomeCall", unary.URI)
+	assert.Equal(t, RecorderDataTypeJson, unary.ReqType)
+	assert.Equal(t, "grpc_hook.GrpcHookRequest", unary.ReqMsg)
+	assert.Equal(t, "grpc_hook.GrpcHookResponse", unary.RspMsg)
+	assert.False(t, unary.ClientStream || unary.ServerStream)
+
+	data, err := ioutil.ReadFile(out + "/" + unary.Req)
+	assert.Nil(t, err)
+
+	var req GrpcHookRequest
+	assert.Nil(t, jsonpb.UnmarshalString(string(data), &req))
+	assert.Equal(t, int32(23), req.ReqId)
+
+	assert.Equal(t, testEchoStreamMethod, stream.URI)
+	assert.Equal(t, RecorderDataTypePbBinary, stream.RspType)
+	assert.True(t, stream.ClientStream && stream.ServerStream)
+
+	// only the first stream succeeded, with 2 requests and 2 responses.
+	data, err = ioutil.ReadFile(out + "/" + stream.Rsp)
+	assert.Nil(t, err)
+
+	var rsp GrpcHookResponse
+	l, n := proto.DecodeVarint(data)
+	assert.Nil(t, proto.Unmarshal(data[n:n+int(l)], &rsp))
+	assert.Equal(t, int32(1), rsp.ReqId)
+
+	r, err := pbdesc.ReadFileDescriptorSet(out + "/" + grpcDescriptorFile)
+	assert.Nil(t, err)
+	assert.True(t, r.HasMessage("grpc_hook.GrpcHookRequest"))
+	assert.True(t, r.HasMessage("grpc_hook.GrpcHookResponse"))
+
+	GlobalMgr.ClearStorage()
+}
+
+func TestSaveGrpcDescriptors(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gorr_grpc_desc")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	path := dir + "/" + grpcDescriptorFile
+
+	assert.Nil(t, saveGrpcDescriptors(dir, &GrpcHookRequest{}, &GrpcHookResponse{}))
+	r, err := pbdesc.ReadFileDescriptorSet(path)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(r.Files().File))
+
+	// file is not touched again for known descriptors.
+	data, err := ioutil.ReadFile(path)
+	assert.Nil(t, err)
+	assert.Nil(t, ioutil.WriteFile(path, []byte("untouched"), 0644))
+	assert.Nil(t, saveGrpcDescriptors(dir, &GrpcHookRequest{}))
+
+	d, err := ioutil.ReadFile(path)
+	assert.Nil(t, err)
+	assert.Equal(t, "untouched", string(d))
+
+	// new descriptors are merged into the saved ones.
+	assert.Nil(t, ioutil.WriteFile(path, data, 0644))
+	assert.Nil(t, saveGrpcDescriptors(dir, &GrpcHookRequest{}, &wrappers.StringValue{}))
+
+	r, err = pbdesc.ReadFileDescriptorSet(path)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(r.Files().File))
+}
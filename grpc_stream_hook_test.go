@@ -0,0 +1,235 @@
+package gorr
+
+import (
+	"context"
+	"io"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+const testEchoStreamMethod = "/grpc_hook.GrpcHookStreamService/Echo"
+
+func echoStreamHandler(srv interface{}, stream grpc.ServerStream) error {
+	stream.SetHeader(metadata.Pairs("x-header", "miliao"))
+
+	for {
+		req := &GrpcHookRequest{}
+		err := stream.RecvMsg(req)
+		if err == io.EOF {
+			stream.SetTrailer(metadata.Pairs("x-trailer", "done"))
+			return nil
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if req.ReqId == 0 {
+			return status.Error(codes.InvalidArgument, "invalid req id")
+		}
+
+		err = stream.SendMsg(&GrpcHookResponse{ReqId: req.ReqId, RspName: req.ReqName})
+		if err != nil {
+			return err
+		}
+	}
+}
+
+var testEchoStreamService = grpc.ServiceDesc{
+	ServiceName: "grpc_hook.GrpcHookStreamService",
+	HandlerType: (*interface{})(nil),
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Echo",
+			Handler:       echoStreamHandler,
+			ServerStreams: true,
+			ClientStreams: true,
+		},
+	},
+}
+
+func runEchoStream(t *testing.T, cc *grpc.ClientConn) {
+	desc := &testEchoStreamService.Streams[0]
+	ctx := context.Background()
+
+	s1, err := cc.NewStream(ctx, desc, testEchoStreamMethod)
+	assert.Nil(t, err)
+
+	assert.Nil(t, s1.SendMsg(&GrpcHookRequest{ReqId: 1, ReqName: "first"}))
+
+	rsp := &GrpcHookResponse{}
+	assert.Nil(t, s1.RecvMsg(rsp))
+	assert.Equal(t, int32(1), rsp.ReqId)
+	assert.Equal(t, "first", rsp.RspName)
+
+	md, err := s1.Header()
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"miliao"}, md.Get("x-header"))
+
+	assert.Nil(t, s1.SendMsg(&GrpcHookRequest{ReqId: 2, ReqName: "second"}))
+	assert.Nil(t, s1.RecvMsg(rsp))
+	assert.Equal(t, int32(2), rsp.ReqId)
+
+	assert.Nil(t, s1.CloseSend())
+	assert.Equal(t, io.EOF, s1.RecvMsg(rsp))
+	assert.Equal(t, []string{"done"}, s1.Trailer().Get("x-trailer"))
+
+	s2, err := cc.NewStream(ctx, desc, testEchoStreamMethod)
+	assert.Nil(t, err)
+
+	assert.Nil(t, s2.SendMsg(&GrpcHookRequest{ReqId: 5}))
+	assert.Nil(t, s2.SendMsg(&GrpcHookRequest{ReqId: 0}))
+	assert.Nil(t, s2.CloseSend())
+
+	assert.Nil(t, s2.RecvMsg(rsp))
+	assert.Equal(t, int32(5), rsp.ReqId)
+
+	err = s2.RecvMsg(rsp)
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	assert.Equal(t, "invalid req id", status.Convert(err).Message())
+}
+
+func TestGrpcStreamHook(t *testing.T) {
+	enableRegressionEngine(RegressionRecord)
+
+	// make sure hooks from other tests are removed.
+	GlobalMgr.SetState(RegressionReplay)
+	UnHookGrpcInvoke()
+
+	GlobalMgr.SetState(RegressionRecord)
+	GlobalMgr.SetStorage(NewMapStorage(100))
+
+	lis := bufconn.Listen(1024 * 1024)
+	srv := grpc.NewServer()
+	srv.RegisterService(&testEchoStreamService, struct{}{})
+	go srv.Serve(lis)
+	defer srv.Stop()
+
+	dialer := func(context.Context, string) (net.Conn, error) { return lis.Dial() }
+
+	err := HookGrpcInvoke()
+	assert.Nil(t, err)
+
+	cc, err := grpc.DialContext(context.Background(), "bufnet", grpc.WithContextDialer(dialer), grpc.WithInsecure())
+	assert.Nil(t, err)
+
+	runEchoStream(t, cc)
+
+	// stream is stored once it finishes, keyed by the first message sent.
+	s0, err := cc.NewStream(context.Background(), &testEchoStreamService.Streams[0], testEchoStreamMethod)
+	assert.Nil(t, err)
+	assert.Nil(t, s0.SendMsg(&GrpcHookRequest{ReqId: 9}))
+	assert.Nil(t, s0.SendMsg(&GrpcHookRequest{ReqId: 10}))
+
+	first, err := marshalStreamMsg(testEchoStreamMethod, &GrpcHookRequest{ReqId: 9})
+	assert.Nil(t, err)
+
+	rsp0 := &GrpcHookResponse{}
+	assert.Nil(t, s0.RecvMsg(rsp0))
+	_, err = LookupGrpcStream(context.Background(), testEchoStreamMethod, [][]byte{first})
+	assert.NotNil(t, err)
+
+	assert.Nil(t, s0.RecvMsg(rsp0))
+	assert.Nil(t, s0.CloseSend())
+	assert.Equal(t, io.EOF, s0.RecvMsg(rsp0))
+
+	rec, err := LookupGrpcStream(context.Background(), testEchoStreamMethod, [][]byte{first, []byte("ignored")})
+	assert.Nil(t, err)
+	assert.Equal(t, 4, len(rec.Events))
+	assert.Nil(t, rec.Err)
+
+	cc.Close()
+
+	UnHookGrpcInvoke()
+	GlobalMgr.SetState(RegressionReplay)
+
+	err = HookGrpcInvoke()
+	assert.Nil(t, err)
+	defer UnHookGrpcInvoke()
+
+	srv.Stop()
+
+	cc, err = grpc.DialContext(context.Background(), "bufnet")
+	assert.Nil(t, err)
+
+	runEchoStream(t, cc)
+
+	// sent messages are checked against recording.
+	s, err := cc.NewStream(context.Background(), &testEchoStreamService.Streams[0], testEchoStreamMethod)
+	assert.Nil(t, err)
+	assert.Nil(t, s.SendMsg(&GrpcHookRequest{ReqId: 1, ReqName: "first"}))
+
+	rsp := &GrpcHookResponse{}
+	assert.Nil(t, s.RecvMsg(rsp))
+	assert.NotNil(t, s.SendMsg(&GrpcHookRequest{ReqId: 3}))
+
+	s, err = cc.NewStream(context.Background(), &testEchoStreamService.Streams[0], testEchoStreamMethod)
+	assert.Nil(t, err)
+	assert.Nil(t, s.SendMsg(&GrpcHookRequest{ReqId: 23}))
+	assert.NotNil(t, s.RecvMsg(rsp))
+
+	GlobalMgr.ClearStorage()
+}
+
+func TestGrpcStreamIgnoredFields(t *testing.T) {
+	enableRegressionEngine(RegressionRecord)
+
+	GlobalMgr.SetState(RegressionReplay)
+	UnHookGrpcInvoke()
+
+	GlobalMgr.SetState(RegressionRecord)
+	GlobalMgr.SetStorage(NewMapStorage(100))
+
+	// req_id of requests is ignored, req_id of responses is kept.
+	SetGrpcKeyConfig(&GrpcKeyConfig{Methods: map[string][]string{testEchoStreamMethod: {"req_id"}}})
+	defer SetGrpcKeyConfig(nil)
+
+	lis := bufconn.Listen(1024 * 1024)
+	srv := grpc.NewServer()
+	srv.RegisterService(&testEchoStreamService, struct{}{})
+	go srv.Serve(lis)
+	defer srv.Stop()
+
+	dialer := func(context.Context, string) (net.Conn, error) { return lis.Dial() }
+
+	err := HookGrpcInvoke()
+	assert.Nil(t, err)
+
+	run := func(cc *grpc.ClientConn, id int32) {
+		s, err := cc.NewStream(context.Background(), &testEchoStreamService.Streams[0], testEchoStreamMethod)
+		assert.Nil(t, err)
+		assert.Nil(t, s.SendMsg(&GrpcHookRequest{ReqId: id, ReqName: "ignored"}))
+		assert.Nil(t, s.CloseSend())
+
+		rsp := &GrpcHookResponse{}
+		assert.Nil(t, s.RecvMsg(rsp))
+		assert.Equal(t, int32(7), rsp.ReqId)
+		assert.Equal(t, "ignored", rsp.RspName)
+		assert.Equal(t, io.EOF, s.RecvMsg(rsp))
+	}
+
+	cc, err := grpc.DialContext(context.Background(), "bufnet", grpc.WithContextDialer(dialer), grpc.WithInsecure())
+	assert.Nil(t, err)
+	run(cc, 7)
+	cc.Close()
+
+	UnHookGrpcInvoke()
+	GlobalMgr.SetState(RegressionReplay)
+
+	err = HookGrpcInvoke()
+	assert.Nil(t, err)
+	defer UnHookGrpcInvoke()
+
+	cc, err = grpc.DialContext(context.Background(), "bufnet")
+	assert.Nil(t, err)
+	run(cc, 8)
+
+	GlobalMgr.ClearStorage()
+}
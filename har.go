@@ -0,0 +1,411 @@
+package gorr
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// HAR 1.2 format, see http://www.softwareishard.com/blog/har-12-spec/
+// only fields that can be derived from gorr recordings are included.
+
+const (
+	httpReqKeyPrefix = "http_request_key_prefix"
+	harVersion       = "1.2"
+)
+
+type HarNameValue struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type HarPostData struct {
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text"`
+}
+
+type HarRequest struct {
+	Method      string         `json:"method"`
+	URL         string         `json:"url"`
+	HTTPVersion string         `json:"httpVersion"`
+	Cookies     []HarNameValue `json:"cookies"`
+	Headers     []HarNameValue `json:"headers"`
+	QueryString []HarNameValue `json:"queryString"`
+	PostData    *HarPostData   `json:"postData,omitempty"`
+	HeadersSize int64          `json:"headersSize"`
+	BodySize    int64          `json:"bodySize"`
+}
+
+type HarContent struct {
+	Size        int64  `json:"size"`
+	Compression int64  `json:"compression,omitempty"`
+	MimeType    string `json:"mimeType"`
+	Text        string `json:"text,omitempty"`
+	Encoding    string `json:"encoding,omitempty"`
+}
+
+type HarResponse struct {
+	Status      int            `json:"status"`
+	StatusText  string         `json:"statusText"`
+	HTTPVersion string         `json:"httpVersion"`
+	Cookies     []HarNameValue `json:"cookies"`
+	Headers     []HarNameValue `json:"headers"`
+	Content     HarContent     `json:"content"`
+	RedirectURL string         `json:"redirectURL"`
+	HeadersSize int64          `json:"headersSize"`
+	BodySize    int64          `json:"bodySize"`
+}
+
+type HarTimings struct {
+	Send    float64 `json:"send"`
+	Wait    float64 `json:"wait"`
+	Receive float64 `json:"receive"`
+}
+
+type HarEntry struct {
+	StartedDateTime string      `json:"startedDateTime"`
+	Time            float64     `json:"time"`
+	Request         HarRequest  `json:"request"`
+	Response        HarResponse `json:"response"`
+	Cache           struct{}    `json:"cache"`
+	Timings         HarTimings  `json:"timings"`
+	Comment         string      `json:"comment,omitempty"`
+}
+
+type HarCreator struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+type HarLog struct {
+	Version string     `json:"version"`
+	Creator HarCreator `json:"creator"`
+	Entries []HarEntry `json:"entries"`
+}
+
+type Har struct {
+	Log HarLog `json:"log"`
+}
+
+type httpReqKeyInfo struct {
+	traceId string
+	url     string
+	method  string
+	proto   string
+	tag     string
+}
+
+// key is built by genHttpReqKey(), url is assumed not containing "@@".
+func parseHttpReqKey(key string) (*httpReqKeyInfo, error) {
+	s := strings.SplitN(key, "@@", 6)
+	if len(s) != 6 || s[0] != httpReqKeyPrefix {
+		return nil, fmt.Errorf("invalid http request key:%s", key)
+	}
+
+	return &httpReqKeyInfo{traceId: s[1], url: s[2], method: s[3], proto: s[4], tag: s[5]}, nil
+}
+
+func toHarNameValue(h map[string][]string) []HarNameValue {
+	ret := make([]HarNameValue, 0, len(h))
+	for _, k := range getSortedHeaderKeys(h) {
+		for _, v := range h[k] {
+			ret = append(ret, HarNameValue{Name: k, Value: v})
+		}
+	}
+	return ret
+}
+
+func fromHarNameValue(nv []HarNameValue) http.Header {
+	h := make(http.Header, len(nv))
+	for _, v := range nv {
+		h.Add(v.Name, v.Value)
+	}
+	return h
+}
+
+func getSortedHeaderKeys(h map[string][]string) []string {
+	keys := make([]string, 0, len(h))
+	for k := range h {
+		keys = append(keys, k)
+	}
+
+	sort.Strings(keys)
+	return keys
+}
+
+func encodeHarText(data []byte) (string, string) {
+	if utf8.Valid(data) {
+		return string(data), ""
+	}
+	return base64.StdEncoding.EncodeToString(data), "base64"
+}
+
+func decodeHarText(text, encoding string) ([]byte, error) {
+	if encoding == "base64" {
+		return base64.StdEncoding.DecodeString(text)
+	}
+	return []byte(text), nil
+}
+
+func buildHarEntry(info *httpReqKeyInfo, rsp *HttpResponseData) HarEntry {
+	req := HarRequest{
+		Method:      info.method,
+		URL:         info.url,
+		HTTPVersion: info.proto,
+		Cookies:     []HarNameValue{},
+		Headers:     []HarNameValue{},
+		QueryString: []HarNameValue{},
+		HeadersSize: -1,
+		BodySize:    -1,
+	}
+
+	if u, err := url.Parse(info.url); err == nil {
+		for _, k := range getSortedHeaderKeys(u.Query()) {
+			for _, v := range u.Query()[k] {
+				req.QueryString = append(req.QueryString, HarNameValue{Name: k, Value: v})
+			}
+		}
+	}
+
+	// tag is a custom key unless request body is keyed, in which case body is not known.
+	if rsp.ReqBodyKeyed {
+		req.BodySize = int64(len(info.tag))
+		if len(info.tag) > 0 {
+			req.PostData = &HarPostData{MimeType: rsp.ReqContentType, Text: info.tag}
+		}
+	}
+
+	body := rsp.Body
+	compression := int64(0)
+	if rsp.Header.Get("Content-Encoding") == "gzip" {
+		reader, err := gzip.NewReader(bytes.NewBuffer(body))
+		if err == nil {
+			plain, err := ioutil.ReadAll(reader)
+			if err == nil {
+				compression = int64(len(plain) - len(body))
+				body = plain
+			}
+		}
+	}
+
+	text, encoding := encodeHarText(body)
+	statusText := strings.TrimSpace(strings.TrimPrefix(rsp.Status, fmt.Sprintf("%d", rsp.StatusCode)))
+
+	cookies := []HarNameValue{}
+	r := http.Response{Header: rsp.Header}
+	for _, c := range r.Cookies() {
+		cookies = append(cookies, HarNameValue{Name: c.Name, Value: c.Value})
+	}
+
+	return HarEntry{
+		StartedDateTime: time.Time{}.Format(time.RFC3339Nano),
+		Time:            0,
+		Request:         req,
+		Response: HarResponse{
+			Status:      rsp.StatusCode,
+			StatusText:  statusText,
+			HTTPVersion: rsp.Proto,
+			Cookies:     cookies,
+			Headers:     toHarNameValue(rsp.Header),
+			Content: HarContent{
+				Size:        int64(len(body)),
+				Compression: compression,
+				MimeType:    rsp.Header.Get("Content-Type"),
+				Text:        text,
+				Encoding:    encoding,
+			},
+			RedirectURL: rsp.Header.Get("Location"),
+			HeadersSize: -1,
+			BodySize:    int64(len(rsp.Body)),
+		},
+		Comment: info.traceId,
+	}
+}
+
+// ExportHttpHar converts all http recordings from storage to HAR.
+func ExportHttpHar(s IterableStorage) (*Har, error) {
+	har := &Har{
+		Log: HarLog{
+			Version: harVersion,
+			Creator: HarCreator{Name: "gorr", Version: "1"},
+			Entries: []HarEntry{},
+		},
+	}
+
+	err := s.ForEach(func(key string, value []byte) error {
+		if !strings.HasPrefix(key, httpReqKeyPrefix+"@@") {
+			return nil
+		}
+
+		info, err := parseHttpReqKey(key)
+		if err != nil {
+			return nil
+		}
+
+		var rsp HttpResponseData
+		err = json.Unmarshal(value, &rsp)
+		if err != nil {
+			return nil
+		}
+
+		har.Log.Entries = append(har.Log.Entries, buildHarEntry(info, &rsp))
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return har, nil
+}
+
+func WriteHttpHar(s IterableStorage, w io.Writer) error {
+	har, err := ExportHttpHar(s)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(har, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshal har failed, err:%s", err)
+	}
+
+	_, err = w.Write(data)
+	return err
+}
+
+func httpResponseDataFromHar(e *HarEntry) (*HttpResponseData, error) {
+	body, err := decodeHarText(e.Response.Content.Text, e.Response.Content.Encoding)
+	if err != nil {
+		return nil, fmt.Errorf("decode har response content failed, err:%s", err)
+	}
+
+	proto := e.Response.HTTPVersion
+	if len(proto) == 0 {
+		proto = "HTTP/1.1"
+	}
+
+	major, minor, ok := http.ParseHTTPVersion(proto)
+	if !ok {
+		major, minor = 1, 1
+	}
+
+	header := fromHarNameValue(e.Response.Headers)
+	length := int64(len(body))
+
+	// content in har is always decoded
+	if len(header.Get("Content-Encoding")) > 0 {
+		header.Del("Content-Encoding")
+		header.Del("Content-Length")
+		length = -1
+	}
+
+	rsp := &HttpResponseData{
+		Status:        fmt.Sprintf("%d %s", e.Response.Status, e.Response.StatusText),
+		StatusCode:    e.Response.Status,
+		Proto:         proto,
+		ProtoMajor:    major,
+		ProtoMinor:    minor,
+		Header:        header,
+		Body:          body,
+		ContentLength: length,
+		URL:           e.Request.URL,
+		Method:        e.Request.Method,
+	}
+
+	if e.Request.PostData != nil {
+		rsp.ReqContentType = e.Request.PostData.MimeType
+	}
+
+	return rsp, nil
+}
+
+// ImportHttpHar stores all entries from har to storage, keys are generated the same way http hook does.
+// trace id is restored from comment of entry, entries without it(eg: exported by browsers) use current trace id,
+// or the default one if regression engine is not enabled.
+func ImportHttpHar(har *Har, s Storage) (int, error) {
+	num := 0
+	for i := range har.Log.Entries {
+		e := &har.Log.Entries[i]
+
+		var body []byte
+		if e.Request.PostData != nil {
+			body = []byte(e.Request.PostData.Text)
+		}
+
+		proto := e.Request.HTTPVersion
+		if len(proto) == 0 {
+			proto = "HTTP/1.1"
+		}
+
+		req, err := http.NewRequest(e.Request.Method, e.Request.URL, bytes.NewBuffer(body))
+		if err != nil {
+			return num, fmt.Errorf("invalid request from %dth har entry, err:%s", i, err)
+		}
+
+		req.Proto = proto
+		req.Header = fromHarNameValue(e.Request.Headers)
+
+		rsp, err := httpResponseDataFromHar(e)
+		if err != nil {
+			return num, fmt.Errorf("invalid response from %dth har entry, err:%s", i, err)
+		}
+
+		traceId, tag := e.Comment, ""
+		if GlobalMgr != nil {
+			tag = GlobalMgr.genKey(RegressionHttpHook, context.Background(), req)
+			if len(traceId) == 0 {
+				traceId = GlobalMgr.GetCurTraceId()
+			}
+		}
+
+		if len(traceId) == 0 {
+			traceId = defaultTraceId
+		}
+		if len(tag) == 0 {
+			tag = string(body)
+			rsp.ReqBodyKeyed = true
+		}
+
+		data, err := json.Marshal(rsp)
+		if err != nil {
+			return num, fmt.Errorf("marshal response from %dth har entry failed, err:%s", i, err)
+		}
+
+		key := buildHttpReqKey(traceId, req.URL.String(), req.Method, proto, tag)
+		err = s.Put(key, data)
+		if err != nil {
+			return num, fmt.Errorf("store %dth har entry failed, err:%s", i, err)
+		}
+
+		num++
+	}
+
+	return num, nil
+}
+
+func ReadHttpHar(r io.Reader, s Storage) (int, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return 0, fmt.Errorf("read har failed, err:%s", err)
+	}
+
+	var har Har
+	err = json.Unmarshal(data, &har)
+	if err != nil {
+		return 0, fmt.Errorf("unmarshal har failed, err:%s", err)
+	}
+
+	return ImportHttpHar(&har, s)
+}
@@ -0,0 +1,112 @@
+package gorr
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHarExportImport(t *testing.T) {
+	enableRegressionEngine(RegressionRecord)
+
+	s1 := NewMapStorage(100)
+	GlobalMgr.SetStorage(s1)
+
+	req, _ := http.NewRequest("POST", "http://some.host.com/api/v1?id=23&name=miliao", bytes.NewBufferString("req body for har"))
+	req.Header.Set("Content-Type", "text/plain")
+	key := genHttpReqKey(req, req.URL.String(), req.Method, req.Proto, []byte("req body for har"))
+
+	header := http.Header{}
+	header.Set("Content-Type", "application/json")
+	header.Add("Set-Cookie", "sid=2333; Path=/")
+
+	rsp := &http.Response{
+		Status:        "200 OK",
+		StatusCode:    200,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          ioutil.NopCloser(bytes.NewBufferString(`{"data":"rsp body for har"}`)),
+		ContentLength: 27,
+		Request:       req,
+	}
+
+	assert.Nil(t, saveResponse(key, rsp, true))
+	assert.Nil(t, s1.Put("some_other_key", []byte("not a http recording")))
+
+	var buf bytes.Buffer
+	assert.Nil(t, WriteHttpHar(s1, &buf))
+
+	var har Har
+	assert.Nil(t, json.Unmarshal(buf.Bytes(), &har))
+	assert.Equal(t, "1.2", har.Log.Version)
+	assert.Equal(t, 1, len(har.Log.Entries))
+
+	e := har.Log.Entries[0]
+	assert.Equal(t, "POST", e.Request.Method)
+	assert.Equal(t, "http://some.host.com/api/v1?id=23&name=miliao", e.Request.URL)
+	assert.Equal(t, "req body for har", e.Request.PostData.Text)
+	assert.Equal(t, "text/plain", e.Request.PostData.MimeType)
+	assert.Equal(t, int64(16), e.Request.BodySize)
+	assert.Equal(t, 2, len(e.Request.QueryString))
+	assert.Equal(t, 200, e.Response.Status)
+	assert.Equal(t, "OK", e.Response.StatusText)
+	assert.Equal(t, `{"data":"rsp body for har"}`, e.Response.Content.Text)
+	assert.Equal(t, []HarNameValue{{Name: "sid", Value: "2333"}}, e.Response.Cookies)
+
+	s2 := NewMapStorage(100)
+	num, err := ReadHttpHar(&buf, s2)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, num)
+
+	v1, err1 := s1.Get(key)
+	v2, err2 := s2.Get(key)
+	assert.Nil(t, err1)
+	assert.Nil(t, err2)
+
+	var d1, d2 HttpResponseData
+	assert.Nil(t, json.Unmarshal(v1, &d1))
+	assert.Nil(t, json.Unmarshal(v2, &d2))
+	assert.Equal(t, d1, d2)
+
+	// trace id is restored from comment
+	assert.Equal(t, GlobalMgr.GetCurTraceId(), e.Comment)
+	e.Comment = "trace-2333"
+	record := GlobalMgr.ShouldRecord()
+	s3 := NewMapStorage(100)
+	num, err = ImportHttpHar(&Har{Log: HarLog{Entries: []HarEntry{e}}}, s3)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, num)
+	_, err = s3.Get(buildHttpReqKey("trace-2333", e.Request.URL, "POST", "HTTP/1.1", "req body for har"))
+	assert.Nil(t, err)
+	assert.Equal(t, record, GlobalMgr.ShouldRecord())
+
+	GlobalMgr.SetStorage(s2)
+	GlobalMgr.SetState(RegressionReplay)
+
+	r, err := getHttpResp(key)
+	assert.Nil(t, err)
+	body, _ := ioutil.ReadAll(r.Body)
+	assert.Equal(t, `{"data":"rsp body for har"}`, string(body))
+
+	// custom keys are not exported as request body.
+	rsp.Body = ioutil.NopCloser(bytes.NewBufferString("rsp"))
+	assert.Nil(t, saveResponse(buildHttpReqKey("trace-custom", req.URL.String(), "POST", "HTTP/1.1", "custom-key"), rsp, false))
+
+	har2, err := ExportHttpHar(s2)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(har2.Log.Entries))
+	for _, e := range har2.Log.Entries {
+		if e.Comment == "trace-custom" {
+			assert.Nil(t, e.Request.PostData)
+			assert.Equal(t, int64(-1), e.Request.BodySize)
+		} else {
+			assert.NotNil(t, e.Request.PostData)
+		}
+	}
+}
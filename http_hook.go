@@ -3,11 +3,14 @@ package gorr
 import (
 	"bytes"
 	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"net/url"
 
 	"github.com/brahma-adshonor/gohook"
 )
@@ -21,18 +24,56 @@ type HttpResponseData struct {
 	Header        http.Header `json:"header"`
 	Body          []byte      `json:"body"`
 	ContentLength int64       `json:"length"`
+
+	URL       string            `json:"url,omitempty"`
+	Method    string            `json:"method,omitempty"`
+	Trailer   http.Header       `json:"trailer,omitempty"`
+	Redirects []HttpRedirectHop `json:"redirects,omitempty"`
+	TLS       *HttpTLSData      `json:"tls,omitempty"`
+
+	// ReqBodyKeyed is true if request body is part of the key, ie: no custom key is generated, see genHttpReqKey.
+	ReqBodyKeyed   bool   `json:"req_body_keyed,omitempty"`
+	ReqContentType string `json:"req_content_type,omitempty"`
 }
 
-func genHttpReqKey(req *http.Request, url, method, proto string, body []byte) string {
-	tag := GlobalMgr.genKey(RegressionHttpHook, context.Background(), req)
+// HttpRedirectHop is an intermediate response followed by http.Client.
+type HttpRedirectHop struct {
+	URL        string      `json:"url"`
+	Method     string      `json:"method"`
+	Status     string      `json:"status"`
+	StatusCode int         `json:"code"`
+	Header     http.Header `json:"header"`
+}
+
+// HttpTLSData is the part of tls.ConnectionState that matters to client code.
+type HttpTLSData struct {
+	Version            uint16   `json:"version"`
+	CipherSuite        uint16   `json:"cipher"`
+	ServerName         string   `json:"server"`
+	NegotiatedProtocol string   `json:"alpn,omitempty"`
+	PeerCertificates   [][]byte `json:"certs,omitempty"`
+}
+
+// genHttpReqTag returns custom key of req if any, or else body, bodyKeyed is true in the latter case.
+func genHttpReqTag(req *http.Request, body []byte) (tag string, bodyKeyed bool) {
+	tag = GlobalMgr.genKey(RegressionHttpHook, context.Background(), req)
 	if len(tag) == 0 {
-		tag = string(body)
+		return string(body), true
 	}
 
-	return fmt.Sprintf("http_request_key_prefix@@%s@@%s@@%s@@%s@@%s", GlobalMgr.GetCurTraceId(), url, method, proto, tag)
+	return tag, false
 }
 
-func saveResponse(key string, r *http.Response) error {
+func genHttpReqKey(req *http.Request, url, method, proto string, body []byte) string {
+	tag, _ := genHttpReqTag(req, body)
+	return buildHttpReqKey(GlobalMgr.GetCurTraceId(), url, method, proto, tag)
+}
+
+func buildHttpReqKey(traceId, url, method, proto, tag string) string {
+	return fmt.Sprintf("%s@@%s@@%s@@%s@@%s@@%s", httpReqKeyPrefix, traceId, url, method, proto, tag)
+}
+
+func saveResponse(key string, r *http.Response, bodyKeyed bool) error {
 	data := HttpResponseData{
 		Status:        r.Status,
 		StatusCode:    r.StatusCode,
@@ -42,6 +83,7 @@ func saveResponse(key string, r *http.Response) error {
 		Header:        r.Header,
 		Body:          nil,
 		ContentLength: r.ContentLength,
+		ReqBodyKeyed:  bodyKeyed,
 	}
 
 	body, err := ioutil.ReadAll(r.Body)
@@ -53,6 +95,17 @@ func saveResponse(key string, r *http.Response) error {
 	data.Body = body
 	r.Body = ioutil.NopCloser(bytes.NewBuffer(body))
 
+	// trailers are only available after body is consumed.
+	data.Trailer = r.Trailer
+	data.TLS = newHttpTLSData(r.TLS)
+
+	if r.Request != nil {
+		data.URL = r.Request.URL.String()
+		data.Method = r.Request.Method
+		data.Redirects = getRedirectHops(r.Request)
+		data.ReqContentType = r.Request.Header.Get("Content-Type")
+	}
+
 	jd, err2 := json.Marshal(data)
 	if err2 != nil {
 		return errors.New("marshal http response for hook failed")
@@ -61,18 +114,158 @@ func saveResponse(key string, r *http.Response) error {
 	return GlobalMgr.StoreValue(key, []byte(jd))
 }
 
+func newHttpTLSData(s *tls.ConnectionState) *HttpTLSData {
+	if s == nil {
+		return nil
+	}
+
+	d := &HttpTLSData{
+		Version:            s.Version,
+		CipherSuite:        s.CipherSuite,
+		ServerName:         s.ServerName,
+		NegotiatedProtocol: s.NegotiatedProtocol,
+	}
+
+	for _, c := range s.PeerCertificates {
+		d.PeerCertificates = append(d.PeerCertificates, c.Raw)
+	}
+
+	return d
+}
+
+func (d *HttpTLSData) connectionState() *tls.ConnectionState {
+	s := &tls.ConnectionState{
+		Version:                    d.Version,
+		HandshakeComplete:          true,
+		CipherSuite:                d.CipherSuite,
+		ServerName:                 d.ServerName,
+		NegotiatedProtocol:         d.NegotiatedProtocol,
+		NegotiatedProtocolIsMutual: true,
+	}
+
+	for _, raw := range d.PeerCertificates {
+		c, err := x509.ParseCertificate(raw)
+		if err == nil {
+			s.PeerCertificates = append(s.PeerCertificates, c)
+		}
+	}
+
+	return s
+}
+
+// getRedirectHops walks back from the final request, http.Client links every redirected
+// request to the response causing it via req.Response.
+func getRedirectHops(req *http.Request) []HttpRedirectHop {
+	var hops []HttpRedirectHop
+	for r := req.Response; r != nil && r.Request != nil; r = r.Request.Response {
+		hop := HttpRedirectHop{
+			URL:        r.Request.URL.String(),
+			Method:     r.Request.Method,
+			Status:     r.Status,
+			StatusCode: r.StatusCode,
+			Header:     r.Header,
+		}
+		hops = append([]HttpRedirectHop{hop}, hops...)
+	}
+
+	return hops
+}
+
+// restoreHttpResp rebuilds the request chain of resp as http.Client would have done,
+// and applies Set-Cookie of every hop to the cookie jar of c.
+func restoreHttpResp(c *http.Client, req *http.Request, data *HttpResponseData, resp *http.Response) error {
+	cur := req
+	for i, h := range data.Redirects {
+		hop := &http.Response{
+			Status:     h.Status,
+			StatusCode: h.StatusCode,
+			Proto:      data.Proto,
+			ProtoMajor: data.ProtoMajor,
+			ProtoMinor: data.ProtoMinor,
+			Header:     h.Header,
+			Body:       http.NoBody,
+			Request:    cur,
+		}
+
+		if c.Jar != nil {
+			c.Jar.SetCookies(cur.URL, hop.Cookies())
+		}
+
+		next, method := data.URL, data.Method
+		if i+1 < len(data.Redirects) {
+			next, method = data.Redirects[i+1].URL, data.Redirects[i+1].Method
+		}
+
+		u, err := url.Parse(next)
+		if err != nil {
+			return fmt.Errorf("invalid redirect url:%s, err:%s", next, err)
+		}
+
+		cur = newRedirectedRequest(req, hop, method, u)
+	}
+
+	resp.Request = cur
+	if c.Jar != nil {
+		c.Jar.SetCookies(cur.URL, resp.Cookies())
+	}
+
+	return nil
+}
+
+func newRedirectedRequest(ireq *http.Request, via *http.Response, method string, u *url.URL) *http.Request {
+	r := &http.Request{
+		Method:     method,
+		URL:        u,
+		Proto:      ireq.Proto,
+		ProtoMajor: ireq.ProtoMajor,
+		ProtoMinor: ireq.ProtoMinor,
+		Header:     make(http.Header),
+		Host:       u.Host,
+		Response:   via,
+	}
+
+	for k, v := range ireq.Header {
+		r.Header[k] = v
+	}
+
+	return r.WithContext(ireq.Context())
+}
+
+func getHttpRespData(key string) (*HttpResponseData, *http.Response, error) {
+	value, err := GlobalMgr.GetValue(key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var data HttpResponseData
+	err = json.Unmarshal(value, &data)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return &data, newHttpResp(&data), nil
+}
+
 func getHttpResp(key string) (*http.Response, error) {
 	value, err := GlobalMgr.GetValue(key)
 	if err != nil {
 		return nil, err
 	}
 
+	return decodeHttpResp(value)
+}
+
+func decodeHttpResp(value []byte) (*http.Response, error) {
 	var data HttpResponseData
-	err = json.Unmarshal(value, &data)
+	err := json.Unmarshal(value, &data)
 	if err != nil {
 		return nil, err
 	}
 
+	return newHttpResp(&data), nil
+}
+
+func newHttpResp(data *HttpResponseData) *http.Response {
 	resp := http.Response{
 		Status:        data.Status,
 		StatusCode:    data.StatusCode,
@@ -82,9 +275,21 @@ func getHttpResp(key string) (*http.Response, error) {
 		Header:        data.Header,
 		Body:          ioutil.NopCloser(bytes.NewBuffer(data.Body)),
 		ContentLength: data.ContentLength,
+		Trailer:       data.Trailer,
 	}
 
-	return &resp, nil
+	if data.TLS != nil {
+		resp.TLS = data.TLS.connectionState()
+	}
+
+	return &resp
+}
+
+// LookupHttpResponse returns the recorded response for req, using the same key http hook uses.
+// body is the request body, req.Body is not touched.
+func LookupHttpResponse(req *http.Request, body []byte) (*http.Response, error) {
+	key := genHttpReqKey(req, req.URL.String(), req.Method, req.Proto, body)
+	return getHttpResp(key)
 }
 
 func doHttp(c *http.Client, req *http.Request) (*http.Response, error) {
@@ -105,17 +310,22 @@ func doHttp(c *http.Client, req *http.Request) (*http.Response, error) {
 	req.Body = ioutil.NopCloser(bytes.NewBuffer(data))
 
 	state := ""
-	key := genHttpReqKey(req, url.String(), method, proto, data)
+	tag, bodyKeyed := genHttpReqTag(req, data)
+	key := buildHttpReqKey(GlobalMgr.GetCurTraceId(), url.String(), method, proto, tag)
 
 	if GlobalMgr.ShouldRecord() {
 		state = "record"
 		rsp, err = doHttpTrampoline(c, req)
 		if err == nil {
-			err = saveResponse(key, rsp)
+			err = saveResponse(key, rsp, bodyKeyed)
 		}
 	} else {
 		state = "replay"
-		rsp, err = getHttpResp(key)
+		var rd *HttpResponseData
+		rd, rsp, err = getHttpRespData(key)
+		if err == nil {
+			err = restoreHttpResp(c, req, rd, rsp)
+		}
 	}
 
 	if err != nil {
@@ -7,6 +7,8 @@ import (
 	"github.com/stretchr/testify/assert"
 	"io/ioutil"
 	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
 	"testing"
 	"time"
 )
@@ -162,3 +164,61 @@ func TestHttpPost(t *testing.T) {
 	UnHookHttpFunc()
 	GlobalMgr.ClearStorage()
 }
+
+func TestHttpRedirectCookie(t *testing.T) {
+	enableRegressionEngine(RegressionRecord)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/start", func(w http.ResponseWriter, r *http.Request) {
+		http.SetCookie(w, &http.Cookie{Name: "sid", Value: "2333", Path: "/"})
+		http.Redirect(w, r, "/final?id=23", http.StatusFound)
+	})
+	mux.HandleFunc("/final", func(w http.ResponseWriter, r *http.Request) {
+		http.SetCookie(w, &http.Cookie{Name: "uid", Value: "miliao", Path: "/"})
+		w.Header().Set("Trailer", "X-Checksum")
+		w.Write([]byte("final rsp"))
+		w.Header().Set("X-Checksum", "23")
+	})
+
+	s := httptest.NewTLSServer(mux)
+	defer s.Close()
+
+	GlobalMgr.SetState(RegressionRecord)
+	GlobalMgr.SetStorage(NewMapStorage(100))
+
+	err := HookHttpFunc()
+	assert.Nil(t, err)
+	defer UnHookHttpFunc()
+
+	check := func(c *http.Client) {
+		req, _ := http.NewRequest("GET", s.URL+"/start", nil)
+		rsp, err := c.Do(req)
+		assert.Nil(t, err)
+
+		body, _ := ioutil.ReadAll(rsp.Body)
+		assert.Equal(t, "final rsp", string(body))
+		assert.Equal(t, "23", rsp.Trailer.Get("X-Checksum"))
+		assert.Equal(t, "/final", rsp.Request.URL.Path)
+		assert.Equal(t, "id=23", rsp.Request.URL.RawQuery)
+		assert.NotNil(t, rsp.Request.Response)
+		assert.Equal(t, http.StatusFound, rsp.Request.Response.StatusCode)
+		assert.Equal(t, req, rsp.Request.Response.Request)
+		assert.NotNil(t, rsp.TLS)
+		assert.Equal(t, 1, len(rsp.TLS.PeerCertificates))
+
+		u, _ := req.URL.Parse("/")
+		assert.Equal(t, 2, len(c.Jar.Cookies(u)))
+	}
+
+	c1 := s.Client()
+	c1.Jar, _ = cookiejar.New(nil)
+	check(c1)
+
+	GlobalMgr.SetState(RegressionReplay)
+
+	c2 := &http.Client{}
+	c2.Jar, _ = cookiejar.New(nil)
+	check(c2)
+
+	GlobalMgr.ClearStorage()
+}
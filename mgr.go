@@ -5,6 +5,8 @@ import (
 	"flag"
 	"fmt"
 	"os"
+	"sort"
+	"sync"
 	"time"
 
 	"github.com/brahma-adshonor/gohook"
@@ -38,6 +40,12 @@ type Storage interface {
 	Get(key string) ([]byte, error)
 }
 
+// IterableStorage is a Storage that is able to enumerate all of its entries.
+type IterableStorage interface {
+	Storage
+	ForEach(fn func(key string, value []byte) error) error
+}
+
 type RegressionMgr struct {
 	state          int
 	store          Storage
@@ -86,6 +94,12 @@ func InitRegressionEngine() int {
 	return *RegressionRunType
 }
 
+// EnableRegressionEngine creates GlobalMgr in given state if it is not created yet, storage and hooks are untouched,
+// it is used by hooks living outside of this package, eg: gorr/redisv8.
+func EnableRegressionEngine(state int) {
+	enableRegressionEngine(state)
+}
+
 func enableRegressionEngine(state int) {
 	if GlobalMgr != nil {
 		return
@@ -216,9 +230,12 @@ func (r *RegressionMgr) GetValue(key string) ([]byte, error) {
 	return data, err
 }
 
+// defaultTraceId is trace id of all recordings, until trace id is kept per goroutine.
+const defaultTraceId = "todo_yet_to_implement_by_gls"
+
 func (r *RegressionMgr) GetCurTraceId() string {
 	// TODO
-	return "todo_yet_to_implement_by_gls"
+	return defaultTraceId
 }
 
 func (r *RegressionMgr) SetCurTraceId() error {
@@ -240,6 +257,10 @@ func (r *RegressionMgr) EnableHook() error {
         EnableMongoHook,
 	}
 
+	for _, h := range registeredHooks() {
+		hk = append(hk, h.enable)
+	}
+
 	for _, fn := range hk {
 		err := fn()
 		if err != nil {
@@ -259,7 +280,43 @@ func (r *RegressionMgr) DisableHook() {
         DisableMongoHook,
 	}
 
+	for _, h := range registeredHooks() {
+		hk = append(hk, h.disable)
+	}
+
 	for _, fn := range hk {
 		fn()
 	}
 }
+
+type hookGroup struct {
+	name    string
+	enable  func() error
+	disable func() error
+}
+
+var (
+	hookLock sync.Mutex
+	hookMap  = make(map[string]hookGroup)
+)
+
+// RegisterHook adds hooks living outside of this package to EnableHook() and DisableHook(), eg: gorr/redisv8,
+// hooks of the same name are replaced.
+func RegisterHook(name string, enable func() error, disable func() error) {
+	hookLock.Lock()
+	defer hookLock.Unlock()
+	hookMap[name] = hookGroup{name: name, enable: enable, disable: disable}
+}
+
+func registeredHooks() []hookGroup {
+	hookLock.Lock()
+	defer hookLock.Unlock()
+
+	ret := make([]hookGroup, 0, len(hookMap))
+	for _, h := range hookMap {
+		ret = append(ret, h)
+	}
+
+	sort.Slice(ret, func(i, j int) bool { return ret[i].name < ret[j].name })
+	return ret
+}
@@ -1,12 +1,16 @@
 package gorr
 
 import (
+	"bufio"
 	"bytes"
 	"compress/gzip"
 	"fmt"
 	"github.com/brahma-adshonor/gohook"
 	"io/ioutil"
+	"math/rand"
+	"net"
 	"net/http"
+	"strings"
 	"sync"
 )
 
@@ -14,6 +18,9 @@ type HttpData struct {
 	Status int
 	Body   []byte
 	Header http.Header
+	Method string
+	Path   string
+	Query  string
 }
 
 type HttpRequestFixer func(pattern string, data []byte) []byte
@@ -35,28 +42,154 @@ func RegisterHttpRecorder(pattern string, handler HttpRecorderHandler, fix HttpR
 	handlerMap[pattern] = httpHandleGroup{recorder: handler, fixer: fix}
 }
 
+// response is buffered until handler flushes or hijacks the connection,
+// after which writes are passed through to the underlying writer, while still being captured
+// up to httpStreamCaptureLimit bytes, responses exceeding the limit are not recorded.
 type httpResponseWriterWrap struct {
-	data HttpData
+	data      HttpData
+	w         http.ResponseWriter
+	committed bool
+	hijacked  bool
+	truncated bool
 }
 
+// max bytes of streaming response captured for recording.
+var httpStreamCaptureLimit = 4 << 20
+
 func (h *httpResponseWriterWrap) Header() http.Header {
 	return h.data.Header
 }
 
 func (h *httpResponseWriterWrap) Write(d []byte) (int, error) {
-	if h.data.Body == nil {
-		h.data.Body = make([]byte, 0, len(d))
+	if !h.committed {
+		h.data.Body = append(h.data.Body, d...)
+		return len(d), nil
 	}
 
-	h.data.Body = append(h.data.Body, d...)
+	if !h.truncated {
+		if len(h.data.Body)+len(d) > httpStreamCaptureLimit {
+			h.truncated = true
+			h.data.Body = nil
+		} else {
+			h.data.Body = append(h.data.Body, d...)
+		}
+	}
 
-	return len(d), nil
+	return h.w.Write(d)
 }
 
 func (h *httpResponseWriterWrap) WriteHeader(stCode int) {
+	if h.committed {
+		// let underlying writer report the superfluous call, recorded status is the one sent.
+		h.w.WriteHeader(stCode)
+		return
+	}
+
 	h.data.Status = stCode
 }
 
+func (h *httpResponseWriterWrap) commit() {
+	if h.committed {
+		return
+	}
+
+	h.committed = true
+
+	if h.data.Status != -1 {
+		h.w.WriteHeader(h.data.Status)
+	}
+
+	if len(h.data.Body) > 0 {
+		h.w.Write(h.data.Body)
+	}
+}
+
+func (h *httpResponseWriterWrap) flush() {
+	h.commit()
+	h.w.(http.Flusher).Flush()
+}
+
+func (h *httpResponseWriterWrap) hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, rw, err := h.w.(http.Hijacker).Hijack()
+	if err == nil {
+		h.hijacked = true
+		h.committed = true
+	}
+
+	return conn, rw, err
+}
+
+func (h *httpResponseWriterWrap) push(target string, opts *http.PushOptions) error {
+	return h.w.(http.Pusher).Push(target, opts)
+}
+
+type flusherFunc func()
+
+func (f flusherFunc) Flush() { f() }
+
+type hijackerFunc func() (net.Conn, *bufio.ReadWriter, error)
+
+func (f hijackerFunc) Hijack() (net.Conn, *bufio.ReadWriter, error) { return f() }
+
+type pusherFunc func(string, *http.PushOptions) error
+
+func (f pusherFunc) Push(target string, opts *http.PushOptions) error { return f(target, opts) }
+
+// wrap returns h with exactly the optional interfaces implemented by the underlying writer,
+// so that handlers probing for http.Flusher/http.Hijacker/http.Pusher see what the server supports.
+func (h *httpResponseWriterWrap) wrap() http.ResponseWriter {
+	_, fl := h.w.(http.Flusher)
+	_, hj := h.w.(http.Hijacker)
+	_, pu := h.w.(http.Pusher)
+
+	f, j, p := flusherFunc(h.flush), hijackerFunc(h.hijack), pusherFunc(h.push)
+
+	switch {
+	case fl && hj && pu:
+		return struct {
+			http.ResponseWriter
+			http.Flusher
+			http.Hijacker
+			http.Pusher
+		}{h, f, j, p}
+	case fl && hj:
+		return struct {
+			http.ResponseWriter
+			http.Flusher
+			http.Hijacker
+		}{h, f, j}
+	case fl && pu:
+		return struct {
+			http.ResponseWriter
+			http.Flusher
+			http.Pusher
+		}{h, f, p}
+	case hj && pu:
+		return struct {
+			http.ResponseWriter
+			http.Hijacker
+			http.Pusher
+		}{h, j, p}
+	case fl:
+		return struct {
+			http.ResponseWriter
+			http.Flusher
+		}{h, f}
+	case hj:
+		return struct {
+			http.ResponseWriter
+			http.Hijacker
+		}{h, j}
+	case pu:
+		return struct {
+			http.ResponseWriter
+			http.Pusher
+		}{h, p}
+	}
+
+	return h
+}
+
 type httpRecorder struct {
 	pattern string
 	origin  http.Handler
@@ -78,25 +211,32 @@ func (h *httpRecorder) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	// reset user-agent
 	r.Header.Set("User-Agent", "RegressionTool")
 
-	wr := &httpResponseWriterWrap{}
+	wr := &httpResponseWriterWrap{w: w}
 	wr.data.Status = -1
 	wr.data.Header = w.Header()
 
-	h.origin.ServeHTTP(wr, r)
+	h.origin.ServeHTTP(wr.wrap(), r)
 
-	req := &HttpData{
-		Body:   reqData,
-		Header: r.Header,
+	if wr.hijacked {
+		GlobalMgr.notifier("native http recorder", "hijacked connection not recorded", []byte(r.URL.Path+"@@"+r.URL.RawQuery))
+		return
 	}
 
-	if wr.data.Status != -1 {
-		w.WriteHeader(wr.data.Status)
+	if wr.truncated {
+		GlobalMgr.notifier("native http recorder", "streaming response too large, not recorded", []byte(r.URL.Path+"@@"+r.URL.RawQuery))
+		return
 	}
 
-	if len(wr.data.Body) > 0 {
-		w.Write(wr.data.Body)
+	req := &HttpData{
+		Body:   reqData,
+		Header: r.Header,
+		Method: r.Method,
+		Path:   r.URL.Path,
+		Query:  r.URL.RawQuery,
 	}
 
+	wr.commit()
+
 	if wr.data.Header.Get("Content-Encoding") == "gzip" {
 		reader, _ := gzip.NewReader(bytes.NewBuffer(wr.data.Body))
 		wr.data.Body, _ = ioutil.ReadAll(reader)
@@ -122,6 +262,86 @@ func (h *httpRecorder) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// HttpRecorderFilter selects requests to be recorded by middleware.
+// Patterns follow http.ServeMux convention: pattern ending with '/' matches all paths under it,
+// otherwise path must match exactly, the longest pattern wins. empty Patterns matches all paths,
+// in which case request path is used as pattern.
+// SampleRate is the fraction of matched requests to record, value <= 0 or >= 1 means recording all.
+type HttpRecorderFilter struct {
+	Patterns   []string
+	SampleRate float64
+}
+
+func (f *HttpRecorderFilter) match(path string) (string, bool) {
+	if len(f.Patterns) == 0 {
+		return path, true
+	}
+
+	found := ""
+	for _, p := range f.Patterns {
+		if len(p) <= len(found) {
+			continue
+		}
+
+		if p == path || (strings.HasSuffix(p, "/") && strings.HasPrefix(path, p)) {
+			found = p
+		}
+	}
+
+	return found, len(found) > 0
+}
+
+func (f *HttpRecorderFilter) sampled() bool {
+	if f.SampleRate <= 0 || f.SampleRate >= 1 {
+		return true
+	}
+
+	return rand.Float64() < f.SampleRate
+}
+
+type httpRecorderMiddleware struct {
+	next    http.Handler
+	filter  HttpRecorderFilter
+	handler HttpRecorderHandler
+	fixer   HttpRequestFixer
+}
+
+func (m *httpRecorderMiddleware) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if GlobalMgr == nil || !GlobalMgr.ShouldRecord() {
+		m.next.ServeHTTP(w, r)
+		return
+	}
+
+	pattern, ok := m.filter.match(r.URL.Path)
+	if !ok || !m.filter.sampled() {
+		m.next.ServeHTTP(w, r)
+		return
+	}
+
+	h := &httpRecorder{
+		prepare: m.fixer,
+		handler: m.handler,
+		origin:  m.next,
+		pattern: pattern,
+	}
+
+	h.ServeHTTP(w, r)
+}
+
+// NewHttpRecorderMiddleware returns a middleware recording inbound requests the same way RegisterHttpRecorder does,
+// it works with any router, and does not rely on hooking http.ServeMux.Handle().
+// requests are passed through untouched unless gorr is in recording state.
+func NewHttpRecorderMiddleware(handler HttpRecorderHandler, fix HttpRequestFixer, filter HttpRecorderFilter) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return &httpRecorderMiddleware{
+			next:    next,
+			filter:  filter,
+			handler: handler,
+			fixer:   fix,
+		}
+	}
+}
+
 func httpHandleHook(s *http.ServeMux, pattern string, handler http.Handler) {
 	h := handler
 	{
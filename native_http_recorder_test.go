@@ -8,6 +8,7 @@ import (
 	"github.com/stretchr/testify/assert"
 	"io/ioutil"
 	"net/http"
+	"net/http/httptest"
 	"net/url"
 	"sync"
 	"testing"
@@ -87,3 +88,133 @@ func TestRegister(t *testing.T) {
 
 	wg.Wait()
 }
+
+func TestHttpRecorderMiddleware(t *testing.T) {
+	enableRegressionEngine(RegressionRecord)
+	GlobalMgr.SetState(RegressionRecord)
+
+	var mu sync.Mutex
+	recorded := map[string]*HttpData{}
+	requests := map[string]*HttpData{}
+
+	mw := NewHttpRecorderMiddleware(func(p, n string, r *HttpData, s *HttpData) {
+		mu.Lock()
+		defer mu.Unlock()
+		recorded[p] = s
+		requests[p] = r
+	}, nil, HttpRecorderFilter{Patterns: []string{"/stream", "/api/"}})
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/stream", func(w http.ResponseWriter, r *http.Request) {
+		f, ok := w.(http.Flusher)
+		assert.True(t, ok)
+
+		w.Write([]byte("chunk1;"))
+		f.Flush()
+		w.Write([]byte("chunk2;"))
+		f.Flush()
+		w.Write([]byte("chunk3"))
+	})
+	mux.HandleFunc("/api/v1/test", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(202)
+		w.Write([]byte("api rsp"))
+	})
+	mux.HandleFunc("/other", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("other rsp"))
+	})
+	mux.HandleFunc("/api/hijack", func(w http.ResponseWriter, r *http.Request) {
+		conn, rw, err := w.(http.Hijacker).Hijack()
+		assert.Nil(t, err)
+		defer conn.Close()
+		rw.WriteString("HTTP/1.1 200 OK\r\nContent-Length: 8\r\nConnection: close\r\n\r\nhijacked")
+		rw.Flush()
+	})
+
+	s := httptest.NewServer(mw(mux))
+	defer s.Close()
+
+	get := func(path string) (int, string) {
+		rsp, err := http.Get(s.URL + path)
+		assert.Nil(t, err)
+		defer rsp.Body.Close()
+		d, _ := ioutil.ReadAll(rsp.Body)
+		return rsp.StatusCode, string(d)
+	}
+
+	code, body := get("/stream")
+	assert.Equal(t, 200, code)
+	assert.Equal(t, "chunk1;chunk2;chunk3", body)
+
+	code, body = get("/api/v1/test?id=23")
+	assert.Equal(t, 202, code)
+	assert.Equal(t, "api rsp", body)
+
+	code, body = get("/other")
+	assert.Equal(t, 200, code)
+	assert.Equal(t, "other rsp", body)
+
+	code, body = get("/api/hijack")
+	assert.Equal(t, 200, code)
+	assert.Equal(t, "hijacked", body)
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	assert.Equal(t, 2, len(recorded))
+	assert.Equal(t, []byte("chunk1;chunk2;chunk3"), recorded["/stream"].Body)
+	assert.Equal(t, 202, recorded["/api/?id=23"].Status)
+	assert.Equal(t, []byte("api rsp"), recorded["/api/?id=23"].Body)
+	assert.Equal(t, "GET", requests["/api/?id=23"].Method)
+	assert.Equal(t, "/api/v1/test", requests["/api/?id=23"].Path)
+	assert.Equal(t, "id=23", requests["/api/?id=23"].Query)
+}
+
+func TestHttpResponseWriterWrap(t *testing.T) {
+	newWrap := func(w http.ResponseWriter) *httpResponseWriterWrap {
+		wr := &httpResponseWriterWrap{w: w}
+		wr.data.Status = -1
+		wr.data.Header = w.Header()
+		return wr
+	}
+
+	// only interfaces of the underlying writer are exposed.
+	rec := httptest.NewRecorder()
+	w := newWrap(rec).wrap()
+	_, fl := w.(http.Flusher)
+	_, hj := w.(http.Hijacker)
+	_, pu := w.(http.Pusher)
+	assert.True(t, fl)
+	assert.False(t, hj)
+	assert.False(t, pu)
+
+	w = newWrap(struct{ http.ResponseWriter }{rec}).wrap()
+	_, fl = w.(http.Flusher)
+	assert.False(t, fl)
+
+	// status written after streaming starts is not recorded.
+	rec = httptest.NewRecorder()
+	wr := newWrap(rec)
+	w = wr.wrap()
+	w.WriteHeader(201)
+	w.Write([]byte("12345"))
+	w.(http.Flusher).Flush()
+	w.WriteHeader(500)
+	assert.Equal(t, 201, rec.Code)
+	assert.Equal(t, 201, wr.data.Status)
+	assert.Equal(t, []byte("12345"), wr.data.Body)
+	assert.False(t, wr.truncated)
+
+	// capture stops once streaming response exceeds limit, while writes still go through.
+	limit := httpStreamCaptureLimit
+	httpStreamCaptureLimit = 8
+	defer func() { httpStreamCaptureLimit = limit }()
+
+	w.Write([]byte("678"))
+	assert.False(t, wr.truncated)
+	w.Write([]byte("9"))
+	assert.True(t, wr.truncated)
+	assert.Nil(t, wr.data.Body)
+	w.Write([]byte("0"))
+	assert.Nil(t, wr.data.Body)
+	assert.Equal(t, "1234567890", rec.Body.String())
+}
@@ -2,15 +2,16 @@ package gorr
 
 import (
 	"gorr/util"
+	"gorr/util/diff"
 	"bytes"
 	"encoding/json"
-
-	//"flag"
+	"flag"
 	"fmt"
 	"io/ioutil"
 	"net/http"
 	"os"
 	"path/filepath"
+	"strings"
 	"sync"
 	"time"
 
@@ -48,6 +49,12 @@ type TestCase struct {
 	Desc    string `json:"Desc"`
 	URI     string `json:"Uri"`
 	Runner  string `json:"runner"`
+
+	// full message type names for grpc test cases, descriptors are stored in reg_grpc.desc
+	ReqMsg       string `json:"ReqMsg,omitempty"`
+	RspMsg       string `json:"RspMsg,omitempty"`
+	ClientStream bool   `json:"ClientStream,omitempty"`
+	ServerStream bool   `json:"ServerStream,omitempty"`
 }
 
 type TestItem struct {
@@ -70,12 +77,87 @@ const (
 	RecorderDataTypePbText   = 25
 	RecorderDataTypePbBinary = 26
 	RecorderDataTypeHttpJson = 27
+	RecorderDataTypeXml      = 28
+	RecorderDataTypeYaml     = 29
+	RecorderDataTypeForm     = 30
+)
+
+// HttpSerializedData is shared with runner and diff tool, see diff.HttpSerializedData.
+type HttpSerializedData = diff.HttpSerializedData
+
+var (
+	RegressionHttpRecordHeaders = flag.String("gorr_http_record_headers", "Content-Type,Accept", "comma separated request headers to keep in recorded http test cases")
+	RegressionGrpcRecordFormat  = flag.Int("gorr_grpc_record_format", RecorderDataTypePbBinary, "format of grpc messages recorded by RecordGrpc, 24 for jsonpb, 26 for binary protobuf")
 )
 
-type HttpSerializedData struct {
-	Body     []byte              `json:"body"`
-	BodyType int                 `json:"btype"`
-	Header   map[string][]string `json:"header"`
+// RecordHttpData records full inbound request(method, path, query, selected headers, body) and response(status, headers, body),
+// both are serialized as HttpSerializedData, so that runner is able to reissue the request without a custom runner.
+func RecordHttpData(outDir, desc string, req *HttpData, rsp *HttpData, db []string) (string, error) {
+	head := http.Header{}
+	for _, k := range strings.Split(*RegressionHttpRecordHeaders, ",") {
+		k = strings.TrimSpace(k)
+		if v, ok := req.Header[http.CanonicalHeaderKey(k)]; ok && len(k) > 0 {
+			head[http.CanonicalHeaderKey(k)] = v
+		}
+	}
+
+	d1 := HttpSerializedData{
+		Body:     req.Body,
+		BodyType: diff.HttpBodyType(req.Header.Get("Content-Type")),
+		Header:   head,
+		Method:   req.Method,
+		Path:     req.Path,
+		Query:    req.Query,
+	}
+
+	head2 := http.Header{}
+	for k, v := range rsp.Header {
+		head2[k] = v
+	}
+
+	for _, k := range diff.HttpVolatileHeaders {
+		head2.Del(k)
+	}
+
+	status := rsp.Status
+	if status <= 0 {
+		status = http.StatusOK
+	}
+
+	d2 := HttpSerializedData{
+		Body:     rsp.Body,
+		BodyType: diff.HttpBodyType(rsp.Header.Get("Content-Type")),
+		Header:   head2,
+		Status:   status,
+	}
+
+	reqData, err := json.MarshalIndent(d1, "", "\t")
+	if err != nil {
+		return "", fmt.Errorf("serialized http request failed, err:%s", err)
+	}
+
+	rspData, err := json.MarshalIndent(d2, "", "\t")
+	if err != nil {
+		return "", fmt.Errorf("serialized http response failed, err:%s", err)
+	}
+
+	uri := req.Path
+	if len(req.Query) > 0 {
+		uri = uri + "?" + req.Query
+	}
+
+	return RecordData(uri, outDir, "http", reqData, RecorderDataTypeHttpJson, rspData, RecorderDataTypeHttpJson, desc, db)
+}
+
+// RecordHttpTestCase can be passed to RegisterHttpRecorder() or NewHttpRecorderMiddleware() directly.
+func RecordHttpTestCase(pattern, desc string, req *HttpData, rsp *HttpData) {
+	dir, err := RecordHttpData("", desc, req, rsp, nil)
+	if err != nil {
+		GlobalMgr.notifier("recording http test case failed", pattern, []byte(err.Error()))
+		return
+	}
+
+	GlobalMgr.notifier("recording http test case done", pattern, []byte(dir))
 }
 
 func RecordHttpExt(uri, desc, name string, head http.Header, req, rsp []byte, t1, t2 int) (string, error) {
@@ -112,21 +194,20 @@ func RecordHttp(outDir, desc string, req *http.Request, rsp *http.Response, db [
 	rsp.Body.Close()
 	rsp.Body = ioutil.NopCloser(bytes.NewBuffer(rspBody))
 
-	return RecordData("", outDir, "http", reqBody, RecorderDataTypeJson, rspBody, RecorderDataTypeJson, desc, db)
+	t1 := diff.HttpBodyType(req.Header.Get("Content-Type"))
+	t2 := diff.HttpBodyType(rsp.Header.Get("Content-Type"))
+	return RecordData("", outDir, "http", reqBody, t1, rspBody, t2, desc, db)
 }
 
+// RecordGrpc records a grpc request and response as test case, in format given by -gorr_grpc_record_format.
+// message type names and descriptors are saved along, use RecordGrpcCall to record method name as well.
 func RecordGrpc(outDir, desc string, req proto.Message, rsp proto.Message, db []string) (string, error) {
-	d1, err1 := json.MarshalIndent(req, "", "\t")
-	if err1 != nil {
-		return "", fmt.Errorf("marshal grpc request failed, err:%s", err1.Error())
+	call := &GrpcCallData{
+		Req: []proto.Message{req},
+		Rsp: []proto.Message{rsp},
 	}
 
-	d2, err2 := json.MarshalIndent(rsp, "", "\t")
-	if err2 != nil {
-		return "", fmt.Errorf("marshal grpc response failed, err:%s", err2.Error())
-	}
-
-	return RecordData("", outDir, "grpc", d1, RecorderDataTypePbBinary, []byte(d2), RecorderDataTypeJson, desc, db)
+	return RecordGrpcCall(outDir, desc, *RegressionGrpcRecordFormat, call, db)
 }
 
 func genUniqueFileName(dir, prefix, suggest string) string {
@@ -148,6 +229,19 @@ func genUniqueFileName(dir, prefix, suggest string) string {
 }
 
 func RecordData(uri, outDir, name string, req []byte, t1 int, rsp []byte, t2 int, desc string, db []string) (string, error) {
+	tc := &TestCase{
+		URI:     uri,
+		ReqType: t1,
+		RspType: t2,
+		Desc:    desc,
+	}
+
+	return recordTestCase(outDir, name, tc, req, rsp, db, nil)
+}
+
+// recordTestCase writes req/rsp to test suit dir and appends tc to its config, tc.Req/tc.Rsp are filled.
+// prepare, if not nil, is called with the output dir before any file of the test case is written.
+func recordTestCase(outDir, name string, tc *TestCase, req, rsp []byte, db []string, prepare func(dir string) error) (string, error) {
 	glock.Lock()
 	defer glock.Unlock()
 
@@ -163,6 +257,13 @@ func RecordData(uri, outDir, name string, req []byte, t1 int, rsp []byte, t2 int
 	files := GlobalMgr.GetDbFiles()
 	files = append(files, db...)
 
+	if prepare != nil {
+		err := prepare(outDir)
+		if err != nil {
+			return "", err
+		}
+	}
+
 	f1 := genUniqueFileName(outDir, "reg_req", name)
 	f2 := genUniqueFileName(outDir, "reg_rsp", name)
 
@@ -194,20 +295,14 @@ func RecordData(uri, outDir, name string, req []byte, t1 int, rsp []byte, t2 int
 
 	ts := time.Now().Format(time.RFC3339)
 
+	tc.Req = f1
+	tc.Rsp = f2
+
 	td := TestItem{
-		DB:      data,
-		Version: 2,
-		Flags:   []string{"-gorr_run_type=2", fmt.Sprintf("-server_time=%s", ts)},
-		TestCases: []*TestCase{
-			&TestCase{
-				Req:     f1,
-				Rsp:     f2,
-				URI:     uri,
-				ReqType: t1,
-				RspType: t2,
-				Desc:    desc,
-			},
-		},
+		DB:        data,
+		Version:   2,
+		Flags:     []string{"-gorr_run_type=2", fmt.Sprintf("-server_time=%s", ts)},
+		TestCases: []*TestCase{tc},
 	}
 
 	if len(data) > 0 {
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"github.com/golang/protobuf/jsonpb"
+	"github.com/golang/protobuf/proto"
 	"github.com/stretchr/testify/assert"
 	"io/ioutil"
 	"net/http"
@@ -91,6 +92,9 @@ func TestRecordGrpc(t *testing.T) {
 	ioutil.WriteFile(db1, []byte("ddddd"), 0644)
 	ioutil.WriteFile(db2, []byte("ddddd"), 0644)
 
+	*RegressionGrpcRecordFormat = RecorderDataTypeJson
+	defer func() { *RegressionGrpcRecordFormat = RecorderDataTypePbBinary }()
+
 	var out string
 	outDir := createOutputDir("cases")
 	out, err := RecordGrpc(outDir, "miliao_test_grpc_record", req, rsp, []string{db1, db2})
@@ -109,7 +113,7 @@ func TestRecordGrpc(t *testing.T) {
 	req2 := &GrpcHookRequest{}
 	rsp2 := &GrpcHookResponse{}
 
-	err1 = json.Unmarshal(reqData, req2)
+	err1 = jsonpb.UnmarshalString(string(reqData), req2)
 	err2 = jsonpb.UnmarshalString(string(rspData), rsp2)
 	assert.Nil(t, err1)
 	assert.Nil(t, err2)
@@ -117,5 +121,104 @@ func TestRecordGrpc(t *testing.T) {
 	assert.Equal(t, req, req2)
 	assert.Equal(t, rsp, rsp2)
 
+	var ti TestItem
+	conf, err := ioutil.ReadFile(out + "/reg_config.json")
+	assert.Nil(t, err)
+	assert.Nil(t, json.Unmarshal(conf, &ti))
+	assert.Equal(t, RecorderDataTypeJson, ti.TestCases[0].ReqType)
+	assert.Equal(t, "grpc_hook.GrpcHookRequest", ti.TestCases[0].ReqMsg)
+	assert.Equal(t, "grpc_hook.GrpcHookResponse", ti.TestCases[0].RspMsg)
+
 	assert.Nil(t, os.RemoveAll(out))
+
+	*RegressionGrpcRecordFormat = RecorderDataTypePbBinary
+
+	out, err = RecordGrpc(createOutputDir("cases"), "miliao_test_grpc_record", req, rsp, nil)
+	assert.Nil(t, err)
+	defer os.RemoveAll(out)
+
+	reqData, err1 = ioutil.ReadFile(out + "/reg_req_grpc.dat")
+	assert.Nil(t, err1)
+	assert.Nil(t, proto.Unmarshal(reqData, req2))
+	assert.True(t, proto.Equal(req, req2))
+
+	_, err = os.Stat(out + "/" + grpcDescriptorFile)
+	assert.Nil(t, err)
+
+	// messages without descriptor are recorded with a warning.
+	var warned []string
+	GlobalMgr.SetNotify(func(src, key string, value []byte) { warned = append(warned, src+":"+key) })
+	defer GlobalMgr.SetNotify(func(string, string, []byte) {})
+
+	out2, err := RecordGrpc(createOutputDir("cases"), "miliao_test_grpc_record", &plainMsg{Name: "miliao"}, rsp, nil)
+	assert.Nil(t, err)
+	defer os.RemoveAll(out2)
+
+	assert.Equal(t, []string{"grpc descriptor not available:*gorr.plainMsg"}, warned)
+
+	_, err = os.Stat(out2 + "/reg_req_grpc.dat")
+	assert.Nil(t, err)
+}
+
+// plainMsg is a proto message without descriptor.
+type plainMsg struct {
+	Name string `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+}
+
+func (m *plainMsg) Reset()         { *m = plainMsg{} }
+func (m *plainMsg) String() string { return proto.CompactTextString(m) }
+func (*plainMsg) ProtoMessage()    {}
+
+func TestRecordHttpData(t *testing.T) {
+	*RegressionOutputDir = "/tmp"
+
+	req := &HttpData{
+		Body:   []byte(`{"id":23}`),
+		Header: http.Header{"Content-Type": []string{"application/json"}, "User-Agent": []string{"RegressionTool"}},
+		Method: "PUT",
+		Path:   "/api/v1/user",
+		Query:  "debug=1",
+	}
+
+	rsp := &HttpData{
+		Status: 201,
+		Body:   []byte("created"),
+		Header: http.Header{"Content-Type": []string{"text/plain"}, "Date": []string{"Mon, 01 Jan 2019 00:00:00 GMT"}, "X-Some": []string{"v1"}},
+	}
+
+	outDir := createOutputDir("cases")
+	out, err := RecordHttpData(outDir, "miliao_http_data_test", req, rsp, nil)
+	assert.Nil(t, err)
+	defer os.RemoveAll(out)
+
+	var ti TestItem
+	conf, err := ioutil.ReadFile(out + "/reg_config.json")
+	assert.Nil(t, err)
+	assert.Nil(t, json.Unmarshal(conf, &ti))
+	assert.Equal(t, 1, len(ti.TestCases))
+
+	tc := ti.TestCases[0]
+	assert.Equal(t, RecorderDataTypeHttpJson, tc.ReqType)
+	assert.Equal(t, RecorderDataTypeHttpJson, tc.RspType)
+	assert.Equal(t, "/api/v1/user?debug=1", tc.URI)
+
+	var d1, d2 HttpSerializedData
+	reqData, err1 := ioutil.ReadFile(out + "/" + tc.Req)
+	rspData, err2 := ioutil.ReadFile(out + "/" + tc.Rsp)
+	assert.Nil(t, err1)
+	assert.Nil(t, err2)
+	assert.Nil(t, json.Unmarshal(reqData, &d1))
+	assert.Nil(t, json.Unmarshal(rspData, &d2))
+
+	assert.Equal(t, "PUT", d1.Method)
+	assert.Equal(t, "/api/v1/user", d1.Path)
+	assert.Equal(t, "debug=1", d1.Query)
+	assert.Equal(t, req.Body, d1.Body)
+	assert.Equal(t, RecorderDataTypeJson, d1.BodyType)
+	assert.Equal(t, map[string][]string{"Content-Type": []string{"application/json"}}, d1.Header)
+
+	assert.Equal(t, 201, d2.Status)
+	assert.Equal(t, rsp.Body, d2.Body)
+	assert.Equal(t, RecorderDataTypeUnknown, d2.BodyType)
+	assert.Equal(t, map[string][]string{"Content-Type": []string{"text/plain"}, "X-Some": []string{"v1"}}, d2.Header)
 }
@@ -0,0 +1,589 @@
+package gorr
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis"
+)
+
+/*
+results of StringCmd, StatusCmd, IntCmd, FloatCmd, BoolCmd and StringSliceCmd are stored in binary, as they always were,
+results of all other cmds are stored in json, tagged by type of the cmd:
+
+	{"type": "ZSliceCmd", "val": [{"Score": 1, "Member": "foo"}]}
+
+replies of Cmd and SliceCmd are of interface{}, they are tagged element by element, see redisTaggedValue.
+*/
+type redisCmdValue struct {
+	Type string          `json:"type"`
+	Val  json.RawMessage `json:"val"`
+}
+
+// redisTaggedValue keeps integers, nils, nested arrays and errors in reply of Cmd and SliceCmd.
+type redisTaggedValue struct {
+	Tag   string              `json:"t"`
+	Str   string              `json:"s,omitempty"`
+	Int   int64               `json:"i,omitempty"`
+	Float redisFloat          `json:"f,omitempty"`
+	Array []*redisTaggedValue `json:"a,omitempty"`
+}
+
+// redisFloat stores non-finite floats as strings, eg: -inf/+inf scores of ZSET, which are not valid json numbers.
+type redisFloat float64
+
+func (f redisFloat) MarshalJSON() ([]byte, error) {
+	v := float64(f)
+	if math.IsInf(v, 0) || math.IsNaN(v) {
+		return json.Marshal(strconv.FormatFloat(v, 'g', -1, 64))
+	}
+	return json.Marshal(v)
+}
+
+func (f *redisFloat) UnmarshalJSON(data []byte) error {
+	var s string
+	if json.Unmarshal(data, &s) == nil {
+		v, err := strconv.ParseFloat(s, 64)
+		*f = redisFloat(v)
+		return err
+	}
+
+	var v float64
+	err := json.Unmarshal(data, &v)
+	*f = redisFloat(v)
+	return err
+}
+
+// redisZValue is redis.Z or redis.ZWithKey with score of redisFloat, it is encoded the same way as them.
+type redisZValue struct {
+	Score  redisFloat  `json:"Score"`
+	Member interface{} `json:"Member"`
+	Key    string      `json:"Key,omitempty"`
+}
+
+func newRedisZValues(zs []redis.Z) []redisZValue {
+	if zs == nil {
+		return nil
+	}
+
+	ret := make([]redisZValue, 0, len(zs))
+	for _, z := range zs {
+		ret = append(ret, redisZValue{Score: redisFloat(z.Score), Member: z.Member})
+	}
+	return ret
+}
+
+func (v *redisZValue) z() redis.Z {
+	return redis.Z{Score: float64(v.Score), Member: v.Member}
+}
+
+type redisScanValue struct {
+	Keys   []string `json:"keys"`
+	Cursor uint64   `json:"cursor"`
+}
+
+// redisReplyError is error inside reply of Cmd and SliceCmd, eg: error in reply of EVAL, it implements redis.Error.
+type redisReplyError string
+
+func (e redisReplyError) Error() string {
+	return string(e)
+}
+
+func (e redisReplyError) RedisError() {}
+
+func newRedisTaggedValue(v interface{}) *redisTaggedValue {
+	switch t := v.(type) {
+	case nil:
+		return &redisTaggedValue{Tag: "nil"}
+	case string:
+		return &redisTaggedValue{Tag: "string", Str: t}
+	case []byte:
+		return &redisTaggedValue{Tag: "string", Str: string(t)}
+	case int64:
+		return &redisTaggedValue{Tag: "int", Int: t}
+	case int:
+		return &redisTaggedValue{Tag: "int", Int: int64(t)}
+	case float64:
+		return &redisTaggedValue{Tag: "float", Float: redisFloat(t)}
+	case bool:
+		if t {
+			return &redisTaggedValue{Tag: "bool", Int: 1}
+		}
+		return &redisTaggedValue{Tag: "bool"}
+	case []interface{}:
+		ret := &redisTaggedValue{Tag: "array", Array: make([]*redisTaggedValue, 0, len(t))}
+		for _, e := range t {
+			ret.Array = append(ret.Array, newRedisTaggedValue(e))
+		}
+		return ret
+	case error:
+		return &redisTaggedValue{Tag: "error", Str: t.Error()}
+	}
+
+	return &redisTaggedValue{Tag: "string", Str: fmt.Sprint(v)}
+}
+
+func (v *redisTaggedValue) value() interface{} {
+	if v == nil {
+		return nil
+	}
+
+	switch v.Tag {
+	case "string":
+		return v.Str
+	case "int":
+		return v.Int
+	case "float":
+		return float64(v.Float)
+	case "bool":
+		return v.Int != 0
+	case "error":
+		return redisReplyError(v.Str)
+	case "array":
+		ret := make([]interface{}, 0, len(v.Array))
+		for _, e := range v.Array {
+			ret = append(ret, e.value())
+		}
+		return ret
+	}
+
+	return nil
+}
+
+func redisTaggedSlice(vs []interface{}) []*redisTaggedValue {
+	ret := make([]*redisTaggedValue, 0, len(vs))
+	for _, v := range vs {
+		ret = append(ret, newRedisTaggedValue(v))
+	}
+	return ret
+}
+
+// redisCmdType returns type name of cmd, eg: StringCmd.
+func redisCmdType(cmd interface{}) string {
+	t := reflect.TypeOf(cmd)
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t.Name()
+}
+
+// encodeRedisCmdValue encodes result of cmd with type tag, ok is false if cmd is not supported.
+// nothing is encoded if cmd fails, and err of cmd is returned.
+func encodeRedisCmdValue(cmd redis.Cmder) (data []byte, ok bool, err error) {
+	var val interface{}
+
+	switch c := cmd.(type) {
+	case *redis.Cmd:
+		var v interface{}
+		v, err = c.Result()
+		val = newRedisTaggedValue(v)
+	case *redis.SliceCmd:
+		var v []interface{}
+		v, err = c.Result()
+		val = redisTaggedSlice(v)
+	case *redis.DurationCmd:
+		val, err = c.Result()
+	case *redis.TimeCmd:
+		val, err = c.Result()
+	case *redis.BoolSliceCmd:
+		val, err = c.Result()
+	case *redis.StringStringMapCmd:
+		val, err = c.Result()
+	case *redis.StringIntMapCmd:
+		val, err = c.Result()
+	case *redis.StringStructMapCmd:
+		val, err = c.Result()
+	case *redis.XMessageSliceCmd:
+		val, err = c.Result()
+	case *redis.XStreamSliceCmd:
+		val, err = c.Result()
+	case *redis.XPendingCmd:
+		val, err = c.Result()
+	case *redis.XPendingExtCmd:
+		val, err = c.Result()
+	case *redis.ZSliceCmd:
+		var v []redis.Z
+		v, err = c.Result()
+		val = newRedisZValues(v)
+	case *redis.ZWithKeyCmd:
+		var v redis.ZWithKey
+		v, err = c.Result()
+		val = redisZValue{Score: redisFloat(v.Score), Member: v.Member, Key: v.Key}
+	case *redis.ScanCmd:
+		var v redisScanValue
+		v.Keys, v.Cursor, err = c.Result()
+		val = v
+	case *redis.ClusterSlotsCmd:
+		val, err = c.Result()
+	case *redis.GeoLocationCmd:
+		val, err = c.Result()
+	case *redis.GeoPosCmd:
+		val, err = c.Result()
+	case *redis.CommandsInfoCmd:
+		val, err = c.Result()
+	default:
+		return nil, false, nil
+	}
+
+	if err != nil {
+		return nil, true, err
+	}
+
+	v, err := json.Marshal(val)
+	if err != nil {
+		return nil, true, fmt.Errorf("marshal redis cmd value failed, err:%s", err)
+	}
+
+	data, err = json.Marshal(&redisCmdValue{Type: redisCmdType(cmd), Val: v})
+	return data, true, err
+}
+
+// loadRedisCmdValue decodes stored result of cmd to v, redis.Nil is returned if result is empty.
+func loadRedisCmdValue(cmd redis.Cmder, v interface{}) error {
+	value, err := getStoredValue(cmd.Args())
+	if err != nil {
+		return err
+	}
+
+	var cv redisCmdValue
+	err = json.Unmarshal(value, &cv)
+	if err != nil {
+		return fmt.Errorf("unmarshal redis cmd value failed, err:%s", err)
+	}
+
+	if cv.Type != redisCmdType(cmd) {
+		return fmt.Errorf("redis cmd type mismatch, recorded:%s, cmd:%s", cv.Type, redisCmdType(cmd))
+	}
+
+	err = json.Unmarshal(cv.Val, v)
+	if err != nil {
+		return fmt.Errorf("unmarshal redis %s value failed, err:%s", cv.Type, err)
+	}
+
+	return nil
+}
+
+// replay hooks for cmds stored with type tag
+func cmdResult(cmd *redis.Cmd) (interface{}, error) {
+	var ret *redisTaggedValue
+	err := loadRedisCmdValue(cmd, &ret)
+	return ret.value(), err
+}
+
+func cmdValue(cmd *redis.Cmd) interface{} {
+	ret, _ := cmdResult(cmd)
+	return ret
+}
+
+// getters of Cmd converting reply, the same as go-redis does.
+func cmdString(cmd *redis.Cmd) (string, error) {
+	v, err := cmdResult(cmd)
+	if err != nil {
+		return "", err
+	}
+
+	if s, ok := v.(string); ok {
+		return s, nil
+	}
+	return "", fmt.Errorf("redis: unexpected type=%T for String", v)
+}
+
+func cmdInt(cmd *redis.Cmd) (int, error) {
+	v, err := cmdInt64(cmd)
+	return int(v), err
+}
+
+func cmdInt64(cmd *redis.Cmd) (int64, error) {
+	v, err := cmdResult(cmd)
+	if err != nil {
+		return 0, err
+	}
+
+	switch t := v.(type) {
+	case int64:
+		return t, nil
+	case string:
+		return strconv.ParseInt(t, 10, 64)
+	}
+	return 0, fmt.Errorf("redis: unexpected type=%T for Int64", v)
+}
+
+func cmdUint64(cmd *redis.Cmd) (uint64, error) {
+	v, err := cmdResult(cmd)
+	if err != nil {
+		return 0, err
+	}
+
+	switch t := v.(type) {
+	case int64:
+		return uint64(t), nil
+	case string:
+		return strconv.ParseUint(t, 10, 64)
+	}
+	return 0, fmt.Errorf("redis: unexpected type=%T for Uint64", v)
+}
+
+func cmdFloat32(cmd *redis.Cmd) (float32, error) {
+	v, err := cmdResult(cmd)
+	if err != nil {
+		return 0, err
+	}
+
+	switch t := v.(type) {
+	case int64:
+		return float32(t), nil
+	case float64:
+		return float32(t), nil
+	case string:
+		f, err := strconv.ParseFloat(t, 32)
+		if err != nil {
+			return 0, err
+		}
+		return float32(f), nil
+	}
+	return 0, fmt.Errorf("redis: unexpected type=%T for Float32", v)
+}
+
+func cmdFloat64(cmd *redis.Cmd) (float64, error) {
+	v, err := cmdResult(cmd)
+	if err != nil {
+		return 0, err
+	}
+
+	switch t := v.(type) {
+	case int64:
+		return float64(t), nil
+	case float64:
+		return t, nil
+	case string:
+		return strconv.ParseFloat(t, 64)
+	}
+	return 0, fmt.Errorf("redis: unexpected type=%T for Float64", v)
+}
+
+func cmdBool(cmd *redis.Cmd) (bool, error) {
+	v, err := cmdResult(cmd)
+	if err != nil {
+		return false, err
+	}
+
+	switch t := v.(type) {
+	case int64:
+		return t != 0, nil
+	case string:
+		return strconv.ParseBool(t)
+	}
+	return false, fmt.Errorf("redis: unexpected type=%T for Bool", v)
+}
+
+func sliceCmdResult(cmd *redis.SliceCmd) ([]interface{}, error) {
+	var vs []*redisTaggedValue
+	err := loadRedisCmdValue(cmd, &vs)
+
+	var ret []interface{}
+	for _, v := range vs {
+		ret = append(ret, v.value())
+	}
+	return ret, err
+}
+
+func sliceCmdValue(cmd *redis.SliceCmd) []interface{} {
+	ret, _ := sliceCmdResult(cmd)
+	return ret
+}
+
+func durationCmdResult(cmd *redis.DurationCmd) (time.Duration, error) {
+	var ret time.Duration
+	err := loadRedisCmdValue(cmd, &ret)
+	return ret, err
+}
+
+func durationCmdValue(cmd *redis.DurationCmd) time.Duration {
+	ret, _ := durationCmdResult(cmd)
+	return ret
+}
+
+func timeCmdResult(cmd *redis.TimeCmd) (time.Time, error) {
+	var ret time.Time
+	err := loadRedisCmdValue(cmd, &ret)
+	return ret, err
+}
+
+func timeCmdValue(cmd *redis.TimeCmd) time.Time {
+	ret, _ := timeCmdResult(cmd)
+	return ret
+}
+
+func boolSliceCmdResult(cmd *redis.BoolSliceCmd) ([]bool, error) {
+	var ret []bool
+	err := loadRedisCmdValue(cmd, &ret)
+	return ret, err
+}
+
+func boolSliceCmdValue(cmd *redis.BoolSliceCmd) []bool {
+	ret, _ := boolSliceCmdResult(cmd)
+	return ret
+}
+
+func stringStringMapCmdResult(cmd *redis.StringStringMapCmd) (map[string]string, error) {
+	var ret map[string]string
+	err := loadRedisCmdValue(cmd, &ret)
+	return ret, err
+}
+
+func stringStringMapCmdValue(cmd *redis.StringStringMapCmd) map[string]string {
+	ret, _ := stringStringMapCmdResult(cmd)
+	return ret
+}
+
+func stringIntMapCmdResult(cmd *redis.StringIntMapCmd) (map[string]int64, error) {
+	var ret map[string]int64
+	err := loadRedisCmdValue(cmd, &ret)
+	return ret, err
+}
+
+func stringIntMapCmdValue(cmd *redis.StringIntMapCmd) map[string]int64 {
+	ret, _ := stringIntMapCmdResult(cmd)
+	return ret
+}
+
+func stringStructMapCmdResult(cmd *redis.StringStructMapCmd) (map[string]struct{}, error) {
+	var ret map[string]struct{}
+	err := loadRedisCmdValue(cmd, &ret)
+	return ret, err
+}
+
+func stringStructMapCmdValue(cmd *redis.StringStructMapCmd) map[string]struct{} {
+	ret, _ := stringStructMapCmdResult(cmd)
+	return ret
+}
+
+func xMessageSliceCmdResult(cmd *redis.XMessageSliceCmd) ([]redis.XMessage, error) {
+	var ret []redis.XMessage
+	err := loadRedisCmdValue(cmd, &ret)
+	return ret, err
+}
+
+func xMessageSliceCmdValue(cmd *redis.XMessageSliceCmd) []redis.XMessage {
+	ret, _ := xMessageSliceCmdResult(cmd)
+	return ret
+}
+
+func xStreamSliceCmdResult(cmd *redis.XStreamSliceCmd) ([]redis.XStream, error) {
+	var ret []redis.XStream
+	err := loadRedisCmdValue(cmd, &ret)
+	return ret, err
+}
+
+func xStreamSliceCmdValue(cmd *redis.XStreamSliceCmd) []redis.XStream {
+	ret, _ := xStreamSliceCmdResult(cmd)
+	return ret
+}
+
+func xPendingCmdResult(cmd *redis.XPendingCmd) (*redis.XPending, error) {
+	var ret *redis.XPending
+	err := loadRedisCmdValue(cmd, &ret)
+	return ret, err
+}
+
+func xPendingCmdValue(cmd *redis.XPendingCmd) *redis.XPending {
+	ret, _ := xPendingCmdResult(cmd)
+	return ret
+}
+
+func xPendingExtCmdResult(cmd *redis.XPendingExtCmd) ([]redis.XPendingExt, error) {
+	var ret []redis.XPendingExt
+	err := loadRedisCmdValue(cmd, &ret)
+	return ret, err
+}
+
+func xPendingExtCmdValue(cmd *redis.XPendingExtCmd) []redis.XPendingExt {
+	ret, _ := xPendingExtCmdResult(cmd)
+	return ret
+}
+
+func zSliceCmdResult(cmd *redis.ZSliceCmd) ([]redis.Z, error) {
+	var vs []redisZValue
+	err := loadRedisCmdValue(cmd, &vs)
+
+	var ret []redis.Z
+	for i := range vs {
+		ret = append(ret, vs[i].z())
+	}
+	return ret, err
+}
+
+func zSliceCmdValue(cmd *redis.ZSliceCmd) []redis.Z {
+	ret, _ := zSliceCmdResult(cmd)
+	return ret
+}
+
+func zWithKeyCmdResult(cmd *redis.ZWithKeyCmd) (redis.ZWithKey, error) {
+	var v redisZValue
+	err := loadRedisCmdValue(cmd, &v)
+	return redis.ZWithKey{Z: v.z(), Key: v.Key}, err
+}
+
+func zWithKeyCmdValue(cmd *redis.ZWithKeyCmd) redis.ZWithKey {
+	ret, _ := zWithKeyCmdResult(cmd)
+	return ret
+}
+
+func scanCmdResult(cmd *redis.ScanCmd) ([]string, uint64, error) {
+	var ret redisScanValue
+	err := loadRedisCmdValue(cmd, &ret)
+	return ret.Keys, ret.Cursor, err
+}
+
+func scanCmdValue(cmd *redis.ScanCmd) ([]string, uint64) {
+	keys, cursor, _ := scanCmdResult(cmd)
+	return keys, cursor
+}
+
+func clusterSlotsCmdResult(cmd *redis.ClusterSlotsCmd) ([]redis.ClusterSlot, error) {
+	var ret []redis.ClusterSlot
+	err := loadRedisCmdValue(cmd, &ret)
+	return ret, err
+}
+
+func clusterSlotsCmdValue(cmd *redis.ClusterSlotsCmd) []redis.ClusterSlot {
+	ret, _ := clusterSlotsCmdResult(cmd)
+	return ret
+}
+
+func geoLocationCmdResult(cmd *redis.GeoLocationCmd) ([]redis.GeoLocation, error) {
+	var ret []redis.GeoLocation
+	err := loadRedisCmdValue(cmd, &ret)
+	return ret, err
+}
+
+func geoLocationCmdValue(cmd *redis.GeoLocationCmd) []redis.GeoLocation {
+	ret, _ := geoLocationCmdResult(cmd)
+	return ret
+}
+
+func geoPosCmdResult(cmd *redis.GeoPosCmd) ([]*redis.GeoPos, error) {
+	var ret []*redis.GeoPos
+	err := loadRedisCmdValue(cmd, &ret)
+	return ret, err
+}
+
+func geoPosCmdValue(cmd *redis.GeoPosCmd) []*redis.GeoPos {
+	ret, _ := geoPosCmdResult(cmd)
+	return ret
+}
+
+func commandsInfoCmdResult(cmd *redis.CommandsInfoCmd) (map[string]*redis.CommandInfo, error) {
+	var ret map[string]*redis.CommandInfo
+	err := loadRedisCmdValue(cmd, &ret)
+	return ret, err
+}
+
+func commandsInfoCmdValue(cmd *redis.CommandsInfoCmd) map[string]*redis.CommandInfo {
+	ret, _ := commandsInfoCmdResult(cmd)
+	return ret
+}
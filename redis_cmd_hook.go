@@ -4,6 +4,9 @@ import (
 	"bytes"
 	"encoding/binary"
 	"errors"
+	"fmt"
+	"strconv"
+
 	"github.com/go-redis/redis"
 )
 
@@ -87,49 +90,138 @@ func stringCmdResult(cmd *redis.StringCmd) (string, error) {
 	return string(value), nil
 }
 
-func intCmdValue(cmd *redis.IntCmd) int64 {
-	var buff bytes.Buffer
-	value, err1 := getStoredValue(cmd.Args())
+// getters of StringCmd converting reply, the same as go-redis does.
+func stringCmdBytes(cmd *redis.StringCmd) ([]byte, error) {
+	v, err := stringCmdResult(cmd)
+	return []byte(v), err
+}
 
-	if err1 != nil {
-		// fmt.Printf("read int cmd from db failed, error:%s\n", err1.Error())
-		return 0
+func stringCmdInt(cmd *redis.StringCmd) (int, error) {
+	v, err := stringCmdResult(cmd)
+	if err != nil {
+		return 0, err
 	}
+	return strconv.Atoi(v)
+}
 
-	sz, err2 := buff.Write(value)
-	if err2 != nil || sz != len(value) {
-		// fmt.Printf("read int cmd size failed, error:%s, sz:%d, len(value):%d\n", err2.Error(), sz, len(value))
-		return 0.0
+func stringCmdInt64(cmd *redis.StringCmd) (int64, error) {
+	v, err := stringCmdResult(cmd)
+	if err != nil {
+		return 0, err
 	}
+	return strconv.ParseInt(v, 10, 64)
+}
 
-	var ret int64
-	err := binary.Read(&buff, binary.LittleEndian, &ret)
+func stringCmdUint64(cmd *redis.StringCmd) (uint64, error) {
+	v, err := stringCmdResult(cmd)
 	if err != nil {
-		// fmt.Printf("read int cmd failed, error:%s\n", err.Error())
-		return 0
+		return 0, err
 	}
+	return strconv.ParseUint(v, 10, 64)
+}
 
-	return ret
+func stringCmdFloat32(cmd *redis.StringCmd) (float32, error) {
+	v, err := stringCmdResult(cmd)
+	if err != nil {
+		return 0, err
+	}
+
+	f, err := strconv.ParseFloat(v, 32)
+	if err != nil {
+		return 0, err
+	}
+	return float32(f), nil
 }
 
-func floatCmdValue(cmd *redis.FloatCmd) float64 {
-	var buff bytes.Buffer
-	value, err1 := getStoredValue(cmd.Args())
+func stringCmdFloat64(cmd *redis.StringCmd) (float64, error) {
+	v, err := stringCmdResult(cmd)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseFloat(v, 64)
+}
 
-	if err1 != nil {
-		return 0.0
+// stringCmdScan scans stored value by original StringCmd.Scan() of a cmd holding the value.
+func stringCmdScan(cmd *redis.StringCmd, val interface{}) error {
+	v, err := stringCmdResult(cmd)
+	if err != nil {
+		return err
 	}
+	return stringCmdScanTrampoline(redis.NewStringResult(v, nil), val)
+}
 
-	sz, err2 := buff.Write(value)
-	if err2 != nil || sz != len(value) {
-		return 0.0
+//go:noinline
+func stringCmdScanTrampoline(cmd *redis.StringCmd, val interface{}) error {
+	fmt.Printf("dummy function for regrestion testing:%v", cmd)
+
+	for i := 0; i < 100000; i++ {
+		fmt.Printf("id:%d\n", i)
+		go func() { fmt.Printf("hello world\n") }()
+	}
+
+	if cmd != nil {
+		panic("trampoline redis redis.StringCmd.Scan() function is not allowed to be called")
+	}
+
+	return nil
+}
+
+func intCmdValue(cmd *redis.IntCmd) int64 {
+	ret, _ := intCmdResult(cmd)
+	return ret
+}
+
+func intCmdResult(cmd *redis.IntCmd) (int64, error) {
+	var ret int64
+	value, err := getStoredValue(cmd.Args())
+	if err != nil {
+		return 0, err
 	}
 
+	err = binary.Read(bytes.NewReader(value), binary.LittleEndian, &ret)
+	if err != nil {
+		return 0, errors.New("read int from buffer failed")
+	}
+
+	return ret, nil
+}
+
+func floatCmdValue(cmd *redis.FloatCmd) float64 {
+	ret, _ := floatCmdResult(cmd)
+	return ret
+}
+
+func floatCmdResult(cmd *redis.FloatCmd) (float64, error) {
 	var ret float64
-	err := binary.Read(&buff, binary.LittleEndian, &ret)
+	value, err := getStoredValue(cmd.Args())
+	if err != nil {
+		return 0.0, err
+	}
+
+	err = binary.Read(bytes.NewReader(value), binary.LittleEndian, &ret)
 	if err != nil {
-		return 0.0
+		return 0.0, errors.New("read float from buffer failed")
 	}
 
+	return ret, nil
+}
+
+func boolCmdValue(cmd *redis.BoolCmd) bool {
+	ret, _ := boolCmdResult(cmd)
 	return ret
 }
+
+func boolCmdResult(cmd *redis.BoolCmd) (bool, error) {
+	var ret bool
+	value, err := getStoredValue(cmd.Args())
+	if err != nil {
+		return false, err
+	}
+
+	err = binary.Read(bytes.NewReader(value), binary.LittleEndian, &ret)
+	if err != nil {
+		return false, errors.New("read bool from buffer failed")
+	}
+
+	return ret, nil
+}
@@ -0,0 +1,196 @@
+package gorr
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// RedisCmd is implemented by cmds of go-redis v8 and v9.
+type RedisCmd interface {
+	Name() string
+	Args() []interface{}
+	Err() error
+	SetErr(error)
+}
+
+// RedisCmdReplayer records and replays cmds of go-redis v8 and v9, whose results are got by Val() and set by SetVal(),
+// outputs of Val() are stored as json array tagged by type of cmd, eg: {"type": "ScanCmd", "val": [["k1"], 12]}.
+// it is used by gorr/redisv8 and gorr/redisv9.
+type RedisCmdReplayer struct {
+	errType reflect.Type
+}
+
+// NewRedisCmdReplayer creates replayer, errReply is an error replied by redis server, eg: redis.TxFailedErr,
+// recorded errors replied by server are replayed in the same type as errReply.
+func NewRedisCmdReplayer(errReply error) *RedisCmdReplayer {
+	return &RedisCmdReplayer{errType: reflect.TypeOf(errReply)}
+}
+
+// Key builds key of cmd sent by client of id, key is scoped by tag generated from ctx, see RegressionMgr.SetGenKey().
+func (r *RedisCmdReplayer) Key(ctx context.Context, id string, cmd RedisCmd) string {
+	args := cmd.Args()
+	ss := make([]string, 0, len(args)+2)
+
+	if tag := GlobalMgr.genKey(RegressionRedisHook, ctx, cmd); len(tag) > 0 {
+		ss = append(ss, tag)
+	}
+
+	ss = append(ss, redisCmdType(cmd)+"@")
+	for _, arg := range args {
+		ss = append(ss, fmt.Sprint(arg))
+	}
+
+	return fmt.Sprintf("%s@%s@%s", GlobalMgr.GetCurTraceId(), id, strings.Join(ss, "@"))
+}
+
+// Save records result of cmd, err is the error of processing cmd, which might not be set to cmd yet.
+func (r *RedisCmdReplayer) Save(key string, cmd RedisCmd, err error) {
+	if err == nil {
+		err = cmd.Err()
+	}
+
+	if err != nil {
+		saveRedisCmdErr(key, err)
+		return
+	}
+
+	data, err := encodeRedisCmdVal(cmd)
+	if err != nil {
+		GlobalMgr.notifier("redis cmd not recording", fmt.Sprintf("key:%s, err:%s", key, err), nil)
+		return
+	}
+
+	clearRedisCmdErr(key)
+	GlobalMgr.StoreValue(key, data)
+	GlobalMgr.notifier("redis cmd recording", key, data)
+}
+
+// Replay sets recorded result to cmd, error set to cmd is returned.
+func (r *RedisCmdReplayer) Replay(key string, cmd RedisCmd) error {
+	err := loadRedisCmdErr(key, r.errType)
+	if err == nil {
+		var data []byte
+		data, err = GlobalMgr.GetValue(key)
+		if err == nil && len(data) == 0 {
+			err = fmt.Errorf("redis cmd not recorded")
+		}
+
+		if err == nil {
+			err = decodeRedisCmdVal(cmd, data)
+		}
+
+		if err != nil {
+			GlobalMgr.notifier("redis cmd replaying failed", key, []byte(err.Error()))
+		} else {
+			GlobalMgr.notifier("redis cmd replaying done", key, data)
+		}
+	} else {
+		GlobalMgr.notifier("redis cmd replaying error", key, []byte(err.Error()))
+	}
+
+	cmd.SetErr(err)
+	return err
+}
+
+// redisTaggedOutput tags value of interface{} or []interface{}, other values are stored as they are.
+func redisTaggedOutput(v reflect.Value) interface{} {
+	t := v.Type()
+	if t.Kind() == reflect.Interface {
+		return newRedisTaggedValue(v.Interface())
+	}
+
+	if t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.Interface {
+		vs, _ := v.Interface().([]interface{})
+		return redisTaggedSlice(vs)
+	}
+
+	return v.Interface()
+}
+
+func encodeRedisCmdVal(cmd RedisCmd) ([]byte, error) {
+	m := reflect.ValueOf(cmd).MethodByName("Val")
+	if !m.IsValid() {
+		return nil, fmt.Errorf("Val() not found for %s", redisCmdType(cmd))
+	}
+
+	outs := m.Call(nil)
+	vals := make([]interface{}, 0, len(outs))
+	for _, o := range outs {
+		vals = append(vals, redisTaggedOutput(o))
+	}
+
+	v, err := json.Marshal(vals)
+	if err != nil {
+		return nil, fmt.Errorf("marshal redis cmd value failed, err:%s", err)
+	}
+
+	return json.Marshal(&redisCmdValue{Type: redisCmdType(cmd), Val: v})
+}
+
+func decodeRedisCmdVal(cmd RedisCmd, data []byte) error {
+	var cv redisCmdValue
+	err := json.Unmarshal(data, &cv)
+	if err != nil {
+		return fmt.Errorf("unmarshal redis cmd value failed, err:%s", err)
+	}
+
+	if cv.Type != redisCmdType(cmd) {
+		return fmt.Errorf("redis cmd type mismatch, recorded:%s, cmd:%s", cv.Type, redisCmdType(cmd))
+	}
+
+	m := reflect.ValueOf(cmd).MethodByName("SetVal")
+	if !m.IsValid() {
+		return fmt.Errorf("SetVal() not found for %s", cv.Type)
+	}
+
+	var vals []json.RawMessage
+	err = json.Unmarshal(cv.Val, &vals)
+	if err != nil || len(vals) != m.Type().NumIn() {
+		return fmt.Errorf("invalid redis %s value:%s", cv.Type, string(cv.Val))
+	}
+
+	args := make([]reflect.Value, 0, len(vals))
+	for i, v := range vals {
+		t := m.Type().In(i)
+		a, err := decodeRedisTaggedOutput(t, v)
+		if err != nil {
+			return fmt.Errorf("unmarshal redis %s value failed, err:%s", cv.Type, err)
+		}
+		args = append(args, a)
+	}
+
+	m.Call(args)
+	return nil
+}
+
+func decodeRedisTaggedOutput(t reflect.Type, data []byte) (reflect.Value, error) {
+	if t.Kind() == reflect.Interface {
+		var tv *redisTaggedValue
+		err := json.Unmarshal(data, &tv)
+		if v := tv.value(); err == nil && v != nil {
+			return reflect.ValueOf(v), nil
+		}
+		return reflect.Zero(t), err
+	}
+
+	if t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.Interface {
+		var tvs []*redisTaggedValue
+		err := json.Unmarshal(data, &tvs)
+		if err != nil || tvs == nil {
+			return reflect.Zero(t), err
+		}
+
+		vs := make([]interface{}, 0, len(tvs))
+		for _, tv := range tvs {
+			vs = append(vs, tv.value())
+		}
+		return reflect.ValueOf(vs), nil
+	}
+
+	p := reflect.New(t)
+	err := json.Unmarshal(data, p.Interface())
+	return p.Elem(), err
+}
@@ -0,0 +1,1711 @@
+package gorr
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis"
+)
+
+/*
+redis emulator is an alternative way of replaying redis cmds, it must be enabled for both recording and replaying.
+
+when recording, results of reads(GET, HGETALL, LRANGE 0 -1, SMEMBERS, ZRANGE 0 -1 WITHSCORES, TTL, etc) are merged into
+a seed of the key, as long as the key is not written before by the app, seeds are stored under trace@id@redis_seed@key.
+seeds merged from reads of fields or members(HGET, HMGET, SISMEMBER, ZSCORE) are partial,
+cmds reading the whole key(HGETALL, HLEN, SMEMBERS, etc) are not emulated against them.
+
+when replaying, supported cmds are executed against an in-memory keyspace loaded lazily from seeds,
+so writes followed by reads behave consistently even when they are reordered or not recorded at all.
+a key is emulated only if its value is known, ie: it is seeded by a full read, or it is overwritten by SET/MSET/etc in replaying,
+cmds on unknown keys and cmds not supported by the emulator are replayed by their recorded keys,
+keys written by such cmds are not emulated any more until they are overwritten.
+
+time is frozen at the recorded time when replaying, so that results do not depend on how fast cmds are replayed:
+ttl of a key stays as seeded until it is changed by writes, keys are never expired by time, only by EXPIRE with ttl <= 0.
+*/
+
+const (
+	redisEmuString = "string"
+	redisEmuHash   = "hash"
+	redisEmuList   = "list"
+	redisEmuSet    = "set"
+	redisEmuZSet   = "zset"
+	redisEmuNone   = "none"
+)
+
+const (
+	redisEmuNoKey = iota
+	redisEmuFirstKey
+	redisEmuAllKeys
+	redisEmuPairKeys
+)
+
+var (
+	redisEmuLock    sync.Mutex
+	redisEmuEnabled = false
+	redisKeyspaces  = make(map[string]*redisKeyspace)
+
+	errRedisEmuUnsupported = errors.New("redis cmd not supported by emulator")
+	errRedisEmuUnknown     = errors.New("redis value unknown to emulator")
+)
+
+// redisEmuValue is value of a key in the emulator, it is stored as seed of the key when recording.
+type redisEmuValue struct {
+	Type string             `json:"type"`
+	Str  string             `json:"str,omitempty"`
+	Hash map[string]string  `json:"hash,omitempty"`
+	List []string           `json:"list,omitempty"`
+	Set  map[string]bool    `json:"set,omitempty"`
+	ZSet map[string]float64 `json:"zset,omitempty"`
+	TTL  time.Duration      `json:"ttl,omitempty"`
+
+	// Partial is true if value is seeded by reads of fields or members, eg: HGET, SISMEMBER, ZSCORE.
+	Partial bool `json:"partial,omitempty"`
+}
+
+// redisKeyspace is keyspace of a client in a trace, values are seeds when recording.
+type redisKeyspace struct {
+	id      string
+	values  map[string]*redisEmuValue
+	loaded  map[string]bool
+	known   map[string]bool
+	written map[string]bool
+	invalid map[string]bool
+}
+
+// redisEmuResult is result of cmd replayed by emulator, it replaces key of cmd in args[0], see getStoredValue.
+type redisEmuResult struct {
+	data []byte
+	err  error
+}
+
+type redisEmuCmd struct {
+	arity int
+	keys  int
+	write bool
+	fn    func(ks *redisKeyspace, name string, args []string) (interface{}, error)
+}
+
+// EnableRedisEmulator enables replaying of redis cmds by emulator, seeds of keys are recorded only if it is enabled.
+func EnableRedisEmulator(enable bool) {
+	redisEmuLock.Lock()
+	defer redisEmuLock.Unlock()
+
+	redisEmuEnabled = enable
+	redisKeyspaces = make(map[string]*redisKeyspace)
+}
+
+// resetRedisEmulator drops all keyspaces, it is called when hooks are installed for recording or replaying.
+func resetRedisEmulator() {
+	redisEmuLock.Lock()
+	defer redisEmuLock.Unlock()
+
+	redisKeyspaces = make(map[string]*redisKeyspace)
+}
+
+func newRedisEmuValue(typ string) *redisEmuValue {
+	v := &redisEmuValue{Type: typ}
+	switch typ {
+	case redisEmuHash:
+		v.Hash = make(map[string]string)
+	case redisEmuSet:
+		v.Set = make(map[string]bool)
+	case redisEmuZSet:
+		v.ZSet = make(map[string]float64)
+	}
+	return v
+}
+
+func (v *redisEmuValue) empty() bool {
+	switch v.Type {
+	case redisEmuHash:
+		return len(v.Hash) == 0
+	case redisEmuList:
+		return len(v.List) == 0
+	case redisEmuSet:
+		return len(v.Set) == 0
+	case redisEmuZSet:
+		return len(v.ZSet) == 0
+	}
+	return false
+}
+
+// getRedisKeyspace returns keyspace of client id in current trace, redisEmuLock must be held.
+func getRedisKeyspace(id string) *redisKeyspace {
+	id = GlobalMgr.GetCurTraceId() + "@" + id
+
+	ks, ok := redisKeyspaces[id]
+	if !ok {
+		ks = &redisKeyspace{
+			id:      id,
+			values:  make(map[string]*redisEmuValue),
+			loaded:  make(map[string]bool),
+			known:   make(map[string]bool),
+			written: make(map[string]bool),
+			invalid: make(map[string]bool),
+		}
+		redisKeyspaces[id] = ks
+	}
+
+	return ks
+}
+
+func (ks *redisKeyspace) seedKey(key string) string {
+	return fmt.Sprintf("%s@redis_seed@%s", ks.id, key)
+}
+
+// loadSeed returns seed of key, ok is false if key is not seeded, v is nil if key is seeded as not existing.
+func (ks *redisKeyspace) loadSeed(key string) (v *redisEmuValue, ok bool) {
+	data, err := GlobalMgr.GetValue(ks.seedKey(key))
+	if err != nil || len(data) == 0 {
+		return nil, false
+	}
+
+	var seed redisEmuValue
+	err = json.Unmarshal(data, &seed)
+	if err != nil {
+		GlobalMgr.notifier("redis emulator invalid seed", ks.seedKey(key), data)
+		return nil, false
+	}
+
+	if seed.Type == redisEmuNone {
+		return nil, true
+	}
+
+	return newRedisEmuValueFrom(&seed), true
+}
+
+// newRedisEmuValueFrom makes sure containers of v are not nil.
+func newRedisEmuValueFrom(v *redisEmuValue) *redisEmuValue {
+	n := newRedisEmuValue(v.Type)
+	if v.Hash != nil {
+		n.Hash = v.Hash
+	}
+	if v.Set != nil {
+		n.Set = v.Set
+	}
+	if v.ZSet != nil {
+		n.ZSet = v.ZSet
+	}
+	n.Str, n.List, n.TTL, n.Partial = v.Str, v.List, v.TTL, v.Partial
+	return n
+}
+
+// knows checks whether fields or members of v are known, partial value knows only fields read, and never the whole of it.
+func (v *redisEmuValue) knows(fields ...string) bool {
+	if v == nil || !v.Partial {
+		return true
+	}
+
+	if len(fields) == 0 {
+		return false
+	}
+
+	for _, f := range fields {
+		ok := false
+		switch v.Type {
+		case redisEmuHash:
+			_, ok = v.Hash[f]
+		case redisEmuSet:
+			ok = v.Set[f]
+		case redisEmuZSet:
+			_, ok = v.ZSet[f]
+		}
+		if !ok {
+			return false
+		}
+	}
+
+	return true
+}
+
+// redisEmuEvery returns every n-th of args, eg: fields of HSET key field value [field value ...].
+func redisEmuEvery(args []string, n int) []string {
+	ss := make([]string, 0, len(args)/n+1)
+	for i := 0; i < len(args); i += n {
+		ss = append(ss, args[i])
+	}
+	return ss
+}
+
+// get returns value of key, nil if key does not exist.
+func (ks *redisKeyspace) get(key string) *redisEmuValue {
+	if !ks.loaded[key] {
+		ks.loaded[key] = true
+		if v, ok := ks.loadSeed(key); ok {
+			ks.known[key] = true
+			if v != nil {
+				ks.values[key] = v
+			}
+		}
+	}
+
+	return ks.values[key]
+}
+
+func (ks *redisKeyspace) lookup(key, typ string) (*redisEmuValue, error) {
+	v := ks.get(key)
+	if v != nil && v.Type != typ {
+		return nil, redisEmuError("WRONGTYPE Operation against a key holding the wrong kind of value")
+	}
+	return v, nil
+}
+
+func (ks *redisKeyspace) lookupOrCreate(key, typ string) (*redisEmuValue, error) {
+	v, err := ks.lookup(key, typ)
+	if err == nil && v == nil {
+		v = newRedisEmuValue(typ)
+		ks.values[key] = v
+	}
+	return v, err
+}
+
+func (ks *redisKeyspace) set(key string, v *redisEmuValue) {
+	ks.loaded[key] = true
+	ks.known[key] = true
+	ks.values[key] = v
+}
+
+func (ks *redisKeyspace) del(key string) bool {
+	if ks.get(key) == nil {
+		return false
+	}
+	delete(ks.values, key)
+	return true
+}
+
+// cleanup removes key if its container is empty, as redis does, partial value might have fields unknown.
+func (ks *redisKeyspace) cleanup(key string) {
+	if v := ks.values[key]; v != nil && !v.Partial && v.empty() {
+		delete(ks.values, key)
+	}
+}
+
+// redisEmuError returns error as replied by redis server.
+func redisEmuError(msg string) error {
+	return reflect.ValueOf(msg).Convert(redisErrorType).Interface().(error)
+}
+
+func redisEmuArg(arg interface{}) string {
+	switch v := arg.(type) {
+	case string:
+		return v
+	case []byte:
+		return string(v)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		if v {
+			return "1"
+		}
+		return "0"
+	}
+	return fmt.Sprint(arg)
+}
+
+func redisEmuArgs(cmd redis.Cmder) (string, []string) {
+	args := cmd.Args()
+	if len(args) == 0 {
+		return "", nil
+	}
+
+	ss := make([]string, 0, len(args)-1)
+	for _, arg := range args[1:] {
+		ss = append(ss, redisEmuArg(arg))
+	}
+
+	return strings.ToLower(redisEmuArg(args[0])), ss
+}
+
+func (c *redisEmuCmd) keysOf(args []string) []string {
+	switch c.keys {
+	case redisEmuFirstKey:
+		return args[:1]
+	case redisEmuAllKeys:
+		return args
+	case redisEmuPairKeys:
+		return redisEmuEvery(args, 2)
+	}
+	return nil
+}
+
+// lookupRedisEmuCmd returns emulated cmd and keys touched by it, cmd is nil if it is not supported.
+func lookupRedisEmuCmd(name string, args []string) (*redisEmuCmd, []string) {
+	c, ok := redisEmuCmds[name]
+	if !ok || len(args) < c.arity {
+		if len(args) > 0 {
+			return nil, args[:1]
+		}
+		return nil, nil
+	}
+
+	return c, c.keysOf(args)
+}
+
+// overwrites checks whether cmd replaces values of its keys regardless of their old values, eg: SET without NX/XX/KEEPTTL.
+func (c *redisEmuCmd) overwrites(name string, args []string) bool {
+	switch name {
+	case "setex", "psetex", "mset":
+		return true
+	case "set":
+		for _, arg := range args[2:] {
+			switch strings.ToLower(arg) {
+			case "nx", "xx", "keepttl", "get":
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// isKnown checks whether values of keys are known to the emulator, seeds of keys are loaded if necessary.
+func (ks *redisKeyspace) isKnown(keys []string) bool {
+	for _, k := range keys {
+		ks.get(k)
+		if ks.invalid[k] || !ks.known[k] {
+			return false
+		}
+	}
+	return true
+}
+
+// check returns emulated cmd and keys touched by it, ok is false if cmd can not be emulated.
+func (ks *redisKeyspace) check(name string, args []string) (c *redisEmuCmd, keys []string, ok bool) {
+	c, keys = lookupRedisEmuCmd(name, args)
+	if c == nil {
+		return nil, keys, false
+	}
+
+	if c.overwrites(name, args) {
+		return c, keys, true
+	}
+
+	return c, keys, ks.isKnown(keys)
+}
+
+// invalidate stops emulating keys written by cmd c, which is replayed by its recorded key, c is nil if it is not supported.
+func (ks *redisKeyspace) invalidate(c *redisEmuCmd, keys []string) {
+	if c != nil && !c.write {
+		return
+	}
+
+	for _, k := range keys {
+		ks.invalid[k] = true
+	}
+}
+
+// canEmulateRedisCmds checks whether all cmds can be emulated, keys written by cmds are invalidated if not.
+func canEmulateRedisCmds(id string, cmds []redis.Cmder) bool {
+	redisEmuLock.Lock()
+	defer redisEmuLock.Unlock()
+
+	if !redisEmuEnabled {
+		return false
+	}
+
+	ks := getRedisKeyspace(id)
+	for _, cc := range cmds {
+		if _, _, ok := ks.check(redisEmuArgs(cc)); !ok {
+			for _, cc := range cmds {
+				c, keys := lookupRedisEmuCmd(redisEmuArgs(cc))
+				ks.invalidate(c, keys)
+			}
+			return false
+		}
+	}
+
+	return true
+}
+
+// emulateRedisCmd executes cmd against keyspace of client id, ok is false if cmd is not emulated,
+// in which case cmd is expected to be replayed by its recorded key.
+func emulateRedisCmd(id string, cmd redis.Cmder) (bool, error) {
+	redisEmuLock.Lock()
+	defer redisEmuLock.Unlock()
+
+	if !redisEmuEnabled {
+		return false, nil
+	}
+
+	ks := getRedisKeyspace(id)
+	name, args := redisEmuArgs(cmd)
+	c, keys, ok := ks.check(name, args)
+	if !ok {
+		ks.invalidate(c, keys)
+		return false, nil
+	}
+
+	if c.overwrites(name, args) {
+		for _, k := range keys {
+			delete(ks.invalid, k)
+		}
+	}
+
+	val, err := c.fn(ks, name, args)
+	if err == errRedisEmuUnsupported || err == errRedisEmuUnknown {
+		ks.invalidate(c, keys)
+		return false, nil
+	}
+
+	data, err2 := encodeRedisEmuResult(cmd, val, err)
+	if err2 != nil {
+		GlobalMgr.notifier("redis emulator encoding result failed", name, []byte(err2.Error()))
+		ks.invalidate(c, keys)
+		return false, nil
+	}
+
+	if err == redis.Nil {
+		if _, ok := cmd.(*redis.BoolCmd); ok {
+			err = nil
+		}
+	}
+
+	GlobalMgr.notifier("redis emulator replaying", name, data)
+
+	// result is kept by cmd itself, as key of cmd is for cmds replayed by recorded keys.
+	r := &redisEmuResult{data: data}
+	if err != nil && err != redis.Nil {
+		r.err = err
+	}
+	cmd.Args()[0] = r
+
+	if err != nil {
+		setRedisCmdErr(cmd, err)
+	}
+
+	return true, err
+}
+
+// encodeRedisEmuResult encodes val in the same way as results of cmd are recorded, see saveRedisCmdValue.
+func encodeRedisEmuResult(cmd redis.Cmder, val interface{}, err error) ([]byte, error) {
+	var buff bytes.Buffer
+	var ok bool
+
+	if _, isBool := cmd.(*redis.BoolCmd); err != nil && !isBool {
+		return nil, nil
+	}
+
+	switch cmd.(type) {
+	case *redis.StringCmd, *redis.StatusCmd:
+		var v string
+		if v, ok = val.(string); ok {
+			binary.Write(&buff, binary.LittleEndian, []byte(v))
+		}
+	case *redis.IntCmd:
+		var v int64
+		if v, ok = val.(int64); ok {
+			binary.Write(&buff, binary.LittleEndian, v)
+		}
+	case *redis.FloatCmd:
+		var v float64
+		if v, ok = val.(float64); ok {
+			binary.Write(&buff, binary.LittleEndian, v)
+		}
+	case *redis.BoolCmd:
+		var v bool
+		switch t := val.(type) {
+		case bool:
+			v, ok = t, true
+		case int64:
+			v, ok = t != 0, true
+		case string:
+			v, ok = t == "OK", true
+		case nil:
+			ok = err != nil
+		}
+		binary.Write(&buff, binary.LittleEndian, v)
+	case *redis.StringSliceCmd:
+		var v []string
+		if v, ok = val.([]string); ok {
+			binary.Write(&buff, binary.LittleEndian, int32(len(v)))
+			for _, s := range v {
+				binary.Write(&buff, binary.LittleEndian, int32(len(s)))
+				binary.Write(&buff, binary.LittleEndian, []byte(s))
+			}
+		}
+	default:
+		return encodeRedisEmuTaggedResult(cmd, val)
+	}
+
+	if !ok {
+		return nil, fmt.Errorf("result of %s mismatch, val:%v", redisCmdType(cmd), val)
+	}
+
+	return buff.Bytes(), nil
+}
+
+func encodeRedisEmuTaggedResult(cmd redis.Cmder, val interface{}) ([]byte, error) {
+	ok := false
+
+	switch cmd.(type) {
+	case *redis.Cmd:
+		if ss, isSlice := val.([]string); isSlice {
+			vs := make([]interface{}, 0, len(ss))
+			for _, s := range ss {
+				vs = append(vs, s)
+			}
+			val = vs
+		}
+		val, ok = newRedisTaggedValue(val), true
+	case *redis.SliceCmd:
+		var vs []interface{}
+		if vs, ok = val.([]interface{}); ok {
+			val = redisTaggedSlice(vs)
+		}
+	case *redis.DurationCmd:
+		_, ok = val.(time.Duration)
+	case *redis.StringStringMapCmd:
+		_, ok = val.(map[string]string)
+	case *redis.ZSliceCmd:
+		_, ok = val.([]redis.Z)
+	}
+
+	if !ok {
+		return nil, fmt.Errorf("result of %s mismatch, val:%v", redisCmdType(cmd), val)
+	}
+
+	v, err := json.Marshal(val)
+	if err != nil {
+		return nil, fmt.Errorf("marshal redis emulator result failed, err:%s", err)
+	}
+
+	return json.Marshal(&redisCmdValue{Type: redisCmdType(cmd), Val: v})
+}
+
+// seedRedisEmulator merges results of reads into seeds of keys, keys written by cmds are not seeded any more.
+func seedRedisEmulator(id string, cmds ...redis.Cmder) {
+	redisEmuLock.Lock()
+	defer redisEmuLock.Unlock()
+
+	if !redisEmuEnabled {
+		return
+	}
+
+	ks := getRedisKeyspace(id)
+	for _, cc := range cmds {
+		name, args := redisEmuArgs(cc)
+		c, keys := lookupRedisEmuCmd(name, args)
+		if c == nil || c.write {
+			for _, k := range keys {
+				ks.written[k] = true
+			}
+			continue
+		}
+
+		ks.seed(name, args, cc)
+	}
+}
+
+// seedValue returns seed of key to merge partial reads into, nil if key is written by the app.
+func (ks *redisKeyspace) seedValue(key, typ string) *redisEmuValue {
+	if ks.written[key] {
+		return nil
+	}
+
+	v := ks.values[key]
+	if v == nil || v.Type != typ {
+		v = newRedisEmuValue(typ)
+		v.Partial = true
+		if old := ks.values[key]; old != nil {
+			v.TTL = old.TTL
+		}
+		ks.values[key] = v
+	}
+
+	return v
+}
+
+// replaceSeed replaces seed of key by a full read of key.
+func (ks *redisKeyspace) replaceSeed(key string, v *redisEmuValue) {
+	if ks.written[key] {
+		return
+	}
+
+	if old := ks.values[key]; old != nil && v.Type != redisEmuNone {
+		v.TTL = old.TTL
+	}
+
+	ks.values[key] = v
+	ks.saveSeed(key)
+}
+
+func (ks *redisKeyspace) saveSeed(key string) {
+	v := ks.values[key]
+	if v == nil || ks.written[key] {
+		return
+	}
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		GlobalMgr.notifier("redis emulator seed not recording", ks.seedKey(key), []byte(err.Error()))
+		return
+	}
+
+	GlobalMgr.StoreValue(ks.seedKey(key), data)
+	GlobalMgr.notifier("redis emulator seed recording", ks.seedKey(key), data)
+}
+
+func (ks *redisKeyspace) seed(name string, args []string, cmd redis.Cmder) {
+	if len(args) == 0 {
+		return
+	}
+
+	key := args[0]
+
+	switch c := cmd.(type) {
+	case *redis.StringCmd:
+		val, err := c.Result()
+		if err == redis.Nil && name == "get" {
+			ks.replaceSeed(key, newRedisEmuValue(redisEmuNone))
+		} else if err == nil && name == "get" {
+			ks.replaceSeed(key, &redisEmuValue{Type: redisEmuString, Str: val})
+		} else if err == nil && name == "hget" {
+			if v := ks.seedValue(key, redisEmuHash); v != nil {
+				v.Hash[args[1]] = val
+				ks.saveSeed(key)
+			}
+		}
+	case *redis.SliceCmd:
+		vals, err := c.Result()
+		if err != nil {
+			return
+		}
+
+		if name == "mget" && len(vals) == len(args) {
+			for i, val := range vals {
+				if s, ok := val.(string); ok {
+					ks.replaceSeed(args[i], &redisEmuValue{Type: redisEmuString, Str: s})
+				} else if val == nil {
+					ks.replaceSeed(args[i], newRedisEmuValue(redisEmuNone))
+				}
+			}
+		} else if name == "hmget" && len(vals) == len(args)-1 {
+			v := ks.seedValue(key, redisEmuHash)
+			for i := 0; v != nil && i < len(vals); i++ {
+				if s, ok := vals[i].(string); ok {
+					v.Hash[args[i+1]] = s
+				}
+			}
+			ks.saveSeed(key)
+		}
+	case *redis.StringStringMapCmd:
+		val, err := c.Result()
+		if err == nil && name == "hgetall" {
+			v := &redisEmuValue{Type: redisEmuHash, Hash: val}
+			if len(val) == 0 {
+				v = newRedisEmuValue(redisEmuNone)
+			}
+			ks.replaceSeed(key, v)
+		}
+	case *redis.StringSliceCmd:
+		val, err := c.Result()
+		if err != nil {
+			return
+		}
+
+		v := newRedisEmuValue(redisEmuNone)
+		if name == "lrange" && args[1] == "0" && args[2] == "-1" {
+			if len(val) > 0 {
+				v = &redisEmuValue{Type: redisEmuList, List: val}
+			}
+		} else if name == "smembers" {
+			if len(val) > 0 {
+				v = newRedisEmuValue(redisEmuSet)
+				for _, m := range val {
+					v.Set[m] = true
+				}
+			}
+		} else {
+			return
+		}
+
+		ks.replaceSeed(key, v)
+	case *redis.BoolCmd:
+		val, err := c.Result()
+		if err == nil && val && name == "sismember" {
+			if v := ks.seedValue(key, redisEmuSet); v != nil {
+				v.Set[args[1]] = true
+				ks.saveSeed(key)
+			}
+		}
+	case *redis.ZSliceCmd:
+		val, err := c.Result()
+		if err != nil || name != "zrange" || args[1] != "0" || args[2] != "-1" {
+			return
+		}
+
+		v := newRedisEmuValue(redisEmuNone)
+		if len(val) > 0 {
+			v = newRedisEmuValue(redisEmuZSet)
+			for _, z := range val {
+				v.ZSet[redisEmuArg(z.Member)] = z.Score
+			}
+		}
+
+		ks.replaceSeed(key, v)
+	case *redis.FloatCmd:
+		val, err := c.Result()
+		if err == nil && name == "zscore" {
+			if v := ks.seedValue(key, redisEmuZSet); v != nil {
+				v.ZSet[args[1]] = val
+				ks.saveSeed(key)
+			}
+		}
+	case *redis.DurationCmd:
+		val, err := c.Result()
+		if err == nil && val > 0 && !ks.written[key] && ks.values[key] != nil && ks.values[key].Type != redisEmuNone {
+			ks.values[key].TTL = val
+			ks.saveSeed(key)
+		}
+	case *redis.IntCmd:
+		val, err := c.Result()
+		if err == nil && val == 0 && name == "exists" && len(args) == 1 {
+			ks.replaceSeed(key, newRedisEmuValue(redisEmuNone))
+		}
+	case *redis.StatusCmd:
+		val, err := c.Result()
+		if err == nil && val == redisEmuNone && name == "type" {
+			ks.replaceSeed(key, newRedisEmuValue(redisEmuNone))
+		}
+	}
+}
+
+var redisEmuCmds = map[string]*redisEmuCmd{
+	"ping":    {0, redisEmuNoKey, false, emuPing},
+	"watch":   {1, redisEmuAllKeys, false, emuOK},
+	"unwatch": {0, redisEmuNoKey, false, emuOK},
+
+	"get":         {1, redisEmuFirstKey, false, emuGet},
+	"set":         {2, redisEmuFirstKey, true, emuSet},
+	"setnx":       {2, redisEmuFirstKey, true, emuSetNX},
+	"setex":       {3, redisEmuFirstKey, true, emuSetEX},
+	"psetex":      {3, redisEmuFirstKey, true, emuSetEX},
+	"mget":        {1, redisEmuAllKeys, false, emuMGet},
+	"mset":        {2, redisEmuPairKeys, true, emuMSet},
+	"incr":        {1, redisEmuFirstKey, true, emuIncrBy},
+	"decr":        {1, redisEmuFirstKey, true, emuIncrBy},
+	"incrby":      {2, redisEmuFirstKey, true, emuIncrBy},
+	"decrby":      {2, redisEmuFirstKey, true, emuIncrBy},
+	"incrbyfloat": {2, redisEmuFirstKey, true, emuIncrByFloat},
+	"append":      {2, redisEmuFirstKey, true, emuAppend},
+	"strlen":      {1, redisEmuFirstKey, false, emuStrLen},
+
+	"del":     {1, redisEmuAllKeys, true, emuDel},
+	"unlink":  {1, redisEmuAllKeys, true, emuDel},
+	"exists":  {1, redisEmuAllKeys, false, emuExists},
+	"expire":  {2, redisEmuFirstKey, true, emuExpire},
+	"pexpire": {2, redisEmuFirstKey, true, emuExpire},
+	"ttl":     {1, redisEmuFirstKey, false, emuTTL},
+	"pttl":    {1, redisEmuFirstKey, false, emuTTL},
+	"persist": {1, redisEmuFirstKey, true, emuPersist},
+	"type":    {1, redisEmuFirstKey, false, emuType},
+
+	"hget":    {2, redisEmuFirstKey, false, emuHGet},
+	"hset":    {3, redisEmuFirstKey, true, emuHSet},
+	"hsetnx":  {3, redisEmuFirstKey, true, emuHSetNX},
+	"hmset":   {3, redisEmuFirstKey, true, emuHSet},
+	"hmget":   {2, redisEmuFirstKey, false, emuHMGet},
+	"hgetall": {1, redisEmuFirstKey, false, emuHGetAll},
+	"hdel":    {2, redisEmuFirstKey, true, emuHDel},
+	"hexists": {2, redisEmuFirstKey, false, emuHExists},
+	"hlen":    {1, redisEmuFirstKey, false, emuHLen},
+	"hincrby": {3, redisEmuFirstKey, true, emuHIncrBy},
+	"hkeys":   {1, redisEmuFirstKey, false, emuHKeys},
+	"hvals":   {1, redisEmuFirstKey, false, emuHKeys},
+
+	"lpush":  {2, redisEmuFirstKey, true, emuPush},
+	"rpush":  {2, redisEmuFirstKey, true, emuPush},
+	"lpop":   {1, redisEmuFirstKey, true, emuPop},
+	"rpop":   {1, redisEmuFirstKey, true, emuPop},
+	"lrange": {3, redisEmuFirstKey, false, emuLRange},
+	"llen":   {1, redisEmuFirstKey, false, emuLLen},
+	"lindex": {2, redisEmuFirstKey, false, emuLIndex},
+
+	"sadd":      {2, redisEmuFirstKey, true, emuSAdd},
+	"srem":      {2, redisEmuFirstKey, true, emuSRem},
+	"smembers":  {1, redisEmuFirstKey, false, emuSMembers},
+	"sismember": {2, redisEmuFirstKey, false, emuSIsMember},
+	"scard":     {1, redisEmuFirstKey, false, emuSCard},
+
+	"zadd":      {3, redisEmuFirstKey, true, emuZAdd},
+	"zrem":      {2, redisEmuFirstKey, true, emuZRem},
+	"zscore":    {2, redisEmuFirstKey, false, emuZScore},
+	"zincrby":   {3, redisEmuFirstKey, true, emuZIncrBy},
+	"zcard":     {1, redisEmuFirstKey, false, emuZCard},
+	"zrange":    {3, redisEmuFirstKey, false, emuZRange},
+	"zrevrange": {3, redisEmuFirstKey, false, emuZRange},
+}
+
+var errRedisEmuNotInteger = redisEmuError("ERR value is not an integer or out of range")
+
+func emuPing(ks *redisKeyspace, name string, args []string) (interface{}, error) {
+	return "PONG", nil
+}
+
+func emuOK(ks *redisKeyspace, name string, args []string) (interface{}, error) {
+	return "OK", nil
+}
+
+func emuGet(ks *redisKeyspace, name string, args []string) (interface{}, error) {
+	v, err := ks.lookup(args[0], redisEmuString)
+	if err != nil {
+		return nil, err
+	}
+	if v == nil {
+		return nil, redis.Nil
+	}
+	return v.Str, nil
+}
+
+// emuSet handles SET key value [EX seconds|PX milliseconds] [NX|XX] [KEEPTTL].
+func emuSet(ks *redisKeyspace, name string, args []string) (interface{}, error) {
+	var ttl time.Duration
+	var nx, xx, keep bool
+
+	for i := 2; i < len(args); i++ {
+		switch strings.ToLower(args[i]) {
+		case "ex", "px":
+			if i+1 >= len(args) {
+				return nil, errRedisEmuUnsupported
+			}
+			n, err := strconv.ParseInt(args[i+1], 10, 64)
+			if err != nil || n <= 0 {
+				return nil, errRedisEmuUnsupported
+			}
+			ttl = time.Duration(n) * time.Second
+			if strings.ToLower(args[i]) == "px" {
+				ttl = time.Duration(n) * time.Millisecond
+			}
+			i++
+		case "nx":
+			nx = true
+		case "xx":
+			xx = true
+		case "keepttl":
+			keep = true
+		default:
+			return nil, errRedisEmuUnsupported
+		}
+	}
+
+	old := ks.get(args[0])
+	if nx && old != nil || xx && old == nil {
+		return nil, redis.Nil
+	}
+
+	v := &redisEmuValue{Type: redisEmuString, Str: args[1]}
+	if keep && old != nil {
+		v.TTL = old.TTL
+	}
+	if ttl > 0 {
+		v.TTL = ttl
+	}
+
+	ks.set(args[0], v)
+	return "OK", nil
+}
+
+func emuSetNX(ks *redisKeyspace, name string, args []string) (interface{}, error) {
+	if ks.get(args[0]) != nil {
+		return int64(0), nil
+	}
+
+	ks.set(args[0], &redisEmuValue{Type: redisEmuString, Str: args[1]})
+	return int64(1), nil
+}
+
+// emuSetEX handles SETEX key seconds value and PSETEX key milliseconds value.
+func emuSetEX(ks *redisKeyspace, name string, args []string) (interface{}, error) {
+	n, err := strconv.ParseInt(args[1], 10, 64)
+	if err != nil || n <= 0 || len(args) > 3 {
+		return nil, errRedisEmuUnsupported
+	}
+
+	ttl := time.Duration(n) * time.Second
+	if name == "psetex" {
+		ttl = time.Duration(n) * time.Millisecond
+	}
+
+	v := &redisEmuValue{Type: redisEmuString, Str: args[2], TTL: ttl}
+	ks.set(args[0], v)
+	return "OK", nil
+}
+
+func emuMGet(ks *redisKeyspace, name string, args []string) (interface{}, error) {
+	vals := make([]interface{}, 0, len(args))
+	for _, k := range args {
+		v := ks.get(k)
+		if v != nil && v.Type == redisEmuString {
+			vals = append(vals, v.Str)
+		} else {
+			vals = append(vals, nil)
+		}
+	}
+	return vals, nil
+}
+
+func emuMSet(ks *redisKeyspace, name string, args []string) (interface{}, error) {
+	if len(args)%2 != 0 {
+		return nil, errRedisEmuUnsupported
+	}
+
+	for i := 0; i < len(args); i += 2 {
+		ks.set(args[i], &redisEmuValue{Type: redisEmuString, Str: args[i+1]})
+	}
+	return "OK", nil
+}
+
+func (ks *redisKeyspace) incrBy(key string, n int64) (int64, error) {
+	v, err := ks.lookup(key, redisEmuString)
+	if err != nil {
+		return 0, err
+	}
+
+	var cur int64
+	if v != nil {
+		cur, err = strconv.ParseInt(v.Str, 10, 64)
+		if err != nil {
+			return 0, errRedisEmuNotInteger
+		}
+	} else {
+		v = newRedisEmuValue(redisEmuString)
+		ks.set(key, v)
+	}
+
+	cur += n
+	v.Str = strconv.FormatInt(cur, 10)
+	return cur, nil
+}
+
+// emuIncrBy handles INCR, DECR, INCRBY and DECRBY.
+func emuIncrBy(ks *redisKeyspace, name string, args []string) (interface{}, error) {
+	n := int64(1)
+	if len(args) > 1 {
+		var err error
+		n, err = strconv.ParseInt(args[1], 10, 64)
+		if err != nil {
+			return nil, errRedisEmuNotInteger
+		}
+	}
+
+	if name == "decr" || name == "decrby" {
+		n = -n
+	}
+
+	return ks.incrBy(args[0], n)
+}
+
+func emuIncrByFloat(ks *redisKeyspace, name string, args []string) (interface{}, error) {
+	n, err := strconv.ParseFloat(args[1], 64)
+	if err != nil {
+		return nil, redisEmuError("ERR value is not a valid float")
+	}
+
+	v, err := ks.lookup(args[0], redisEmuString)
+	if err != nil {
+		return nil, err
+	}
+
+	var cur float64
+	if v != nil {
+		cur, err = strconv.ParseFloat(v.Str, 64)
+		if err != nil {
+			return nil, redisEmuError("ERR value is not a valid float")
+		}
+	} else {
+		v = newRedisEmuValue(redisEmuString)
+		ks.set(args[0], v)
+	}
+
+	cur += n
+	v.Str = strconv.FormatFloat(cur, 'f', -1, 64)
+	return cur, nil
+}
+
+func emuAppend(ks *redisKeyspace, name string, args []string) (interface{}, error) {
+	v, err := ks.lookupOrCreate(args[0], redisEmuString)
+	if err != nil {
+		return nil, err
+	}
+
+	v.Str += args[1]
+	return int64(len(v.Str)), nil
+}
+
+func emuStrLen(ks *redisKeyspace, name string, args []string) (interface{}, error) {
+	v, err := ks.lookup(args[0], redisEmuString)
+	if err != nil || v == nil {
+		return int64(0), err
+	}
+	return int64(len(v.Str)), nil
+}
+
+func emuDel(ks *redisKeyspace, name string, args []string) (interface{}, error) {
+	n := int64(0)
+	for _, k := range args {
+		if ks.del(k) {
+			n++
+		}
+	}
+	return n, nil
+}
+
+func emuExists(ks *redisKeyspace, name string, args []string) (interface{}, error) {
+	n := int64(0)
+	for _, k := range args {
+		if ks.get(k) != nil {
+			n++
+		}
+	}
+	return n, nil
+}
+
+// emuExpire handles EXPIRE key seconds and PEXPIRE key milliseconds.
+func emuExpire(ks *redisKeyspace, name string, args []string) (interface{}, error) {
+	n, err := strconv.ParseInt(args[1], 10, 64)
+	if err != nil || len(args) > 2 {
+		return nil, errRedisEmuUnsupported
+	}
+
+	v := ks.get(args[0])
+	if v == nil {
+		return int64(0), nil
+	}
+
+	ttl := time.Duration(n) * time.Second
+	if name == "pexpire" {
+		ttl = time.Duration(n) * time.Millisecond
+	}
+
+	if ttl <= 0 {
+		ks.del(args[0])
+	} else {
+		v.TTL = ttl
+	}
+
+	return int64(1), nil
+}
+
+// emuTTL handles TTL and PTTL, results are scaled as DurationCmd does, eg: -2s for missing key.
+// time is frozen, ttl stays as seeded or set by the last write.
+func emuTTL(ks *redisKeyspace, name string, args []string) (interface{}, error) {
+	precision := time.Second
+	if name == "pttl" {
+		precision = time.Millisecond
+	}
+
+	v := ks.get(args[0])
+	if v == nil {
+		return -2 * precision, nil
+	}
+	if v.TTL <= 0 {
+		return -1 * precision, nil
+	}
+
+	return time.Duration(math.Ceil(float64(v.TTL)/float64(precision))) * precision, nil
+}
+
+func emuPersist(ks *redisKeyspace, name string, args []string) (interface{}, error) {
+	v := ks.get(args[0])
+	if v == nil || v.TTL <= 0 {
+		return int64(0), nil
+	}
+
+	v.TTL = 0
+	return int64(1), nil
+}
+
+func emuType(ks *redisKeyspace, name string, args []string) (interface{}, error) {
+	v := ks.get(args[0])
+	if v == nil {
+		return redisEmuNone, nil
+	}
+	return v.Type, nil
+}
+
+func emuHGet(ks *redisKeyspace, name string, args []string) (interface{}, error) {
+	v, err := ks.lookup(args[0], redisEmuHash)
+	if err != nil {
+		return nil, err
+	}
+	if !v.knows(args[1]) {
+		return nil, errRedisEmuUnknown
+	}
+
+	if v != nil {
+		if s, ok := v.Hash[args[1]]; ok {
+			return s, nil
+		}
+	}
+
+	return nil, redis.Nil
+}
+
+// emuHSet handles HSET and HMSET, number of new fields is returned for HSET.
+func emuHSet(ks *redisKeyspace, name string, args []string) (interface{}, error) {
+	if len(args)%2 != 1 {
+		return nil, errRedisEmuUnsupported
+	}
+
+	v, err := ks.lookupOrCreate(args[0], redisEmuHash)
+	if err != nil {
+		return nil, err
+	}
+	if name != "hmset" && !v.knows(redisEmuEvery(args[1:], 2)...) {
+		return nil, errRedisEmuUnknown
+	}
+
+	n := int64(0)
+	for i := 1; i < len(args); i += 2 {
+		if _, ok := v.Hash[args[i]]; !ok {
+			n++
+		}
+		v.Hash[args[i]] = args[i+1]
+	}
+
+	if name == "hmset" {
+		return "OK", nil
+	}
+	return n, nil
+}
+
+func emuHSetNX(ks *redisKeyspace, name string, args []string) (interface{}, error) {
+	v, err := ks.lookupOrCreate(args[0], redisEmuHash)
+	if err != nil {
+		return nil, err
+	}
+	if !v.knows(args[1]) {
+		return nil, errRedisEmuUnknown
+	}
+
+	if _, ok := v.Hash[args[1]]; ok {
+		return int64(0), nil
+	}
+
+	v.Hash[args[1]] = args[2]
+	return int64(1), nil
+}
+
+func emuHMGet(ks *redisKeyspace, name string, args []string) (interface{}, error) {
+	v, err := ks.lookup(args[0], redisEmuHash)
+	if err != nil {
+		return nil, err
+	}
+	if !v.knows(args[1:]...) {
+		return nil, errRedisEmuUnknown
+	}
+
+	vals := make([]interface{}, 0, len(args)-1)
+	for _, f := range args[1:] {
+		if s, ok := v.field(f); ok {
+			vals = append(vals, s)
+		} else {
+			vals = append(vals, nil)
+		}
+	}
+	return vals, nil
+}
+
+func (v *redisEmuValue) field(f string) (string, bool) {
+	if v == nil {
+		return "", false
+	}
+	s, ok := v.Hash[f]
+	return s, ok
+}
+
+func emuHGetAll(ks *redisKeyspace, name string, args []string) (interface{}, error) {
+	v, err := ks.lookup(args[0], redisEmuHash)
+	if err != nil {
+		return nil, err
+	}
+	if !v.knows() {
+		return nil, errRedisEmuUnknown
+	}
+
+	m := make(map[string]string)
+	if v != nil {
+		for f, s := range v.Hash {
+			m[f] = s
+		}
+	}
+	return m, nil
+}
+
+func emuHDel(ks *redisKeyspace, name string, args []string) (interface{}, error) {
+	v, err := ks.lookup(args[0], redisEmuHash)
+	if err != nil || v == nil {
+		return int64(0), err
+	}
+	if !v.knows(args[1:]...) {
+		return nil, errRedisEmuUnknown
+	}
+
+	n := int64(0)
+	for _, f := range args[1:] {
+		if _, ok := v.Hash[f]; ok {
+			delete(v.Hash, f)
+			n++
+		}
+	}
+
+	ks.cleanup(args[0])
+	return n, nil
+}
+
+func emuHExists(ks *redisKeyspace, name string, args []string) (interface{}, error) {
+	v, err := ks.lookup(args[0], redisEmuHash)
+	if err != nil {
+		return nil, err
+	}
+	if !v.knows(args[1]) {
+		return nil, errRedisEmuUnknown
+	}
+
+	if _, ok := v.field(args[1]); ok {
+		return int64(1), nil
+	}
+	return int64(0), nil
+}
+
+func emuHLen(ks *redisKeyspace, name string, args []string) (interface{}, error) {
+	v, err := ks.lookup(args[0], redisEmuHash)
+	if err != nil || v == nil {
+		return int64(0), err
+	}
+	if !v.knows() {
+		return nil, errRedisEmuUnknown
+	}
+	return int64(len(v.Hash)), nil
+}
+
+func emuHIncrBy(ks *redisKeyspace, name string, args []string) (interface{}, error) {
+	n, err := strconv.ParseInt(args[2], 10, 64)
+	if err != nil {
+		return nil, errRedisEmuNotInteger
+	}
+
+	v, err := ks.lookupOrCreate(args[0], redisEmuHash)
+	if err != nil {
+		return nil, err
+	}
+	if !v.knows(args[1]) {
+		return nil, errRedisEmuUnknown
+	}
+
+	var cur int64
+	if s, ok := v.Hash[args[1]]; ok {
+		cur, err = strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return nil, redisEmuError("ERR hash value is not an integer")
+		}
+	}
+
+	cur += n
+	v.Hash[args[1]] = strconv.FormatInt(cur, 10)
+	return cur, nil
+}
+
+// emuHKeys handles HKEYS and HVALS, results are ordered by fields.
+func emuHKeys(ks *redisKeyspace, name string, args []string) (interface{}, error) {
+	v, err := ks.lookup(args[0], redisEmuHash)
+	if err != nil {
+		return nil, err
+	}
+	if !v.knows() {
+		return nil, errRedisEmuUnknown
+	}
+
+	ss := make([]string, 0)
+	if v == nil {
+		return ss, nil
+	}
+
+	fields := make([]string, 0, len(v.Hash))
+	for f := range v.Hash {
+		fields = append(fields, f)
+	}
+	sort.Strings(fields)
+
+	if name == "hkeys" {
+		return fields, nil
+	}
+
+	for _, f := range fields {
+		ss = append(ss, v.Hash[f])
+	}
+	return ss, nil
+}
+
+// emuPush handles LPUSH and RPUSH.
+func emuPush(ks *redisKeyspace, name string, args []string) (interface{}, error) {
+	v, err := ks.lookupOrCreate(args[0], redisEmuList)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, e := range args[1:] {
+		if name == "lpush" {
+			v.List = append([]string{e}, v.List...)
+		} else {
+			v.List = append(v.List, e)
+		}
+	}
+
+	return int64(len(v.List)), nil
+}
+
+// emuPop handles LPOP and RPOP without count.
+func emuPop(ks *redisKeyspace, name string, args []string) (interface{}, error) {
+	if len(args) > 1 {
+		return nil, errRedisEmuUnsupported
+	}
+
+	v, err := ks.lookup(args[0], redisEmuList)
+	if err != nil {
+		return nil, err
+	}
+	if v == nil || len(v.List) == 0 {
+		return nil, redis.Nil
+	}
+
+	var e string
+	if name == "lpop" {
+		e, v.List = v.List[0], v.List[1:]
+	} else {
+		e, v.List = v.List[len(v.List)-1], v.List[:len(v.List)-1]
+	}
+
+	ks.cleanup(args[0])
+	return e, nil
+}
+
+// redisEmuRange converts start and stop to bounds of slice of length n, as LRANGE does.
+func redisEmuRange(start, stop string, n int) (int, int, error) {
+	lo, err := strconv.Atoi(start)
+	if err != nil {
+		return 0, 0, errRedisEmuNotInteger
+	}
+	hi, err := strconv.Atoi(stop)
+	if err != nil {
+		return 0, 0, errRedisEmuNotInteger
+	}
+
+	if lo < 0 {
+		lo += n
+	}
+	if hi < 0 {
+		hi += n
+	}
+	if lo < 0 {
+		lo = 0
+	}
+	if hi >= n {
+		hi = n - 1
+	}
+	if lo > hi {
+		return 0, 0, nil
+	}
+
+	return lo, hi + 1, nil
+}
+
+func emuLRange(ks *redisKeyspace, name string, args []string) (interface{}, error) {
+	v, err := ks.lookup(args[0], redisEmuList)
+	if err != nil {
+		return nil, err
+	}
+
+	ss := make([]string, 0)
+	if v == nil {
+		return ss, nil
+	}
+
+	lo, hi, err := redisEmuRange(args[1], args[2], len(v.List))
+	if err != nil {
+		return nil, err
+	}
+
+	return append(ss, v.List[lo:hi]...), nil
+}
+
+func emuLLen(ks *redisKeyspace, name string, args []string) (interface{}, error) {
+	v, err := ks.lookup(args[0], redisEmuList)
+	if err != nil || v == nil {
+		return int64(0), err
+	}
+	return int64(len(v.List)), nil
+}
+
+func emuLIndex(ks *redisKeyspace, name string, args []string) (interface{}, error) {
+	i, err := strconv.Atoi(args[1])
+	if err != nil {
+		return nil, errRedisEmuNotInteger
+	}
+
+	v, err := ks.lookup(args[0], redisEmuList)
+	if err != nil {
+		return nil, err
+	}
+	if v == nil {
+		return nil, redis.Nil
+	}
+
+	if i < 0 {
+		i += len(v.List)
+	}
+	if i < 0 || i >= len(v.List) {
+		return nil, redis.Nil
+	}
+
+	return v.List[i], nil
+}
+
+func emuSAdd(ks *redisKeyspace, name string, args []string) (interface{}, error) {
+	v, err := ks.lookupOrCreate(args[0], redisEmuSet)
+	if err != nil {
+		return nil, err
+	}
+	if !v.knows(args[1:]...) {
+		return nil, errRedisEmuUnknown
+	}
+
+	n := int64(0)
+	for _, m := range args[1:] {
+		if !v.Set[m] {
+			v.Set[m] = true
+			n++
+		}
+	}
+	return n, nil
+}
+
+func emuSRem(ks *redisKeyspace, name string, args []string) (interface{}, error) {
+	v, err := ks.lookup(args[0], redisEmuSet)
+	if err != nil || v == nil {
+		return int64(0), err
+	}
+	if !v.knows(args[1:]...) {
+		return nil, errRedisEmuUnknown
+	}
+
+	n := int64(0)
+	for _, m := range args[1:] {
+		if v.Set[m] {
+			delete(v.Set, m)
+			n++
+		}
+	}
+
+	ks.cleanup(args[0])
+	return n, nil
+}
+
+// emuSMembers returns members in order, which is unspecified by redis.
+func emuSMembers(ks *redisKeyspace, name string, args []string) (interface{}, error) {
+	v, err := ks.lookup(args[0], redisEmuSet)
+	if err != nil {
+		return nil, err
+	}
+	if !v.knows() {
+		return nil, errRedisEmuUnknown
+	}
+
+	ss := make([]string, 0)
+	if v != nil {
+		for m := range v.Set {
+			ss = append(ss, m)
+		}
+	}
+
+	sort.Strings(ss)
+	return ss, nil
+}
+
+func emuSIsMember(ks *redisKeyspace, name string, args []string) (interface{}, error) {
+	v, err := ks.lookup(args[0], redisEmuSet)
+	if err != nil {
+		return nil, err
+	}
+	if !v.knows(args[1]) {
+		return nil, errRedisEmuUnknown
+	}
+
+	if v != nil && v.Set[args[1]] {
+		return int64(1), nil
+	}
+	return int64(0), nil
+}
+
+func emuSCard(ks *redisKeyspace, name string, args []string) (interface{}, error) {
+	v, err := ks.lookup(args[0], redisEmuSet)
+	if err != nil || v == nil {
+		return int64(0), err
+	}
+	if !v.knows() {
+		return nil, errRedisEmuUnknown
+	}
+	return int64(len(v.Set)), nil
+}
+
+// emuZAdd handles ZADD key score member [score member ...], options like NX/XX/CH/INCR are not supported.
+func emuZAdd(ks *redisKeyspace, name string, args []string) (interface{}, error) {
+	if len(args)%2 != 1 {
+		return nil, errRedisEmuUnsupported
+	}
+
+	scores := make([]float64, 0, len(args)/2)
+	for i := 1; i < len(args); i += 2 {
+		s, err := strconv.ParseFloat(args[i], 64)
+		if err != nil {
+			return nil, errRedisEmuUnsupported
+		}
+		scores = append(scores, s)
+	}
+
+	v, err := ks.lookupOrCreate(args[0], redisEmuZSet)
+	if err != nil {
+		return nil, err
+	}
+	if !v.knows(redisEmuEvery(args[2:], 2)...) {
+		return nil, errRedisEmuUnknown
+	}
+
+	n := int64(0)
+	for i, s := range scores {
+		m := args[2*i+2]
+		if _, ok := v.ZSet[m]; !ok {
+			n++
+		}
+		v.ZSet[m] = s
+	}
+	return n, nil
+}
+
+func emuZRem(ks *redisKeyspace, name string, args []string) (interface{}, error) {
+	v, err := ks.lookup(args[0], redisEmuZSet)
+	if err != nil || v == nil {
+		return int64(0), err
+	}
+	if !v.knows(args[1:]...) {
+		return nil, errRedisEmuUnknown
+	}
+
+	n := int64(0)
+	for _, m := range args[1:] {
+		if _, ok := v.ZSet[m]; ok {
+			delete(v.ZSet, m)
+			n++
+		}
+	}
+
+	ks.cleanup(args[0])
+	return n, nil
+}
+
+func emuZScore(ks *redisKeyspace, name string, args []string) (interface{}, error) {
+	v, err := ks.lookup(args[0], redisEmuZSet)
+	if err != nil {
+		return nil, err
+	}
+	if !v.knows(args[1]) {
+		return nil, errRedisEmuUnknown
+	}
+
+	if v != nil {
+		if s, ok := v.ZSet[args[1]]; ok {
+			return s, nil
+		}
+	}
+	return nil, redis.Nil
+}
+
+func emuZIncrBy(ks *redisKeyspace, name string, args []string) (interface{}, error) {
+	n, err := strconv.ParseFloat(args[1], 64)
+	if err != nil {
+		return nil, redisEmuError("ERR value is not a valid float")
+	}
+
+	v, err := ks.lookupOrCreate(args[0], redisEmuZSet)
+	if err != nil {
+		return nil, err
+	}
+	if !v.knows(args[2]) {
+		return nil, errRedisEmuUnknown
+	}
+
+	v.ZSet[args[2]] += n
+	return v.ZSet[args[2]], nil
+}
+
+func emuZCard(ks *redisKeyspace, name string, args []string) (interface{}, error) {
+	v, err := ks.lookup(args[0], redisEmuZSet)
+	if err != nil || v == nil {
+		return int64(0), err
+	}
+	if !v.knows() {
+		return nil, errRedisEmuUnknown
+	}
+	return int64(len(v.ZSet)), nil
+}
+
+// emuZRange handles ZRANGE and ZREVRANGE with optional WITHSCORES.
+func emuZRange(ks *redisKeyspace, name string, args []string) (interface{}, error) {
+	withScores := false
+	if len(args) == 4 && strings.ToLower(args[3]) == "withscores" {
+		withScores = true
+	} else if len(args) > 3 {
+		return nil, errRedisEmuUnsupported
+	}
+
+	v, err := ks.lookup(args[0], redisEmuZSet)
+	if err != nil {
+		return nil, err
+	}
+	if !v.knows() {
+		return nil, errRedisEmuUnknown
+	}
+
+	zs := make([]redis.Z, 0)
+	if v != nil {
+		for m, s := range v.ZSet {
+			zs = append(zs, redis.Z{Score: s, Member: m})
+		}
+	}
+
+	rev := name == "zrevrange"
+	sort.Slice(zs, func(i, j int) bool {
+		if zs[i].Score != zs[j].Score {
+			return zs[i].Score < zs[j].Score != rev
+		}
+		return zs[i].Member.(string) < zs[j].Member.(string) != rev
+	})
+
+	lo, hi, err := redisEmuRange(args[1], args[2], len(zs))
+	if err != nil {
+		return nil, err
+	}
+	zs = zs[lo:hi]
+
+	if withScores {
+		return zs, nil
+	}
+
+	ss := make([]string, 0, len(zs))
+	for _, z := range zs {
+		ss = append(ss, z.Member.(string))
+	}
+	return ss, nil
+}
@@ -0,0 +1,239 @@
+package gorr
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis"
+	"github.com/stretchr/testify/assert"
+)
+
+// redisEmuStep is a cmd run against emulator, val and err are ignored if cmd is not expected to be emulated.
+type redisEmuStep struct {
+	cmd      string
+	val      interface{}
+	err      string
+	emulated bool
+}
+
+func runRedisEmuStep(ks *redisKeyspace, s string) (interface{}, error, bool) {
+	args := strings.Fields(s)
+	name, args := args[0], args[1:]
+
+	c, keys, ok := ks.check(name, args)
+	if !ok {
+		ks.invalidate(c, keys)
+		return nil, nil, false
+	}
+
+	val, err := c.fn(ks, name, args)
+	if err == errRedisEmuUnsupported || err == errRedisEmuUnknown {
+		ks.invalidate(c, keys)
+		return nil, nil, false
+	}
+
+	return val, err, true
+}
+
+func TestRedisEmulatorCmds(t *testing.T) {
+	enableRegressionEngine(RegressionReplay)
+	GlobalMgr.SetStorage(NewMapStorage(100))
+
+	tests := []struct {
+		name  string
+		seeds map[string]*redisEmuValue
+		steps []redisEmuStep
+	}{
+		{
+			name: "ttl",
+			seeds: map[string]*redisEmuValue{
+				"k":       {Type: redisEmuString, Str: "v", TTL: 100 * time.Second},
+				"missing": {Type: redisEmuNone},
+			},
+			steps: []redisEmuStep{
+				{"ttl k", 100 * time.Second, "", true},
+				{"pttl k", 100 * time.Second, "", true},
+				{"append k !", int64(2), "", true},
+				{"ttl k", 100 * time.Second, "", true},
+				{"set k x", "OK", "", true},
+				{"ttl k", -1 * time.Second, "", true},
+				{"set k y ex 10", "OK", "", true},
+				{"set k z keepttl", "OK", "", true},
+				{"ttl k", 10 * time.Second, "", true},
+				{"persist k", int64(1), "", true},
+				{"persist k", int64(0), "", true},
+				{"pttl k", -1 * time.Millisecond, "", true},
+				{"psetex k 1500 v", "OK", "", true},
+				{"pttl k", 1500 * time.Millisecond, "", true},
+				{"ttl k", 2 * time.Second, "", true},
+				{"expire k 0", int64(1), "", true},
+				{"get k", nil, "redis: nil", true},
+				{"ttl missing", -2 * time.Second, "", true},
+				{"expire missing 10", int64(0), "", true},
+			},
+		},
+		{
+			name:  "list",
+			seeds: map[string]*redisEmuValue{"q": {Type: redisEmuList, List: []string{"a", "b", "c", "d"}}},
+			steps: []redisEmuStep{
+				{"lrange q 0 -1", []string{"a", "b", "c", "d"}, "", true},
+				{"lrange q -2 -1", []string{"c", "d"}, "", true},
+				{"lrange q -100 1", []string{"a", "b"}, "", true},
+				{"lrange q 2 1", []string{}, "", true},
+				{"lrange q 5 10", []string{}, "", true},
+				{"lrange q x 1", nil, "ERR value is not an integer or out of range", true},
+				{"lindex q -1", "d", "", true},
+				{"lindex q -5", nil, "redis: nil", true},
+				{"lindex q 4", nil, "redis: nil", true},
+				{"get q", nil, "WRONGTYPE Operation against a key holding the wrong kind of value", true},
+				{"lpop q", "a", "", true},
+				{"rpop q", "d", "", true},
+				{"lpush q x y", int64(4), "", true},
+				{"lrange q 0 -1", []string{"y", "x", "b", "c"}, "", true},
+				{"lpop q 2", nil, "", false},
+				{"llen q", nil, "", false},
+				{"lpush q z", nil, "", false},
+			},
+		},
+		{
+			name:  "list popped empty",
+			seeds: map[string]*redisEmuValue{"q": {Type: redisEmuList, List: []string{"a"}}},
+			steps: []redisEmuStep{
+				{"rpop q", "a", "", true},
+				{"exists q", int64(0), "", true},
+				{"lpop q", nil, "redis: nil", true},
+				{"llen q", int64(0), "", true},
+				{"rpush q b", int64(1), "", true},
+				{"lindex q 0", "b", "", true},
+			},
+		},
+		{
+			name:  "set",
+			seeds: map[string]*redisEmuValue{"s": {Type: redisEmuSet, Set: map[string]bool{"m1": true, "m2": true}}},
+			steps: []redisEmuStep{
+				{"sadd s m2 m3", int64(1), "", true},
+				{"srem s m1 m9", int64(1), "", true},
+				{"smembers s", []string{"m2", "m3"}, "", true},
+				{"scard s", int64(2), "", true},
+				{"sismember s m2", int64(1), "", true},
+				{"sismember s m1", int64(0), "", true},
+				{"srem s m2 m3", int64(2), "", true},
+				{"exists s", int64(0), "", true},
+				{"smembers s", []string{}, "", true},
+			},
+		},
+		{
+			name:  "partial set",
+			seeds: map[string]*redisEmuValue{"s": {Type: redisEmuSet, Set: map[string]bool{"m1": true}, Partial: true}},
+			steps: []redisEmuStep{
+				{"sismember s m1", int64(1), "", true},
+				{"sismember s m2", nil, "", false},
+				{"smembers s", nil, "", false},
+				{"scard s", nil, "", false},
+			},
+		},
+		{
+			name:  "partial set written",
+			seeds: map[string]*redisEmuValue{"s": {Type: redisEmuSet, Set: map[string]bool{"m1": true}, Partial: true}},
+			steps: []redisEmuStep{
+				{"srem s m1", int64(1), "", true},
+				{"exists s", int64(1), "", true},
+				// members removed from partial value are unknown again.
+				{"sismember s m1", nil, "", false},
+				{"sadd s m1", nil, "", false},
+			},
+		},
+		{
+			name:  "zset",
+			seeds: map[string]*redisEmuValue{"z": {Type: redisEmuZSet, ZSet: map[string]float64{"a": 1, "b": 2, "c": 2}}},
+			steps: []redisEmuStep{
+				{"zrange z 0 -1", []string{"a", "b", "c"}, "", true},
+				{"zrevrange z 0 0", []string{"c"}, "", true},
+				{"zrange z -2 -1 withscores", []redis.Z{{Score: 2, Member: "b"}, {Score: 2, Member: "c"}}, "", true},
+				{"zrange z 3 -1", []string{}, "", true},
+				{"zrange z 0 -1 limit", nil, "", false},
+			},
+		},
+		{
+			name:  "zset written",
+			seeds: map[string]*redisEmuValue{"z": {Type: redisEmuZSet, ZSet: map[string]float64{"a": 1, "b": 2}}},
+			steps: []redisEmuStep{
+				{"zincrby z 5 a", float64(6), "", true},
+				{"zscore z a", float64(6), "", true},
+				{"zscore z x", nil, "redis: nil", true},
+				{"zincrby z x a", nil, "ERR value is not a valid float", true},
+				{"zadd z 0 d 3 b", int64(1), "", true},
+				{"zrevrange z 0 -1", []string{"a", "b", "d"}, "", true},
+				{"zrem z a b d x", int64(3), "", true},
+				{"zcard z", int64(0), "", true},
+				{"exists z", int64(0), "", true},
+			},
+		},
+		{
+			name:  "partial zset",
+			seeds: map[string]*redisEmuValue{"z": {Type: redisEmuZSet, ZSet: map[string]float64{"a": 1}, Partial: true}},
+			steps: []redisEmuStep{
+				{"zscore z a", float64(1), "", true},
+				{"zincrby z 1 a", float64(2), "", true},
+				{"zscore z b", nil, "", false},
+				{"zcard z", nil, "", false},
+				{"zrange z 0 -1", nil, "", false},
+			},
+		},
+		{
+			name:  "partial hash",
+			seeds: map[string]*redisEmuValue{"h": {Type: redisEmuHash, Hash: map[string]string{"f1": "v1"}, Partial: true}},
+			steps: []redisEmuStep{
+				{"hget h f1", "v1", "", true},
+				{"hget h f2", nil, "", false},
+				{"hlen h", nil, "", false},
+				{"hgetall h", nil, "", false},
+			},
+		},
+		{
+			name: "not seeded",
+			steps: []redisEmuStep{
+				{"get k", nil, "", false},
+				{"lrange q 0 -1", nil, "", false},
+				{"set k v", "OK", "", true},
+				{"get k", "v", "", true},
+				{"ttl k", -1 * time.Second, "", true},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			redisEmuLock.Lock()
+			defer redisEmuLock.Unlock()
+
+			ks := getRedisKeyspace("emulator_test_" + tt.name)
+			for k, v := range tt.seeds {
+				data, err := json.Marshal(v)
+				assert.Nil(t, err)
+				assert.Nil(t, GlobalMgr.StoreValue(ks.seedKey(k), data))
+			}
+
+			for _, s := range tt.steps {
+				val, err, ok := runRedisEmuStep(ks, s.cmd)
+				assert.Equal(t, s.emulated, ok, s.cmd)
+				if !s.emulated {
+					continue
+				}
+
+				if len(s.err) > 0 {
+					assert.NotNil(t, err, s.cmd)
+					if err != nil {
+						assert.Equal(t, s.err, err.Error(), s.cmd)
+					}
+					continue
+				}
+
+				assert.Nil(t, err, s.cmd)
+				assert.Equal(t, s.val, val, s.cmd)
+			}
+		})
+	}
+}
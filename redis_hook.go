@@ -3,6 +3,7 @@ package gorr
 import (
 	"fmt"
 	"reflect"
+	"time"
 
 	"github.com/brahma-adshonor/gohook"
 	"github.com/go-redis/redis"
@@ -31,10 +32,14 @@ hook point:
 1. Client.Process()/ClusterClient.Process: for recoding/replaying cmd
 2. Client.WrapProcess(): for go redis < 6.15.1, Client.Process() is not available.
 3. NewClient()/NewRedisClient(): used to call WrapProcess()/AdHook() on client objects.
-4. IntCmd/StringCmd/FloatCmd/SliceCmd/StatusCmd/etc: hook Result()/Val() method.
-5. Client.WrapPipelineProcess()/ClusterClient.WrapPipelineProcess(): for go redis < 6.15.1, used to intercept queued cmds.
+4. IntCmd/StringCmd/FloatCmd/SliceCmd/StatusCmd/etc: hook Result()/Val() method, and getters converting reply of Cmd/StringCmd, eg: Int64()/Scan().
+5. Client.WrapPipelineProcess()/ClusterClient.WrapPipelineProcess(): for go redis < 6.15.1, used to intercept queued cmds, including cmds of TxPipeline.
 6. hook added by Client.AddHook()/ClusterClient.AdHook(): for go redis > 6.15.1, used to intercept pipeline cmd.
 7. Pipeline.Exec()/Pipeline.ExecContext(): used to ignore dummy error from hook added by AdHook()
+8. Client.Watch(): used to wrap processors of Tx, see redis_tx_hook.go.
+9. PubSub.Subscribe()/PubSub.ReceiveTimeout()/etc: for recording/replaying messages of subscriptions, see redis_pubsub_hook.go.
+
+cmds can also be replayed by an in-memory emulator seeded from recorded reads, see redis_emulator.go.
 */
 
 // client.Process wrapper
@@ -48,14 +53,20 @@ func clientProcessWrapper(c *redis.Client, oldProcess func(cmd redis.Cmder) erro
 		GlobalMgr.notifier("calling client.ProcessWrapper", key, []byte(""))
 
 		if GlobalMgr.ShouldRecord() {
+			start := time.Now()
 			err = oldProcess(cmd)
 			if err != nil && err != redis.Nil {
-				GlobalMgr.notifier("redis Client.Process() wrapper recording failed", key, []byte(err.Error()))
-				return err
+				GlobalMgr.notifier("redis Client.Process() wrapper recording error", key, []byte(err.Error()))
 			}
 			saveRedisCmdValue(key, cmd)
+			seedRedisEmulator(id, cmd)
+			saveRedisCmdElapsed(key, cmd, time.Since(start))
+		} else if ok, err2 := emulateRedisCmd(id, cmd); ok {
+			err = err2
 		} else {
+			replayRedisCmdElapsed(key, cmd)
 			addKeyToRedisCmd(cmd, key)
+			err = replayRedisCmdErr(cmd, key)
 		}
 
 		return err
@@ -90,7 +101,13 @@ func newRedisClient(opt *redis.Options) *redis.Client {
 			GlobalMgr.notifier("cannot call redis.WrapProcess()", "should not hook redis.NewClient()", []byte(""))
 		}
 
+		// processor of pipeline is wrapped first, then processor of tx pipeline.
+		n := 0
 		wrap2 := func(old func([]redis.Cmder) error) func([]redis.Cmder) error {
+			n++
+			if n > 1 {
+				return clientTxPipelineProcessWrapper(c, old)
+			}
 			return clientPipelineProcessWrapper(c, old)
 		}
 
@@ -137,7 +154,12 @@ func newRedisClusterClient(opt *redis.ClusterOptions) *redis.ClusterClient {
 	}
 
 	if redisHasProcessWrap {
+		n := 0
 		wrap2 := func(old func([]redis.Cmder) error) func([]redis.Cmder) error {
+			n++
+			if n > 1 {
+				return clusterClientTxPipelineProcessWrapper(c, old)
+			}
 			return clusterClientPipelineProcessWrapper(c, old)
 		}
 
@@ -185,14 +207,20 @@ func redisClientProcess(c *redis.Client, cmd redis.Cmder) error {
 	key := buildRedisCmdKey(id, cmd)
 
 	if GlobalMgr.ShouldRecord() {
+		start := time.Now()
 		err = redisClientProcessTrampoline(c, cmd)
 		if err != nil && err != redis.Nil {
-			GlobalMgr.notifier("redis Client.Process() recording failed", key, []byte(err.Error()))
-			return err
+			GlobalMgr.notifier("redis Client.Process() recording error", key, []byte(err.Error()))
 		}
 		saveRedisCmdValue(key, cmd)
+		seedRedisEmulator(id, cmd)
+		saveRedisCmdElapsed(key, cmd, time.Since(start))
+	} else if ok, err2 := emulateRedisCmd(id, cmd); ok {
+		err = err2
 	} else {
+		replayRedisCmdElapsed(key, cmd)
 		addKeyToRedisCmd(cmd, key)
+		err = replayRedisCmdErr(cmd, key)
 	}
 
 	return err
@@ -222,14 +250,20 @@ func redisClusterClientProcess(c *redis.ClusterClient, cmd redis.Cmder) error {
 	key := buildRedisCmdKey(id, cmd)
 
 	if GlobalMgr.ShouldRecord() {
+		start := time.Now()
 		err = redisClusterClientProcessTrampoline(c, cmd)
 		if err != nil && err != redis.Nil {
-			GlobalMgr.notifier("redis ClusterClient.Process() recording failed", key, []byte(err.Error()))
-			return err
+			GlobalMgr.notifier("redis ClusterClient.Process() recording error", key, []byte(err.Error()))
 		}
 		saveRedisCmdValue(key, cmd)
+		seedRedisEmulator(id, cmd)
+		saveRedisCmdElapsed(key, cmd, time.Since(start))
+	} else if ok, err2 := emulateRedisCmd(id, cmd); ok {
+		err = err2
 	} else {
+		replayRedisCmdElapsed(key, cmd)
 		addKeyToRedisCmd(cmd, key)
+		err = replayRedisCmdErr(cmd, key)
 	}
 
 	return err
@@ -270,12 +304,71 @@ var (
 		CmdValue{&redis.StringCmd{}, "Result", stringCmdResult, nil},
 		CmdValue{&redis.StatusCmd{}, "Result", statusCmdResult, nil},
 		CmdValue{&redis.StringSliceCmd{}, "Result", stringSliceCmdResult, nil},
+		CmdValue{&redis.IntCmd{}, "Result", intCmdResult, nil},
+		CmdValue{&redis.FloatCmd{}, "Result", floatCmdResult, nil},
+		CmdValue{&redis.BoolCmd{}, "Val", boolCmdValue, nil},
+		CmdValue{&redis.BoolCmd{}, "Result", boolCmdResult, nil},
+		CmdValue{&redis.StringCmd{}, "Bytes", stringCmdBytes, nil},
+		CmdValue{&redis.StringCmd{}, "Int", stringCmdInt, nil},
+		CmdValue{&redis.StringCmd{}, "Int64", stringCmdInt64, nil},
+		CmdValue{&redis.StringCmd{}, "Uint64", stringCmdUint64, nil},
+		CmdValue{&redis.StringCmd{}, "Float32", stringCmdFloat32, nil},
+		CmdValue{&redis.StringCmd{}, "Float64", stringCmdFloat64, nil},
+		CmdValue{&redis.StringCmd{}, "Scan", stringCmdScan, stringCmdScanTrampoline},
+
+		// cmds stored with type tag
+		CmdValue{&redis.Cmd{}, "Val", cmdValue, nil},
+		CmdValue{&redis.Cmd{}, "Result", cmdResult, nil},
+		CmdValue{&redis.Cmd{}, "String", cmdString, nil},
+		CmdValue{&redis.Cmd{}, "Int", cmdInt, nil},
+		CmdValue{&redis.Cmd{}, "Int64", cmdInt64, nil},
+		CmdValue{&redis.Cmd{}, "Uint64", cmdUint64, nil},
+		CmdValue{&redis.Cmd{}, "Float32", cmdFloat32, nil},
+		CmdValue{&redis.Cmd{}, "Float64", cmdFloat64, nil},
+		CmdValue{&redis.Cmd{}, "Bool", cmdBool, nil},
+		CmdValue{&redis.SliceCmd{}, "Val", sliceCmdValue, nil},
+		CmdValue{&redis.SliceCmd{}, "Result", sliceCmdResult, nil},
+		CmdValue{&redis.DurationCmd{}, "Val", durationCmdValue, nil},
+		CmdValue{&redis.DurationCmd{}, "Result", durationCmdResult, nil},
+		CmdValue{&redis.TimeCmd{}, "Val", timeCmdValue, nil},
+		CmdValue{&redis.TimeCmd{}, "Result", timeCmdResult, nil},
+		CmdValue{&redis.BoolSliceCmd{}, "Val", boolSliceCmdValue, nil},
+		CmdValue{&redis.BoolSliceCmd{}, "Result", boolSliceCmdResult, nil},
+		CmdValue{&redis.StringStringMapCmd{}, "Val", stringStringMapCmdValue, nil},
+		CmdValue{&redis.StringStringMapCmd{}, "Result", stringStringMapCmdResult, nil},
+		CmdValue{&redis.StringIntMapCmd{}, "Val", stringIntMapCmdValue, nil},
+		CmdValue{&redis.StringIntMapCmd{}, "Result", stringIntMapCmdResult, nil},
+		CmdValue{&redis.StringStructMapCmd{}, "Val", stringStructMapCmdValue, nil},
+		CmdValue{&redis.StringStructMapCmd{}, "Result", stringStructMapCmdResult, nil},
+		CmdValue{&redis.XMessageSliceCmd{}, "Val", xMessageSliceCmdValue, nil},
+		CmdValue{&redis.XMessageSliceCmd{}, "Result", xMessageSliceCmdResult, nil},
+		CmdValue{&redis.XStreamSliceCmd{}, "Val", xStreamSliceCmdValue, nil},
+		CmdValue{&redis.XStreamSliceCmd{}, "Result", xStreamSliceCmdResult, nil},
+		CmdValue{&redis.XPendingCmd{}, "Val", xPendingCmdValue, nil},
+		CmdValue{&redis.XPendingCmd{}, "Result", xPendingCmdResult, nil},
+		CmdValue{&redis.XPendingExtCmd{}, "Val", xPendingExtCmdValue, nil},
+		CmdValue{&redis.XPendingExtCmd{}, "Result", xPendingExtCmdResult, nil},
+		CmdValue{&redis.ZSliceCmd{}, "Val", zSliceCmdValue, nil},
+		CmdValue{&redis.ZSliceCmd{}, "Result", zSliceCmdResult, nil},
+		CmdValue{&redis.ZWithKeyCmd{}, "Val", zWithKeyCmdValue, nil},
+		CmdValue{&redis.ZWithKeyCmd{}, "Result", zWithKeyCmdResult, nil},
+		CmdValue{&redis.ScanCmd{}, "Val", scanCmdValue, nil},
+		CmdValue{&redis.ScanCmd{}, "Result", scanCmdResult, nil},
+		CmdValue{&redis.ClusterSlotsCmd{}, "Val", clusterSlotsCmdValue, nil},
+		CmdValue{&redis.ClusterSlotsCmd{}, "Result", clusterSlotsCmdResult, nil},
+		CmdValue{&redis.GeoLocationCmd{}, "Val", geoLocationCmdValue, nil},
+		CmdValue{&redis.GeoLocationCmd{}, "Result", geoLocationCmdResult, nil},
+		CmdValue{&redis.GeoPosCmd{}, "Val", geoPosCmdValue, nil},
+		CmdValue{&redis.GeoPosCmd{}, "Result", geoPosCmdResult, nil},
+		CmdValue{&redis.CommandsInfoCmd{}, "Val", commandsInfoCmdValue, nil},
+		CmdValue{&redis.CommandsInfoCmd{}, "Result", commandsInfoCmdResult, nil},
 	}
 )
 
 func UnHookRedisFunc() error {
 	var c1 redis.Client
 	var c2 redis.ClusterClient
+	var ps redis.PubSub
 
 	var pl redis.Pipeline
 
@@ -303,6 +396,27 @@ func UnHookRedisFunc() error {
 		msg += fmt.Sprintf("unhook redis.NewClusterClient() failed:%s@@", err13.Error())
 	}
 
+	err14 := gohook.UnHookMethod(&c1, "Watch")
+	if err14 != nil {
+		msg += fmt.Sprintf("unhook redis.Client.Watch failed:%s@@", err14.Error())
+	}
+
+	for _, h := range []struct {
+		target interface{}
+		fn     string
+	}{
+		{&ps, "Subscribe"}, {&ps, "PSubscribe"}, {&ps, "ReceiveTimeout"}, {&ps, "Close"},
+	} {
+		err := gohook.UnHookMethod(h.target, h.fn)
+		if err != nil {
+			msg += fmt.Sprintf("unhook %s() for %s failed, err:%s@@", h.fn, reflect.TypeOf(h.target).Elem().Name(), err.Error())
+		}
+	}
+
+	for _, c := range redisPubSubReplayHooks {
+		gohook.UnHookMethod(c.cmd, c.fn)
+	}
+
 	err2 := gohook.UnHookMethod(&c2, "Process")
 	if err2 != nil {
 		msg += fmt.Sprintf("unhook redis.ClusterClient.Process failed:%s@@", err2.Error())
@@ -331,6 +445,7 @@ func HookRedisFunc() error {
 	var err error
 	var c1 redis.Client
 	var c2 redis.ClusterClient
+	var ps redis.PubSub
 
 	var pl redis.Pipeline
 
@@ -345,6 +460,11 @@ func HookRedisFunc() error {
 		return fmt.Errorf("hook redis.Client.Process() failed, err:%s", err.Error())
 	}
 
+	err = gohook.HookMethod(&c1, "Watch", redisClientWatch, redisClientWatchTrampoline)
+	if err != nil {
+		return fmt.Errorf("hook redis.Client.Watch() failed, err:%s", err.Error())
+	}
+
 	err = gohook.Hook(redis.NewClient, newRedisClient, newRedisClientTrampoline)
 	if err != nil {
 		GlobalMgr.notifier("hook redis.NewClient() failed", err.Error(), []byte(""))
@@ -373,6 +493,14 @@ func HookRedisFunc() error {
 		}
 	}
 
+	err = hookRedisPubSub(&ps)
+	if err != nil {
+		return err
+	}
+
+	resetRedisSeq()
+	resetRedisEmulator()
+
 	if !GlobalMgr.ShouldRecord() {
 		// replay
 		for _, c := range cmd {
@@ -388,6 +516,13 @@ func HookRedisFunc() error {
 				return fmt.Errorf("unhook %s() for %s failed, err:%s@@", c.fn, v.Type().Name(), err.Error())
 			}
 		}
+
+		for _, c := range redisPubSubReplayHooks {
+			err = gohook.HookMethod(c.cmd, c.fn, c.replace, nil)
+			if err != nil {
+				return fmt.Errorf("hook redis.PubSub.%s() failed, err:%s", c.fn, err.Error())
+			}
+		}
 	}
 
 	return nil
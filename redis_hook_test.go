@@ -2,13 +2,19 @@ package gorr
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"github.com/brahma-adshonor/gohook"
 	"github.com/go-redis/redis"
 	"github.com/stretchr/testify/assert"
+	"io"
+	"math"
+	"net"
 	"reflect"
+	"strings"
 	"testing"
 	"time"
+	"unsafe"
 )
 
 var (
@@ -16,6 +22,7 @@ var (
 	redisFloatValue       = 93.334
 	redisStringValue      = "foo redis value"
 	redisStringSliceValue = []string{"foo redis value", "foo redis value22", "miliao"}
+	redisZSliceValue      = []redis.Z{{Score: 1, Member: "m1"}, {Score: 2, Member: "m2"}}
 )
 
 func stringCmdHookVal(cmd *redis.StringCmd) string {
@@ -68,6 +75,16 @@ func floatCmdHookResult(cmd *redis.FloatCmd) (float64, error) {
 	return float64(redisFloatValue), nil
 }
 
+func zSliceCmdHookResult(cmd *redis.ZSliceCmd) ([]redis.Z, error) {
+	fmt.Println("calling hook for testing ZSliceCmd.Result()")
+	return redisZSliceValue, nil
+}
+
+func stringCmdHookErrResult(cmd *redis.StringCmd) (string, error) {
+	fmt.Println("calling hook for testing StringCmd.Result() with error")
+	return "", reflect.ValueOf("WRONGTYPE Operation against a key holding the wrong kind of value").Convert(redisErrorType).Interface().(error)
+}
+
 func clientProcessTramplineHook(c *redis.Client, cmd redis.Cmder) error {
 	fmt.Println("calling hook for testing client.Process()")
 	return nil
@@ -316,6 +333,14 @@ func TestStringCmd(t *testing.T) {
 	assert.Equal(t, redisStoredString, val1)
 	assert.Equal(t, redisStoredString, val2)
 
+	data, err6 := cmd1.Bytes()
+	assert.Nil(t, err6)
+	assert.Equal(t, []byte(redisStoredString), data)
+
+	var val3 string
+	assert.Nil(t, cmd1.Scan(&val3))
+	assert.Equal(t, redisStoredString, val3)
+
 	{
 		pp2 := c2.Pipeline()
 		if redisHasHook {
@@ -595,3 +620,592 @@ func TestStringSliceCmd(t *testing.T) {
 	assert.Equal(t, redisStringSliceValueStored, ret)
 	redisStringSliceValue = redisStringSliceValueStored
 }
+
+func TestRedisCmdValue(t *testing.T) {
+	GlobalMgr.SetStorage(NewMapStorage(100))
+
+	evalValue := []interface{}{int64(1), "foo", nil, []interface{}{int64(2), "bar"}, redisReplyError("ERR bad")}
+	saveRedisCmdValue("eval", redis.NewCmdResult(evalValue, nil))
+	v1, err1 := cmdResult(redis.NewCmd("eval"))
+	assert.Nil(t, err1)
+	assert.Equal(t, evalValue, v1)
+
+	saveRedisCmdValue("mget", redis.NewSliceResult([]interface{}{"a", nil}, nil))
+	assert.Equal(t, []interface{}{"a", nil}, sliceCmdValue(redis.NewSliceCmd("mget")))
+
+	hash := map[string]string{"f1": "v1", "f2": "v2"}
+	saveRedisCmdValue("hgetall", redis.NewStringStringMapResult(hash, nil))
+	assert.Equal(t, hash, stringStringMapCmdValue(redis.NewStringStringMapCmd("hgetall")))
+
+	zs := []redis.Z{{Score: 1.5, Member: "m1"}, {Score: 2, Member: "m2"}, {Score: math.Inf(-1), Member: "m3"}, {Score: math.Inf(1), Member: "m4"}}
+	saveRedisCmdValue("zrange", redis.NewZSliceCmdResult(zs, nil))
+	assert.Equal(t, zs, zSliceCmdValue(redis.NewZSliceCmd("zrange")))
+
+	saveRedisCmdValue("eval_inf", redis.NewCmdResult([]interface{}{math.Inf(-1), 1.5}, nil))
+	assert.Equal(t, []interface{}{math.Inf(-1), 1.5}, cmdValue(redis.NewCmd("eval_inf")))
+
+	// getters converting reply
+	saveRedisCmdValue("eval_num", redis.NewCmdResult("23", nil))
+	n1, err4 := cmdInt64(redis.NewCmd("eval_num"))
+	assert.Nil(t, err4)
+	assert.Equal(t, int64(23), n1)
+	f1, _ := cmdFloat64(redis.NewCmd("eval_num"))
+	assert.Equal(t, float64(23), f1)
+	_, err5 := cmdBool(redis.NewCmd("eval"))
+	assert.NotNil(t, err5)
+
+	saveRedisCmdValue("get_num", redis.NewStringResult("42", nil))
+	n2, err6 := stringCmdInt64(redis.NewStringCmd("get_num"))
+	assert.Nil(t, err6)
+	assert.Equal(t, int64(42), n2)
+
+	saveRedisCmdValue("get_nil", redis.NewStringResult("", redis.Nil))
+	_, err7 := stringCmdUint64(redis.NewStringCmd("get_nil"))
+	assert.Equal(t, redis.Nil, err7)
+
+	saveRedisCmdValue("scan", redis.NewScanCmdResult([]string{"k1", "k2"}, 233, nil))
+	keys, cursor := scanCmdValue(redis.NewScanCmd(nil, "scan"))
+	assert.Equal(t, []string{"k1", "k2"}, keys)
+	assert.Equal(t, uint64(233), cursor)
+
+	saveRedisCmdValue("ttl", redis.NewDurationResult(3*time.Second, nil))
+	assert.Equal(t, 3*time.Second, durationCmdValue(redis.NewDurationCmd(time.Second, "ttl")))
+
+	saveRedisCmdValue("bools", redis.NewBoolSliceResult([]bool{true, false}, nil))
+	assert.Equal(t, []bool{true, false}, boolSliceCmdValue(redis.NewBoolSliceCmd("bools")))
+
+	geo := []redis.GeoLocation{{Name: "p1", Longitude: 13.3, Latitude: 38.1, Dist: 1.5}}
+	saveRedisCmdValue("georadius", redis.NewGeoLocationCmdResult(geo, nil))
+	assert.Equal(t, geo, geoLocationCmdValue(redis.NewGeoLocationCmd(&redis.GeoRadiusQuery{}, "georadius")))
+
+	// redis.Nil is stored as empty value
+	saveRedisCmdValue("hgetall_nil", redis.NewStringStringMapResult(nil, redis.Nil))
+	_, err2 := stringStringMapCmdResult(redis.NewStringStringMapCmd("hgetall_nil"))
+	assert.Equal(t, redis.Nil, err2)
+
+	// type tag is checked
+	_, err3 := stringIntMapCmdResult(redis.NewStringIntMapCmd("hgetall"))
+	assert.NotNil(t, err3)
+}
+
+func TestZSliceCmd(t *testing.T) {
+	setupRedisHook(t)
+
+	defer func() {
+		UnHookRedisFunc()
+	}()
+
+	var zc redis.ZSliceCmd
+	err := gohook.HookMethod(&zc, "Result", zSliceCmdHookResult, nil)
+	assert.Nil(t, err)
+
+	c := redis.NewClient(&redis.Options{
+		Addr:        "127.0.0.0:2335",
+		DialTimeout: time.Duration(222) * time.Second,
+		ReadTimeout: time.Duration(333) * time.Second,
+	})
+
+	c.ZRangeWithScores("miliao-zset", 0, -1)
+
+	gohook.UnHookMethod(&zc, "Result")
+	gohook.UnHook(redisClientProcessTrampoline)
+	UnHookRedisFunc()
+
+	GlobalMgr.SetState(RegressionReplay)
+	err2 := HookRedisFunc()
+	assert.Nil(t, err2)
+
+	cmd := c.ZRangeWithScores("miliao-zset", 0, -1)
+	ret, err3 := cmd.Result()
+	assert.Nil(t, err3)
+	assert.Equal(t, redisZSliceValue, ret)
+	assert.Equal(t, redisZSliceValue, cmd.Val())
+}
+
+func TestRedisCmdErr(t *testing.T) {
+	errs := []error{
+		reflect.ValueOf("MOVED 3999 127.0.0.1:6381").Convert(redisErrorType).Interface().(error),
+		&redisNetError{msg: "i/o timeout", timeout: true},
+		&redisNetError{msg: "connection refused"},
+		io.EOF,
+		errors.New("redis: connection pool timeout"),
+		context.DeadlineExceeded,
+	}
+
+	for _, e := range errs {
+		err := newRedisCmdErr(e).error(redisErrorType)
+		assert.Equal(t, e, err)
+		assert.Equal(t, reflect.TypeOf(e), reflect.TypeOf(err))
+	}
+
+	cmd := redis.NewStringCmd("get", "foo")
+	setRedisCmdErr(cmd, io.EOF)
+	assert.Equal(t, io.EOF, cmd.Err())
+
+	setupRedisHook(t)
+
+	defer func() {
+		UnHookRedisFunc()
+	}()
+
+	var sc redis.StringCmd
+	err := gohook.HookMethod(&sc, "Result", stringCmdHookErrResult, nil)
+	assert.Nil(t, err)
+
+	c := redis.NewClient(&redis.Options{
+		Addr:        "127.0.0.0:2336",
+		DialTimeout: time.Duration(222) * time.Second,
+		ReadTimeout: time.Duration(333) * time.Second,
+	})
+
+	c.Get("miliao-hash")
+
+	gohook.UnHookMethod(&sc, "Result")
+	gohook.UnHook(redisClientProcessTrampoline)
+	UnHookRedisFunc()
+
+	GlobalMgr.SetState(RegressionReplay)
+	err2 := HookRedisFunc()
+	assert.Nil(t, err2)
+
+	cmd2 := c.Get("miliao-hash")
+	_, err3 := cmd2.Result()
+	assert.NotNil(t, err3)
+	assert.Equal(t, redisErrorType, reflect.TypeOf(err3))
+	assert.Equal(t, "WRONGTYPE Operation against a key holding the wrong kind of value", err3.Error())
+	assert.Equal(t, err3, cmd2.Err())
+
+	// cmd succeeded is not affected
+	assert.Nil(t, c.Get("foo_the_bar_other").Err())
+
+	// error of an earlier run is cleared once cmd succeeds
+	UnHookRedisFunc()
+	saveRedisCmdErr("miliao-err", io.EOF)
+	assert.Equal(t, io.EOF, loadRedisCmdErr("miliao-err", redisErrorType))
+	saveRedisCmdValue("miliao-err", redis.NewStringResult("bar", nil))
+	assert.Nil(t, loadRedisCmdErr("miliao-err", redisErrorType))
+}
+
+var redisTxFails = 0
+
+// wrapTxPipelineProcessHook setups 'old' processor which fails tx for redisTxFails times.
+func wrapTxPipelineProcessHook(c interface{}, fn func(func([]redis.Cmder) error) func([]redis.Cmder) error) bool {
+	wrapPipelineProcessTrampoline(c, func(func([]redis.Cmder) error) func([]redis.Cmder) error {
+		return func(cmds []redis.Cmder) error {
+			if redisTxFails > 0 {
+				redisTxFails--
+				for _, cc := range cmds {
+					setRedisCmdErr(cc, redis.TxFailedErr)
+				}
+				return redis.TxFailedErr
+			}
+			return nil
+		}
+	})
+
+	return wrapPipelineProcessTrampoline(c, fn)
+}
+
+func wrapRedisTxProcessHook(tx *redis.Tx, fn func(func(redis.Cmder) error) func(redis.Cmder) error) bool {
+	wrapRedisTxProcessTrampoline(tx, func(func(redis.Cmder) error) func(redis.Cmder) error {
+		return func(redis.Cmder) error {
+			return nil
+		}
+	})
+
+	return wrapRedisTxProcessTrampoline(tx, fn)
+}
+
+//go:noinline
+func wrapRedisTxProcessTrampoline(tx *redis.Tx, fn func(func(redis.Cmder) error) func(redis.Cmder) error) bool {
+	fmt.Printf("dummy function for regrestion testing")
+
+	for i := 0; i < 100000; i++ {
+		fmt.Printf("id:%d\n", i)
+		go func() { fmt.Printf("hello world\n") }()
+	}
+
+	if tx != nil {
+		panic("trampoline redis wrapRedisTxProcess() function is not allowed to be called")
+	}
+
+	return true
+}
+
+func TestRedisTx(t *testing.T) {
+	setupRedisHook(t)
+
+	defer func() {
+		UnHookRedisFunc()
+	}()
+
+	gohook.UnHook(wrapRedisPipelineProcessor)
+	err1 := gohook.Hook(wrapRedisPipelineProcessor, wrapTxPipelineProcessHook, wrapPipelineProcessTrampoline)
+	assert.Nil(t, err1)
+
+	err2 := gohook.Hook(wrapRedisTxProcess, wrapRedisTxProcessHook, wrapRedisTxProcessTrampoline)
+	assert.Nil(t, err2)
+
+	c := redis.NewClient(&redis.Options{
+		Addr:        "127.0.0.0:2337",
+		DialTimeout: time.Duration(222) * time.Second,
+		ReadTimeout: time.Duration(333) * time.Second,
+	})
+
+	var incrs []*redis.IntCmd
+	txf := func(tx *redis.Tx) error {
+		tx.Get("miliao-tx")
+		_, err := tx.Pipelined(func(p redis.Pipeliner) error {
+			incrs = append(incrs, p.Incr("miliao-tx"))
+			return nil
+		})
+		return err
+	}
+
+	watch := func() error {
+		for i := 0; i < 3; i++ {
+			err := c.Watch(txf, "miliao-tx")
+			if err != redis.TxFailedErr {
+				return err
+			}
+		}
+		return redis.TxFailedErr
+	}
+
+	multi := func(p redis.Pipeliner) error {
+		p.Incr("miliao-tx2")
+		return nil
+	}
+
+	redisTxFails = 1
+	assert.Nil(t, watch())
+	assert.Equal(t, 2, len(incrs))
+
+	redisTxFails = 1
+	_, err3 := c.TxPipelined(multi)
+	assert.Equal(t, redis.TxFailedErr, err3)
+	_, err4 := c.TxPipelined(multi)
+	assert.Nil(t, err4)
+
+	gohook.UnHook(wrapRedisTxProcess)
+	gohook.UnHook(wrapRedisPipelineProcessor)
+	gohook.UnHook(redisClientProcessTrampoline)
+	UnHookRedisFunc()
+
+	GlobalMgr.SetState(RegressionReplay)
+	err5 := HookRedisFunc()
+	assert.Nil(t, err5)
+
+	// watch is retried as it is recorded
+	incrs = nil
+	assert.Nil(t, watch())
+	assert.Equal(t, 2, len(incrs))
+	assert.Equal(t, redis.TxFailedErr, incrs[0].Err())
+	assert.Nil(t, incrs[1].Err())
+	assert.Equal(t, int64(0), incrs[1].Val())
+
+	cmds, err6 := c.TxPipelined(multi)
+	assert.Equal(t, redis.TxFailedErr, err6)
+	assert.Equal(t, redis.TxFailedErr, cmds[0].Err())
+
+	_, err7 := c.TxPipelined(multi)
+	assert.Nil(t, err7)
+
+	// not recorded
+	_, err8 := c.TxPipelined(multi)
+	assert.NotNil(t, err8)
+}
+
+var redisPubSubScript = []interface{}{
+	&redis.Subscription{Kind: "subscribe", Channel: "miliao-ch", Count: 1},
+	&redis.Message{Channel: "miliao-ch", Payload: "m1"},
+	&redis.Message{Channel: "miliao-ch", Payload: "m2"},
+}
+
+var redisPubSubReceived = 0
+
+func pubSubSubscribeHook(ps *redis.PubSub, channels ...string) error {
+	return nil
+}
+
+func pubSubReceiveTimeoutHook(ps *redis.PubSub, timeout time.Duration) (interface{}, error) {
+	if redisPubSubReceived >= len(redisPubSubScript) {
+		return nil, &redisNetError{msg: "i/o timeout", timeout: true}
+	}
+
+	if redisPubSubReceived == 2 {
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	msg := redisPubSubScript[redisPubSubReceived]
+	redisPubSubReceived++
+	return msg, nil
+}
+
+func wrapBlockingClientProcessHook(c *redis.Client, fn func(func(redis.Cmder) error) func(redis.Cmder) error) bool {
+	wrapRedisClientProcessTrampoline(c, func(func(redis.Cmder) error) func(redis.Cmder) error {
+		return func(redis.Cmder) error {
+			time.Sleep(50 * time.Millisecond)
+			return nil
+		}
+	})
+
+	return wrapRedisClientProcessTrampoline(c, fn)
+}
+
+func TestRedisPubSub(t *testing.T) {
+	// time.Now() might be hooked by other tests, intervals are measured by it.
+	gohook.UnHook(time.Now)
+	setupRedisHook(t)
+
+	defer func() {
+		SetRedisReplayTimeScale(1)
+		UnHookRedisFunc()
+	}()
+
+	err1 := gohook.Hook(redisPubSubSubscribeTrampoline, pubSubSubscribeHook, nil)
+	assert.Nil(t, err1)
+
+	err2 := gohook.Hook(redisPubSubReceiveTimeoutTrampoline, pubSubReceiveTimeoutHook, nil)
+	assert.Nil(t, err2)
+
+	gohook.UnHook(wrapRedisClientProcess)
+	err3 := gohook.Hook(wrapRedisClientProcess, wrapBlockingClientProcessHook, wrapRedisClientProcessTrampoline)
+	assert.Nil(t, err3)
+
+	c := redis.NewClient(&redis.Options{
+		Addr:        "127.0.0.0:2338",
+		DialTimeout: time.Duration(222) * time.Second,
+		ReadTimeout: time.Duration(333) * time.Second,
+	})
+
+	sub := c.Subscribe("miliao-ch")
+	for range redisPubSubScript {
+		_, err := sub.Receive()
+		assert.Nil(t, err)
+	}
+	_, err4 := sub.ReceiveTimeout(time.Millisecond)
+	assert.NotNil(t, err4)
+	sub.Close()
+
+	c.BLPop(time.Second, "miliao-list")
+
+	gohook.UnHook(redisPubSubSubscribeTrampoline)
+	gohook.UnHook(redisPubSubReceiveTimeoutTrampoline)
+	gohook.UnHook(wrapRedisClientProcess)
+	gohook.UnHook(redisClientProcessTrampoline)
+	UnHookRedisFunc()
+
+	GlobalMgr.SetState(RegressionReplay)
+	SetRedisReplayTimeScale(0.1)
+
+	err5 := HookRedisFunc()
+	assert.Nil(t, err5)
+
+	sub2 := c.Subscribe("miliao-ch")
+
+	msg, err6 := sub2.Receive()
+	assert.Nil(t, err6)
+	assert.Equal(t, redisPubSubScript[0], msg)
+
+	m1, err7 := sub2.ReceiveMessage()
+	assert.Nil(t, err7)
+	assert.Equal(t, "m1", m1.Payload)
+
+	start := time.Now()
+	m2, err8 := sub2.ReceiveMessage()
+	assert.Nil(t, err8)
+	assert.Equal(t, "m2", m2.Payload)
+	assert.True(t, time.Since(start) < 45*time.Millisecond)
+
+	// recorded timeout is replayed, then it times out as no more messages.
+	_, err9 := sub2.ReceiveTimeout(time.Second)
+	assert.NotNil(t, err9)
+	assert.True(t, err9.(net.Error).Timeout())
+
+	_, err10 := sub2.ReceiveTimeout(time.Millisecond)
+	assert.NotNil(t, err10)
+
+	sub2.Close()
+	_, err11 := sub2.Receive()
+	assert.Equal(t, redisPubSubClosedErr, err11)
+
+	start = time.Now()
+	assert.Nil(t, c.BLPop(time.Second, "miliao-list").Err())
+	assert.True(t, time.Since(start) >= 4*time.Millisecond)
+
+	// messages are delivered by channel as well
+	UnHookRedisFunc()
+	err12 := HookRedisFunc()
+	assert.Nil(t, err12)
+
+	// health check of channel is fed by ping instead of reconnecting.
+	sub4 := c.Subscribe("miliao-ch")
+	pf := reflect.ValueOf(sub4).Elem().FieldByName("ping")
+	ping := make(chan struct{}, 1)
+	reflect.NewAt(pf.Type(), unsafe.Pointer(pf.UnsafeAddr())).Elem().Set(reflect.ValueOf(ping))
+	assert.Nil(t, sub4.Ping())
+	assert.Equal(t, 1, len(ping))
+	sub4.Close()
+
+	sub3 := c.Subscribe("miliao-ch")
+	ch := sub3.Channel()
+	assert.Equal(t, "m1", (<-ch).Payload)
+	assert.Equal(t, "m2", (<-ch).Payload)
+
+	sub3.Close()
+	_, ok := <-ch
+	assert.False(t, ok)
+}
+
+// redisEmulatorReplies are replies of redis server when recording TestRedisEmulator, keyed by args of cmd.
+var redisEmulatorReplies = map[string]interface{}{
+	"get user:1":                  "alice",
+	"get counter":                 "56",
+	"hget settings theme":         "dark",
+	"hlen settings":               int64(3),
+	"incr hits":                   int64(57),
+	"setnx lock 1":                false,
+	"get missing":                 redis.Nil,
+	"ttl user:1":                  100 * time.Second,
+	"hgetall profile":             map[string]string{"name": "alice"},
+	"lrange queue 0 -1":           []string{"a", "b"},
+	"smembers tags":               []string{"t1"},
+	"zrange rank 0 -1 withscores": []redis.Z{{Score: 1, Member: "m1"}},
+	"set written x":               "OK",
+	"get written":                 "x",
+	"getset user:2 new":           "old",
+	"get user:2":                  "new",
+}
+
+// setRedisCmdVal sets val to cmd as redis server does, SetVal() is not available before go-redis v8.
+func setRedisCmdVal(cmd redis.Cmder, val interface{}) {
+	f := reflect.ValueOf(cmd).Elem().FieldByName("val")
+	reflect.NewAt(f.Type(), unsafe.Pointer(f.UnsafeAddr())).Elem().Set(reflect.ValueOf(val))
+}
+
+func wrapEmulatorClientProcessHook(c *redis.Client, fn func(func(redis.Cmder) error) func(redis.Cmder) error) bool {
+	wrapRedisClientProcessTrampoline(c, func(func(redis.Cmder) error) func(redis.Cmder) error {
+		return func(cmd redis.Cmder) error {
+			_, args := redisEmuArgs(cmd)
+			reply := redisEmulatorReplies[cmd.Name()+" "+strings.Join(args, " ")]
+			if err, ok := reply.(error); ok {
+				setRedisCmdErr(cmd, err)
+				return err
+			}
+			if reply != nil {
+				setRedisCmdVal(cmd, reply)
+			}
+			return nil
+		}
+	})
+
+	return wrapRedisClientProcessTrampoline(c, fn)
+}
+
+func TestRedisEmulator(t *testing.T) {
+	setupRedisHook(t)
+	EnableRedisEmulator(true)
+
+	defer func() {
+		EnableRedisEmulator(false)
+		UnHookRedisFunc()
+	}()
+
+	gohook.UnHook(wrapRedisClientProcess)
+	err1 := gohook.Hook(wrapRedisClientProcess, wrapEmulatorClientProcessHook, wrapRedisClientProcessTrampoline)
+	assert.Nil(t, err1)
+
+	c := redis.NewClient(&redis.Options{
+		Addr:        "127.0.0.0:2339",
+		DialTimeout: time.Duration(222) * time.Second,
+		ReadTimeout: time.Duration(333) * time.Second,
+	})
+
+	assert.Equal(t, "alice", c.Get("user:1").Val())
+	assert.Equal(t, "56", c.Get("counter").Val())
+	assert.Equal(t, "dark", c.HGet("settings", "theme").Val())
+	assert.Equal(t, int64(3), c.HLen("settings").Val())
+	assert.Equal(t, int64(57), c.Incr("hits").Val())
+	assert.False(t, c.SetNX("lock", "1", 0).Val())
+	assert.Equal(t, redis.Nil, c.Get("missing").Err())
+	assert.Equal(t, 100*time.Second, c.TTL("user:1").Val())
+	c.HGetAll("profile")
+	c.LRange("queue", 0, -1)
+	c.SMembers("tags")
+	c.ZRangeWithScores("rank", 0, -1)
+	c.Set("written", "x", 0)
+	assert.Equal(t, "x", c.Get("written").Val())
+	assert.Equal(t, "old", c.GetSet("user:2", "new").Val())
+	assert.Equal(t, "new", c.Get("user:2").Val())
+
+	gohook.UnHook(wrapRedisClientProcess)
+	gohook.UnHook(redisClientProcessTrampoline)
+	UnHookRedisFunc()
+
+	GlobalMgr.SetState(RegressionReplay)
+	err2 := HookRedisFunc()
+	assert.Nil(t, err2)
+
+	// cmds are reordered, and most of them were never recorded.
+	assert.Equal(t, int64(57), c.Incr("counter").Val())
+	assert.Equal(t, "57", c.Get("counter").Val())
+
+	assert.Equal(t, int64(6), c.Append("user:1", "!").Val())
+	v, err := c.Get("user:1").Result()
+	assert.Nil(t, err)
+	assert.Equal(t, "alice!", v)
+	assert.Equal(t, 100*time.Second, c.TTL("user:1").Val())
+
+	assert.Equal(t, redis.Nil, c.Get("missing").Err())
+	_, err = c.Get("missing").Result()
+	assert.Equal(t, redis.Nil, err)
+
+	assert.True(t, c.HSet("profile", "age", "18").Val())
+	assert.Equal(t, map[string]string{"name": "alice", "age": "18"}, c.HGetAll("profile").Val())
+	assert.Equal(t, []interface{}{"alice", nil}, c.HMGet("profile", "name", "city").Val())
+
+	assert.Equal(t, int64(3), c.RPush("queue", "c").Val())
+	assert.Equal(t, "a", c.LPop("queue").Val())
+	assert.Equal(t, []string{"b", "c"}, c.LRange("queue", 0, -1).Val())
+
+	assert.Equal(t, int64(1), c.SAdd("tags", "t2").Val())
+	assert.True(t, c.SIsMember("tags", "t2").Val())
+	assert.Equal(t, []string{"t1", "t2"}, c.SMembers("tags").Val())
+
+	assert.Equal(t, float64(6), c.ZIncrBy("rank", 5, "m1").Val())
+	c.ZAdd("rank", redis.Z{Score: 3, Member: "m2"})
+	assert.Equal(t, []redis.Z{{Score: 6, Member: "m1"}, {Score: 3, Member: "m2"}}, c.ZRevRangeWithScores("rank", 0, -1).Val())
+
+	// fields seeded by partial reads are emulated, but not the whole key.
+	assert.False(t, c.HSet("settings", "theme", "light").Val())
+	assert.Equal(t, "light", c.HGet("settings", "theme").Val())
+	assert.Equal(t, int64(3), c.HLen("settings").Val())
+
+	// keys written before being read are not seeded, their recorded results are replayed.
+	assert.Equal(t, "x", c.Get("written").Val())
+	assert.Equal(t, int64(57), c.Incr("hits").Val())
+	assert.False(t, c.SetNX("lock", "1", 0).Val())
+
+	// keys overwritten are emulated.
+	assert.Equal(t, "OK", c.Set("written", "y", time.Minute).Val())
+	assert.False(t, c.SetNX("written", "z", 0).Val())
+	assert.Equal(t, "y", c.Get("written").Val())
+	assert.Equal(t, int64(1), c.Del("written", "missing").Val())
+	assert.Equal(t, int64(0), c.Exists("written").Val())
+
+	err = c.LPush("user:1", "x").Err()
+	assert.Equal(t, redisErrorType, reflect.TypeOf(err))
+
+	pp := c.Pipeline()
+	r1 := pp.Incr("counter")
+	r2 := pp.Get("counter")
+	_, err = pp.Exec()
+	assert.Nil(t, err)
+	assert.Equal(t, int64(58), r1.Val())
+	assert.Equal(t, "58", r2.Val())
+
+	// cmds not supported by emulator are replayed by recorded keys, so are the keys touched.
+	assert.Equal(t, "old", c.GetSet("user:2", "new").Val())
+	assert.Equal(t, "new", c.Get("user:2").Val())
+}
@@ -2,11 +2,16 @@ package gorr
 
 import (
 	"bytes"
+	"context"
 	"encoding/binary"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
+	"net"
 	"reflect"
 	"strings"
+	"unsafe"
 
 	"github.com/go-redis/redis"
 )
@@ -39,23 +44,7 @@ func buildRedisCmdKey(id string, cmd redis.Cmder) string {
 	args := cmd.Args()
 	ss := make([]string, 0, len(args)+1)
 
-	switch cmd.(type) {
-	case *redis.StringCmd:
-		ss = append(ss, "StringCmd@")
-	case *redis.StatusCmd:
-		ss = append(ss, "StatusCmd@")
-	case *redis.IntCmd:
-		ss = append(ss, "IntCmd@")
-	case *redis.FloatCmd:
-		ss = append(ss, "FloatCmd@")
-	case *redis.BoolCmd:
-		ss = append(ss, "BoolCmd@")
-	case *redis.StringSliceCmd:
-		ss = append(ss, "StringSliceCmd@")
-	default:
-		// panic("not supported redis cmd type")
-		ss = append(ss, cmd.Name())
-	}
+	ss = append(ss, redisCmdType(cmd)+"@")
 
 	for _, arg := range args {
 		ss = append(ss, fmt.Sprint(arg))
@@ -100,42 +89,45 @@ func saveRedisCmdValue(key string, cmd redis.Cmder) {
 			binary.Write(&buff, binary.LittleEndian, []byte(v))
 		}
 	default:
-		GlobalMgr.notifier("redis cmd recording for not-supported cmd", key, []byte(""))
-		return
+		var data []byte
+		var ok bool
+		data, ok, err = encodeRedisCmdValue(cmd)
+		if !ok {
+			GlobalMgr.notifier("redis cmd recording for not-supported cmd", key, []byte(""))
+			return
+		}
+		buff.Write(data)
 	}
 
 	if err == nil || err == redis.Nil {
+		clearRedisCmdErr(key)
 		GlobalMgr.StoreValue(key, buff.Bytes())
 		GlobalMgr.notifier("redis cmd recording", key, buff.Bytes())
 	} else {
-		GlobalMgr.notifier("redis cmd not recording", fmt.Sprintf("cmd error occurs, key:%s, err:%s", key, err.Error()), nil)
+		saveRedisCmdErr(key, err)
 	}
 }
 
 func addKeyToRedisCmd(cmd redis.Cmder, key string) {
-	switch c := cmd.(type) {
-	case *redis.StringCmd:
-		arg := c.Args()
-		arg[0] = key
-	case *redis.StatusCmd:
-		arg := c.Args()
-		arg[0] = key
-	case *redis.IntCmd:
-		arg := c.Args()
-		arg[0] = key
-	case *redis.FloatCmd:
-		arg := c.Args()
-		arg[0] = key
-	case *redis.BoolCmd:
-		arg := c.Args()
-		arg[0] = key
-	case *redis.StringSliceCmd:
-		arg := c.Args()
-		arg[0] = key
-	default:
+	if !isRedisCmdSupported(cmd) {
 		// panic("not supported redis cmd type")
 		GlobalMgr.notifier("redis cmd replaying not supported cmd", key, []byte(""))
+		return
 	}
+
+	arg := cmd.Args()
+	arg[0] = key
+}
+
+// isRedisCmdSupported checks whether getters of cmd are hooked for replaying.
+func isRedisCmdSupported(c redis.Cmder) bool {
+	for _, v := range cmd {
+		if reflect.TypeOf(v.cmd) == reflect.TypeOf(c) {
+			return true
+		}
+	}
+
+	return false
 }
 
 func getStoredValue(args []interface{}) ([]byte, error) {
@@ -152,12 +144,23 @@ func getStoredValue(args []interface{}) ([]byte, error) {
 			break
 		}
 
+		if r, isEmu := args[0].(*redisEmuResult); isEmu {
+			key, value, err = "redis_emulator", r.data, r.err
+			break
+		}
+
 		key, ok = args[0].(string)
 		if !ok {
 			err = errors.New("get key from args failed, invalid type")
 			break
 		}
 
+		err = loadRedisCmdErr(key, redisErrorType)
+		if err != nil {
+			GlobalMgr.notifier("redis cmd replaying error", key, []byte(err.Error()))
+			return nil, err
+		}
+
 		value, err = GlobalMgr.GetValue(key)
 		break
 	}
@@ -174,3 +177,153 @@ func getStoredValue(args []interface{}) ([]byte, error) {
 
 	return value, err
 }
+
+const (
+	redisErrRedis    = "redis"
+	redisErrTimeout  = "timeout"
+	redisErrNet      = "net"
+	redisErrEOF      = "eof"
+	redisErrCanceled = "canceled"
+	redisErrDeadline = "deadline"
+	redisErrOther    = "other"
+)
+
+// redisCmdErr is error of cmd stored under key of the cmd with suffix "@error".
+type redisCmdErr struct {
+	Kind string `json:"kind"`
+	Msg  string `json:"msg"`
+}
+
+// redisNetError replays timeouts and connection errors, it implements net.Error.
+type redisNetError struct {
+	msg     string
+	timeout bool
+}
+
+func (e *redisNetError) Error() string {
+	return e.msg
+}
+
+func (e *redisNetError) Timeout() bool {
+	return e.timeout
+}
+
+func (e *redisNetError) Temporary() bool {
+	return e.timeout
+}
+
+// redis error replied by server, eg: WRONGTYPE, MOVED, is of type proto.RedisError,
+// which is internal to go-redis, redis.TxFailedErr is used to get the type.
+var redisErrorType = reflect.TypeOf(redis.TxFailedErr)
+
+func redisCmdErrKey(key string) string {
+	return key + "@error"
+}
+
+func newRedisCmdErr(err error) *redisCmdErr {
+	e := &redisCmdErr{Kind: redisErrOther, Msg: err.Error()}
+
+	if reflect.TypeOf(err) == redisErrorType {
+		e.Kind = redisErrRedis
+	} else if _, ok := err.(interface{ RedisError() }); ok {
+		e.Kind = redisErrRedis
+	} else if err == context.Canceled {
+		e.Kind = redisErrCanceled
+	} else if err == context.DeadlineExceeded {
+		e.Kind = redisErrDeadline
+	} else if err == io.EOF {
+		e.Kind = redisErrEOF
+	} else if ne, ok := err.(net.Error); ok {
+		e.Kind = redisErrNet
+		if ne.Timeout() {
+			e.Kind = redisErrTimeout
+		}
+	}
+
+	return e
+}
+
+// error rebuilds recorded error, errors replied by server are of errType.
+func (e *redisCmdErr) error(errType reflect.Type) error {
+	switch e.Kind {
+	case redisErrRedis:
+		return reflect.ValueOf(e.Msg).Convert(errType).Interface().(error)
+	case redisErrTimeout:
+		return &redisNetError{msg: e.Msg, timeout: true}
+	case redisErrNet:
+		return &redisNetError{msg: e.Msg}
+	case redisErrEOF:
+		return io.EOF
+	case redisErrCanceled:
+		return context.Canceled
+	case redisErrDeadline:
+		return context.DeadlineExceeded
+	}
+
+	return errors.New(e.Msg)
+}
+
+func saveRedisCmdErr(key string, err error) {
+	data, err2 := json.Marshal(newRedisCmdErr(err))
+	if err2 != nil {
+		GlobalMgr.notifier("redis cmd not recording", fmt.Sprintf("marshal cmd error failed, key:%s, err:%s", key, err2.Error()), nil)
+		return
+	}
+
+	GlobalMgr.StoreValue(redisCmdErrKey(key), data)
+	GlobalMgr.notifier("redis cmd error recording", key, data)
+}
+
+// clearRedisCmdErr overwrites error recorded by an earlier run of cmd, as cmd succeeds this time.
+func clearRedisCmdErr(key string) {
+	data, err := GlobalMgr.GetValue(redisCmdErrKey(key))
+	if err == nil && len(data) > 0 {
+		GlobalMgr.StoreValue(redisCmdErrKey(key), []byte{})
+	}
+}
+
+// loadRedisCmdErr returns error recorded for cmd, nil if cmd succeeded.
+func loadRedisCmdErr(key string, errType reflect.Type) error {
+	data, err := GlobalMgr.GetValue(redisCmdErrKey(key))
+	if err != nil || len(data) == 0 {
+		return nil
+	}
+
+	var e redisCmdErr
+	err = json.Unmarshal(data, &e)
+	if err != nil {
+		GlobalMgr.notifier("redis cmd replaying invalid error", key, data)
+		return nil
+	}
+
+	return e.error(errType)
+}
+
+// setRedisCmdErr sets err to cmd, SetErr() is not available before go-redis v8, unexported field is set instead.
+func setRedisCmdErr(cmd redis.Cmder, err error) {
+	v := reflect.ValueOf(cmd)
+	m := v.MethodByName("SetErr")
+	if m.IsValid() {
+		m.Call([]reflect.Value{reflect.ValueOf(&err).Elem()})
+		return
+	}
+
+	if v.Kind() != reflect.Ptr || v.Elem().Kind() != reflect.Struct {
+		return
+	}
+
+	f := v.Elem().FieldByName("err")
+	if f.IsValid() && f.Type() == reflect.TypeOf(&err).Elem() {
+		reflect.NewAt(f.Type(), unsafe.Pointer(f.UnsafeAddr())).Elem().Set(reflect.ValueOf(&err).Elem())
+	}
+}
+
+// replayRedisCmdErr sets error recorded for cmd, which is keyed by key, to cmd.
+func replayRedisCmdErr(cmd redis.Cmder, key string) error {
+	err := loadRedisCmdErr(key, redisErrorType)
+	if err != nil {
+		setRedisCmdErr(cmd, err)
+	}
+
+	return err
+}
@@ -25,8 +25,12 @@ func (rh *redisHook) BeforeProcessPipeline(ctx context.Context, cmds []redis.Cmd
 	if !GlobalMgr.ShouldRecord() {
 		GlobalMgr.notifier("calling redisHook.BeforeProcessPipeline for replaying\n", rh.id, []byte(""))
 		for _, cc := range cmds {
+			if ok, _ := emulateRedisCmd(rh.id, cc); ok {
+				continue
+			}
 			key := buildRedisCmdKey(rh.id, cc)
 			addKeyToRedisCmd(cc, key)
+			replayRedisCmdErr(cc, key)
 		}
 		return ctx, errRedisPipeNorm
 	}
@@ -41,6 +45,7 @@ func (rh *redisHook) AfterProcessPipeline(ctx context.Context, cmds []redis.Cmde
 			key := buildRedisCmdKey(rh.id, cc)
 			saveRedisCmdValue(key, cc)
 		}
+		seedRedisEmulator(rh.id, cmds...)
 		return errRedisPipeNorm
 	}
 
@@ -50,11 +55,22 @@ func (rh *redisHook) AfterProcessPipeline(ctx context.Context, cmds []redis.Cmde
 func redisPipelineExec(p *redis.Pipeline) ([]redis.Cmder, error) {
 	r, err := redisPipelineExecTramp(p)
 	if err == errRedisPipeNorm {
-		return r, nil
+		return r, redisCmdsFirstErr(r)
 	}
 	return r, err
 }
 
+// redisCmdsFirstErr returns the first replayed error of cmds, as pipeline.Exec() does.
+func redisCmdsFirstErr(cmds []redis.Cmder) error {
+	for _, cc := range cmds {
+		if err := cc.Err(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
 func redisPipelineExecTramp(p *redis.Pipeline) ([]redis.Cmder, error) {
 	fmt.Printf("dummy function for regrestion testing")
 	fmt.Printf("dummy function for regrestion testing:%v", p)
@@ -74,7 +90,7 @@ func redisPipelineExecTramp(p *redis.Pipeline) ([]redis.Cmder, error) {
 func redisPipelineExecContext(p *redis.Pipeline, ctx context.Context) ([]redis.Cmder, error) {
 	r, err := redisPipelineExecContextTramp(p, ctx)
 	if err == errRedisPipeNorm {
-		return r, nil
+		return r, redisCmdsFirstErr(r)
 	}
 	return r, err
 }
@@ -108,18 +124,25 @@ func redisPipelineProcessor(id string, cmd []redis.Cmder, old func(cmd []redis.C
 	if GlobalMgr.ShouldRecord() {
 		err = old(cmd)
 		if err != nil && err != redis.Nil {
-			GlobalMgr.notifier("redis Client.Pipeline.ProcessWrapper() recording failed", cs, []byte(err.Error()))
-			return err
+			GlobalMgr.notifier("redis Client.Pipeline.ProcessWrapper() recording error", cs, []byte(err.Error()))
 		}
 
 		for _, cc := range cmd {
 			key := buildRedisCmdKey(id, cc)
 			saveRedisCmdValue(key, cc)
 		}
+		seedRedisEmulator(id, cmd...)
 	} else {
 		for _, cc := range cmd {
-			key := buildRedisCmdKey(id, cc)
-			addKeyToRedisCmd(cc, key)
+			ok, err2 := emulateRedisCmd(id, cc)
+			if !ok {
+				key := buildRedisCmdKey(id, cc)
+				addKeyToRedisCmd(cc, key)
+				err2 = replayRedisCmdErr(cc, key)
+			}
+			if err == nil {
+				err = err2
+			}
 		}
 	}
 
@@ -0,0 +1,482 @@
+package gorr
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+	"unsafe"
+
+	"github.com/brahma-adshonor/gohook"
+	"github.com/go-redis/redis"
+)
+
+/*
+messages received by a subscription are recorded in order with offsets to the time the first one is received,
+the n-th message is stored under key@n, and number of messages is stored under key of the subscription.
+for replaying, PubSub is faked by hooking its methods, recorded messages are delivered in the same order and intervals,
+intervals are scaled by SetRedisReplayTimeScale().
+
+blocking cmds(eg: BLPOP, XREAD BLOCK) are recorded with time elapsed, and replayed after the scaled elapsed time.
+
+hook point:
+1. PubSub.Subscribe()/PSubscribe(): channels subscribed before the first message is received are used to build key of subscription.
+2. PubSub.ReceiveTimeout(): all of Receive()/ReceiveMessage()/Channel() are built on it, for recording/replaying messages.
+3. PubSub.Close(): used to stop replaying.
+4. PubSub.Unsubscribe()/PUnsubscribe()/Ping(): for replaying only, nothing is sent to server, Ping() keeps health check of PubSub.Channel() from reconnecting.
+*/
+
+var (
+	redisTimeLock  sync.Mutex
+	redisTimeScale = 1.0
+
+	redisPubSubLock sync.Mutex
+	redisPubSubMap  = make(map[*redis.PubSub]*redisPubSub)
+
+	// redisPubSubClosedErr is the error returned by PubSub.Receive() after PubSub is closed,
+	// PubSub.Channel() is closed when it is received.
+	redisPubSubClosedErr = closedRedisPubSubErr()
+)
+
+func closedRedisPubSubErr() error {
+	c := redis.NewClient(&redis.Options{})
+	defer c.Close()
+
+	ps := c.Subscribe()
+	ps.Close()
+	return ps.Close()
+}
+
+// SetRedisReplayTimeScale scales intervals of replayed pubsub messages and time elapsed by blocking cmds,
+// eg: 0.1 replays 10 times faster than recorded, 0 replays without waiting.
+func SetRedisReplayTimeScale(scale float64) {
+	redisTimeLock.Lock()
+	defer redisTimeLock.Unlock()
+	redisTimeScale = scale
+}
+
+func redisReplayDelay(d time.Duration) time.Duration {
+	redisTimeLock.Lock()
+	defer redisTimeLock.Unlock()
+	return time.Duration(float64(d) * redisTimeScale)
+}
+
+type redisPubSubEvent struct {
+	Offset time.Duration       `json:"offset"`
+	Sub    *redis.Subscription `json:"sub,omitempty"`
+	Msg    *redis.Message      `json:"msg,omitempty"`
+	Pong   *redis.Pong         `json:"pong,omitempty"`
+	Err    *redisCmdErr        `json:"err,omitempty"`
+}
+
+func newRedisPubSubEvent(offset time.Duration, msg interface{}, err error) *redisPubSubEvent {
+	ev := &redisPubSubEvent{Offset: offset}
+	if err != nil {
+		ev.Err = newRedisCmdErr(err)
+		return ev
+	}
+
+	switch m := msg.(type) {
+	case *redis.Subscription:
+		ev.Sub = m
+	case *redis.Message:
+		ev.Msg = m
+	case *redis.Pong:
+		ev.Pong = m
+	}
+
+	return ev
+}
+
+type redisPubSubValue struct {
+	Count int `json:"count"`
+}
+
+func (ev *redisPubSubEvent) value() (interface{}, error) {
+	if ev.Err != nil {
+		return nil, ev.Err.error(redisErrorType)
+	}
+
+	// copied, as messages might be modified by receivers.
+	if ev.Sub != nil {
+		m := *ev.Sub
+		return &m, nil
+	}
+
+	if ev.Msg != nil {
+		m := *ev.Msg
+		return &m, nil
+	}
+
+	if ev.Pong != nil {
+		m := *ev.Pong
+		return &m, nil
+	}
+
+	return nil, fmt.Errorf("invalid recorded redis pubsub message")
+}
+
+// redisPubSub keeps messages of subscription, it is created when PubSub is used, and removed when PubSub is closed.
+type redisPubSub struct {
+	mu       sync.Mutex
+	channels []string
+	key      string
+	start    time.Time
+	events   []*redisPubSubEvent
+	next     int
+	last     time.Duration
+	saved    int
+
+	done chan struct{}
+	once sync.Once
+}
+
+func getRedisPubSub(ps *redis.PubSub, create bool) *redisPubSub {
+	redisPubSubLock.Lock()
+	defer redisPubSubLock.Unlock()
+
+	s := redisPubSubMap[ps]
+	if s == nil && create {
+		s = &redisPubSub{done: make(chan struct{})}
+		redisPubSubMap[ps] = s
+	}
+
+	return s
+}
+
+func removeRedisPubSub(ps *redis.PubSub) *redisPubSub {
+	redisPubSubLock.Lock()
+	defer redisPubSubLock.Unlock()
+
+	s := redisPubSubMap[ps]
+	delete(redisPubSubMap, ps)
+	return s
+}
+
+func (s *redisPubSub) subscribe(kind string, channels []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.key) == 0 {
+		s.channels = append(s.channels, kind+":"+strings.Join(channels, "#"))
+	}
+}
+
+// init builds key by channels subscribed before the first message is received, recorded messages are loaded for replaying.
+func (s *redisPubSub) init() {
+	if len(s.key) > 0 {
+		return
+	}
+
+	key := fmt.Sprintf("%s@redis_pubsub@%s", GlobalMgr.GetCurTraceId(), strings.Join(s.channels, "@"))
+	s.key = fmt.Sprintf("%s@%d", key, nextRedisSeq(key))
+	s.start = time.Now()
+
+	if GlobalMgr.ShouldRecord() {
+		return
+	}
+
+	var pv redisPubSubValue
+	data, err := GlobalMgr.GetValue(s.key)
+	if err == nil {
+		err = json.Unmarshal(data, &pv)
+	}
+
+	for i := 0; err == nil && i < pv.Count; i++ {
+		var ev redisPubSubEvent
+		data, err = GlobalMgr.GetValue(fmt.Sprintf("%s@%d", s.key, i))
+		if err == nil {
+			err = json.Unmarshal(data, &ev)
+		}
+		s.events = append(s.events, &ev)
+	}
+
+	if err != nil {
+		GlobalMgr.notifier("redis pubsub replaying failed", s.key, []byte(err.Error()))
+	} else {
+		GlobalMgr.notifier("redis pubsub replaying", s.key, []byte(fmt.Sprintf("messages:%d", len(s.events))))
+	}
+}
+
+// save records message received, number of messages is updated every time, as PubSub might not be closed.
+func (s *redisPubSub) save(msg interface{}, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.init()
+
+	key := fmt.Sprintf("%s@%d", s.key, s.saved)
+	data, err := json.Marshal(newRedisPubSubEvent(time.Since(s.start), msg, err))
+	if err != nil {
+		GlobalMgr.notifier("redis pubsub recording failed", key, []byte(err.Error()))
+		return
+	}
+
+	GlobalMgr.StoreValue(key, data)
+	GlobalMgr.notifier("redis pubsub recording", key, data)
+
+	s.saved++
+	data, _ = json.Marshal(&redisPubSubValue{Count: s.saved})
+	GlobalMgr.StoreValue(s.key, data)
+}
+
+func (s *redisPubSub) close() {
+	s.once.Do(func() { close(s.done) })
+}
+
+// receive delivers the next recorded message after scaled interval,
+// it blocks until PubSub is closed or timeout when all messages are delivered.
+func (s *redisPubSub) receive(timeout time.Duration) (interface{}, error) {
+	s.mu.Lock()
+	s.init()
+
+	var ev *redisPubSubEvent
+	if s.next < len(s.events) {
+		ev = s.events[s.next]
+		s.next++
+	}
+	s.mu.Unlock()
+
+	if ev == nil {
+		if timeout <= 0 {
+			<-s.done
+			return nil, redisPubSubClosedErr
+		}
+
+		select {
+		case <-s.done:
+			return nil, redisPubSubClosedErr
+		case <-time.After(timeout):
+			return nil, &redisNetError{msg: "i/o timeout", timeout: true}
+		}
+	}
+
+	s.mu.Lock()
+	d := redisReplayDelay(ev.Offset - s.last)
+	s.last = ev.Offset
+	s.mu.Unlock()
+
+	if d > 0 {
+		select {
+		case <-s.done:
+			return nil, redisPubSubClosedErr
+		case <-time.After(d):
+		}
+	}
+
+	return ev.value()
+}
+
+// redis.PubSub.Subscribe() hook, nothing is sent to server for replaying,
+// as subscribing is replied by messages received, which are replayed by PubSub.ReceiveTimeout().
+func redisPubSubSubscribe(ps *redis.PubSub, channels ...string) error {
+	getRedisPubSub(ps, true).subscribe("subscribe", channels)
+	if !GlobalMgr.ShouldRecord() {
+		return nil
+	}
+
+	return redisPubSubSubscribeTrampoline(ps, channels...)
+}
+
+//go:noinline
+func redisPubSubSubscribeTrampoline(ps *redis.PubSub, channels ...string) error {
+	fmt.Printf("dummy function for regrestion testing:%v", ps)
+
+	for i := 0; i < 100000; i++ {
+		fmt.Printf("id:%d\n", i)
+		go func() { fmt.Printf("hello world\n") }()
+	}
+
+	if ps != nil {
+		panic("trampoline redis redis.PubSub.Subscribe() function is not allowed to be called")
+	}
+
+	return nil
+}
+
+// redis.PubSub.PSubscribe() hook
+func redisPubSubPSubscribe(ps *redis.PubSub, patterns ...string) error {
+	getRedisPubSub(ps, true).subscribe("psubscribe", patterns)
+	if !GlobalMgr.ShouldRecord() {
+		return nil
+	}
+
+	return redisPubSubPSubscribeTrampoline(ps, patterns...)
+}
+
+//go:noinline
+func redisPubSubPSubscribeTrampoline(ps *redis.PubSub, patterns ...string) error {
+	fmt.Printf("dummy function for regrestion testing:%v", ps)
+
+	for i := 0; i < 100000; i++ {
+		fmt.Printf("id:%d\n", i)
+		go func() { fmt.Printf("hello world\n") }()
+	}
+
+	if ps != nil {
+		panic("trampoline redis redis.PubSub.PSubscribe() function is not allowed to be called")
+	}
+
+	return nil
+}
+
+// redis.PubSub.ReceiveTimeout() hook
+func redisPubSubReceiveTimeout(ps *redis.PubSub, timeout time.Duration) (interface{}, error) {
+	if GlobalMgr.ShouldRecord() {
+		msg, err := redisPubSubReceiveTimeoutTrampoline(ps, timeout)
+		if err != redisPubSubClosedErr {
+			getRedisPubSub(ps, true).save(msg, err)
+		}
+		return msg, err
+	}
+
+	s := getRedisPubSub(ps, false)
+	if s == nil {
+		// PubSub is closed, or no channel is subscribed.
+		return nil, redisPubSubClosedErr
+	}
+
+	return s.receive(timeout)
+}
+
+//go:noinline
+func redisPubSubReceiveTimeoutTrampoline(ps *redis.PubSub, timeout time.Duration) (interface{}, error) {
+	fmt.Printf("dummy function for regrestion testing:%v", ps)
+
+	for i := 0; i < 100000; i++ {
+		fmt.Printf("id:%d\n", i)
+		go func() { fmt.Printf("hello world\n") }()
+	}
+
+	if ps != nil {
+		panic("trampoline redis redis.PubSub.ReceiveTimeout() function is not allowed to be called")
+	}
+
+	return nil, nil
+}
+
+// redis.PubSub.Close() hook
+func redisPubSubClose(ps *redis.PubSub) error {
+	s := removeRedisPubSub(ps)
+	if s != nil {
+		s.close()
+	}
+
+	return redisPubSubCloseTrampoline(ps)
+}
+
+//go:noinline
+func redisPubSubCloseTrampoline(ps *redis.PubSub) error {
+	fmt.Printf("dummy function for regrestion testing:%v", ps)
+
+	for i := 0; i < 100000; i++ {
+		fmt.Printf("id:%d\n", i)
+		go func() { fmt.Printf("hello world\n") }()
+	}
+
+	if ps != nil {
+		panic("trampoline redis redis.PubSub.Close() function is not allowed to be called")
+	}
+
+	return nil
+}
+
+// unsubscribing and ping are replied by messages received, which are replayed by PubSub.ReceiveTimeout().
+func redisPubSubUnsubscribe(ps *redis.PubSub, channels ...string) error {
+	return nil
+}
+
+// PubSub.Channel() pings server when no message is received for 30 seconds, and reconnects if still nothing,
+// ping channel is fed as if pong is received, so that no connection is made in replaying.
+func redisPubSubPing(ps *redis.PubSub, payload ...string) error {
+	v := reflect.ValueOf(ps).Elem().FieldByName("ping")
+	if !v.IsValid() || v.Kind() != reflect.Chan {
+		return nil
+	}
+
+	ch := reflect.NewAt(v.Type(), unsafe.Pointer(v.UnsafeAddr())).Elem()
+	if !ch.IsNil() {
+		ch.TrySend(reflect.Zero(ch.Type().Elem()))
+	}
+
+	return nil
+}
+
+var (
+	redisPubSubReplayHooks = []CmdValue{
+		CmdValue{&redis.PubSub{}, "Unsubscribe", redisPubSubUnsubscribe, nil},
+		CmdValue{&redis.PubSub{}, "PUnsubscribe", redisPubSubUnsubscribe, nil},
+		CmdValue{&redis.PubSub{}, "Ping", redisPubSubPing, nil},
+	}
+)
+
+// isRedisBlockingCmd checks whether cmd blocks until data is available, eg: BLPOP, XREAD BLOCK.
+func isRedisBlockingCmd(cmd redis.Cmder) bool {
+	switch strings.ToLower(cmd.Name()) {
+	case "blpop", "brpop", "brpoplpush", "bzpopmin", "bzpopmax":
+		return true
+	case "xread", "xreadgroup":
+		for _, arg := range cmd.Args() {
+			if s, ok := arg.(string); ok && strings.ToLower(s) == "block" {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func saveRedisCmdElapsed(key string, cmd redis.Cmder, d time.Duration) {
+	if !isRedisBlockingCmd(cmd) {
+		return
+	}
+
+	GlobalMgr.StoreValue(key+"@elapsed", []byte(d.String()))
+	GlobalMgr.notifier("redis blocking cmd recording", key, []byte(d.String()))
+}
+
+// replayRedisCmdElapsed waits for scaled time elapsed by blocking cmd, it must be called before key is added to cmd.
+func replayRedisCmdElapsed(key string, cmd redis.Cmder) {
+	if !isRedisBlockingCmd(cmd) {
+		return
+	}
+
+	data, err := GlobalMgr.GetValue(key + "@elapsed")
+	if err != nil || len(data) == 0 {
+		return
+	}
+
+	d, err := time.ParseDuration(string(data))
+	if err != nil {
+		GlobalMgr.notifier("redis invalid elapsed time of blocking cmd", key, data)
+		return
+	}
+
+	time.Sleep(redisReplayDelay(d))
+}
+
+func hookRedisPubSub(ps *redis.PubSub) error {
+	err := gohook.HookMethod(ps, "Subscribe", redisPubSubSubscribe, redisPubSubSubscribeTrampoline)
+	if err != nil {
+		return fmt.Errorf("hook redis.PubSub.Subscribe() failed, err:%s", err.Error())
+	}
+
+	err = gohook.HookMethod(ps, "PSubscribe", redisPubSubPSubscribe, redisPubSubPSubscribeTrampoline)
+	if err != nil {
+		return fmt.Errorf("hook redis.PubSub.PSubscribe() failed, err:%s", err.Error())
+	}
+
+	err = gohook.HookMethod(ps, "ReceiveTimeout", redisPubSubReceiveTimeout, redisPubSubReceiveTimeoutTrampoline)
+	if err != nil {
+		return fmt.Errorf("hook redis.PubSub.ReceiveTimeout() failed, err:%s", err.Error())
+	}
+
+	err = gohook.HookMethod(ps, "Close", redisPubSubClose, redisPubSubCloseTrampoline)
+	if err != nil {
+		return fmt.Errorf("hook redis.PubSub.Close() failed, err:%s", err.Error())
+	}
+
+	return nil
+}
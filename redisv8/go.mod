@@ -0,0 +1,12 @@
+module gorr/redisv8
+
+go 1.14
+
+require (
+	github.com/brahma-adshonor/gohook v0.0.0-20191009123657-4dfde2738c74
+	github.com/go-redis/redis/v8 v8.11.5
+	github.com/stretchr/testify v1.5.1
+	gorr v0.0.0-00010101000000-000000000000
+)
+
+replace gorr => ../
@@ -0,0 +1,321 @@
+// Package redisv8 records and replays redis cmds of github.com/go-redis/redis/v8.
+//
+// it is registered to gorr by importing, hooks are enabled by gorr.GlobalMgr.EnableHook():
+//
+//	import _ "gorr/redisv8"
+package redisv8
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/brahma-adshonor/gohook"
+	"github.com/go-redis/redis/v8"
+
+	"gorr"
+)
+
+// please disable inlining by adding following gcflags to compiler
+// go build -gcflags=all='-l=1' -o main main.go
+
+/*
+hook point:
+1. NewClient()/NewClusterClient(): used to add Hook to clients.
+2. Hook.BeforeProcess()/BeforeProcessPipeline(): for replaying, recorded results are set to cmds,
+   and errReplayed is returned to stop go-redis from sending cmds to server.
+3. Hook.AfterProcess()/AfterProcessPipeline(): for recording, and restoring errors of cmds overwritten by errReplayed.
+4. Client.Process()/ClusterClient.Process()/Pipeline.Exec(): used to ignore errReplayed.
+*/
+
+var (
+	replayer    = gorr.NewRedisCmdReplayer(redis.TxFailedErr)
+	errReplayed = errors.New("gorr redis dummy error for replayed cmd")
+)
+
+func init() {
+	gorr.RegisterHook("redisv8", HookRedisFunc, UnHookRedisFunc)
+}
+
+type replayedKey struct{}
+
+// replayed keeps errors of replayed cmds, until they are restored by AfterProcess()/AfterProcessPipeline().
+type replayed struct {
+	cmds []redis.Cmder
+	errs []error
+}
+
+// Hook records and replays cmds, it is added to clients created after HookRedisFunc() is called,
+// or it can be added by client.AddHook() explicitly.
+type Hook struct {
+	id string
+}
+
+// NewHook creates hook for client of id, see ClientId() and ClusterClientId().
+func NewHook(id string) *Hook {
+	return &Hook{id: id}
+}
+
+func ClientId(c *redis.Client) string {
+	opt := c.Options()
+	return fmt.Sprintf("redis_client_id@%s@%s", opt.Addr, opt.Network)
+}
+
+func ClusterClientId(c *redis.ClusterClient) string {
+	opt := c.Options()
+	return fmt.Sprintf("redis_cluster_client_id@%s", strings.Join(opt.Addrs, "#"))
+}
+
+func (h *Hook) BeforeProcess(ctx context.Context, cmd redis.Cmder) (context.Context, error) {
+	if gorr.GlobalMgr.ShouldRecord() {
+		return ctx, nil
+	}
+
+	err := replayer.Replay(replayer.Key(ctx, h.id, cmd), cmd)
+	r := &replayed{cmds: []redis.Cmder{cmd}, errs: []error{err}}
+	return context.WithValue(ctx, replayedKey{}, r), errReplayed
+}
+
+func (h *Hook) AfterProcess(ctx context.Context, cmd redis.Cmder) error {
+	if r, ok := ctx.Value(replayedKey{}).(*replayed); ok && len(r.cmds) == 1 && r.cmds[0] == cmd {
+		cmd.SetErr(r.errs[0])
+		return r.errs[0]
+	}
+
+	if gorr.GlobalMgr.ShouldRecord() {
+		replayer.Save(replayer.Key(ctx, h.id, cmd), cmd, nil)
+	}
+
+	return nil
+}
+
+func (h *Hook) BeforeProcessPipeline(ctx context.Context, cmds []redis.Cmder) (context.Context, error) {
+	if gorr.GlobalMgr.ShouldRecord() {
+		return ctx, nil
+	}
+
+	r := &replayed{cmds: cmds}
+	for _, cc := range cmds {
+		r.errs = append(r.errs, replayer.Replay(replayer.Key(ctx, h.id, cc), cc))
+	}
+
+	return context.WithValue(ctx, replayedKey{}, r), errReplayed
+}
+
+func (h *Hook) AfterProcessPipeline(ctx context.Context, cmds []redis.Cmder) error {
+	if r, ok := ctx.Value(replayedKey{}).(*replayed); ok && len(r.cmds) == len(cmds) {
+		for i, cc := range cmds {
+			cc.SetErr(r.errs[i])
+		}
+		return nil
+	}
+
+	if gorr.GlobalMgr.ShouldRecord() {
+		for _, cc := range cmds {
+			replayer.Save(replayer.Key(ctx, h.id, cc), cc, nil)
+		}
+	}
+
+	return nil
+}
+
+func cmdsFirstErr(cmds []redis.Cmder) error {
+	for _, cc := range cmds {
+		if err := cc.Err(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func newRedisClient(opt *redis.Options) *redis.Client {
+	c := newRedisClientTrampoline(opt)
+	if c != nil {
+		c.AddHook(NewHook(ClientId(c)))
+	}
+
+	return c
+}
+
+//go:noinline
+func newRedisClientTrampoline(opt *redis.Options) *redis.Client {
+	fmt.Printf("dummy function for regrestion testing:%v", opt)
+
+	for i := 0; i < 100000; i++ {
+		fmt.Printf("id:%d\n", i)
+		go func() { fmt.Printf("hello world\n") }()
+	}
+
+	if opt != nil {
+		panic("trampoline function is not allowed to be called directly")
+	}
+
+	return nil
+}
+
+func newRedisClusterClient(opt *redis.ClusterOptions) *redis.ClusterClient {
+	c := newRedisClusterClientTrampoline(opt)
+	if c != nil {
+		c.AddHook(NewHook(ClusterClientId(c)))
+	}
+
+	return c
+}
+
+//go:noinline
+func newRedisClusterClientTrampoline(opt *redis.ClusterOptions) *redis.ClusterClient {
+	fmt.Printf("dummy function for regrestion testing:%v", opt)
+
+	for i := 0; i < 100000; i++ {
+		fmt.Printf("id:%d\n", i)
+		go func() { fmt.Printf("hello world\n") }()
+	}
+
+	if opt != nil {
+		panic("trampoline function is not allowed to be called directly")
+	}
+
+	return nil
+}
+
+func redisClientProcess(c *redis.Client, ctx context.Context, cmd redis.Cmder) error {
+	err := redisClientProcessTrampoline(c, ctx, cmd)
+	if err == errReplayed {
+		return cmd.Err()
+	}
+
+	return err
+}
+
+//go:noinline
+func redisClientProcessTrampoline(c *redis.Client, ctx context.Context, cmd redis.Cmder) error {
+	fmt.Printf("dummy function for regrestion testing:%v, %v", c, ctx)
+
+	for i := 0; i < 100000; i++ {
+		fmt.Printf("id:%d\n", i)
+		go func() { fmt.Printf("hello world\n") }()
+	}
+
+	if c != nil {
+		panic("trampoline function is not allowed to be called directly")
+	}
+
+	return nil
+}
+
+func redisClusterClientProcess(c *redis.ClusterClient, ctx context.Context, cmd redis.Cmder) error {
+	err := redisClusterClientProcessTrampoline(c, ctx, cmd)
+	if err == errReplayed {
+		return cmd.Err()
+	}
+
+	return err
+}
+
+//go:noinline
+func redisClusterClientProcessTrampoline(c *redis.ClusterClient, ctx context.Context, cmd redis.Cmder) error {
+	fmt.Printf("dummy function for regrestion testing:%v, %v", c, ctx)
+
+	for i := 0; i < 100000; i++ {
+		fmt.Printf("id:%d\n", i)
+		go func() { fmt.Printf("hello world\n") }()
+	}
+
+	if c != nil {
+		panic("trampoline function is not allowed to be called directly")
+	}
+
+	return nil
+}
+
+func redisPipelineExec(p *redis.Pipeline, ctx context.Context) ([]redis.Cmder, error) {
+	cmds, err := redisPipelineExecTrampoline(p, ctx)
+	if err == errReplayed {
+		return cmds, cmdsFirstErr(cmds)
+	}
+
+	return cmds, err
+}
+
+//go:noinline
+func redisPipelineExecTrampoline(p *redis.Pipeline, ctx context.Context) ([]redis.Cmder, error) {
+	fmt.Printf("dummy function for regrestion testing:%v, %v", p, ctx)
+
+	for i := 0; i < 100000; i++ {
+		fmt.Printf("id:%d\n", i)
+		go func() { fmt.Printf("hello world\n") }()
+	}
+
+	if p != nil {
+		panic("trampoline function is not allowed to be called directly")
+	}
+
+	return nil, nil
+}
+
+func UnHookRedisFunc() error {
+	var c1 redis.Client
+	var c2 redis.ClusterClient
+	var pl redis.Pipeline
+
+	msg := ""
+	for _, err := range []error{
+		gohook.UnHook(redis.NewClient),
+		gohook.UnHook(redis.NewClusterClient),
+		gohook.UnHookMethod(&c1, "Process"),
+		gohook.UnHookMethod(&c2, "Process"),
+		gohook.UnHookMethod(&pl, "Exec"),
+	} {
+		if err != nil {
+			msg += err.Error() + "@@"
+		}
+	}
+
+	if msg != "" {
+		return fmt.Errorf("unhook redis v8 failed:%s", msg)
+	}
+
+	return nil
+}
+
+func HookRedisFunc() error {
+	var err error
+	var c1 redis.Client
+	var c2 redis.ClusterClient
+	var pl redis.Pipeline
+
+	defer func() {
+		if err != nil {
+			UnHookRedisFunc()
+		}
+	}()
+
+	err = gohook.Hook(redis.NewClient, newRedisClient, newRedisClientTrampoline)
+	if err != nil {
+		return fmt.Errorf("hook redis.NewClient() failed, err:%s", err.Error())
+	}
+
+	err = gohook.Hook(redis.NewClusterClient, newRedisClusterClient, newRedisClusterClientTrampoline)
+	if err != nil {
+		return fmt.Errorf("hook redis.NewClusterClient() failed, err:%s", err.Error())
+	}
+
+	err = gohook.HookMethod(&c1, "Process", redisClientProcess, redisClientProcessTrampoline)
+	if err != nil {
+		return fmt.Errorf("hook redis.Client.Process() failed, err:%s", err.Error())
+	}
+
+	err = gohook.HookMethod(&c2, "Process", redisClusterClientProcess, redisClusterClientProcessTrampoline)
+	if err != nil {
+		return fmt.Errorf("hook redis.ClusterClient.Process() failed, err:%s", err.Error())
+	}
+
+	err = gohook.HookMethod(&pl, "Exec", redisPipelineExec, redisPipelineExecTrampoline)
+	if err != nil {
+		return fmt.Errorf("hook redis pipeline.Exec() failed, err:%s", err.Error())
+	}
+
+	return nil
+}
@@ -0,0 +1,131 @@
+package redisv8
+
+import (
+	"context"
+	"testing"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/stretchr/testify/assert"
+
+	"gorr"
+)
+
+type traceKey struct{}
+
+func setupHook(t *testing.T) {
+	gorr.EnableRegressionEngine(gorr.RegressionRecord)
+	gorr.GlobalMgr.SetState(gorr.RegressionRecord)
+	gorr.GlobalMgr.SetStorage(gorr.NewMapStorage(100))
+
+	err := HookRedisFunc()
+	assert.Nil(t, err)
+}
+
+// record processes cmd by hook, result of cmd is set by fn instead of redis server.
+func record(ctx context.Context, h *Hook, cmd redis.Cmder, fn func()) {
+	ctx, _ = h.BeforeProcess(ctx, cmd)
+	fn()
+	h.AfterProcess(ctx, cmd)
+}
+
+func TestHook(t *testing.T) {
+	setupHook(t)
+	defer UnHookRedisFunc()
+
+	ctx := context.Background()
+	c := redis.NewClient(&redis.Options{Addr: "127.0.0.1:1"})
+	h := NewHook(ClientId(c))
+
+	get := redis.NewStringCmd(ctx, "get", "foo")
+	record(ctx, h, get, func() { get.SetVal("bar") })
+
+	miss := redis.NewStringCmd(ctx, "get", "miss")
+	record(ctx, h, miss, func() { miss.SetErr(redis.Nil) })
+
+	scan := redis.NewScanCmd(ctx, nil, "scan", 0, "match", "k*", "count", 10)
+	record(ctx, h, scan, func() { scan.SetVal([]string{"k1", "k2"}, 12) })
+
+	eval := redis.NewCmd(ctx, "eval", "return {1,'a'}", 0)
+	record(ctx, h, eval, func() { eval.SetVal([]interface{}{int64(1), "a", nil}) })
+
+	hash := redis.NewStringStringMapCmd(ctx, "hgetall", "h")
+	record(ctx, h, hash, func() { hash.SetVal(map[string]string{"f": "v"}) })
+
+	timeout := redis.NewIntCmd(ctx, "incr", "slow")
+	record(ctx, h, timeout, func() { timeout.SetErr(context.DeadlineExceeded) })
+
+	p1 := redis.NewIntCmd(ctx, "incr", "p1")
+	p2 := redis.NewStringCmd(ctx, "get", "p2")
+	pipe := []redis.Cmder{p1, p2}
+	ctx2, _ := h.BeforeProcessPipeline(ctx, pipe)
+	p1.SetVal(3)
+	p2.SetErr(redis.Nil)
+	h.AfterProcessPipeline(ctx2, pipe)
+
+	gorr.GlobalMgr.SetState(gorr.RegressionReplay)
+
+	c2 := redis.NewClient(&redis.Options{Addr: "127.0.0.1:1"})
+
+	v, err := c2.Get(ctx, "foo").Result()
+	assert.Nil(t, err)
+	assert.Equal(t, "bar", v)
+
+	assert.Equal(t, redis.Nil, c2.Get(ctx, "miss").Err())
+
+	keys, cursor, err := c2.Scan(ctx, 0, "k*", 10).Result()
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"k1", "k2"}, keys)
+	assert.Equal(t, uint64(12), cursor)
+
+	ev, err := c2.Eval(ctx, "return {1,'a'}", nil).Result()
+	assert.Nil(t, err)
+	assert.Equal(t, []interface{}{int64(1), "a", nil}, ev)
+
+	assert.Equal(t, map[string]string{"f": "v"}, c2.HGetAll(ctx, "h").Val())
+	assert.Equal(t, context.DeadlineExceeded, c2.Incr(ctx, "slow").Err())
+
+	cmd := redis.NewStringCmd(ctx, "get", "foo")
+	assert.Nil(t, c2.Process(ctx, cmd))
+	assert.Equal(t, "bar", cmd.Val())
+
+	pp := c2.Pipeline()
+	r1 := pp.Incr(ctx, "p1")
+	r2 := pp.Get(ctx, "p2")
+	_, err = pp.Exec(ctx)
+	assert.Equal(t, redis.Nil, err)
+	assert.Equal(t, int64(3), r1.Val())
+	assert.Equal(t, redis.Nil, r2.Err())
+
+	// not recorded
+	assert.NotNil(t, c2.Get(ctx, "other").Err())
+}
+
+func TestHookTraceScope(t *testing.T) {
+	setupHook(t)
+	defer UnHookRedisFunc()
+
+	gorr.GlobalMgr.SetGenKey(func(hook int, ctx context.Context, v interface{}) string {
+		if hook != gorr.RegressionRedisHook {
+			return ""
+		}
+		s, _ := ctx.Value(traceKey{}).(string)
+		return s
+	})
+	defer gorr.GlobalMgr.SetGenKey(func(int, context.Context, interface{}) string { return "" })
+
+	c := redis.NewClient(&redis.Options{Addr: "127.0.0.1:2"})
+	h := NewHook(ClientId(c))
+	ctx1 := context.WithValue(context.Background(), traceKey{}, "t1")
+	ctx2 := context.WithValue(context.Background(), traceKey{}, "t2")
+
+	get1 := redis.NewStringCmd(ctx1, "get", "foo")
+	record(ctx1, h, get1, func() { get1.SetVal("v1") })
+
+	get2 := redis.NewStringCmd(ctx2, "get", "foo")
+	record(ctx2, h, get2, func() { get2.SetVal("v2") })
+
+	gorr.GlobalMgr.SetState(gorr.RegressionReplay)
+
+	assert.Equal(t, "v2", c.Get(ctx2, "foo").Val())
+	assert.Equal(t, "v1", c.Get(ctx1, "foo").Val())
+}
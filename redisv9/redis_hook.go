@@ -0,0 +1,188 @@
+// Package redisv9 records and replays redis cmds of github.com/redis/go-redis/v9.
+//
+// it is registered to gorr by importing, hooks are enabled by gorr.GlobalMgr.EnableHook():
+//
+//	import _ "gorr/redisv9"
+package redisv9
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/brahma-adshonor/gohook"
+	"github.com/redis/go-redis/v9"
+
+	"gorr"
+)
+
+// please disable inlining by adding following gcflags to compiler
+// go build -gcflags=all='-l=1' -o main main.go
+
+/*
+hook point:
+1. NewClient()/NewClusterClient(): used to add Hook to clients.
+2. Hook.ProcessHook()/ProcessPipelineHook(): cmds are recorded after next hook returns,
+   for replaying, recorded results are set to cmds and next hook is skipped, so nothing is sent to server.
+*/
+
+var replayer = gorr.NewRedisCmdReplayer(redis.TxFailedErr)
+
+func init() {
+	gorr.RegisterHook("redisv9", HookRedisFunc, UnHookRedisFunc)
+}
+
+// Hook records and replays cmds, it is added to clients created after HookRedisFunc() is called,
+// or it can be added by client.AddHook() explicitly.
+type Hook struct {
+	id string
+}
+
+// NewHook creates hook for client of id, see ClientId() and ClusterClientId().
+func NewHook(id string) *Hook {
+	return &Hook{id: id}
+}
+
+func ClientId(c *redis.Client) string {
+	opt := c.Options()
+	return fmt.Sprintf("redis_client_id@%s@%s", opt.Addr, opt.Network)
+}
+
+func ClusterClientId(c *redis.ClusterClient) string {
+	opt := c.Options()
+	return fmt.Sprintf("redis_cluster_client_id@%s", strings.Join(opt.Addrs, "#"))
+}
+
+func (h *Hook) DialHook(next redis.DialHook) redis.DialHook {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		if !gorr.GlobalMgr.ShouldRecord() {
+			return nil, fmt.Errorf("redis dial is not allowed in replaying, addr:%s", addr)
+		}
+		return next(ctx, network, addr)
+	}
+}
+
+func (h *Hook) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		key := replayer.Key(ctx, h.id, cmd)
+		if !gorr.GlobalMgr.ShouldRecord() {
+			return replayer.Replay(key, cmd)
+		}
+
+		err := next(ctx, cmd)
+		replayer.Save(key, cmd, err)
+		return err
+	}
+}
+
+func (h *Hook) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return func(ctx context.Context, cmds []redis.Cmder) error {
+		if !gorr.GlobalMgr.ShouldRecord() {
+			var first error
+			for _, cc := range cmds {
+				err := replayer.Replay(replayer.Key(ctx, h.id, cc), cc)
+				if first == nil {
+					first = err
+				}
+			}
+			return first
+		}
+
+		err := next(ctx, cmds)
+		for _, cc := range cmds {
+			replayer.Save(replayer.Key(ctx, h.id, cc), cc, nil)
+		}
+		return err
+	}
+}
+
+func newRedisClient(opt *redis.Options) *redis.Client {
+	c := newRedisClientTrampoline(opt)
+	if c != nil {
+		c.AddHook(NewHook(ClientId(c)))
+	}
+
+	return c
+}
+
+//go:noinline
+func newRedisClientTrampoline(opt *redis.Options) *redis.Client {
+	fmt.Printf("dummy function for regrestion testing:%v", opt)
+
+	for i := 0; i < 100000; i++ {
+		fmt.Printf("id:%d\n", i)
+		go func() { fmt.Printf("hello world\n") }()
+	}
+
+	if opt != nil {
+		panic("trampoline function is not allowed to be called directly")
+	}
+
+	return nil
+}
+
+func newRedisClusterClient(opt *redis.ClusterOptions) *redis.ClusterClient {
+	c := newRedisClusterClientTrampoline(opt)
+	if c != nil {
+		c.AddHook(NewHook(ClusterClientId(c)))
+	}
+
+	return c
+}
+
+//go:noinline
+func newRedisClusterClientTrampoline(opt *redis.ClusterOptions) *redis.ClusterClient {
+	fmt.Printf("dummy function for regrestion testing:%v", opt)
+
+	for i := 0; i < 100000; i++ {
+		fmt.Printf("id:%d\n", i)
+		go func() { fmt.Printf("hello world\n") }()
+	}
+
+	if opt != nil {
+		panic("trampoline function is not allowed to be called directly")
+	}
+
+	return nil
+}
+
+func UnHookRedisFunc() error {
+	msg := ""
+	for _, err := range []error{
+		gohook.UnHook(redis.NewClient),
+		gohook.UnHook(redis.NewClusterClient),
+	} {
+		if err != nil {
+			msg += err.Error() + "@@"
+		}
+	}
+
+	if msg != "" {
+		return fmt.Errorf("unhook redis v9 failed:%s", msg)
+	}
+
+	return nil
+}
+
+func HookRedisFunc() error {
+	var err error
+
+	defer func() {
+		if err != nil {
+			UnHookRedisFunc()
+		}
+	}()
+
+	err = gohook.Hook(redis.NewClient, newRedisClient, newRedisClientTrampoline)
+	if err != nil {
+		return fmt.Errorf("hook redis.NewClient() failed, err:%s", err.Error())
+	}
+
+	err = gohook.Hook(redis.NewClusterClient, newRedisClusterClient, newRedisClusterClientTrampoline)
+	if err != nil {
+		return fmt.Errorf("hook redis.NewClusterClient() failed, err:%s", err.Error())
+	}
+
+	return nil
+}
@@ -0,0 +1,113 @@
+package redisv9
+
+import (
+	"context"
+	"testing"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+
+	"gorr"
+)
+
+type traceKey struct{}
+
+func setupHook(t *testing.T) {
+	gorr.EnableRegressionEngine(gorr.RegressionRecord)
+	gorr.GlobalMgr.SetState(gorr.RegressionRecord)
+	gorr.GlobalMgr.SetStorage(gorr.NewMapStorage(100))
+
+	err := HookRedisFunc()
+	assert.Nil(t, err)
+}
+
+// record processes cmd by hook, result of cmd is set by fn instead of redis server.
+func record(ctx context.Context, h *Hook, cmd redis.Cmder, fn func() error) {
+	h.ProcessHook(func(ctx context.Context, cmd redis.Cmder) error {
+		return fn()
+	})(ctx, cmd)
+}
+
+func TestHook(t *testing.T) {
+	setupHook(t)
+	defer UnHookRedisFunc()
+
+	ctx := context.Background()
+	c := redis.NewClient(&redis.Options{Addr: "127.0.0.1:1"})
+	h := NewHook(ClientId(c))
+
+	get := redis.NewStringCmd(ctx, "get", "foo")
+	record(ctx, h, get, func() error { get.SetVal("bar"); return nil })
+
+	miss := redis.NewStringCmd(ctx, "get", "miss")
+	record(ctx, h, miss, func() error { return redis.Nil })
+
+	zs := []redis.Z{{Score: 1, Member: "m1"}}
+	zrange := redis.NewZSliceCmd(ctx, "zrange", "z", 0, -1, "withscores")
+	record(ctx, h, zrange, func() error { zrange.SetVal(zs); return nil })
+
+	eval := redis.NewCmd(ctx, "eval", "return 1", 0)
+	record(ctx, h, eval, func() error { eval.SetVal(int64(1)); return nil })
+
+	p1 := redis.NewIntCmd(ctx, "incr", "p1")
+	p2 := redis.NewStringCmd(ctx, "get", "p2")
+	h.ProcessPipelineHook(func(ctx context.Context, cmds []redis.Cmder) error {
+		p1.SetVal(3)
+		p2.SetErr(redis.Nil)
+		return redis.Nil
+	})(ctx, []redis.Cmder{p1, p2})
+
+	gorr.GlobalMgr.SetState(gorr.RegressionReplay)
+
+	v, err := c.Get(ctx, "foo").Result()
+	assert.Nil(t, err)
+	assert.Equal(t, "bar", v)
+
+	assert.Equal(t, redis.Nil, c.Get(ctx, "miss").Err())
+	assert.Equal(t, zs, c.ZRangeWithScores(ctx, "z", 0, -1).Val())
+
+	ev, err := c.Eval(ctx, "return 1", nil).Result()
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), ev)
+
+	pp := c.Pipeline()
+	r1 := pp.Incr(ctx, "p1")
+	r2 := pp.Get(ctx, "p2")
+	_, err = pp.Exec(ctx)
+	assert.Equal(t, redis.Nil, err)
+	assert.Equal(t, int64(3), r1.Val())
+	assert.Equal(t, redis.Nil, r2.Err())
+
+	// not recorded
+	assert.NotNil(t, c.Get(ctx, "other").Err())
+}
+
+func TestHookTraceScope(t *testing.T) {
+	setupHook(t)
+	defer UnHookRedisFunc()
+
+	gorr.GlobalMgr.SetGenKey(func(hook int, ctx context.Context, v interface{}) string {
+		if hook != gorr.RegressionRedisHook {
+			return ""
+		}
+		s, _ := ctx.Value(traceKey{}).(string)
+		return s
+	})
+	defer gorr.GlobalMgr.SetGenKey(func(int, context.Context, interface{}) string { return "" })
+
+	c := redis.NewClient(&redis.Options{Addr: "127.0.0.1:2"})
+	h := NewHook(ClientId(c))
+	ctx1 := context.WithValue(context.Background(), traceKey{}, "t1")
+	ctx2 := context.WithValue(context.Background(), traceKey{}, "t2")
+
+	get1 := redis.NewStringCmd(ctx1, "get", "foo")
+	record(ctx1, h, get1, func() error { get1.SetVal("v1"); return nil })
+
+	get2 := redis.NewStringCmd(ctx2, "get", "foo")
+	record(ctx2, h, get2, func() error { get2.SetVal("v2"); return nil })
+
+	gorr.GlobalMgr.SetState(gorr.RegressionReplay)
+
+	assert.Equal(t, "v2", c.Get(ctx2, "foo").Val())
+	assert.Equal(t, "v1", c.Get(ctx1, "foo").Val())
+}
@@ -17,3 +17,9 @@ go test
 cd ../dbtool
 go test
 
+
+cd $CURPATH/redisv8
+go test -gcflags=all='-l'
+
+cd $CURPATH/redisv9
+go test -gcflags=all='-l'
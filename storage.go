@@ -8,6 +8,7 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"sort"
 	"sync"
 	"time"
 )
@@ -47,6 +48,31 @@ func (s *MapStorage) Get(key string) ([]byte, error) {
 	return v, nil
 }
 
+func (s *MapStorage) ForEach(fn func(key string, value []byte) error) error {
+	s.mu.Lock()
+	keys := make([]string, 0, len(s.m))
+	for k := range s.m {
+		keys = append(keys, k)
+	}
+	s.mu.Unlock()
+
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		v, err := s.Get(k)
+		if err != nil {
+			continue
+		}
+
+		err = fn(k, v)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
 func (s *MapStorage) Clear() {
 	s.mu.Lock()
 	defer s.mu.Unlock()
@@ -187,6 +213,39 @@ func (s *BoltStorage) Get(key string) ([]byte, error) {
 	return ret[:len(ret)-1], nil
 }
 
+// ForEach walks all entries in key order, big values stored in separate files are loaded transparently.
+func (s *BoltStorage) ForEach(fn func(key string, value []byte) error) error {
+	keys := make([]string, 0, 1024)
+
+	s.mu.Lock()
+	err := s.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(*gorr_bolt_bucket_name))
+		return b.ForEach(func(k, v []byte) error {
+			keys = append(keys, string(k))
+			return nil
+		})
+	})
+	s.mu.Unlock()
+
+	if err != nil {
+		return err
+	}
+
+	for _, k := range keys {
+		v, err := s.Get(k)
+		if err != nil {
+			continue
+		}
+
+		err = fn(k, v)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
 func (s *BoltStorage) Clear() {
 }
 
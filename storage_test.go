@@ -76,3 +76,29 @@ func TestBoltDb(t *testing.T) {
 
 	assert.Equal(t, 2, len(db.AllFiles()))
 }
+
+func TestBoltDbForEach(t *testing.T) {
+	db, err := NewBoltStorage("./r.test.foreach.data")
+	assert.Nil(t, err)
+
+	defer func() {
+		for _, f := range db.AllFiles() {
+			os.Remove(f)
+		}
+	}()
+
+	assert.Nil(t, db.Put("k2", []byte("v2")))
+	assert.Nil(t, db.Put("k1", []byte("v1")))
+
+	keys := []string{}
+	values := []string{}
+	err = db.ForEach(func(k string, v []byte) error {
+		keys = append(keys, k)
+		values = append(values, string(v))
+		return nil
+	})
+
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"k1", "k2"}, keys)
+	assert.Equal(t, []string{"v1", "v2"}, values)
+}
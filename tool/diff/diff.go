@@ -1,177 +1,129 @@
 package main
 
 import (
-	"bytes"
 	"encoding/json"
 	"flag"
 	"fmt"
-	//"github.com/golang/protobuf/jsonpb"
-	//"github.com/golang/protobuf/proto"
-	//"github.com/golang/protobuf/ptypes/struct"
-	"github.com/pmezard/go-difflib/difflib"
-	"io/ioutil"
 	"os"
+	"strings"
+
+	"gorr/util/diff"
 )
 
 const (
-	recorderDataTypeUnknown  = 23
-	recorderDataTypeJSON     = 24
-	recorderDataTypePbText   = 25
-	recorderDataTypePbBinary = 26
+	formatText = "text"
+	formatJSON = "json"
 )
 
 var (
 	expect = flag.String("expect", "", "expected data")
 	actual = flag.String("actual", "", "actual data")
-	dType  = flag.Int("type", recorderDataTypeJSON, "data type for diff")
+	dType  = flag.Int("type", diff.DataTypeJSON, "data type for diff, 24 json, 25 protobuf text, 26 protobuf binary, 27 http, 28 xml, 29 yaml, 30 form")
+	format = flag.String("format", formatText, "output format, text or json")
+
+	msgType       = flag.String("msg", "", "full message type name for protobuf diff, eg: package.Message")
+	descriptorSet = flag.String("descriptor_set", "", "comma separated FileDescriptorSet files for protobuf diff")
+	msgStream     = flag.Bool("stream", false, "data is length delimited messages of a grpc stream")
+	pbDefaults    = flag.Bool("pb_keep_defaults", false, "compare fields set to default values, by default they are treated as absent")
+	pbUnknown     = flag.Bool("pb_keep_unknown", false, "compare unknown fields, by default they are ignored")
+	pbRepeated    = flag.String("pb_repeated", "order", "how repeated fields are compared: order or set")
+	headers       = flag.String("headers", "", "comma separated http headers to compare, * for all headers")
+	embeddedJSON  = flag.Bool("embedded_json", false, "decode and compare json objects or arrays embedded in strings")
+
+	rulesFile = flag.String("rules", "", "comma separated json files of diff rules, for ignored paths, tolerances, unordered arrays and matchers")
+
+	strategyName   = flag.String("strategy", "", "name of differ to use, eg: json, xml, or differs registered by plugins")
+	strategyCmd    = flag.String("strategy_cmd", "", "external differ command, see diff.CommandDiffer for the protocol")
+	strategyParams = flag.String("strategy_params", "", "parameters of differ, json object of strings")
 )
 
-func doDiff(dt int, ef, af string) (string, error) {
-	var err error
-	var diff string
-	var epData, atData []byte
-
-	epData, err = ioutil.ReadFile(ef)
-	if err != nil {
-		return "", fmt.Errorf("read expect data failed, file:%s, err: %s", ef, err)
+func options() (*diff.Options, error) {
+	opt := &diff.Options{
+		MsgType:      *msgType,
+		Stream:       *msgStream,
+		KeepDefaults: *pbDefaults,
+		KeepUnknown:  *pbUnknown,
+		Repeated:     *pbRepeated,
+		EmbeddedJSON: *embeddedJSON,
 	}
 
-	atData, err = ioutil.ReadFile(af)
-	if err != nil {
-		return "", fmt.Errorf("read actual data failed, file:%s, err: %s", af, err)
+	if len(*descriptorSet) > 0 {
+		opt.DescriptorSet = strings.Split(*descriptorSet, ",")
 	}
 
-	rawDiff := false
-	if dt == recorderDataTypeJSON {
-		diff, err = diffJSON(epData, atData)
-		if err != nil {
-			rawDiff = true
-		}
-	} else if dt == recorderDataTypePbBinary {
-		diff, err = diffProtobuf(epData, atData)
-		if err != nil {
-			rawDiff = true
-		}
-	} else {
-		rawDiff = true
+	if len(*headers) > 0 {
+		opt.Headers = strings.Split(*headers, ",")
 	}
 
-	if rawDiff {
-		if !bytes.Equal(epData, atData) {
-			diff, err = difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
-				A:        difflib.SplitLines(string(epData)),
-				B:        difflib.SplitLines(string(atData)),
-				FromFile: "Expected",
-				FromDate: "",
-				ToFile:   "Actual",
-				ToDate:   "",
-				Context:  1,
-			})
-
-			if err != nil {
-				diff = fmt.Sprintf("failed to perform raw diff, err:%s", err)
-			}
+	if len(*rulesFile) > 0 {
+		rules, err := diff.LoadRules(strings.Split(*rulesFile, ",")...)
+		if err != nil {
+			return nil, err
 		}
+		opt.Rules = rules
 	}
 
-	if len(diff) > 0 {
-		return fmt.Sprintf("diff output:\n%s\n", diff), nil
-	}
-
-	return "", nil
+	return opt, nil
 }
 
-func diffProtobuf(ep, at []byte) (string, error) {
-	// NOT working
-	panic("pb binary is not supported")
-}
-
-func diffJSON(ep, at []byte) (string, error) {
-	var ep1, at1 map[string]interface{}
-
-	err1 := json.Unmarshal(ep, &ep1)
-	if err1 != nil {
-		return "", fmt.Errorf("unmarshal expect data failed, err:%s", err1)
+func doDiff(opt *diff.Options) (*diff.Result, error) {
+	if len(*strategyName) == 0 && len(*strategyCmd) == 0 {
+		return diff.DiffFiles(*dType, *expect, *actual, opt)
 	}
 
-	err2 := json.Unmarshal(at, &at1)
-	if err2 != nil {
-		return "", fmt.Errorf("unmarshal actual data failed, err:%s", err2)
+	s := &diff.Strategy{Name: *strategyName, Cmd: *strategyCmd}
+	if len(*strategyParams) > 0 {
+		err := json.Unmarshal([]byte(*strategyParams), &s.Params)
+		if err != nil {
+			return nil, fmt.Errorf("invalid strategy params:%s, err:%s", *strategyParams, err)
+		}
 	}
 
-	d, err := diffAny("", ep1, at1)
-	if err != nil {
-		return "", fmt.Errorf("diff json map failed, err:%s", err)
-	}
+	return diff.DiffStrategyFiles(s, *dType, *expect, *actual, opt)
+}
 
-	if d == nil {
-		return "", nil
+// output returns diff in given format, json output is always present, text output is empty if no difference.
+func output(ret *diff.Result, f string) (string, error) {
+	if f == formatText {
+		return ret.String(), nil
 	}
 
-	diff := d.String(2)
-	if len(diff) == 0 {
-		return "", nil
+	d, err := json.Marshal(ret)
+	if err != nil {
+		return "", err
 	}
 
-	return "--- Expected\n+++ Actual\n@@@@@@@@@@@@@@@@@\n" + diff, nil
+	return string(d) + "\n", nil
 }
 
-func diffJSONText(ep, at []byte) (string, error) {
-	var ep1, at1 map[string]interface{}
-
-	err1 := json.Unmarshal(ep, &ep1)
-	if err1 != nil {
-		return "", fmt.Errorf("unmarshal expect data failed, err:%s", err1)
-	}
-
-	err2 := json.Unmarshal(at, &at1)
-	if err2 != nil {
-		return "", fmt.Errorf("unmarshal actual data failed, err:%s", err2)
-	}
-
-	var d1, d2 []byte
+func main() {
+	flag.Parse()
 
-	d1, err1 = json.MarshalIndent(ep1, "", "\t")
-	if err1 != nil {
-		return "", fmt.Errorf("marshal expect data failed, err:%s", err1)
+	if *format != formatText && *format != formatJSON {
+		fmt.Printf("invalid output format:%s\n", *format)
+		os.Exit(23)
 	}
 
-	d2, err2 = json.MarshalIndent(at1, "", "\t")
-	if err2 != nil {
-		return "", fmt.Errorf("marshal actual data failed, err:%s", err2)
+	opt, err := options()
+	if err != nil {
+		fmt.Printf("invalid diff options, err:%s\n", err)
+		os.Exit(23)
 	}
 
-	var err error
-	var diff string
-	if !bytes.Equal(d1, d2) {
-		diff, err = difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
-			A:        difflib.SplitLines(string(d1)),
-			B:        difflib.SplitLines(string(d2)),
-			FromFile: "Expected",
-			FromDate: "",
-			ToFile:   "Actual",
-			ToDate:   "",
-			Context:  1,
-		})
-
-		if err != nil {
-			return "", fmt.Errorf("failed to perform raw diff, err:%s", err)
-		}
+	ret, err := doDiff(opt)
+	if err != nil {
+		fmt.Printf("failed to perform diff, err:%s\n", err)
+		os.Exit(23)
 	}
 
-	return diff, nil
-}
-
-func main() {
-	flag.Parse()
-	diff, err := doDiff(*dType, *expect, *actual)
+	out, err := output(ret, *format)
 	if err != nil {
-		fmt.Printf("failed to perform diff, err:%s\n", err)
+		fmt.Printf("failed to output diff, err:%s\n", err)
 		os.Exit(23)
 	}
 
-	if len(diff) > 0 {
-		fmt.Printf("%s", diff)
+	fmt.Printf("%s", out)
+	if !ret.Equal() {
 		os.Exit(250)
 	}
 
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+
+	"gorr/util/pbdesc"
+
+	"github.com/golang/protobuf/proto"
+	"google.golang.org/grpc"
+)
+
+const (
+	// same as gorr.grpcDescriptorFile
+	grpcDescriptorFile = "reg_grpc.desc"
+)
+
+var (
+	grpcDescriptorSet = flag.String("grpc_descriptor_set", "", "comma separated FileDescriptorSet files of the service, used along with descriptors recorded with test cases")
+)
+
+func isGrpcCase(v *TestCase) bool {
+	return len(v.ReqMsg) > 0 && len(v.RspMsg) > 0 && strings.HasPrefix(v.URI, "/")
+}
+
+// grpcDescriptorFiles returns descriptor sets given by -grpc_descriptor_set and the one recorded in dir.
+func grpcDescriptorFiles(dir string) []string {
+	files := make([]string, 0, 4)
+	if len(*grpcDescriptorSet) > 0 {
+		files = append(files, strings.Split(*grpcDescriptorSet, ",")...)
+	}
+
+	local := dir + "/" + grpcDescriptorFile
+	if _, err := os.Stat(local); err == nil {
+		files = append(files, local)
+	}
+
+	return files
+}
+
+func loadGrpcRegistry(dir string) (*pbdesc.Registry, error) {
+	return pbdesc.ReadFileDescriptorSet(grpcDescriptorFiles(dir)...)
+}
+
+// splitGrpcMessages parses test case data in binary or jsonpb form into serialized messages.
+func splitGrpcMessages(r *pbdesc.Registry, msg string, dtype int, data []byte, stream bool) ([][]byte, error) {
+	if dtype == recorderDataTypePbBinary {
+		if !stream {
+			return [][]byte{data}, nil
+		}
+
+		var ret [][]byte
+		for len(data) > 0 {
+			l, n := proto.DecodeVarint(data)
+			if n == 0 || uint64(len(data)-n) < l {
+				return nil, fmt.Errorf("invalid length delimited messages")
+			}
+
+			ret = append(ret, data[n:n+int(l)])
+			data = data[n+int(l):]
+		}
+		return ret, nil
+	}
+
+	if dtype != recorderDataTypeJSON {
+		return nil, fmt.Errorf("unsupported grpc data type:%d", dtype)
+	}
+
+	if !stream {
+		d, err := r.FromJSON(msg, data)
+		if err != nil {
+			return nil, err
+		}
+		return [][]byte{d}, nil
+	}
+
+	var all struct {
+		Messages []json.RawMessage `json:"messages"`
+	}
+
+	err := json.Unmarshal(data, &all)
+	if err != nil {
+		return nil, fmt.Errorf("invalid json stream, err:%s", err)
+	}
+
+	ret := make([][]byte, 0, len(all.Messages))
+	for _, m := range all.Messages {
+		d, err := r.FromJSON(msg, m)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, d)
+	}
+
+	return ret, nil
+}
+
+// joinGrpcMessages is the reverse of splitGrpcMessages.
+func joinGrpcMessages(r *pbdesc.Registry, msg string, dtype int, msgs [][]byte, stream bool) ([]byte, error) {
+	if !stream && len(msgs) != 1 {
+		return nil, fmt.Errorf("exactly one message expected, got:%d", len(msgs))
+	}
+
+	if dtype == recorderDataTypePbBinary {
+		if !stream {
+			return msgs[0], nil
+		}
+
+		var out []byte
+		for _, m := range msgs {
+			out = append(out, proto.EncodeVarint(uint64(len(m)))...)
+			out = append(out, m...)
+		}
+		return out, nil
+	}
+
+	all := make([]interface{}, 0, len(msgs))
+	for _, m := range msgs {
+		v, err := r.Decode(msg, m)
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, v)
+	}
+
+	if !stream {
+		return json.MarshalIndent(all[0], "", "\t")
+	}
+
+	return json.MarshalIndent(map[string]interface{}{"messages": all}, "", "\t")
+}
+
+// runGrpcCase issues the grpc call recorded by gorr grpc recorder to addr, and writes response to output.
+func runGrpcCase(addr, dir string, v *TestCase, output string) ([]byte, error) {
+	r, err := loadGrpcRegistry(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	reqFile := dir + "/" + v.Req
+	data, err := ioutil.ReadFile(reqFile)
+	if err != nil {
+		return nil, fmt.Errorf("read request file failed, file:%s, err:%s", reqFile, err)
+	}
+
+	reqs, err := splitGrpcMessages(r, v.ReqMsg, v.ReqType, data, v.ClientStream)
+	if err != nil {
+		return nil, fmt.Errorf("parse grpc request failed, file:%s, err:%s", reqFile, err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(60)*time.Second)
+	defer cancel()
+
+	cc, err := grpc.DialContext(ctx, addr, grpc.WithInsecure(), grpc.WithBlock())
+	if err != nil {
+		return nil, fmt.Errorf("dial grpc server failed, addr:%s, err:%s", addr, err)
+	}
+	defer cc.Close()
+
+	var rsps [][]byte
+	if !v.ClientStream && !v.ServerStream {
+		var rsp []byte
+		err = cc.Invoke(ctx, v.URI, &reqs[0], &rsp, grpc.ForceCodec(pbdesc.RawCodec{}))
+		rsps = append(rsps, rsp)
+	} else {
+		rsps, err = callGrpcStream(ctx, cc, v, reqs)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("grpc call failed, method:%s, err:%s", v.URI, err)
+	}
+
+	out, err := joinGrpcMessages(r, v.RspMsg, v.RspType, rsps, v.ServerStream)
+	if err != nil {
+		return nil, fmt.Errorf("serialize grpc response failed, method:%s, err:%s", v.URI, err)
+	}
+
+	err = ioutil.WriteFile(output, out, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("write grpc response failed, file:%s, err:%s", output, err)
+	}
+
+	return []byte(fmt.Sprintf("grpc call %s done, requests:%d, responses:%d", v.URI, len(reqs), len(rsps))), nil
+}
+
+func callGrpcStream(ctx context.Context, cc *grpc.ClientConn, v *TestCase, reqs [][]byte) ([][]byte, error) {
+	desc := &grpc.StreamDesc{ClientStreams: v.ClientStream, ServerStreams: v.ServerStream}
+	s, err := cc.NewStream(ctx, desc, v.URI, grpc.ForceCodec(pbdesc.RawCodec{}))
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range reqs {
+		err = s.SendMsg(&reqs[i])
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = s.CloseSend()
+	if err != nil {
+		return nil, err
+	}
+
+	var rsps [][]byte
+	for {
+		var rsp []byte
+		err = s.RecvMsg(&rsp)
+		if err == io.EOF {
+			return rsps, nil
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		rsps = append(rsps, rsp)
+	}
+}
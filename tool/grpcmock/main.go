@@ -0,0 +1,256 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"gorr"
+	"io"
+	"net"
+	"os"
+	"strings"
+
+	"gorr/util/pbdesc"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// serve recorded grpc responses from gorr db, so that non-go programs can use gorr recordings as well.
+// services are described by FileDescriptorSet, generated by: protoc --include_imports --descriptor_set_out=service.desc service.proto
+//   grpcmock -addr=:9090 -descriptor_set=service.desc -on_miss=unimplemented -gorr_db_dir=. -gorr_db_file=gorr.db
+
+const (
+	missUnimplemented = "unimplemented"
+	missFail          = "fail"
+)
+
+var (
+	listenAddr    = flag.String("addr", "127.0.0.1:9090", "address to listen on")
+	descriptorSet = flag.String("descriptor_set", "", "comma separated FileDescriptorSet files of the recorded services")
+	onMiss        = flag.String("on_miss", missUnimplemented, "action for calls not recorded: unimplemented or fail")
+)
+
+type mockServer struct {
+	reg  *pbdesc.Registry
+	miss string
+	fail chan error
+}
+
+func newMockServer(reg *pbdesc.Registry, miss string) (*mockServer, error) {
+	switch miss {
+	case missUnimplemented, missFail:
+	default:
+		return nil, fmt.Errorf("invalid miss action:%s", miss)
+	}
+
+	return &mockServer{reg: reg, miss: miss, fail: make(chan error, 1)}, nil
+}
+
+func (s *mockServer) newServer() *grpc.Server {
+	return grpc.NewServer(grpc.CustomCodec(pbdesc.RawCodec{}), grpc.UnknownServiceHandler(s.handle))
+}
+
+// canonical re-encodes request deterministically as gorr grpc hook does, requests from non-go clients
+// may order fields differently. fields ignored by -gorr_grpc_key_config are cleared as well.
+// message is used as is if its type is unknown.
+func (s *mockServer) canonical(m *pbdesc.Method, data []byte) []byte {
+	v, err := s.reg.Decode(m.Input, data)
+	if err != nil {
+		return data
+	}
+
+	for _, f := range gorr.GrpcKeyIgnoredFields(m.Name) {
+		s.reg.Clear(m.Input, v, f)
+	}
+
+	d, err := s.reg.Encode(m.Input, v)
+	if err != nil {
+		return data
+	}
+
+	return d
+}
+
+func (s *mockServer) handle(srv interface{}, stream grpc.ServerStream) error {
+	name, _ := grpc.MethodFromServerStream(stream)
+	m, ok := s.reg.Method(name)
+	if !ok {
+		return status.Errorf(codes.Unimplemented, "method not found in descriptor set:%s", name)
+	}
+
+	if !m.ClientStreaming && !m.ServerStreaming {
+		return s.handleUnary(stream, m)
+	}
+
+	return s.handleStream(stream, m)
+}
+
+func (s *mockServer) handleUnary(stream grpc.ServerStream, m *pbdesc.Method) error {
+	var req []byte
+	err := stream.RecvMsg(&req)
+	if err != nil {
+		return err
+	}
+
+	call, err := gorr.LookupGrpcCall(stream.Context(), m.Name, s.canonical(m, req))
+	if err != nil {
+		return s.onMiss(m.Name, err)
+	}
+
+	stream.SetHeader(call.Header)
+	stream.SetTrailer(call.Trailer)
+
+	if call.Err != nil {
+		fmt.Printf("recorded error served, method:%s, err:%s\n", m.Name, call.Err)
+		return call.Err
+	}
+
+	fmt.Printf("recorded response served, method:%s\n", m.Name)
+	return stream.SendMsg(&call.Rsp)
+}
+
+// handleStream looks up recorded stream keyed by no message, or else by the first message received,
+// then recorded events are replayed in order.
+func (s *mockServer) handleStream(stream grpc.ServerStream, m *pbdesc.Method) error {
+	ctx := stream.Context()
+
+	var sent [][]byte
+	var rec *gorr.GrpcRecordedStream
+	for {
+		var err error
+		rec, err = gorr.LookupGrpcStream(ctx, m.Name, sent)
+		if err == nil {
+			break
+		}
+
+		if len(sent) > 0 {
+			return s.onMiss(m.Name, err)
+		}
+
+		var d []byte
+		err1 := stream.RecvMsg(&d)
+		if err1 == io.EOF {
+			return s.onMiss(m.Name, err)
+		}
+
+		if err1 != nil {
+			return err1
+		}
+
+		sent = append(sent, s.canonical(m, d))
+	}
+
+	stream.SetHeader(rec.Header)
+
+	err := s.replayEvents(ctx, stream, m, rec, len(sent))
+	if err != nil {
+		return err
+	}
+
+	stream.SetTrailer(rec.Trailer)
+
+	fmt.Printf("recorded stream served, method:%s, events:%d\n", m.Name, len(rec.Events))
+	return rec.Err
+}
+
+func (s *mockServer) replayEvents(ctx context.Context, stream grpc.ServerStream, m *pbdesc.Method, rec *gorr.GrpcRecordedStream, skip int) error {
+	closed := false
+	for i := range rec.Events {
+		e := &rec.Events[i]
+		if !e.Send {
+			err := stream.SendMsg(&e.Data)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		// messages used to find the recording are consumed already.
+		if skip > 0 {
+			skip--
+			continue
+		}
+
+		if closed {
+			continue
+		}
+
+		var d []byte
+		err := stream.RecvMsg(&d)
+		if err == io.EOF {
+			closed = true
+			continue
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if !bytes.Equal(s.canonical(m, d), e.Data) {
+			fmt.Printf("message differs from recording, method:%s, event:%d\n", m.Name, i)
+		}
+	}
+
+	return ctx.Err()
+}
+
+func (s *mockServer) onMiss(method string, err error) error {
+	fmt.Printf("call not recorded, action:%s, method:%s, err:%s\n", s.miss, method, err)
+
+	if s.miss == missFail {
+		select {
+		case s.fail <- fmt.Errorf("call not recorded: %s", method):
+		default:
+		}
+	}
+
+	return status.Errorf(codes.Unimplemented, "call not recorded:%s", method)
+}
+
+func main() {
+	flag.Parse()
+
+	db := *gorr.RegressionDbDirectory + "/" + *gorr.RegressionDbFile
+	if _, err := os.Stat(db); err != nil {
+		fmt.Printf("gorr db not available, path:%s, err:%s\n", db, err)
+		os.Exit(23)
+	}
+
+	if len(*descriptorSet) == 0 {
+		fmt.Printf("descriptor set is required\n")
+		os.Exit(23)
+	}
+
+	reg, err := pbdesc.ReadFileDescriptorSet(strings.Split(*descriptorSet, ",")...)
+	if err != nil {
+		fmt.Printf("load descriptor set failed, err:%s\n", err)
+		os.Exit(23)
+	}
+
+	s, err := newMockServer(reg, *onMiss)
+	if err != nil {
+		fmt.Printf("invalid arguments, err:%s\n", err)
+		os.Exit(23)
+	}
+
+	*gorr.RegressionRunType = gorr.RegressionReplay
+	gorr.InitRegressionEngine()
+
+	lis, err := net.Listen("tcp", *listenAddr)
+	if err != nil {
+		fmt.Printf("listen failed, addr:%s, err:%s\n", *listenAddr, err)
+		os.Exit(23)
+	}
+
+	go func() {
+		err := s.newServer().Serve(lis)
+		s.fail <- fmt.Errorf("serve failed, err:%s", err)
+	}()
+
+	err = <-s.fail
+	fmt.Printf("grpc mock server stopped, err:%s\n", err)
+	os.Exit(1)
+}
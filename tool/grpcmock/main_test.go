@@ -0,0 +1,210 @@
+package main
+
+import (
+	"context"
+	"gorr"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"testing"
+
+	"gorr/util/pbdesc"
+
+	"github.com/golang/protobuf/proto"
+	descpb "github.com/golang/protobuf/protoc-gen-go/descriptor"
+	"github.com/golang/protobuf/ptypes/wrappers"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	binlogpb "google.golang.org/grpc/binarylog/grpc_binarylog_v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+var testStreamDesc = grpc.StreamDesc{
+	StreamName: "Stream",
+	Handler: func(srv interface{}, stream grpc.ServerStream) error {
+		for {
+			req := &wrappers.StringValue{}
+			err := stream.RecvMsg(req)
+			if err == io.EOF {
+				return nil
+			}
+
+			if err != nil {
+				return err
+			}
+
+			err = stream.SendMsg(&wrappers.Int64Value{Value: int64(len(req.Value))})
+			if err != nil {
+				return err
+			}
+		}
+	},
+	ServerStreams: true,
+	ClientStreams: true,
+}
+
+var testService = grpc.ServiceDesc{
+	ServiceName: "gorr.test.Echo",
+	HandlerType: (*interface{})(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Call",
+			Handler: func(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+				req := &wrappers.StringValue{}
+				err := dec(req)
+				if err != nil {
+					return nil, err
+				}
+
+				grpc.SetHeader(ctx, metadata.Pairs("x-header", req.Value))
+				if len(req.Value) == 0 {
+					return nil, status.Error(codes.InvalidArgument, "empty value")
+				}
+
+				return &wrappers.Int64Value{Value: int64(len(req.Value))}, nil
+			},
+		},
+	},
+	Streams: []grpc.StreamDesc{testStreamDesc},
+}
+
+func testRegistry(t *testing.T) *pbdesc.Registry {
+	r := pbdesc.NewRegistry()
+	assert.Nil(t, r.AddRegisteredFile("google/protobuf/wrappers.proto"))
+
+	r.AddFile(&descpb.FileDescriptorProto{
+		Name:       proto.String("echo.proto"),
+		Package:    proto.String("gorr.test"),
+		Syntax:     proto.String("proto3"),
+		Dependency: []string{"google/protobuf/wrappers.proto"},
+		Service: []*descpb.ServiceDescriptorProto{
+			{
+				Name: proto.String("Echo"),
+				Method: []*descpb.MethodDescriptorProto{
+					{
+						Name:       proto.String("Call"),
+						InputType:  proto.String(".google.protobuf.StringValue"),
+						OutputType: proto.String(".google.protobuf.Int64Value"),
+					},
+					{
+						Name:            proto.String("Stream"),
+						InputType:       proto.String(".google.protobuf.StringValue"),
+						OutputType:      proto.String(".google.protobuf.Int64Value"),
+						ClientStreaming: proto.Bool(true),
+						ServerStreaming: proto.Bool(true),
+					},
+				},
+			},
+		},
+	})
+
+	return r
+}
+
+func serve(t *testing.T, s *grpc.Server, opts ...grpc.DialOption) (*grpc.ClientConn, func()) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	go s.Serve(lis)
+
+	cc, err := grpc.Dial(lis.Addr().String(), append(opts, grpc.WithInsecure())...)
+	assert.Nil(t, err)
+
+	return cc, func() { cc.Close(); s.Stop() }
+}
+
+func runCalls(t *testing.T, cc *grpc.ClientConn) {
+	ctx := context.Background()
+
+	var header metadata.MD
+	rsp := &wrappers.Int64Value{}
+	assert.Nil(t, cc.Invoke(ctx, "/gorr.test.Echo/Call", &wrappers.StringValue{Value: "miliao"}, rsp, grpc.Header(&header)))
+	assert.Equal(t, int64(6), rsp.Value)
+	assert.Equal(t, []string{"miliao"}, header.Get("x-header"))
+
+	err := cc.Invoke(ctx, "/gorr.test.Echo/Call", &wrappers.StringValue{}, rsp)
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	s, err := cc.NewStream(ctx, &testStreamDesc, "/gorr.test.Echo/Stream")
+	assert.Nil(t, err)
+
+	for i, v := range []string{"a", "bc"} {
+		assert.Nil(t, s.SendMsg(&wrappers.StringValue{Value: v}))
+		assert.Nil(t, s.RecvMsg(rsp))
+		assert.Equal(t, int64(i+1), rsp.Value)
+	}
+
+	assert.Nil(t, s.CloseSend())
+	assert.Equal(t, io.EOF, s.RecvMsg(rsp))
+}
+
+func TestMockServer(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gorr_grpc_mock")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	*gorr.RegressionDbDirectory = dir
+	*gorr.RegressionDbFile = "gorr.db"
+	*gorr.RegressionRunType = gorr.RegressionReplay
+	gorr.InitRegressionEngine()
+
+	// record calls to a real server through client interceptors.
+	gorr.GlobalMgr.SetState(gorr.RegressionRecord)
+
+	srv := grpc.NewServer()
+	srv.RegisterService(&testService, struct{}{})
+	cc, stop := serve(t, srv, grpc.WithUnaryInterceptor(gorr.GrpcUnaryClientInterceptor()), grpc.WithStreamInterceptor(gorr.GrpcStreamClientInterceptor()))
+	runCalls(t, cc)
+	stop()
+
+	gorr.GlobalMgr.SetState(gorr.RegressionReplay)
+
+	s1, err := newMockServer(testRegistry(t), missUnimplemented)
+	assert.Nil(t, err)
+
+	cc, stop = serve(t, s1.newServer())
+	defer stop()
+
+	runCalls(t, cc)
+
+	err = cc.Invoke(context.Background(), "/gorr.test.Echo/Call", &wrappers.StringValue{Value: "none"}, &wrappers.Int64Value{})
+	assert.Equal(t, codes.Unimplemented, status.Code(err))
+
+	err = cc.Invoke(context.Background(), "/gorr.test.None/Call", &wrappers.StringValue{Value: "none"}, &wrappers.Int64Value{})
+	assert.Equal(t, codes.Unimplemented, status.Code(err))
+
+	s3, err := newMockServer(testRegistry(t), missFail)
+	assert.Nil(t, err)
+	assert.NotNil(t, s3.onMiss("/gorr.test.Echo/Call", io.EOF))
+	assert.NotNil(t, <-s3.fail)
+
+	_, err = newMockServer(testRegistry(t), "unknown")
+	assert.NotNil(t, err)
+}
+
+func TestCanonical(t *testing.T) {
+	r := pbdesc.NewRegistry()
+	for _, f := range []string{"google/protobuf/timestamp.proto", "google/protobuf/duration.proto", "grpc/binarylog/grpc_binarylog_v1/binarylog.proto"} {
+		assert.Nil(t, r.AddRegisteredFile(f))
+	}
+
+	s, err := newMockServer(r, missUnimplemented)
+	assert.Nil(t, err)
+
+	// oneof payload is marshaled after peer by golang/protobuf.
+	entry := &binlogpb.GrpcLogEntry{
+		CallId:  23,
+		Type:    binlogpb.GrpcLogEntry_EVENT_TYPE_CLIENT_MESSAGE,
+		Payload: &binlogpb.GrpcLogEntry_Message{Message: &binlogpb.Message{Length: 5, Data: []byte("hello")}},
+		Peer:    &binlogpb.Address{Type: binlogpb.Address_TYPE_IPV4, Address: "127.0.0.1", IpPort: 80},
+	}
+
+	b := proto.NewBuffer(nil)
+	b.SetDeterministic(true)
+	assert.Nil(t, b.Marshal(entry))
+
+	m := &pbdesc.Method{Name: "/gorr.test.Log/Call", Input: "grpc.binarylog.v1.GrpcLogEntry"}
+	assert.Equal(t, b.Bytes(), s.canonical(m, b.Bytes()))
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"gorr"
+	"os"
+)
+
+// convert http recordings between gorr db and HAR 1.2.
+//   export: hartool -mode=export -db=gorr.db -har=out.har
+//   import: hartool -mode=import -db=gorr.db -har=in.har
+
+var (
+	mode    = flag.String("mode", "export", "export(gorr db to har) or import(har to gorr db)")
+	dbFile  = flag.String("db", "gorr.db", "path to gorr db")
+	harFile = flag.String("har", "", "path to har file")
+)
+
+func run() error {
+	if len(*harFile) == 0 {
+		return fmt.Errorf("har file is required")
+	}
+
+	db, err := gorr.NewBoltStorage(*dbFile)
+	if err != nil {
+		return fmt.Errorf("open gorr db failed, file:%s, err:%s", *dbFile, err)
+	}
+	defer db.Close()
+
+	switch *mode {
+	case "export":
+		f, err := os.Create(*harFile)
+		if err != nil {
+			return fmt.Errorf("create har file failed, file:%s, err:%s", *harFile, err)
+		}
+		defer f.Close()
+
+		return gorr.WriteHttpHar(db, f)
+	case "import":
+		f, err := os.Open(*harFile)
+		if err != nil {
+			return fmt.Errorf("open har file failed, file:%s, err:%s", *harFile, err)
+		}
+		defer f.Close()
+
+		num, err := gorr.ReadHttpHar(f, db)
+		fmt.Printf("%d har entries imported\n", num)
+		return err
+	default:
+		return fmt.Errorf("unknown mode:%s", *mode)
+	}
+}
+
+func main() {
+	flag.Parse()
+
+	err := run()
+	if err != nil {
+		fmt.Printf("hartool failed, err:%s\n", err)
+		os.Exit(23)
+	}
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"gorr/util/diff"
+	"io/ioutil"
+	"net/http"
+	"time"
+)
+
+// runHttpCase issues the http request recorded in reqFile to addr, and writes response to output.
+func runHttpCase(addr, reqFile, output string) ([]byte, error) {
+	data, err := ioutil.ReadFile(reqFile)
+	if err != nil {
+		return nil, fmt.Errorf("read request file failed, file:%s, err:%s", reqFile, err)
+	}
+
+	var req diff.HttpSerializedData
+	err = json.Unmarshal(data, &req)
+	if err != nil {
+		return nil, fmt.Errorf("unmarshal http request failed, file:%s, err:%s", reqFile, err)
+	}
+
+	method := req.Method
+	if len(method) == 0 {
+		method = "POST"
+	}
+
+	url := "http://" + addr + req.Path
+	if len(req.Query) > 0 {
+		url = url + "?" + req.Query
+	}
+
+	r, err := http.NewRequest(method, url, bytes.NewBuffer(req.Body))
+	if err != nil {
+		return nil, fmt.Errorf("create http request failed, url:%s, err:%s", url, err)
+	}
+
+	for k, v := range req.Header {
+		r.Header[k] = v
+	}
+
+	c := http.Client{Timeout: time.Duration(60) * time.Second}
+	rsp, err := c.Do(r)
+	if err != nil {
+		return nil, fmt.Errorf("http request failed, url:%s, err:%s", url, err)
+	}
+	defer rsp.Body.Close()
+
+	body, err := ioutil.ReadAll(rsp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("read http response failed, url:%s, err:%s", url, err)
+	}
+
+	if rsp.Header.Get("Content-Encoding") == "gzip" {
+		reader, err := gzip.NewReader(bytes.NewBuffer(body))
+		if err != nil {
+			return nil, fmt.Errorf("invalid gzip response, url:%s, err:%s", url, err)
+		}
+
+		body, err = ioutil.ReadAll(reader)
+		reader.Close()
+		if err != nil {
+			return nil, fmt.Errorf("decompress http response failed, url:%s, err:%s", url, err)
+		}
+	}
+
+	for _, h := range diff.HttpVolatileHeaders {
+		rsp.Header.Del(h)
+	}
+
+	out := diff.HttpSerializedData{
+		Body:     body,
+		BodyType: diff.HttpBodyType(rsp.Header.Get("Content-Type")),
+		Header:   rsp.Header,
+		Status:   rsp.StatusCode,
+	}
+
+	data, err = json.MarshalIndent(out, "", "\t")
+	if err != nil {
+		return nil, fmt.Errorf("marshal http response failed, url:%s, err:%s", url, err)
+	}
+
+	err = ioutil.WriteFile(output, data, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("write http response failed, file:%s, err:%s", output, err)
+	}
+
+	return []byte(fmt.Sprintf("%s %s done, status:%d", method, url, rsp.StatusCode)), nil
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"gorr"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// serve recorded http responses from gorr db, so that non-go programs can use gorr recordings as well.
+// db is specified by -gorr_db_dir and -gorr_db_file.
+//   httpmock -addr=:8080 -target=http://api.some.com -on_miss=404 -gorr_db_dir=. -gorr_db_file=gorr.db
+
+const (
+	missNotFound = "404"
+	missProxy    = "proxy"
+	missFail     = "fail"
+)
+
+var (
+	listenAddr = flag.String("addr", "127.0.0.1:8080", "address to listen on")
+	target     = flag.String("target", "", "scheme and host of the recorded dependency, eg: http://api.some.com, host of incoming request is used if empty")
+	proto      = flag.String("proto", "HTTP/1.1", "protocol version used to build request key, http.NewRequest() always sets HTTP/1.1")
+	onMiss     = flag.String("on_miss", missNotFound, "action for requests not recorded: 404, proxy or fail")
+	proxyAddr  = flag.String("proxy", "", "upstream to forward requests not recorded to, required by -on_miss=proxy")
+)
+
+type mockHandler struct {
+	target string
+	proto  string
+	miss   string
+	proxy  http.Handler
+	fail   chan error
+}
+
+func newMockHandler(target, proto, miss, proxy string) (*mockHandler, error) {
+	h := &mockHandler{
+		target: strings.TrimRight(target, "/"),
+		proto:  proto,
+		miss:   miss,
+		fail:   make(chan error, 1),
+	}
+
+	switch miss {
+	case missNotFound, missFail:
+	case missProxy:
+		u, err := url.Parse(proxy)
+		if err != nil || len(u.Host) == 0 {
+			return nil, fmt.Errorf("invalid proxy address:%s", proxy)
+		}
+		h.proxy = httputil.NewSingleHostReverseProxy(u)
+	default:
+		return nil, fmt.Errorf("invalid miss action:%s", miss)
+	}
+
+	return h, nil
+}
+
+// rebuild the request as seen by the client, so that it maps to the same key as http hook.
+func (h *mockHandler) clientRequest(r *http.Request) (*http.Request, error) {
+	base := h.target
+	if len(base) == 0 {
+		base = "http://" + r.Host
+	}
+
+	req, err := http.NewRequest(r.Method, base+r.URL.RequestURI(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Proto = h.proto
+	req.Header = r.Header
+	return req, nil
+}
+
+func (h *mockHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var body []byte
+	if r.Body != nil {
+		body, _ = ioutil.ReadAll(r.Body)
+		r.Body.Close()
+	}
+
+	r.Body = ioutil.NopCloser(bytes.NewBuffer(body))
+
+	req, err := h.clientRequest(r)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("invalid request, err:%s", err), http.StatusBadRequest)
+		return
+	}
+
+	rsp, err := gorr.LookupHttpResponse(req, body)
+	if err != nil {
+		h.onMiss(w, r, req)
+		return
+	}
+	defer rsp.Body.Close()
+
+	for k, v := range rsp.Header {
+		w.Header()[k] = v
+	}
+
+	w.WriteHeader(rsp.StatusCode)
+	io.Copy(w, rsp.Body)
+
+	fmt.Printf("recorded response served, %s %s\n", req.Method, req.URL)
+}
+
+func (h *mockHandler) onMiss(w http.ResponseWriter, r *http.Request, req *http.Request) {
+	fmt.Printf("request not recorded, action:%s, %s %s\n", h.miss, req.Method, req.URL)
+
+	switch h.miss {
+	case missProxy:
+		h.proxy.ServeHTTP(w, r)
+	case missFail:
+		http.Error(w, "request not recorded", http.StatusInternalServerError)
+		select {
+		case h.fail <- fmt.Errorf("request not recorded: %s %s", req.Method, req.URL):
+		default:
+		}
+	default:
+		http.Error(w, "request not recorded", http.StatusNotFound)
+	}
+}
+
+func main() {
+	flag.Parse()
+
+	db := *gorr.RegressionDbDirectory + "/" + *gorr.RegressionDbFile
+	if _, err := os.Stat(db); err != nil {
+		fmt.Printf("gorr db not available, path:%s, err:%s\n", db, err)
+		os.Exit(23)
+	}
+
+	h, err := newMockHandler(*target, *proto, *onMiss, *proxyAddr)
+	if err != nil {
+		fmt.Printf("invalid arguments, err:%s\n", err)
+		os.Exit(23)
+	}
+
+	*gorr.RegressionRunType = gorr.RegressionReplay
+	gorr.InitRegressionEngine()
+
+	go func() {
+		err := http.ListenAndServe(*listenAddr, h)
+		h.fail <- fmt.Errorf("listen failed, err:%s", err)
+	}()
+
+	err = <-h.fail
+	fmt.Printf("http mock server stopped, err:%s\n", err)
+	os.Exit(1)
+}
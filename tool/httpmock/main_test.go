@@ -0,0 +1,115 @@
+package main
+
+import (
+	"gorr"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func harEntry(method, url, body string, code int, rsp string) gorr.HarEntry {
+	return gorr.HarEntry{
+		Request: gorr.HarRequest{
+			Method:      method,
+			URL:         url,
+			HTTPVersion: "HTTP/1.1",
+			PostData:    &gorr.HarPostData{Text: body},
+		},
+		Response: gorr.HarResponse{
+			Status:      code,
+			StatusText:  http.StatusText(code),
+			HTTPVersion: "HTTP/1.1",
+			Headers:     []gorr.HarNameValue{{Name: "Content-Type", Value: "application/json"}},
+			Content:     gorr.HarContent{Text: rsp},
+		},
+	}
+}
+
+func doRequest(t *testing.T, method, url, body string) (int, string) {
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+	assert.Nil(t, err)
+
+	rsp, err := http.DefaultClient.Do(req)
+	assert.Nil(t, err)
+	defer rsp.Body.Close()
+
+	data, err := ioutil.ReadAll(rsp.Body)
+	assert.Nil(t, err)
+	return rsp.StatusCode, string(data)
+}
+
+func TestMockServer(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gorr_http_mock")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	db, err := gorr.NewBoltStorage(dir + "/gorr.db")
+	assert.Nil(t, err)
+
+	har := &gorr.Har{}
+	har.Log.Entries = []gorr.HarEntry{
+		harEntry("GET", "http://api.some.com/v1/user?id=23", "", 200, `{"name":"miliao"}`),
+		harEntry("POST", "http://api.some.com/v1/user", `{"id":24}`, 201, `{"created":true}`),
+	}
+
+	num, err := gorr.ImportHttpHar(har, db)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, num)
+	db.Close()
+
+	*gorr.RegressionDbDirectory = dir
+	*gorr.RegressionDbFile = "gorr.db"
+	*gorr.RegressionRunType = gorr.RegressionReplay
+	gorr.InitRegressionEngine()
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("from upstream"))
+	}))
+	defer upstream.Close()
+
+	h1, err := newMockHandler("http://api.some.com", "HTTP/1.1", missNotFound, "")
+	assert.Nil(t, err)
+	s1 := httptest.NewServer(h1)
+	defer s1.Close()
+
+	code, rsp := doRequest(t, "GET", s1.URL+"/v1/user?id=23", "")
+	assert.Equal(t, 200, code)
+	assert.Equal(t, `{"name":"miliao"}`, rsp)
+
+	code, rsp = doRequest(t, "POST", s1.URL+"/v1/user", `{"id":24}`)
+	assert.Equal(t, 201, code)
+	assert.Equal(t, `{"created":true}`, rsp)
+
+	code, _ = doRequest(t, "POST", s1.URL+"/v1/user", `{"id":25}`)
+	assert.Equal(t, 404, code)
+
+	h2, err := newMockHandler("http://api.some.com", "HTTP/1.1", missProxy, upstream.URL)
+	assert.Nil(t, err)
+	s2 := httptest.NewServer(h2)
+	defer s2.Close()
+
+	code, rsp = doRequest(t, "GET", s2.URL+"/v1/user?id=23", "")
+	assert.Equal(t, 200, code)
+	assert.Equal(t, `{"name":"miliao"}`, rsp)
+
+	code, rsp = doRequest(t, "GET", s2.URL+"/v1/user?id=24", "")
+	assert.Equal(t, 200, code)
+	assert.Equal(t, "from upstream", rsp)
+
+	h3, err := newMockHandler("http://api.some.com", "HTTP/1.1", missFail, "")
+	assert.Nil(t, err)
+	s3 := httptest.NewServer(h3)
+	defer s3.Close()
+
+	code, _ = doRequest(t, "GET", s3.URL+"/v1/none", "")
+	assert.Equal(t, 500, code)
+	assert.NotNil(t, <-h3.fail)
+
+	_, err = newMockHandler("", "HTTP/1.1", "unknown", "")
+	assert.NotNil(t, err)
+}
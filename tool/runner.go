@@ -2,6 +2,7 @@ package main
 
 import (
 	"gorr/util"
+	"gorr/util/diff"
 	"encoding/json"
 	"flag"
 	"fmt"
@@ -28,18 +29,36 @@ type TestCase struct {
 	Runner  string `json:"runner"`
 	Diff    int    `json:"DiffType"`
 	Failed  int    `json:"Failed"`
+
+	ReqMsg       string `json:"ReqMsg,omitempty"`
+	RspMsg       string `json:"RspMsg,omitempty"`
+	ClientStream bool   `json:"ClientStream,omitempty"`
+	ServerStream bool   `json:"ServerStream,omitempty"`
+	PbRepeated   string `json:"PbRepeated,omitempty"`
+	Rules        string `json:"Rules,omitempty"`
+
+	// http headers to compare for http cases, * for all headers.
+	DiffHeaders []string `json:"DiffHeaders,omitempty"`
+
+	// decode and compare json embedded in strings.
+	EmbeddedJSON bool `json:"EmbeddedJSON,omitempty"`
+
+	// differ used instead of the one chosen by DiffType.
+	DiffStrategy *diff.Strategy `json:"DiffStrategy,omitempty"`
 }
 
 type TestItem struct {
-	DB           []string    `json:"db"`
-	Flags        []string    `json:"flags"`
-	Input        []MoveData  `json:"input"`
-	TestCases    []*TestCase `json:"cases"`
-	Version      int         `json:"version"`
-	EnvFlagFile  string      `json:"env_flag_files,omitempty"`
-	Path         string      `json:"-"`
-	FilesChanged []string    `json:"-"`
-	FailAgain    []string    `json:"-"`
+	DB           []string       `json:"db"`
+	Flags        []string       `json:"flags"`
+	Input        []MoveData     `json:"input"`
+	TestCases    []*TestCase    `json:"cases"`
+	Version      int            `json:"version"`
+	EnvFlagFile  string         `json:"env_flag_files,omitempty"`
+	Rules        string         `json:"rules,omitempty"`
+	DiffStrategy *diff.Strategy `json:"diff_strategy,omitempty"`
+	Path         string         `json:"-"`
+	FilesChanged []string       `json:"-"`
+	FailAgain    []string       `json:"-"`
 }
 
 const (
@@ -47,8 +66,15 @@ const (
 	recorderDataTypeJSON     = 24
 	recorderDataTypePbText   = 25
 	recorderDataTypePbBinary = 26
+	recorderDataTypeHTTPJSON = 27
+	recorderDataTypeXML      = 28
+	recorderDataTypeYAML     = 29
+	recorderDataTypeForm     = 30
 )
 
+// builtinDiffer selects the differ linked into runner instead of an external diff tool.
+const builtinDiffer = "builtin"
+
 var (
 	ServerAddr            = flag.String("server_addr", "", "server address")
 	DefaultRunner         = flag.String("runner", "", "run to issue request")
@@ -59,7 +85,7 @@ var (
 	RegressionDb          = flag.String("regression_db_path", "", "path to regression db")
 	RegressionFlagFile    = flag.String("regression_flag", "", "path to flag file for setting regression flags")
 	TestCaseConfigPattern = flag.String("test_case_config_pattern", "reg_config.json", "test case config file name")
-	diffTool              = flag.String("diffTool", "./rdiff", "tool to perform diff")
+	diffTool              = flag.String("diffTool", "./rdiff", "tool to perform diff, use \"builtin\" for the builtin differ")
 	updateOldCase         = flag.Int("update_case_from_diff", 0, "whether to update test cases when diff presents")
 	onTestSuitFailCmd     = flag.String("on_test_suit_fail_handler", "", "cmd to execute on test suit failure")
 	outputFileChangedList = flag.String("output_file_changed", "files.changed", "file to record file that is updated")
@@ -139,6 +165,7 @@ type DiffInfo struct {
 	RspFile     string
 	RspActual   string
 	DiffContent string
+	Changes     []diff.Change
 }
 
 // RunTestResult run test suit result
@@ -151,6 +178,109 @@ type RunTestResult struct {
 	Diff map[string]DiffInfo
 }
 
+// caseDiff is how responses of a test case are compared.
+type caseDiff struct {
+	opt        *diff.Options
+	rulesFiles []string
+	strategy   *diff.Strategy
+}
+
+// newCaseDiff collects diff options of test case, rules and strategy of test case take precedence over the ones of test suite.
+func newCaseDiff(dir string, t *TestItem, v *TestCase) *caseDiff {
+	opt := &diff.Options{Headers: v.DiffHeaders, EmbeddedJSON: v.EmbeddedJSON}
+	if len(v.RspMsg) > 0 {
+		opt.MsgType = v.RspMsg
+		opt.DescriptorSet = grpcDescriptorFiles(dir)
+		opt.Stream = v.ServerStream
+		opt.Repeated = v.PbRepeated
+	}
+
+	var rulesFiles []string
+	for _, r := range []string{v.Rules, t.Rules} {
+		if len(r) > 0 {
+			rulesFiles = append(rulesFiles, dir+"/"+r)
+		}
+	}
+
+	s := v.DiffStrategy
+	if s == nil {
+		s = t.DiffStrategy
+	}
+
+	// plugin command is relative to directory of test suite.
+	if s != nil && strings.HasPrefix(s.Cmd, "./") {
+		s2 := *s
+		s2.Cmd = dir + "/" + s.Cmd[2:]
+		s = &s2
+	}
+
+	return &caseDiff{opt: opt, rulesFiles: rulesFiles, strategy: s}
+}
+
+func shellQuote(s string) string {
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
+
+// args returns arguments of diff tool.
+func (c *caseDiff) args() string {
+	opt := c.opt
+
+	args := ""
+	if len(opt.MsgType) > 0 {
+		args = fmt.Sprintf(" -msg=%s -descriptor_set=%s -stream=%t", opt.MsgType, strings.Join(opt.DescriptorSet, ","), opt.Stream)
+		if len(opt.Repeated) > 0 {
+			args += " -pb_repeated=" + opt.Repeated
+		}
+	}
+
+	if len(opt.Headers) > 0 {
+		args += " -headers=" + shellQuote(strings.Join(opt.Headers, ","))
+	}
+
+	if opt.EmbeddedJSON {
+		args += " -embedded_json"
+	}
+
+	if len(c.rulesFiles) > 0 {
+		args += " -rules=" + strings.Join(c.rulesFiles, ",")
+	}
+
+	if s := c.strategy; s != nil {
+		args += " -strategy=" + shellQuote(s.Name) + " -strategy_cmd=" + shellQuote(s.Cmd)
+		if len(s.Params) > 0 {
+			d, _ := json.Marshal(s.Params)
+			args += " -strategy_params=" + shellQuote(string(d))
+		}
+	}
+
+	return args
+}
+
+// run compares responses with diff library, output is the same as the one of diff tool.
+func (c *caseDiff) run(dt int, ef, af string) ([]byte, []diff.Change, error) {
+	if len(c.rulesFiles) > 0 {
+		rules, err := diff.LoadRules(c.rulesFiles...)
+		if err != nil {
+			return nil, nil, err
+		}
+		c.opt.Rules = rules
+	}
+
+	var ret *diff.Result
+	var err error
+	if c.strategy != nil {
+		ret, err = diff.DiffStrategyFiles(c.strategy, dt, ef, af, c.opt)
+	} else {
+		ret, err = diff.DiffFiles(dt, ef, af, c.opt)
+	}
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return []byte(ret.String()), ret.Changes, nil
+}
+
 // RunTestCase run all cases from a test suit
 func RunTestCase(differ, start_cmd, stop_cmd, addr string, store_dir, regression_db, regression_flag_file string, t *TestItem) ([]*TestItem, *RunTestResult) {
 	util.RunCmd(stop_cmd)
@@ -294,22 +424,34 @@ func RunTestCase(differ, start_cmd, stop_cmd, addr string, store_dir, regression
 			cmd = *DefaultRunner
 		}
 
-		if cmd[0] != '/' {
-			cmd = "./" + cmd
-		}
+		reqFile := dir + "/" + v.Req
 
-		uri := ""
-		if len(v.URI) > 0 {
-			uri = " -uri=\"" + v.URI + "\""
-		}
+		var output []byte
+		if len(cmd) == 0 && v.ReqType == recorderDataTypeHTTPJSON {
+			// full http request is recorded, issue it directly.
+			cmd = "builtin http runner, req:" + reqFile
+			output, err = runHttpCase(addr, reqFile, res)
+		} else if len(cmd) == 0 && isGrpcCase(v) {
+			// grpc call recorded by grpc recorder, replay it with recorded descriptors.
+			cmd = "builtin grpc runner, method:" + v.URI
+			output, err = runGrpcCase(addr, dir, v, res)
+		} else {
+			if cmd[0] != '/' {
+				cmd = "./" + cmd
+			}
 
-		cmd = caseVer + " " + cmd
-		reqFile := dir + "/" + v.Req
+			uri := ""
+			if len(v.URI) > 0 {
+				uri = " -uri=\"" + v.URI + "\""
+			}
+
+			cmd = caseVer + " " + cmd
 
-		dt := fmt.Sprintf(" -reqType=%d -rspType=%d ", v.ReqType, v.RspType)
-		cmd = cmd + " -addr=" + addr + " -input=" + reqFile + " -output=" + res + dt + uri + " -v=100 -logtostderr=true 2>&1"
+			dt := fmt.Sprintf(" -reqType=%d -rspType=%d ", v.ReqType, v.RspType)
+			cmd = cmd + " -addr=" + addr + " -input=" + reqFile + " -output=" + res + dt + uri + " -v=100 -logtostderr=true 2>&1"
 
-		output, err := util.RunCmd(cmd)
+			output, err = util.RunCmd(cmd)
+		}
 
 		if err != nil {
 			ret.Fail++
@@ -322,12 +464,27 @@ func RunTestCase(differ, start_cmd, stop_cmd, addr string, store_dir, regression
 		dtype := v.Diff
 		if dtype == 0 {
 			dtype = recorderDataTypeJSON
+			switch v.RspType {
+			case recorderDataTypeHTTPJSON, recorderDataTypePbBinary, recorderDataTypeXML, recorderDataTypeYAML, recorderDataTypeForm:
+				dtype = v.RspType
+			case recorderDataTypePbText:
+				if len(v.RspMsg) > 0 {
+					dtype = v.RspType
+				}
+			}
 		}
 
+		cd := newCaseDiff(dir, t, v)
 		rspFile := dir + "/" + v.Rsp
-		diffCmd := fmt.Sprintf("%s -expect=%s -actual=%s -type=%d 2>&1", differ, rspFile, res, dtype)
 
-		output, err = util.RunCmd(diffCmd)
+		var changes []diff.Change
+		diffCmd := "builtin differ"
+		if differ == builtinDiffer {
+			output, changes, err = cd.run(dtype, rspFile, res)
+		} else {
+			diffCmd = fmt.Sprintf("%s -expect=%s -actual=%s -type=%d%s 2>&1", differ, rspFile, res, dtype, cd.args())
+			output, err = util.RunCmd(diffCmd)
+		}
 
 		if err != nil || len(output) > 0 {
 			if v.Failed == 0 || *updateOldCase > 0 {
@@ -339,6 +496,7 @@ func RunTestCase(differ, start_cmd, stop_cmd, addr string, store_dir, regression
 						RspFile:     rspFile,
 						RspActual:   res,
 						DiffContent: m,
+						Changes:     changes,
 					}
 					m = fmt.Sprintf("\033[31m@@@@@%dth test case failed@@@@@\033[m, name:%s, err:%v, cmd:%s, diffcmd:%s, failed before:%d, update failed:%d", i, v.Desc, err, cmd, diffCmd, v.Failed, *updateOldCase)
 					ret.Msg = append(ret.Msg, m)
@@ -365,6 +523,7 @@ func RunTestCase(differ, start_cmd, stop_cmd, addr string, store_dir, regression
 					RspFile:     rspFile,
 					RspActual:   res,
 					DiffContent: m,
+					Changes:     changes,
 				}
 				m = fmt.Sprintf("\033[31m@@@@@%dth test case failed AGAIN@@@@@\033[m, name:%s, err:%v, cmd:%s", i, v.Desc, err, cmd)
 				ret.Msg = append(ret.Msg, m)
@@ -1,11 +1,26 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
 	"github.com/stretchr/testify/assert"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"os/exec"
+	"strings"
 	"testing"
+
+	"gorr/util/diff"
+	"gorr/util/pbdesc"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes/wrappers"
+	"google.golang.org/grpc"
 )
 
 func TestScan(t *testing.T) {
@@ -47,24 +62,32 @@ func TestScan(t *testing.T) {
 
 func TestRunCase(t *testing.T) {
 	*TestCaseConfigPattern = "config.json"
-	item := &TestItem{
-		Path:  "./dummy.config",
-		DB:    []string{"testdata/dummy.rsp"},
-		Flags: []string{"-h"},
-		Input: []MoveData{MoveData{Src: "testdata/dummy.rsp", Dst: "/tmp/dummy.rsp"}},
-		TestCases: []*TestCase{
-			&TestCase{Req: "dummy.req", Rsp: "testdata/dummy.rsp", Desc: "dummy test", Runner: "/bin/echo"}, // succ
-			&TestCase{Req: "dummy.req", Rsp: "dummy2.rsp", Desc: "dummy test", Runner: "/bin/echo"},         // fail
-			&TestCase{Req: "dummy.req", Rsp: "dummy.rsp", Desc: "dummy test", Runner: "/bin/echo2"},         // fail
-		},
+	newItem := func() *TestItem {
+		return &TestItem{
+			Path:  "./dummy.config",
+			DB:    []string{"testdata/dummy.rsp"},
+			Flags: []string{"-h"},
+			Input: []MoveData{MoveData{Src: "testdata/dummy.rsp", Dst: "/tmp/dummy.rsp"}},
+			TestCases: []*TestCase{
+				&TestCase{Req: "dummy.req", Rsp: "testdata/dummy.rsp", Desc: "dummy test", Runner: "/bin/echo"}, // succ
+				&TestCase{Req: "dummy.req", Rsp: "dummy2.rsp", Desc: "dummy test", Runner: "/bin/echo"},         // fail
+				&TestCase{Req: "dummy.req", Rsp: "dummy.rsp", Desc: "dummy test", Runner: "/bin/echo2"},         // fail
+			},
+		}
 	}
 
+	item := newItem()
 	nt, ret := RunTestCase("./rdiff", "/bin/ls", "/bin/ls", "1.1.1.1:233", "./testdata", "/tmp", "./testdata/f.test.flag", item)
 
 	assert.Equal(t, 2, ret.Fail)
 
 	fmt.Printf("total err:%d\nmsg:%+v\ndiff:%+v", ret.Fail, ret.Msg, ret.Diff)
 
+	// builtin differ
+	nt2, ret2 := RunTestCase(builtinDiffer, "/bin/ls", "/bin/ls", "1.1.1.1:233", "./testdata", "/tmp", "./testdata/f.test.flag", newItem())
+	assert.Equal(t, 2, ret2.Fail)
+	nt = append(nt, nt2...)
+
 	os.Remove(item.Path)
 	os.Remove("./testdata/f.test.flag")
 
@@ -76,7 +99,7 @@ func TestRunCase(t *testing.T) {
 func TestMain(m *testing.M) {
 	// call flag.Parse() here if TestMain uses flags
 
-	_, err := exec.Command("/bin/sh", "-c", "go build -o rdiff ./diff/diff.go ./diff/diffValue.go").Output()
+	_, err := exec.Command("/bin/sh", "-c", "go build -o rdiff ./diff").Output()
 	if err != nil {
 		fmt.Printf("build diff tool failed\n")
 		os.Exit(23)
@@ -87,3 +110,156 @@ func TestMain(m *testing.M) {
 
 	os.Exit(ret)
 }
+
+func TestRunHttpCase(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		d, _ := ioutil.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("X-Method", r.Method)
+		w.WriteHeader(202)
+		w.Write([]byte(fmt.Sprintf(`{"path":"%s","query":"%s","ct":"%s","body":%s}`, r.URL.Path, r.URL.RawQuery, r.Header.Get("Content-Type"), d)))
+	}))
+	defer s.Close()
+
+	req := diff.HttpSerializedData{
+		Body:   []byte(`{"id":23}`),
+		Header: map[string][]string{"Content-Type": []string{"application/json"}},
+		Method: "PUT",
+		Path:   "/api/v1/user",
+		Query:  "debug=1",
+	}
+
+	data, err := json.Marshal(req)
+	assert.Nil(t, err)
+
+	reqFile := "./testdata/http.req.tmp"
+	rspFile := "./testdata/http.rsp.tmp"
+	assert.Nil(t, ioutil.WriteFile(reqFile, data, 0644))
+	defer os.Remove(reqFile)
+	defer os.Remove(rspFile)
+
+	_, err = runHttpCase(strings.TrimPrefix(s.URL, "http://"), reqFile, rspFile)
+	assert.Nil(t, err)
+
+	var rsp diff.HttpSerializedData
+	data, err = ioutil.ReadFile(rspFile)
+	assert.Nil(t, err)
+	assert.Nil(t, json.Unmarshal(data, &rsp))
+
+	assert.Equal(t, 202, rsp.Status)
+	assert.Equal(t, recorderDataTypeJSON, rsp.BodyType)
+	assert.Equal(t, "PUT", rsp.Header["X-Method"][0])
+	assert.Equal(t, `{"path":"/api/v1/user","query":"debug=1","ct":"application/json","body":{"id":23}}`, string(rsp.Body))
+	assert.Nil(t, rsp.Header["Date"])
+}
+
+var testGrpcService = grpc.ServiceDesc{
+	ServiceName: "gorr.test.Echo",
+	HandlerType: (*interface{})(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Call",
+			Handler: func(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+				req := &wrappers.StringValue{}
+				err := dec(req)
+				if err != nil {
+					return nil, err
+				}
+				return &wrappers.Int64Value{Value: int64(len(req.Value))}, nil
+			},
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName: "Stream",
+			Handler: func(srv interface{}, stream grpc.ServerStream) error {
+				for {
+					req := &wrappers.StringValue{}
+					err := stream.RecvMsg(req)
+					if err == io.EOF {
+						return nil
+					}
+
+					if err != nil {
+						return err
+					}
+
+					err = stream.SendMsg(&wrappers.Int64Value{Value: int64(len(req.Value))})
+					if err != nil {
+						return err
+					}
+				}
+			},
+			ServerStreams: true,
+			ClientStreams: true,
+		},
+	},
+}
+
+func TestRunGrpcCase(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+
+	srv := grpc.NewServer()
+	srv.RegisterService(&testGrpcService, struct{}{})
+	go srv.Serve(lis)
+	defer srv.Stop()
+
+	dir, err := ioutil.TempDir("", "gorr_grpc_runner")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	r := pbdesc.NewRegistry()
+	assert.Nil(t, r.AddRegisteredFile("google/protobuf/wrappers.proto"))
+	desc, err := proto.Marshal(r.Files())
+	assert.Nil(t, err)
+	assert.Nil(t, ioutil.WriteFile(dir+"/"+grpcDescriptorFile, desc, 0644))
+
+	unary := &TestCase{
+		Req:     "unary.req",
+		ReqType: recorderDataTypeJSON,
+		RspType: recorderDataTypeJSON,
+		URI:     "/gorr.test.Echo/Call",
+		ReqMsg:  "google.protobuf.StringValue",
+		RspMsg:  "google.protobuf.Int64Value",
+	}
+	assert.True(t, isGrpcCase(unary))
+	assert.Nil(t, ioutil.WriteFile(dir+"/unary.req", []byte(`"miliao"`), 0644))
+
+	_, err = runGrpcCase(lis.Addr().String(), dir, unary, dir+"/unary.rsp")
+	assert.Nil(t, err)
+
+	data, err := ioutil.ReadFile(dir + "/unary.rsp")
+	assert.Nil(t, err)
+	assert.Equal(t, `"6"`, string(data))
+
+	stream := &TestCase{
+		Req:          "stream.req",
+		ReqType:      recorderDataTypePbBinary,
+		RspType:      recorderDataTypeJSON,
+		URI:          "/gorr.test.Echo/Stream",
+		ReqMsg:       "google.protobuf.StringValue",
+		RspMsg:       "google.protobuf.Int64Value",
+		ClientStream: true,
+		ServerStream: true,
+	}
+
+	var reqs []byte
+	for _, s := range []string{"a", "bc"} {
+		m, _ := proto.Marshal(&wrappers.StringValue{Value: s})
+		reqs = append(reqs, proto.EncodeVarint(uint64(len(m)))...)
+		reqs = append(reqs, m...)
+	}
+	assert.Nil(t, ioutil.WriteFile(dir+"/stream.req", reqs, 0644))
+
+	_, err = runGrpcCase(lis.Addr().String(), dir, stream, dir+"/stream.rsp")
+	assert.Nil(t, err)
+
+	var rsp struct {
+		Messages []string `json:"messages"`
+	}
+	data, err = ioutil.ReadFile(dir + "/stream.rsp")
+	assert.Nil(t, err)
+	assert.Nil(t, json.Unmarshal(data, &rsp))
+	assert.Equal(t, []string{"1", "2"}, rsp.Messages)
+}
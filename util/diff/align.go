@@ -0,0 +1,392 @@
+package diff
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	// maxAlignCells limits cost of aligning arrays, larger arrays are compared index by index.
+	maxAlignCells = 1 << 20
+	// maxAlignNodes limits cost of aligning arrays whose elements are compared by diffAny(),
+	// it is number of cells times average number of values in elements, so deep elements get fewer cells.
+	maxAlignNodes = 1 << 22
+)
+
+// aligner finds the longest common subsequence of two arrays, elements are the same if they are equal,
+// or if they have equal value of field idKey when given.
+// elements are fingerprinted first, equal elements are found by fingerprints, diffAny() is only called
+// when rules or empty values might make different fingerprints the same, and its results are memoized.
+type aligner struct {
+	df    *differ
+	path  []string
+	idKey string
+	ep    []interface{}
+	at    []interface{}
+
+	epId  []int
+	atId  []int
+	exact bool
+	nodes int
+	memo  map[[2]int]bool
+}
+
+func newAligner(df *differ, path []string, idKey string, ep, at []interface{}) *aligner {
+	a := &aligner{df: df, path: path, idKey: idKey, ep: ep, at: at, memo: make(map[[2]int]bool)}
+	a.exact = len(df.rules.Ignore) == 0 && len(df.rules.Tolerance) == 0 && len(df.rules.Match) == 0
+
+	ids := make(map[string]int)
+	intern := func(vs []interface{}) []int {
+		ret := make([]int, 0, len(vs))
+		for _, v := range vs {
+			var b strings.Builder
+			n, loose := writeFingerprint(&b, v)
+			a.nodes += n
+			a.exact = a.exact && !loose
+
+			id, ok := ids[b.String()]
+			if !ok {
+				id = len(ids)
+				ids[b.String()] = id
+			}
+			ret = append(ret, id)
+		}
+		return ret
+	}
+
+	a.epId = intern(ep)
+	a.atId = intern(at)
+	return a
+}
+
+// affordable reports whether cost of aligning is within budget.
+func (a *aligner) affordable() bool {
+	cells := len(a.ep) * len(a.at)
+	if cells > maxAlignCells {
+		return false
+	}
+
+	if a.exact || cells == 0 {
+		return true
+	}
+
+	avg := a.nodes / (len(a.ep) + len(a.at))
+	if avg < 1 {
+		avg = 1
+	}
+	return cells <= maxAlignNodes/avg
+}
+
+func (a *aligner) same(i, j int) (bool, error) {
+	if len(a.idKey) > 0 {
+		k1, ok1 := elemKey(a.ep[i], a.idKey)
+		k2, ok2 := elemKey(a.at[j], a.idKey)
+		if ok1 && ok2 {
+			return k1 == k2, nil
+		}
+	}
+
+	if a.epId[i] == a.atId[j] {
+		return true, nil
+	}
+
+	if a.exact {
+		return false, nil
+	}
+
+	if s, ok := a.memo[[2]int{i, j}]; ok {
+		return s, nil
+	}
+
+	c, err := a.df.diffAny(subPath(a.path, fmt.Sprintf("%d", i)), "", a.ep[i], a.at[j])
+	if err != nil {
+		return false, err
+	}
+
+	a.memo[[2]int{i, j}] = c == nil
+	return c == nil, nil
+}
+
+// writeFingerprint writes canonical form of v, which is the same for values diffAny() finds equal without rules,
+// except for nil and empty values, which are reported as loose. number of values in v is returned.
+func writeFingerprint(b *strings.Builder, v interface{}) (int, bool) {
+	switch t := v.(type) {
+	case nil:
+		b.WriteString("n")
+		return 1, true
+	case string:
+		b.WriteString("s")
+		b.WriteString(strconv.Quote(t))
+		return 1, false
+	case []interface{}:
+		nodes, loose := 1, len(t) == 0
+		b.WriteString("[")
+		for _, e := range t {
+			n, l := writeFingerprint(b, e)
+			nodes += n
+			loose = loose || l
+			b.WriteString(",")
+		}
+		b.WriteString("]")
+		return nodes, loose
+	case map[string]interface{}:
+		nodes, loose := 1, len(t) == 0
+		keys := make([]string, 0, len(t))
+		for k := range t {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		b.WriteString("{")
+		for _, k := range keys {
+			b.WriteString(strconv.Quote(k))
+			b.WriteString(":")
+			n, l := writeFingerprint(b, t[k])
+			nodes += n
+			loose = loose || l
+			b.WriteString(",")
+		}
+		b.WriteString("}")
+		return nodes, loose
+	}
+
+	fmt.Fprintf(b, "%T:%+v", v, v)
+
+	switch rv := reflect.ValueOf(v); rv.Kind() {
+	case reflect.Slice, reflect.Map, reflect.Array:
+		return 1, rv.Len() == 0
+	}
+	return 1, false
+}
+
+// anchors returns index pairs of the common subsequence in ascending order.
+func (a *aligner) anchors() ([][2]int, error) {
+	n, m := len(a.ep), len(a.at)
+
+	// common prefix and suffix are aligned directly, most arrays differ in a few elements only.
+	lo := 0
+	for lo < n && lo < m {
+		s, err := a.same(lo, lo)
+		if err != nil {
+			return nil, err
+		}
+		if !s {
+			break
+		}
+		lo++
+	}
+
+	hi := 0
+	for hi < n-lo && hi < m-lo {
+		s, err := a.same(n-1-hi, m-1-hi)
+		if err != nil {
+			return nil, err
+		}
+		if !s {
+			break
+		}
+		hi++
+	}
+
+	r, c := n-lo-hi, m-lo-hi
+	eq := make([][]bool, r)
+	dp := make([][]int, r+1)
+	for i := range dp {
+		dp[i] = make([]int, c+1)
+	}
+
+	for i := r - 1; i >= 0; i-- {
+		eq[i] = make([]bool, c)
+		for j := c - 1; j >= 0; j-- {
+			s, err := a.same(lo+i, lo+j)
+			if err != nil {
+				return nil, err
+			}
+
+			eq[i][j] = s
+			if s {
+				dp[i][j] = dp[i+1][j+1] + 1
+			} else if dp[i+1][j] >= dp[i][j+1] {
+				dp[i][j] = dp[i+1][j]
+			} else {
+				dp[i][j] = dp[i][j+1]
+			}
+		}
+	}
+
+	ret := make([][2]int, 0, lo+hi+dp[0][0])
+	for i := 0; i < lo; i++ {
+		ret = append(ret, [2]int{i, i})
+	}
+
+	for i, j := 0, 0; i < r && j < c; {
+		if eq[i][j] {
+			ret = append(ret, [2]int{lo + i, lo + j})
+			i++
+			j++
+		} else if dp[i+1][j] >= dp[i][j+1] {
+			i++
+		} else {
+			j++
+		}
+	}
+
+	for i := hi; i > 0; i-- {
+		ret = append(ret, [2]int{n - i, m - i})
+	}
+
+	return ret, nil
+}
+
+// diffAligned compares arrays aligned by longest common subsequence. elements not aligned are reported
+// as moved if the same element is found elsewhere, as changed if both arrays have elements between
+// the same aligned ones, otherwise as deleted or inserted.
+func (df *differ) diffAligned(a *aligner, key string) (*diffNode, error) {
+	path, idKey, ep, at := a.path, a.idKey, a.ep, a.at
+	anchors, err := a.anchors()
+	if err != nil {
+		return nil, err
+	}
+
+	// -1 for elements not aligned.
+	epPair := make([]int, len(ep))
+	atPair := make([]int, len(at))
+	for i := range epPair {
+		epPair[i] = -1
+	}
+	for j := range atPair {
+		atPair[j] = -1
+	}
+	for _, p := range anchors {
+		epPair[p[0]] = p[1]
+		atPair[p[1]] = p[0]
+	}
+
+	moved := make(map[int]int)
+	movedTo := make(map[int]bool)
+	for i := range ep {
+		if epPair[i] >= 0 {
+			continue
+		}
+
+		for j := range at {
+			if atPair[j] >= 0 || movedTo[j] {
+				continue
+			}
+
+			s, err := a.same(i, j)
+			if err != nil {
+				return nil, err
+			}
+
+			if s {
+				moved[i] = j
+				movedTo[j] = true
+				break
+			}
+		}
+	}
+
+	d := &diffNode{path: path, key: key, present: 3}
+	add := func(c *diffNode, err error) error {
+		if err != nil {
+			return err
+		}
+		if c != nil {
+			d.child = append(d.child, c)
+		}
+		return nil
+	}
+
+	// walk gaps between anchors, a virtual anchor is appended at the end.
+	pi, pj := -1, -1
+	for _, p := range append(anchors, [2]int{len(ep), len(at)}) {
+		var dels, ins []int
+		for i := pi + 1; i < p[0]; i++ {
+			if _, ok := moved[i]; !ok {
+				dels = append(dels, i)
+			}
+		}
+		for j := pj + 1; j < p[1]; j++ {
+			if !movedTo[j] {
+				ins = append(ins, j)
+			}
+		}
+
+		// elements of different keys are different elements, they are never paired as changed.
+		changed := make(map[int]int)
+		if len(idKey) == 0 {
+			for x := 0; x < len(dels) && x < len(ins); x++ {
+				changed[dels[x]] = ins[x]
+			}
+		}
+
+		for i := pi + 1; i < p[0]; i++ {
+			if j, ok := moved[i]; ok {
+				err = add(df.diffMoved(path, i, j, ep[i], at[j]))
+			} else if j, ok := changed[i]; ok {
+				k := fmt.Sprintf("%d", i)
+				err = add(df.diffAny(subPath(path, k), k, ep[i], at[j]))
+			} else {
+				k := fmt.Sprintf("%d", i)
+				err = add(df.diffSingle(1, subPath(path, k), k, ep[i]))
+			}
+
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		for _, j := range ins[len(changed):] {
+			k := fmt.Sprintf("%d", j)
+			err = add(df.diffSingle(2, subPath(path, k), k, at[j]))
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		// aligned elements are equal, unless they are aligned by key.
+		if p[0] < len(ep) && len(idKey) > 0 {
+			k := fmt.Sprintf("%d", p[0])
+			err = add(df.diffAny(subPath(path, k), k, ep[p[0]], at[p[1]]))
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		pi, pj = p[0], p[1]
+	}
+
+	if len(d.child) > 0 {
+		return d, nil
+	}
+
+	return nil, nil
+}
+
+// diffMoved reports element moved from index i to j, along with its changes if any.
+func (df *differ) diffMoved(path []string, i, j int, ep, at interface{}) (*diffNode, error) {
+	k := fmt.Sprintf("%d->%d", i, j)
+	c, err := df.diffAny(subPath(path, fmt.Sprintf("%d", i)), k, ep, at)
+	if err != nil {
+		return nil, err
+	}
+
+	to := subPath(path, fmt.Sprintf("%d", j))
+	if c != nil {
+		c.moved = true
+		c.to = to
+		return c, nil
+	}
+
+	txt, err := json.Marshal(ep)
+	if err != nil {
+		txt = []byte(fmt.Sprintf("%+v", ep))
+	}
+
+	return &diffNode{path: subPath(path, fmt.Sprintf("%d", i)), key: k, present: 3, moved: true, to: to, expect: string(txt)}, nil
+}
@@ -0,0 +1,413 @@
+// Package diff compares recorded and actual responses of regression test cases.
+package diff
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/pmezard/go-difflib/difflib"
+
+	"gorr/util/pbdesc"
+)
+
+// data types, same as gorr.RecorderDataType*
+const (
+	DataTypeUnknown  = 23
+	DataTypeJSON     = 24
+	DataTypePbText   = 25
+	DataTypePbBinary = 26
+	DataTypeHTTPJSON = 27
+	DataTypeXML      = 28
+	DataTypeYAML     = 29
+	DataTypeForm     = 30
+)
+
+// change kinds
+const (
+	KindChanged  = "changed"
+	KindDeleted  = "deleted"
+	KindInserted = "inserted"
+	KindMoved    = "moved"
+)
+
+// Options of diff, zero value compares json values as they are.
+type Options struct {
+	// message type and FileDescriptorSet files, required for protobuf diff.
+	MsgType       string
+	DescriptorSet []string
+
+	// data is length delimited messages of a grpc stream.
+	Stream bool
+
+	// compare fields set to default values, by default they are treated as absent.
+	KeepDefaults bool
+
+	// compare unknown fields, by default they are ignored.
+	KeepUnknown bool
+
+	// how repeated fields are compared: "order" or "set", default "order".
+	Repeated string
+
+	// headers compared for http data, "*" for all headers, by default no header is compared.
+	Headers []string
+
+	// string values holding json objects or arrays are decoded and compared as json values.
+	EmbeddedJSON bool
+
+	Rules *Rules
+}
+
+// Change is a difference of leaf value, or an array element moved.
+// Path is dot separated keys and array indexes from root value.
+type Change struct {
+	Path   string `json:"path"`
+	Kind   string `json:"kind"`
+	Expect string `json:"expect,omitempty"`
+	Actual string `json:"actual,omitempty"`
+	To     string `json:"to,omitempty"`
+}
+
+// Result of diff, Text is the human readable diff, empty if data are the same.
+type Result struct {
+	Changes []Change `json:"changes,omitempty"`
+	Text    string   `json:"text,omitempty"`
+
+	// data can not be decoded and is compared as text, Changes is not available.
+	Raw bool `json:"raw,omitempty"`
+}
+
+// Equal returns whether no difference is found.
+func (r *Result) Equal() bool {
+	return len(r.Text) == 0
+}
+
+// String returns diff as printed by diff tool.
+func (r *Result) String() string {
+	if r.Equal() {
+		return ""
+	}
+
+	return fmt.Sprintf("diff output:\n%s\n", r.Text)
+}
+
+type differ struct {
+	opt   *Options
+	rules *Rules
+}
+
+func newDiffer(opt *Options) (*differ, error) {
+	if opt == nil {
+		opt = &Options{}
+	}
+
+	rules := opt.Rules
+	if rules == nil {
+		rules = &Rules{}
+	}
+
+	err := rules.compile()
+	if err != nil {
+		return nil, err
+	}
+
+	return &differ{opt: opt, rules: rules}, nil
+}
+
+func readFiles(ef, af string) ([]byte, []byte, error) {
+	epData, err := ioutil.ReadFile(ef)
+	if err != nil {
+		return nil, nil, fmt.Errorf("read expect data failed, file:%s, err: %s", ef, err)
+	}
+
+	atData, err := ioutil.ReadFile(af)
+	if err != nil {
+		return nil, nil, fmt.Errorf("read actual data failed, file:%s, err: %s", af, err)
+	}
+
+	return epData, atData, nil
+}
+
+// DiffFiles compares data of expect file and actual file.
+func DiffFiles(dt int, ef, af string, opt *Options) (*Result, error) {
+	epData, atData, err := readFiles(ef, af)
+	if err != nil {
+		return nil, err
+	}
+
+	return Diff(dt, epData, atData, opt)
+}
+
+// DiffStrategyFiles compares data of expect file and actual file with differ of strategy s.
+func DiffStrategyFiles(s *Strategy, dt int, ef, af string, opt *Options) (*Result, error) {
+	epData, atData, err := readFiles(ef, af)
+	if err != nil {
+		return nil, err
+	}
+
+	return DiffStrategy(s, dt, epData, atData, opt)
+}
+
+// Diff compares data of type dt, data is compared as text if it can not be decoded.
+func Diff(dt int, epData, atData []byte, opt *Options) (*Result, error) {
+	df, err := newDiffer(opt)
+	if err != nil {
+		return nil, err
+	}
+
+	var d *diffNode
+	rawDiff := false
+	if dt == DataTypeJSON {
+		d, err = df.diffJSON(epData, atData)
+		if err != nil {
+			rawDiff = true
+		}
+	} else if dt == DataTypeHTTPJSON {
+		d, err = df.diffHTTP(epData, atData)
+		if err != nil {
+			rawDiff = true
+		}
+	} else if dt == DataTypeXML || dt == DataTypeYAML || dt == DataTypeForm {
+		d, err = df.diffDecoded(dt, epData, atData)
+		if err != nil {
+			rawDiff = true
+		}
+	} else if dt == DataTypePbBinary || dt == DataTypePbText {
+		d, err = df.diffProtobuf(epData, atData, dt == DataTypePbText)
+		if err != nil {
+			rawDiff = true
+		}
+	} else {
+		rawDiff = true
+	}
+
+	if rawDiff {
+		return diffRaw(epData, atData), nil
+	}
+
+	ret := &Result{}
+	if d == nil {
+		return ret, nil
+	}
+
+	diff := d.String(2)
+	if len(diff) == 0 {
+		return ret, nil
+	}
+
+	ret.Text = "--- Expected\n+++ Actual\n@@@@@@@@@@@@@@@@@\n" + diff
+	ret.Changes = d.changes(nil)
+	return ret, nil
+}
+
+func diffRaw(epData, atData []byte) *Result {
+	ret := &Result{Raw: true}
+	if bytes.Equal(epData, atData) {
+		return ret
+	}
+
+	diff, err := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        difflib.SplitLines(string(epData)),
+		B:        difflib.SplitLines(string(atData)),
+		FromFile: "Expected",
+		FromDate: "",
+		ToFile:   "Actual",
+		ToDate:   "",
+		Context:  1,
+	})
+
+	if err != nil {
+		diff = fmt.Sprintf("failed to perform raw diff, err:%s", err)
+	}
+
+	ret.Text = diff
+	return ret
+}
+
+// protobufValue converts message(s) in binary or text format to json value, streams are converted to {"messages":[...]}.
+func (df *differ) protobufValue(r *pbdesc.Registry, data []byte, text bool) (interface{}, error) {
+	opt := df.opt
+	if text {
+		if opt.Stream {
+			return nil, fmt.Errorf("stream is not supported in text format")
+		}
+
+		var err error
+		data, err = r.FromText(opt.MsgType, data)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	msgs := [][]byte{data}
+	if opt.Stream {
+		msgs = nil
+		for len(data) > 0 {
+			l, n := proto.DecodeVarint(data)
+			if n == 0 || uint64(len(data)-n) < l {
+				return nil, fmt.Errorf("invalid length delimited messages")
+			}
+
+			msgs = append(msgs, data[n:n+int(l)])
+			data = data[n+int(l):]
+		}
+	}
+
+	all := make([]interface{}, 0, len(msgs))
+	for _, m := range msgs {
+		d, err := r.ToJSON(opt.MsgType, m)
+		if err != nil {
+			return nil, err
+		}
+
+		var v interface{}
+		err = json.Unmarshal(d, &v)
+		if err != nil {
+			return nil, err
+		}
+
+		if !opt.KeepDefaults {
+			r.TrimDefaults(opt.MsgType, v)
+		}
+
+		if opt.Repeated == "set" {
+			r.SortRepeated(opt.MsgType, v)
+		}
+
+		all = append(all, v)
+	}
+
+	if !opt.Stream {
+		return all[0], nil
+	}
+
+	return map[string]interface{}{"messages": all}, nil
+}
+
+func (df *differ) registry(text bool) (*pbdesc.Registry, error) {
+	opt := df.opt
+	if len(opt.Repeated) > 0 && opt.Repeated != "order" && opt.Repeated != "set" {
+		return nil, fmt.Errorf("invalid repeated mode:%s", opt.Repeated)
+	}
+
+	r, err := pbdesc.ReadFileDescriptorSet(opt.DescriptorSet...)
+	if err != nil {
+		return nil, err
+	}
+
+	// text format has no unknown fields.
+	r.KeepUnknown = opt.KeepUnknown && !text
+	return r, nil
+}
+
+// diffProtobuf decodes messages with descriptor set and message type, and compares them as json values.
+func (df *differ) diffProtobuf(ep, at []byte, text bool) (*diffNode, error) {
+	opt := df.opt
+	if len(opt.MsgType) == 0 || len(opt.DescriptorSet) == 0 {
+		return nil, fmt.Errorf("message type and descriptor set are required for protobuf diff")
+	}
+
+	r, err := df.registry(text)
+	if err != nil {
+		return nil, err
+	}
+
+	ep1, err1 := df.protobufValue(r, ep, text)
+	if err1 != nil {
+		return nil, fmt.Errorf("decode expect data failed, err:%s", err1)
+	}
+
+	at1, err2 := df.protobufValue(r, at, text)
+	if err2 != nil {
+		return nil, fmt.Errorf("decode actual data failed, err:%s", err2)
+	}
+
+	d, err := df.diffRoot(ep1, at1)
+	if err != nil {
+		return nil, fmt.Errorf("diff protobuf failed, err:%s", err)
+	}
+
+	return d, nil
+}
+
+// diffRoot compares decoded values.
+func (df *differ) diffRoot(ep, at interface{}) (*diffNode, error) {
+	if df.opt.EmbeddedJSON {
+		ep = expandJSON(ep)
+		at = expandJSON(at)
+	}
+
+	return df.diffAny(nil, "", ep, at)
+}
+
+// diffDecoded compares data in xml, yaml or form format.
+func (df *differ) diffDecoded(dt int, ep, at []byte) (*diffNode, error) {
+	ep1, err1 := decodeValue(dt, ep)
+	if err1 != nil {
+		return nil, fmt.Errorf("decode expect data failed, err:%s", err1)
+	}
+
+	at1, err2 := decodeValue(dt, at)
+	if err2 != nil {
+		return nil, fmt.Errorf("decode actual data failed, err:%s", err2)
+	}
+
+	return df.diffRoot(ep1, at1)
+}
+
+func (df *differ) diffJSON(ep, at []byte) (*diffNode, error) {
+	var ep1, at1 map[string]interface{}
+
+	err1 := json.Unmarshal(ep, &ep1)
+	if err1 != nil {
+		return nil, fmt.Errorf("unmarshal expect data failed, err:%s", err1)
+	}
+
+	err2 := json.Unmarshal(at, &at1)
+	if err2 != nil {
+		return nil, fmt.Errorf("unmarshal actual data failed, err:%s", err2)
+	}
+
+	d, err := df.diffRoot(ep1, at1)
+	if err != nil {
+		return nil, fmt.Errorf("diff json map failed, err:%s", err)
+	}
+
+	return d, nil
+}
+
+// changes appends leaf differences of d to ret.
+func (d *diffNode) changes(ret []Change) []Change {
+	path := strings.Join(d.path, ".")
+	if d.moved {
+		ret = append(ret, Change{Path: path, Kind: KindMoved, Expect: d.expect, To: strings.Join(d.to, ".")})
+		if len(d.child) == 0 {
+			return ret
+		}
+	}
+
+	// value of different types is reported as a pair of nodes of the same path.
+	if len(d.child) == 2 && len(d.child[0].child) == 0 && len(d.child[1].child) == 0 &&
+		d.child[0].present == 1 && d.child[1].present == 2 && path == strings.Join(d.child[0].path, ".") {
+		return append(ret, Change{Path: path, Kind: KindChanged, Expect: d.child[0].expect, Actual: d.child[1].actual})
+	}
+
+	if len(d.child) > 0 {
+		for _, c := range d.child {
+			ret = c.changes(ret)
+		}
+		return ret
+	}
+
+	switch d.present {
+	case 1:
+		return append(ret, Change{Path: path, Kind: KindDeleted, Expect: d.expect})
+	case 2:
+		return append(ret, Change{Path: path, Kind: KindInserted, Actual: d.actual})
+	}
+
+	return append(ret, Change{Path: path, Kind: KindChanged, Expect: d.expect, Actual: d.actual})
+}
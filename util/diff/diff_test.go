@@ -0,0 +1,616 @@
+package diff
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"github.com/golang/protobuf/proto"
+	descpb "github.com/golang/protobuf/protoc-gen-go/descriptor"
+	"github.com/stretchr/testify/assert"
+	"gorr/util/pbdesc"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+type diffType2 struct {
+	D3 int    `json:"d1"`
+	D4 int    `json:"d2"`
+	N2 string `json:"name"`
+}
+
+type diffType struct {
+	D1 int       `json:"d1"`
+	D2 int       `json:"d2"`
+	N1 string    `json:"name"`
+	Dt diffType2 `json:"dtype"`
+	Ar []string  `json:"sar"`
+}
+
+// diffString returns text of Diff.
+func diffString(dt int, ep, at []byte, opt *Options) (string, error) {
+	ret, err := Diff(dt, ep, at, opt)
+	if err != nil {
+		return "", err
+	}
+
+	return ret.Text, nil
+}
+
+func diffFile(dt int, ef, af string) (string, error) {
+	ret, err := DiffFiles(dt, ef, af, nil)
+	if err != nil {
+		return "", err
+	}
+
+	return ret.String(), nil
+}
+
+func TestJSONDiff(t *testing.T) {
+	s1 := diffType{
+		D1: 23,
+		D2: 42,
+		N1: "miliao",
+		Dt: diffType2{
+			D3: 230,
+			D4: 420,
+			N2: "miliao2",
+		},
+	}
+
+	s2 := diffType{
+		D1: 23,
+		D2: 42,
+		N1: "miliao",
+		Dt: diffType2{
+			D3: 230,
+			D4: 420,
+			N2: "miliao2",
+		},
+	}
+
+	s3 := diffType{
+		D1: 23,
+		D2: 42,
+		N1: "change",
+		Dt: diffType2{
+			D3: 230,
+			D4: 420,
+			N2: "miliao2",
+		},
+	}
+
+	s4 := diffType{
+		D1: 23,
+		D2: 42,
+		Ar: []string{},
+		Dt: diffType2{
+			D3: 230,
+			D4: 420,
+			N2: "miliao2",
+		},
+	}
+
+	s5 := diffType{
+		D1: 23,
+		D2: 42,
+		Dt: diffType2{
+			D3: 230,
+			D4: 420,
+			N2: "miliao2",
+		},
+	}
+
+	var err error
+	var d1, d2, d3, d4, d5 []byte
+
+	d1, err = json.Marshal(s1)
+	assert.Nil(t, err)
+
+	d2, err = json.Marshal(s2)
+	assert.Nil(t, err)
+
+	d3, err = json.Marshal(s3)
+	assert.Nil(t, err)
+
+	d4, err = json.Marshal(s4)
+	assert.Nil(t, err)
+	d5, err = json.Marshal(s5)
+	assert.Nil(t, err)
+
+	f1 := "./d1.txt"
+	err = ioutil.WriteFile(f1, d1, 0666)
+	assert.Nil(t, err)
+
+	f2 := "./d2.txt"
+	err = ioutil.WriteFile(f2, d2, 0666)
+	assert.Nil(t, err)
+
+	f3 := "./d3.txt"
+	err = ioutil.WriteFile(f3, d3, 0666)
+	assert.Nil(t, err)
+
+	f4 := "./d4.txt"
+	err = ioutil.WriteFile(f4, d4, 0666)
+	assert.Nil(t, err)
+
+	f5 := "./d5.txt"
+	err = ioutil.WriteFile(f5, d5, 0666)
+	assert.Nil(t, err)
+
+	defer func() {
+		os.Remove(f1)
+		os.Remove(f2)
+		os.Remove(f3)
+		os.Remove(f4)
+		os.Remove(f5)
+	}()
+
+	var diff string
+	diff, err = diffFile(DataTypeJSON, f1, f2)
+	assert.Nil(t, err)
+	assert.Equal(t, "", diff)
+
+	diff, err = diffFile(DataTypeJSON, f1, f3)
+	assert.Nil(t, err)
+	assert.NotEqual(t, "", diff)
+	fmt.Printf("json diff from DiffFiles:\n%s\n", diff)
+
+	diff, err = diffFile(DataTypeJSON, f4, f5)
+	assert.Nil(t, err)
+	assert.Equal(t, "", diff)
+}
+
+type dt struct {
+	iv  int
+	sv  string
+	itv []interface{}
+	mtv map[string]interface{}
+}
+
+func TestDiffMapStruct(t *testing.T) {
+	df, _ := newDiffer(nil)
+
+	d1 := map[string]interface{}{
+		"iv":  23,
+		"sv":  "miliao",
+		"itv": []interface{}{42, "mm", map[string]interface{}{"kv1": 111, "kv2": "vvvv"}},
+		"mtv": map[string]interface{}{"mv1": 2222, "mv2": "vvv2", "sl": []interface{}{"s1", 5555}},
+	}
+
+	d2 := map[string]interface{}{
+		"iv":  234,
+		"itv": []interface{}{432, map[string]interface{}{"kv1": 111, "kv2": "vvvv"}},
+		"mtv": map[string]interface{}{"mv1": 2222, "mv2": "vvv2", "sl": []interface{}{"s1", 5555}},
+	}
+
+	d3 := map[string]interface{}{
+		"iv":  234,
+		"itv": []interface{}{432, map[string]interface{}{"kv1": 111, "kv2": "vvvv"}},
+		"mtv": map[string]interface{}{"mv1": 2222, "mv2": "vvv2", "sl": []interface{}{"s1", 5555}},
+	}
+
+	n, err := df.diffSingle(1, nil, "", d1)
+	assert.Nil(t, err)
+
+	diff := n.String(2)
+	assert.NotEqual(t, "", diff)
+
+	fmt.Printf("diff of single:\n%s\n", diff)
+
+	n, err = df.diffMap(nil, "", d1, d2)
+	assert.Nil(t, err)
+
+	diff = n.String(2)
+	assert.NotEqual(t, "", diff)
+	fmt.Printf("diff of map:\n%s\n", diff)
+
+	n2, err2 := df.diffAny(nil, "", d1, d2)
+	assert.Nil(t, err2)
+
+	diff2 := n2.String(2)
+	assert.NotEqual(t, "", diff2)
+	fmt.Printf("diff of any:\n%s\n", diff2)
+
+	assert.Equal(t, diff, diff2)
+
+	n3, err3 := df.diffAny(nil, "", d2, d3)
+	assert.Nil(t, err3)
+
+	assert.Nil(t, n3)
+}
+
+func TestHTTPDiff(t *testing.T) {
+	assert.Equal(t, DataTypeJSON, HttpBodyType(""))
+	assert.Equal(t, DataTypeJSON, HttpBodyType("application/json; charset=utf-8"))
+	assert.Equal(t, DataTypePbBinary, HttpBodyType("application/x-protobuf"))
+	assert.Equal(t, DataTypeUnknown, HttpBodyType("text/plain"))
+
+	d1 := HttpSerializedData{Status: 200, BodyType: DataTypeJSON, Body: []byte(`{"a":1,"b":"x"}`), Header: map[string][]string{"X-Id": []string{"1"}}}
+	d2 := HttpSerializedData{Status: 200, BodyType: DataTypeJSON, Body: []byte(`{"b":"x","a":1}`), Header: map[string][]string{"X-Id": []string{"2"}}}
+	d3 := HttpSerializedData{Status: 500, BodyType: DataTypeJSON, Body: []byte(`{"a":2,"b":"x"}`)}
+
+	e1, _ := json.Marshal(d1)
+	e2, _ := json.Marshal(d2)
+	e3, _ := json.Marshal(d3)
+
+	diff, err := diffString(DataTypeHTTPJSON, e1, e2, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, "", diff)
+
+	diff, err = diffString(DataTypeHTTPJSON, e1, e3, nil)
+	assert.Nil(t, err)
+	assert.Contains(t, diff, "status")
+	assert.Contains(t, diff, "500")
+	assert.Contains(t, diff, "a: 2")
+	fmt.Printf("http diff:\n%s\n", diff)
+
+	// selected headers
+	diff, err = diffString(DataTypeHTTPJSON, e1, e2, &Options{Headers: []string{"x-id"}})
+	assert.Nil(t, err)
+	assert.Contains(t, diff, "X-Id")
+
+	diff, err = diffString(DataTypeHTTPJSON, e1, e2, &Options{Headers: []string{"*"}})
+	assert.Nil(t, err)
+	assert.Contains(t, diff, "X-Id")
+
+	diff, err = diffString(DataTypeHTTPJSON, e1, e2, &Options{Headers: []string{"X-Other"}})
+	assert.Nil(t, err)
+	assert.Equal(t, "", diff)
+
+	// gzip body
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	w.Write([]byte(`{"a":1,"b":"x"}`))
+	w.Close()
+
+	d4 := HttpSerializedData{Status: 200, BodyType: DataTypeJSON, Body: buf.Bytes()}
+	e4, _ := json.Marshal(d4)
+	diff, err = diffString(DataTypeHTTPJSON, e1, e4, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, "", diff)
+
+	// text body compared by lines
+	d5 := HttpSerializedData{Status: 200, BodyType: DataTypeUnknown, Body: []byte("l1\nl2\nl3\n")}
+	d6 := HttpSerializedData{Status: 200, BodyType: DataTypeUnknown, Body: []byte("l0\nl1\nl2\nl3\n")}
+	e5, _ := json.Marshal(d5)
+	e6, _ := json.Marshal(d6)
+
+	ret, err := Diff(DataTypeHTTPJSON, e5, e6, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, []Change{{Path: "body.0", Kind: KindInserted, Actual: "l0"}}, ret.Changes)
+
+	// protobuf body
+	r := pbdesc.NewRegistry()
+	assert.Nil(t, r.AddRegisteredFile("google/protobuf/descriptor.proto"))
+
+	desc, _ := proto.Marshal(r.Files())
+	f := "./http.desc"
+	assert.Nil(t, ioutil.WriteFile(f, desc, 0644))
+	defer os.Remove(f)
+
+	p1, _ := proto.Marshal(&descpb.FileDescriptorProto{Name: proto.String("a.proto")})
+	p2, _ := proto.Marshal(&descpb.FileDescriptorProto{Name: proto.String("b.proto")})
+	e7, _ := json.Marshal(HttpSerializedData{Status: 200, BodyType: DataTypePbBinary, Body: p1})
+	e8, _ := json.Marshal(HttpSerializedData{Status: 200, BodyType: DataTypePbBinary, Body: p2})
+
+	ret, err = Diff(DataTypeHTTPJSON, e7, e8, &Options{MsgType: "google.protobuf.FileDescriptorProto", DescriptorSet: []string{f}})
+	assert.Nil(t, err)
+	assert.Equal(t, []Change{{Path: "body.name", Kind: KindChanged, Expect: "a.proto", Actual: "b.proto"}}, ret.Changes)
+}
+
+func TestProtobufDiff(t *testing.T) {
+	r := pbdesc.NewRegistry()
+	assert.Nil(t, r.AddRegisteredFile("google/protobuf/descriptor.proto"))
+
+	desc, err := proto.Marshal(r.Files())
+	assert.Nil(t, err)
+
+	f := "./pb.desc"
+	assert.Nil(t, ioutil.WriteFile(f, desc, 0644))
+	defer os.Remove(f)
+
+	opt := &Options{MsgType: "google.protobuf.FileDescriptorProto", DescriptorSet: []string{f}}
+
+	d1, _ := proto.Marshal(&descpb.FileDescriptorProto{Name: proto.String("a.proto"), Dependency: []string{"b.proto"}})
+	d2, _ := proto.Marshal(&descpb.FileDescriptorProto{Name: proto.String("a.proto"), Dependency: []string{"c.proto"}})
+
+	diff, err := diffString(DataTypePbBinary, d1, d1, opt)
+	assert.Nil(t, err)
+	assert.Equal(t, "", diff)
+
+	diff, err = diffString(DataTypePbBinary, d1, d2, opt)
+	assert.Nil(t, err)
+	assert.Contains(t, diff, "c.proto")
+
+	// defaults are treated as absent, repeated fields compared in order or as set.
+	d3, _ := proto.Marshal(&descpb.FileDescriptorProto{Name: proto.String("a.proto"), Dependency: []string{"c.proto", "b.proto"}, Options: &descpb.FileOptions{OptimizeFor: descpb.FileOptions_SPEED.Enum()}})
+	d4, _ := proto.Marshal(&descpb.FileDescriptorProto{Name: proto.String("a.proto"), Dependency: []string{"b.proto", "c.proto"}})
+
+	diff, err = diffString(DataTypePbBinary, d3, d4, opt)
+	assert.Nil(t, err)
+	assert.NotEqual(t, "", diff)
+
+	opt.Repeated = "set"
+	diff, err = diffString(DataTypePbBinary, d3, d4, opt)
+	assert.Nil(t, err)
+	assert.Equal(t, "", diff)
+
+	opt.KeepDefaults = true
+	diff, err = diffString(DataTypePbBinary, d3, d4, opt)
+	assert.Nil(t, err)
+	assert.Contains(t, diff, "SPEED")
+	opt.KeepDefaults = false
+	opt.Repeated = "order"
+
+	// text format
+	t1 := []byte(proto.MarshalTextString(&descpb.FileDescriptorProto{Name: proto.String("a.proto"), Dependency: []string{"b.proto"}}))
+	t2 := []byte(proto.CompactTextString(&descpb.FileDescriptorProto{Name: proto.String("a.proto"), Dependency: []string{"c.proto"}}))
+
+	diff, err = diffString(DataTypePbText, t1, t1, opt)
+	assert.Nil(t, err)
+	assert.Equal(t, "", diff)
+
+	diff, err = diffString(DataTypePbText, t1, t2, opt)
+	assert.Nil(t, err)
+	assert.Contains(t, diff, "c.proto")
+
+	opt.Stream = true
+
+	s1 := append(proto.EncodeVarint(uint64(len(d1))), d1...)
+	s2 := append(append([]byte{}, s1...), s1...)
+
+	diff, err = diffString(DataTypePbBinary, s2, s2, opt)
+	assert.Nil(t, err)
+	assert.Equal(t, "", diff)
+
+	diff, err = diffString(DataTypePbBinary, s1, s2, opt)
+	assert.Nil(t, err)
+	assert.NotEqual(t, "", diff)
+
+	// compared as text without message type.
+	opt.MsgType = ""
+	ret, err := Diff(DataTypePbBinary, d1, d2, opt)
+	assert.Nil(t, err)
+	assert.True(t, ret.Raw)
+}
+
+func TestDiffRules(t *testing.T) {
+	f := "./rules.json"
+	data := `{
+		"ignore": ["$.ts", "**.request_id"],
+		"tolerance": [{"path": "items[*].price", "abs": 0.01}, {"path": "ratio", "rel": 0.001}],
+		"unordered": [{"path": "tags"}, {"path": "items", "key": "id"}],
+		"match": [{"path": "trace", "regex": "^[0-9a-f]{8}$"}]
+	}`
+	assert.Nil(t, ioutil.WriteFile(f, []byte(data), 0644))
+	defer os.Remove(f)
+
+	r, err := LoadRules(f)
+	assert.Nil(t, err)
+
+	opt := &Options{Rules: r}
+
+	ep := `{"ts":1,"ratio":1000,"trace":"00000000","tags":["a","b","a"],
+		"items":[{"id":1,"price":1.00,"request_id":"x"},{"id":2,"price":2.00}]}`
+	at := `{"ts":2,"ratio":1000.9,"trace":"0123abcd","tags":["a","a","b"],
+		"items":[{"id":2,"price":2.005},{"id":1,"price":0.999,"request_id":"y"}]}`
+
+	diff, err := diffString(DataTypeJSON, []byte(ep), []byte(at), opt)
+	assert.Nil(t, err)
+	assert.Equal(t, "", diff)
+
+	at = `{"ts":2,"ratio":1002,"trace":"xyz","tags":["a","c","b"],
+		"items":[{"id":3,"price":2.00},{"id":1,"price":1.1}]}`
+
+	diff, err = diffString(DataTypeJSON, []byte(ep), []byte(at), opt)
+	assert.Nil(t, err)
+	assert.Contains(t, diff, "ratio")
+	assert.Contains(t, diff, "xyz")
+	assert.Contains(t, diff, "c")
+	assert.Contains(t, diff, "1.1")
+	assert.Contains(t, diff, "id: 3")
+	assert.NotContains(t, diff, "ts")
+	fmt.Printf("diff with rules:\n%s\n", diff)
+
+	assert.True(t, matchPath("**.id", []string{"a", "0", "id"}))
+	assert.True(t, matchPath("a.*.id", []string{"a", "0", "id"}))
+	assert.False(t, matchPath("a.id", []string{"a", "0", "id"}))
+
+	_, err = LoadRules("./not_exist.json")
+	assert.NotNil(t, err)
+}
+
+func TestDiffArrayAlign(t *testing.T) {
+	df, _ := newDiffer(nil)
+	ep := []interface{}{"a", "b", "c", "d", "e"}
+
+	// one element inserted at front.
+	n, err := df.diffAny(nil, "", ep, []interface{}{"x", "a", "b", "c", "d", "e"})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(n.child))
+	assert.Equal(t, byte(2), n.child[0].present)
+	assert.Equal(t, "x", n.child[0].actual)
+
+	// element deleted, and element changed in place.
+	n, err = df.diffAny(nil, "", ep, []interface{}{"a", "c", "D", "e"})
+	assert.Nil(t, err)
+	diff := n.String(2)
+	assert.Contains(t, diff, "-  1: b")
+	assert.Contains(t, diff, "-  3: d")
+	assert.Contains(t, diff, "+  3: D")
+	fmt.Printf("aligned diff:\n%s\n", diff)
+
+	// element moved.
+	n, err = df.diffAny(nil, "", ep, []interface{}{"b", "c", "d", "e", "a"})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(n.child))
+	assert.True(t, n.child[0].moved)
+	assert.Contains(t, n.String(2), `~  0->4: "a"`)
+
+	// elements aligned by key.
+	df.rules = &Rules{Align: []ArrayRule{{Path: "items", Key: "id"}}}
+
+	m1 := map[string]interface{}{"items": []interface{}{
+		map[string]interface{}{"id": 1, "v": "a"},
+		map[string]interface{}{"id": 2, "v": "b"},
+		map[string]interface{}{"id": 3, "v": "c"},
+	}}
+	m2 := map[string]interface{}{"items": []interface{}{
+		map[string]interface{}{"id": 2, "v": "B"},
+		map[string]interface{}{"id": 3, "v": "c"},
+		map[string]interface{}{"id": 1, "v": "a"},
+		map[string]interface{}{"id": 4, "v": "d"},
+	}}
+
+	n, err = df.diffAny(nil, "", m1, m2)
+	assert.Nil(t, err)
+	diff = n.String(2)
+	assert.Contains(t, diff, "~  0->2")
+	assert.Contains(t, diff, "+  v: B")
+	assert.Contains(t, diff, "+  id: 4")
+	fmt.Printf("keyed diff:\n%s\n", diff)
+
+	// deep elements get fewer cells when they are compared under rules.
+	deep := make([]interface{}, 0, 300)
+	for i := 0; i < 300; i++ {
+		items := make([]interface{}, 0, 100)
+		for j := 0; j < 100; j++ {
+			items = append(items, map[string]interface{}{"id": float64(j), "ts": float64(i)})
+		}
+		deep = append(deep, map[string]interface{}{"items": items})
+	}
+
+	df.rules = &Rules{}
+	assert.True(t, newAligner(df, nil, "", deep, deep).affordable())
+	df.rules = &Rules{Ignore: []string{"**.ts"}}
+	assert.False(t, newAligner(df, nil, "", deep, deep).affordable())
+}
+
+func TestDiffChanges(t *testing.T) {
+	ep := `{"a":1,"b":{"c":"x","d":[1,2,3]},"e":"gone","t":1}`
+	at := `{"a":2,"b":{"c":"x","d":[2,3,1]},"f":"new","t":"1"}`
+
+	ret, err := Diff(DataTypeJSON, []byte(ep), []byte(at), nil)
+	assert.Nil(t, err)
+	assert.False(t, ret.Equal())
+	assert.False(t, ret.Raw)
+	assert.Equal(t, []Change{
+		{Path: "a", Kind: KindChanged, Expect: "1", Actual: "2"},
+		{Path: "b.d.0", Kind: KindMoved, Expect: "1", To: "b.d.2"},
+		{Path: "e", Kind: KindDeleted, Expect: "gone"},
+		{Path: "t", Kind: KindChanged, Expect: "1", Actual: "1"},
+		{Path: "f", Kind: KindInserted, Actual: "new"},
+	}, ret.Changes)
+
+	d, err := json.Marshal(ret)
+	assert.Nil(t, err)
+	assert.Contains(t, string(d), `"kind":"moved"`)
+
+	ret, err = Diff(DataTypeJSON, []byte(ep), []byte(ep), nil)
+	assert.Nil(t, err)
+	assert.True(t, ret.Equal())
+	assert.Equal(t, "", ret.String())
+
+	ret, err = Diff(DataTypeUnknown, []byte("a\nb\n"), []byte("a\nc\n"), nil)
+	assert.Nil(t, err)
+	assert.True(t, ret.Raw)
+	assert.Contains(t, ret.String(), "+c")
+}
+
+func TestFormatDiff(t *testing.T) {
+	x1 := `<?xml version="1.0"?><order id="1"><item sku="a">2</item><item sku="b">1</item><note>  hi </note></order>`
+	x2 := `<order id="1">
+		<item sku="a">2</item>
+		<item sku="c">1</item>
+		<note>hi</note>
+	</order>`
+
+	ret, err := Diff(DataTypeXML, []byte(x1), []byte(x1), nil)
+	assert.Nil(t, err)
+	assert.True(t, ret.Equal())
+
+	ret, err = Diff(DataTypeXML, []byte(x1), []byte(x2), nil)
+	assert.Nil(t, err)
+	assert.False(t, ret.Raw)
+	assert.Equal(t, []Change{{Path: "order.item.1.@sku", Kind: KindChanged, Expect: "b", Actual: "c"}}, ret.Changes)
+
+	y1 := "a: 1\nb:\n  - p\n  - q\n1: one\n"
+	y2 := "1: one\nb: [p, r]\na: 1\n"
+
+	ret, err = Diff(DataTypeYAML, []byte(y1), []byte(y2), nil)
+	assert.Nil(t, err)
+	assert.False(t, ret.Raw)
+	assert.Equal(t, []Change{{Path: "b.1", Kind: KindChanged, Expect: "q", Actual: "r"}}, ret.Changes)
+
+	ret, err = Diff(DataTypeForm, []byte("a=1&b=2&b=3"), []byte("b=2&b=4&a=1"), nil)
+	assert.Nil(t, err)
+	assert.Equal(t, []Change{{Path: "b.1", Kind: KindChanged, Expect: "3", Actual: "4"}}, ret.Changes)
+
+	// embedded json
+	j1 := `{"payload":"{\"a\":1,\"b\":\"[1,2]\"}"}`
+	j2 := `{"payload":"{\"b\":\"[1,3]\", \"a\":1}"}`
+
+	ret, err = Diff(DataTypeJSON, []byte(j1), []byte(j2), nil)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(ret.Changes))
+	assert.Equal(t, "payload", ret.Changes[0].Path)
+
+	ret, err = Diff(DataTypeJSON, []byte(j1), []byte(j2), &Options{EmbeddedJSON: true})
+	assert.Nil(t, err)
+	assert.Equal(t, []Change{{Path: "payload.b.1", Kind: KindChanged, Expect: "2", Actual: "3"}}, ret.Changes)
+
+	// not decodable
+	ret, err = Diff(DataTypeXML, []byte("a"), []byte("b"), nil)
+	assert.Nil(t, err)
+	assert.True(t, ret.Raw)
+}
+
+func TestDiffStrategy(t *testing.T) {
+	RegisterDiffer("len", DifferFunc(func(req *Request) (*Result, error) {
+		if len(req.Expect) == len(req.Actual) {
+			return &Result{}, nil
+		}
+		return &Result{Text: req.Params["msg"]}, nil
+	}))
+
+	ret, err := DiffStrategy(&Strategy{Name: "len", Params: map[string]string{"msg": "length differs"}}, DataTypeJSON, []byte("ab"), []byte("abc"), nil)
+	assert.Nil(t, err)
+	assert.Equal(t, "length differs", ret.Text)
+
+	_, err = DiffStrategy(&Strategy{Name: "not_exist"}, DataTypeJSON, nil, nil, nil)
+	assert.NotNil(t, err)
+
+	// builtin differs
+	ep := []byte(`{"a":[1,2],"s":"{\"b\":1}"}`)
+	at := []byte(`{"a":[2,1],"s":"{ \"b\": 1 }"}`)
+
+	ret, err = DiffStrategy(&Strategy{}, DataTypeJSON, ep, at, nil)
+	assert.Nil(t, err)
+	assert.False(t, ret.Equal())
+
+	ret, err = DiffStrategy(&Strategy{Name: "json", Params: map[string]string{"embedded_json": "true"}}, DataTypeUnknown, ep, at, &Options{Rules: &Rules{Unordered: []ArrayRule{{Path: "a"}}}})
+	assert.Nil(t, err)
+	assert.True(t, ret.Equal())
+
+	_, err = DiffStrategy(&Strategy{Name: "json", Params: map[string]string{"embedded_json": "maybe"}}, DataTypeJSON, ep, at, nil)
+	assert.NotNil(t, err)
+
+	// command plugin
+	f := "./plugin.sh"
+	script := "#!/bin/sh\ncat > /dev/null\necho '{\"text\":\"differs\",\"changes\":[{\"path\":\"a\",\"kind\":\"changed\"}]}'\n"
+	assert.Nil(t, ioutil.WriteFile(f, []byte(script), 0755))
+	defer os.Remove(f)
+
+	ret, err = DiffStrategy(&Strategy{Cmd: f}, DataTypeJSON, ep, at, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, "differs", ret.Text)
+	assert.Equal(t, []Change{{Path: "a", Kind: KindChanged}}, ret.Changes)
+
+	_, err = DiffStrategy(&Strategy{Cmd: "/bin/sh -c 'exit 1'"}, DataTypeJSON, ep, at, nil)
+	assert.NotNil(t, err)
+
+	_, err = DiffStrategy(&Strategy{Cmd: " \t "}, DataTypeJSON, ep, at, nil)
+	assert.NotNil(t, err)
+}
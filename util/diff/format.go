@@ -0,0 +1,179 @@
+package diff
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// decodeValue decodes data in json, xml, yaml or form format to json like value.
+func decodeValue(dt int, data []byte) (interface{}, error) {
+	switch dt {
+	case DataTypeJSON:
+		var v interface{}
+		err := json.Unmarshal(data, &v)
+		return v, err
+	case DataTypeXML:
+		return xmlValue(data)
+	case DataTypeYAML:
+		return yamlValue(data)
+	case DataTypeForm:
+		return formValue(data)
+	}
+
+	return nil, fmt.Errorf("unsupported data type:%d", dt)
+}
+
+// xmlValue converts xml document to {"root": {...}}, attributes are keyed by "@name", text by "#text",
+// elements of the same name are collected to array, element with text only is converted to string.
+func xmlValue(data []byte) (interface{}, error) {
+	dec := xml.NewDecoder(bytes.NewReader(data))
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			return nil, fmt.Errorf("no xml element found")
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		if start, ok := tok.(xml.StartElement); ok {
+			v, err := xmlElement(dec, start)
+			if err != nil {
+				return nil, err
+			}
+
+			return map[string]interface{}{start.Name.Local: v}, nil
+		}
+	}
+}
+
+func xmlElement(dec *xml.Decoder, start xml.StartElement) (interface{}, error) {
+	ret := make(map[string]interface{})
+	for _, a := range start.Attr {
+		ret["@"+a.Name.Local] = a.Value
+	}
+
+	var text strings.Builder
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+
+		switch t := tok.(type) {
+		case xml.StartElement:
+			v, err := xmlElement(dec, t)
+			if err != nil {
+				return nil, err
+			}
+
+			name := t.Name.Local
+			switch prev := ret[name].(type) {
+			case nil:
+				ret[name] = v
+			case []interface{}:
+				ret[name] = append(prev, v)
+			default:
+				ret[name] = []interface{}{prev, v}
+			}
+		case xml.CharData:
+			text.Write(t)
+		case xml.EndElement:
+			s := strings.TrimSpace(text.String())
+			if len(ret) == 0 {
+				return s, nil
+			}
+
+			if len(s) > 0 {
+				ret["#text"] = s
+			}
+			return ret, nil
+		}
+	}
+}
+
+// yamlValue converts yaml document, keys of maps are converted to strings.
+func yamlValue(data []byte) (interface{}, error) {
+	var v interface{}
+	err := yaml.Unmarshal(data, &v)
+	if err != nil {
+		return nil, err
+	}
+
+	return yamlConvert(v), nil
+}
+
+func yamlConvert(v interface{}) interface{} {
+	switch t := v.(type) {
+	case map[interface{}]interface{}:
+		ret := make(map[string]interface{}, len(t))
+		for k, e := range t {
+			ret[fmt.Sprintf("%v", k)] = yamlConvert(e)
+		}
+		return ret
+	case []interface{}:
+		for i, e := range t {
+			t[i] = yamlConvert(e)
+		}
+	}
+
+	return v
+}
+
+// formValue converts url encoded form, field of multiple values is converted to array.
+func formValue(data []byte) (interface{}, error) {
+	vs, err := url.ParseQuery(strings.TrimSpace(string(data)))
+	if err != nil {
+		return nil, err
+	}
+
+	ret := make(map[string]interface{}, len(vs))
+	for k, v := range vs {
+		if len(v) == 1 {
+			ret[k] = v[0]
+			continue
+		}
+
+		list := make([]interface{}, len(v))
+		for i, e := range v {
+			list[i] = e
+		}
+		ret[k] = list
+	}
+
+	return ret, nil
+}
+
+// expandJSON replaces string leaves holding json objects or arrays with decoded values, recursively.
+func expandJSON(v interface{}) interface{} {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		for k, e := range t {
+			t[k] = expandJSON(e)
+		}
+	case []interface{}:
+		for i, e := range t {
+			t[i] = expandJSON(e)
+		}
+	case string:
+		s := strings.TrimSpace(t)
+		if len(s) < 2 || (s[0] != '{' && s[0] != '[') {
+			return v
+		}
+
+		var d interface{}
+		if json.Unmarshal([]byte(s), &d) == nil {
+			return expandJSON(d)
+		}
+	}
+
+	return v
+}
@@ -0,0 +1,179 @@
+package diff
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// HttpSerializedData is http request or response recorded as test case, see gorr.RecordHttpData().
+type HttpSerializedData struct {
+	Body     []byte              `json:"body"`
+	BodyType int                 `json:"btype"`
+	Header   map[string][]string `json:"header"`
+	Method   string              `json:"method,omitempty"`
+	Path     string              `json:"path,omitempty"`
+	Query    string              `json:"query,omitempty"`
+	Status   int                 `json:"status,omitempty"`
+}
+
+// HttpVolatileHeaders are response headers that differ from run to run or are consumed by transport.
+var HttpVolatileHeaders = []string{"Date", "Content-Length", "Content-Encoding", "Transfer-Encoding", "Connection"}
+
+// HttpBodyType returns data type of body by Content-Type, body without Content-Type is taken as json.
+func HttpBodyType(contentType string) int {
+	if len(contentType) == 0 || strings.Contains(contentType, "json") {
+		return DataTypeJSON
+	}
+
+	if strings.Contains(contentType, "protobuf") {
+		return DataTypePbBinary
+	}
+
+	if strings.Contains(contentType, "xml") {
+		return DataTypeXML
+	}
+
+	if strings.Contains(contentType, "yaml") {
+		return DataTypeYAML
+	}
+
+	if strings.Contains(contentType, "x-www-form-urlencoded") {
+		return DataTypeForm
+	}
+
+	return DataTypeUnknown
+}
+
+// httpBody decompresses gzip body, Content-Encoding is not recorded, so gzip is detected by magic number as well.
+func httpBody(d *HttpSerializedData) []byte {
+	h := http.Header(d.Header)
+	if h.Get("Content-Encoding") != "gzip" && !bytes.HasPrefix(d.Body, []byte{0x1f, 0x8b}) {
+		return d.Body
+	}
+
+	r, err := gzip.NewReader(bytes.NewReader(d.Body))
+	if err != nil {
+		return d.Body
+	}
+	defer r.Close()
+
+	body, err := ioutil.ReadAll(r)
+	if err != nil {
+		return d.Body
+	}
+
+	return body
+}
+
+// httpBodyValue decodes body by its declared type, protobuf body is decoded if message type is given.
+// text body is compared line by line, binary body is compared in base64.
+func (df *differ) httpBodyValue(d *HttpSerializedData) interface{} {
+	body := httpBody(d)
+
+	switch d.BodyType {
+	case DataTypeJSON, DataTypeXML, DataTypeYAML, DataTypeForm:
+		v, err := decodeValue(d.BodyType, body)
+		if err == nil {
+			return v
+		}
+	case DataTypePbBinary, DataTypePbText:
+		if len(df.opt.MsgType) > 0 && len(df.opt.DescriptorSet) > 0 {
+			text := d.BodyType == DataTypePbText
+			r, err := df.registry(text)
+			if err == nil {
+				v, err := df.protobufValue(r, body, text)
+				if err == nil {
+					return v
+				}
+			}
+		}
+	}
+
+	if !utf8.Valid(body) {
+		return "base64:" + base64.StdEncoding.EncodeToString(body)
+	}
+
+	s := string(body)
+	if !strings.Contains(strings.TrimSuffix(s, "\n"), "\n") {
+		return s
+	}
+
+	var lines []interface{}
+	for _, l := range strings.Split(strings.TrimSuffix(s, "\n"), "\n") {
+		lines = append(lines, l)
+	}
+
+	return lines
+}
+
+// httpHeaderValue returns headers selected by Options.Headers.
+func (df *differ) httpHeaderValue(d *HttpSerializedData) map[string]interface{} {
+	h := http.Header(d.Header)
+
+	var names []string
+	for _, k := range df.opt.Headers {
+		if k == "*" {
+			names = names[:0]
+			for k2 := range h {
+				names = append(names, k2)
+			}
+			break
+		}
+		names = append(names, http.CanonicalHeaderKey(strings.TrimSpace(k)))
+	}
+
+	sort.Strings(names)
+
+	ret := make(map[string]interface{})
+	for _, k := range names {
+		var vs []interface{}
+		for _, v := range h[k] {
+			vs = append(vs, v)
+		}
+
+		if len(vs) > 0 {
+			ret[k] = vs
+		}
+	}
+
+	return ret
+}
+
+func (df *differ) httpValue(d *HttpSerializedData) map[string]interface{} {
+	ret := map[string]interface{}{"status": d.Status, "body": df.httpBodyValue(d)}
+	if len(df.opt.Headers) > 0 {
+		ret["header"] = df.httpHeaderValue(d)
+	}
+
+	return ret
+}
+
+// diffHTTP compares status code, selected headers and decoded body of http response recorded as HttpSerializedData.
+func (df *differ) diffHTTP(ep, at []byte) (*diffNode, error) {
+	var ep1, at1 HttpSerializedData
+
+	err1 := json.Unmarshal(ep, &ep1)
+	if err1 != nil {
+		return nil, fmt.Errorf("unmarshal expect http data failed, err:%s", err1)
+	}
+
+	err2 := json.Unmarshal(at, &at1)
+	if err2 != nil {
+		return nil, fmt.Errorf("unmarshal actual http data failed, err:%s", err2)
+	}
+
+	d, err := df.diffRoot(df.httpValue(&ep1), df.httpValue(&at1))
+	if err != nil {
+		return nil, fmt.Errorf("diff http data failed, err:%s", err)
+	}
+
+	return d, nil
+}
@@ -0,0 +1,247 @@
+package diff
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"regexp"
+	"strings"
+)
+
+// Rules relaxes comparison of values at given paths, paths are dot separated keys or array indexes
+// from the root value, eg: "body.items.0.ts", "$.body.items[*].ts".
+// "*" matches one segment, "**" matches any number of segments.
+// eg:
+//
+//	{
+//	  "ignore": ["body.ts", "**.request_id"],
+//	  "tolerance": [{"path": "body.items.*.price", "abs": 0.01, "rel": 0.001}],
+//	  "unordered": [{"path": "body.tags"}, {"path": "body.items", "key": "id"}],
+//	  "align": [{"path": "body.events", "key": "seq"}],
+//	  "match": [{"path": "body.trace", "regex": "^[0-9a-f]{32}$"}]
+//	}
+type Rules struct {
+	Ignore    []string        `json:"ignore,omitempty"`
+	Tolerance []ToleranceRule `json:"tolerance,omitempty"`
+	Unordered []ArrayRule     `json:"unordered,omitempty"`
+	Align     []ArrayRule     `json:"align,omitempty"`
+	Match     []MatchRule     `json:"match,omitempty"`
+}
+
+// ToleranceRule treats numbers as equal if they differ by no more than abs, or by no more than rel of the expected value.
+// empty path matches all numbers.
+type ToleranceRule struct {
+	Path string  `json:"path,omitempty"`
+	Abs  float64 `json:"abs,omitempty"`
+	Rel  float64 `json:"rel,omitempty"`
+}
+
+// ArrayRule identifies elements of arrays at path by value of field key.
+// for "unordered", arrays are compared as multisets, or elements are paired by key if key is given.
+// for "align", ordered arrays are aligned by key instead of by equal elements.
+// empty path matches all arrays.
+type ArrayRule struct {
+	Path string `json:"path,omitempty"`
+	Key  string `json:"key,omitempty"`
+}
+
+// MatchRule accepts any actual leaf value matching regex, expected value is not used.
+type MatchRule struct {
+	Path  string `json:"path"`
+	Regex string `json:"regex"`
+
+	re *regexp.Regexp
+}
+
+// LoadRules reads and merges rules files, rules of former files take precedence.
+func LoadRules(files ...string) (*Rules, error) {
+	ret := &Rules{}
+	for _, f := range files {
+		data, err := ioutil.ReadFile(f)
+		if err != nil {
+			return nil, fmt.Errorf("read rules file failed, file:%s, err:%s", f, err)
+		}
+
+		var r Rules
+		err = json.Unmarshal(data, &r)
+		if err != nil {
+			return nil, fmt.Errorf("invalid rules file:%s, err:%s", f, err)
+		}
+
+		ret.Ignore = append(ret.Ignore, r.Ignore...)
+		ret.Tolerance = append(ret.Tolerance, r.Tolerance...)
+		ret.Unordered = append(ret.Unordered, r.Unordered...)
+		ret.Align = append(ret.Align, r.Align...)
+		ret.Match = append(ret.Match, r.Match...)
+	}
+
+	err := ret.compile()
+	if err != nil {
+		return nil, err
+	}
+
+	return ret, nil
+}
+
+func (r *Rules) compile() error {
+	for i := range r.Match {
+		m := &r.Match[i]
+		if m.re != nil {
+			continue
+		}
+
+		re, err := regexp.Compile(m.Regex)
+		if err != nil {
+			return fmt.Errorf("invalid regex for path:%s, err:%s", m.Path, err)
+		}
+		m.re = re
+	}
+
+	return nil
+}
+
+func (r *Rules) ignored(path []string) bool {
+	for _, p := range r.Ignore {
+		if matchPath(p, path) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (r *Rules) unordered(path []string) *ArrayRule {
+	for i := range r.Unordered {
+		if matchPath(r.Unordered[i].Path, path) {
+			return &r.Unordered[i]
+		}
+	}
+
+	return nil
+}
+
+func (r *Rules) alignKey(path []string) string {
+	for _, a := range r.Align {
+		if matchPath(a.Path, path) {
+			return a.Key
+		}
+	}
+
+	return ""
+}
+
+// matched returns whether a matcher is defined for path, and whether v matches it.
+func (r *Rules) matched(path []string, v interface{}) (bool, bool) {
+	for i := range r.Match {
+		m := &r.Match[i]
+		if !matchPath(m.Path, path) {
+			continue
+		}
+
+		switch v.(type) {
+		case map[string]interface{}, []interface{}, nil:
+			return true, false
+		}
+
+		return true, m.re != nil && m.re.MatchString(fmt.Sprintf("%+v", v))
+	}
+
+	return false, false
+}
+
+func (r *Rules) tolerated(path []string, ep, at interface{}) bool {
+	if len(r.Tolerance) == 0 {
+		return false
+	}
+
+	f1, ok1 := ruleNumber(ep)
+	f2, ok2 := ruleNumber(at)
+	if !ok1 || !ok2 {
+		return false
+	}
+
+	for _, t := range r.Tolerance {
+		if !matchPath(t.Path, path) {
+			continue
+		}
+
+		d := math.Abs(f1 - f2)
+		if d <= t.Abs || d <= t.Rel*math.Abs(f1) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func ruleNumber(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case int:
+		return float64(n), true
+	case json.Number:
+		f, err := n.Float64()
+		return f, err == nil
+	}
+
+	return 0, false
+}
+
+// splitPath converts "$.a[*].b" to ["a", "*", "b"].
+func splitPath(p string) []string {
+	p = strings.TrimPrefix(p, "$")
+	p = strings.Replace(p, "[", ".", -1)
+	p = strings.Replace(p, "]", "", -1)
+
+	var ret []string
+	for _, s := range strings.Split(p, ".") {
+		if len(s) > 0 {
+			ret = append(ret, s)
+		}
+	}
+
+	return ret
+}
+
+// matchPath reports whether path matches pattern, empty pattern matches all paths.
+func matchPath(pattern string, path []string) bool {
+	if len(pattern) == 0 {
+		return true
+	}
+
+	return matchSegments(splitPath(pattern), path)
+}
+
+func matchSegments(pattern, path []string) bool {
+	if len(pattern) == 0 {
+		return len(path) == 0
+	}
+
+	if pattern[0] == "**" {
+		for i := 0; i <= len(path); i++ {
+			if matchSegments(pattern[1:], path[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+
+	if len(path) == 0 {
+		return false
+	}
+
+	if pattern[0] != "*" && pattern[0] != path[0] {
+		return false
+	}
+
+	return matchSegments(pattern[1:], path[1:])
+}
+
+// subPath returns path of child k, path is never shared between siblings.
+func subPath(path []string, k string) []string {
+	ret := make([]string, len(path), len(path)+1)
+	copy(ret, path)
+	return append(ret, k)
+}
@@ -0,0 +1,201 @@
+package diff
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Strategy names a differ along with its parameters, it is given by test case or test suite, eg:
+//
+//	{"name": "json", "params": {"repeated": "set", "embedded_json": "true"}}
+//	{"name": "csv", "cmd": "./plugins/csvdiff", "params": {"key": "id"}}
+//
+// differ registered by RegisterDiffer() is used if cmd is empty, otherwise cmd is run as CommandDiffer,
+// cmd is split by spaces to command and arguments.
+type Strategy struct {
+	Name   string            `json:"name,omitempty"`
+	Cmd    string            `json:"cmd,omitempty"`
+	Params map[string]string `json:"params,omitempty"`
+}
+
+// Request to a differ, it is also the stdin of command plugins, in json.
+type Request struct {
+	// data type of test case, eg: DataTypeJSON.
+	Type   int               `json:"type"`
+	Expect []byte            `json:"expect"`
+	Actual []byte            `json:"actual"`
+	Params map[string]string `json:"params,omitempty"`
+
+	// options derived from test case, used by builtin differs.
+	Options *Options `json:"-"`
+}
+
+// Differ compares expected data with actual data.
+type Differ interface {
+	Diff(req *Request) (*Result, error)
+}
+
+// DifferFunc adapts function to Differ.
+type DifferFunc func(req *Request) (*Result, error)
+
+// Diff implements Differ.
+func (f DifferFunc) Diff(req *Request) (*Result, error) {
+	return f(req)
+}
+
+var (
+	differLock sync.Mutex
+	differMap  = make(map[string]Differ)
+)
+
+// RegisterDiffer makes differ available by name, differ of the same name is replaced.
+func RegisterDiffer(name string, d Differ) {
+	differLock.Lock()
+	defer differLock.Unlock()
+	differMap[name] = d
+}
+
+// GetDiffer returns differ registered by name.
+func GetDiffer(name string) (Differ, bool) {
+	differLock.Lock()
+	defer differLock.Unlock()
+	d, ok := differMap[name]
+	return d, ok
+}
+
+// builtin differs, data type of test case is used by "default".
+func init() {
+	types := map[string]int{
+		"default":  0,
+		"json":     DataTypeJSON,
+		"pbtext":   DataTypePbText,
+		"protobuf": DataTypePbBinary,
+		"http":     DataTypeHTTPJSON,
+		"xml":      DataTypeXML,
+		"yaml":     DataTypeYAML,
+		"form":     DataTypeForm,
+		"raw":      DataTypeUnknown,
+	}
+
+	for name, dt := range types {
+		dt := dt
+		RegisterDiffer(name, DifferFunc(func(req *Request) (*Result, error) {
+			opt, err := paramOptions(req.Options, req.Params)
+			if err != nil {
+				return nil, err
+			}
+
+			t := dt
+			if t == 0 {
+				t = req.Type
+			}
+
+			return Diff(t, req.Expect, req.Actual, opt)
+		}))
+	}
+}
+
+// paramOptions overrides options of test case with parameters of builtin differs:
+// msg, stream, keep_defaults, keep_unknown, repeated, headers(comma separated) and embedded_json.
+func paramOptions(base *Options, params map[string]string) (*Options, error) {
+	opt := &Options{}
+	if base != nil {
+		*opt = *base
+	}
+
+	for k, v := range params {
+		var err error
+		switch k {
+		case "msg":
+			opt.MsgType = v
+		case "repeated":
+			opt.Repeated = v
+		case "headers":
+			opt.Headers = strings.Split(v, ",")
+		case "stream":
+			opt.Stream, err = strconv.ParseBool(v)
+		case "keep_defaults":
+			opt.KeepDefaults, err = strconv.ParseBool(v)
+		case "keep_unknown":
+			opt.KeepUnknown, err = strconv.ParseBool(v)
+		case "embedded_json":
+			opt.EmbeddedJSON, err = strconv.ParseBool(v)
+		default:
+			err = fmt.Errorf("unknown parameter")
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("invalid parameter:%s=%s, err:%s", k, v, err)
+		}
+	}
+
+	return opt, nil
+}
+
+// CommandDiffer runs an external command as differ, the protocol is:
+//   - Request is written to stdin of the command in json, expect and actual are base64 encoded.
+//   - command writes Result to stdout in json, eg: {"text": "...", "changes": [{"path": "a", "kind": "changed"}]},
+//     empty text means no difference. {} is written if data are the same.
+//   - command exits with 0 if diff is performed, no matter there is difference or not,
+//     non-zero exit code means failure of the command itself, stderr is returned as error.
+type CommandDiffer struct {
+	Path string
+	Args []string
+}
+
+// Diff implements Differ.
+func (c *CommandDiffer) Diff(req *Request) (*Result, error) {
+	in, err := json.Marshal(req)
+	if err != nil {
+		return nil, fmt.Errorf("marshal diff request failed, err:%s", err)
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command(c.Path, c.Args...)
+	cmd.Stdin = bytes.NewReader(in)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	err = cmd.Run()
+	if err != nil {
+		return nil, fmt.Errorf("run diff command failed, cmd:%s, err:%s, stderr:%s", c.Path, err, stderr.String())
+	}
+
+	var ret Result
+	err = json.Unmarshal(stdout.Bytes(), &ret)
+	if err != nil {
+		return nil, fmt.Errorf("invalid output of diff command, cmd:%s, err:%s, output:%s", c.Path, err, stdout.String())
+	}
+
+	return &ret, nil
+}
+
+// DiffStrategy compares data of type dt with differ of strategy s, opt is passed to builtin differs.
+func DiffStrategy(s *Strategy, dt int, ep, at []byte, opt *Options) (*Result, error) {
+	req := &Request{Type: dt, Expect: ep, Actual: at, Params: s.Params, Options: opt}
+	if len(s.Cmd) > 0 {
+		args := strings.Fields(s.Cmd)
+		if len(args) == 0 {
+			return nil, fmt.Errorf("invalid diff command:%q", s.Cmd)
+		}
+
+		return (&CommandDiffer{Path: args[0], Args: args[1:]}).Diff(req)
+	}
+
+	name := s.Name
+	if len(name) == 0 {
+		name = "default"
+	}
+
+	d, ok := GetDiffer(name)
+	if !ok {
+		return nil, fmt.Errorf("differ not found:%s", name)
+	}
+
+	return d.Diff(req)
+}
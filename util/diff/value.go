@@ -1,4 +1,4 @@
-package main
+package diff
 
 import (
 	"fmt"
@@ -13,6 +13,7 @@ const (
 )
 
 type diffNode struct {
+	path   []string
 	key    string
 	expect string
 	actual string
@@ -20,6 +21,10 @@ type diffNode struct {
 	elemType int
 	present  byte
 
+	// element of array moved, key is "from->to".
+	moved bool
+	to    []string
+
 	child []*diffNode
 }
 
@@ -40,6 +45,10 @@ func (d *diffNode) String(indent int) string {
 	prefix := genSpaceStr(indent)
 
 	sz := len(d.child)
+	if sz == 0 && d.moved {
+		return fmt.Sprintf("%s~  %s: %s", prefix, d.key, d.expect)
+	}
+
 	if sz == 0 {
 		txt1 := ""
 		txt2 := ""
@@ -58,6 +67,8 @@ func (d *diffNode) String(indent int) string {
 		prefix3 = "-"
 	} else if d.present == 2 {
 		prefix3 = "+"
+	} else if d.moved {
+		prefix3 = "~"
 	}
 
 	lc := make([]string, 0, sz)
@@ -87,8 +98,8 @@ func (d *diffNode) String(indent int) string {
 	return ret
 }
 
-func diffMap(key string, ep, at map[string]interface{}) (*diffNode, error) {
-	d := &diffNode{key: key, present: 3, elemType: elemTypeMAP}
+func (df *differ) diffMap(path []string, key string, ep, at map[string]interface{}) (*diffNode, error) {
+	d := &diffNode{path: path, key: key, present: 3, elemType: elemTypeMAP}
 
 	k1 := getSortedKeys(ep)
 	k2 := getSortedKeys(at)
@@ -97,9 +108,9 @@ func diffMap(key string, ep, at map[string]interface{}) (*diffNode, error) {
 		var err error
 		var c *diffNode
 		if _, ok := at[k]; ok {
-			c, err = diffAny(k, ep[k], at[k])
+			c, err = df.diffAny(subPath(path, k), k, ep[k], at[k])
 		} else {
-			c, err = diffSingle(1, k, ep[k])
+			c, err = df.diffSingle(1, subPath(path, k), k, ep[k])
 		}
 		if err != nil {
 			return nil, err
@@ -113,7 +124,7 @@ func diffMap(key string, ep, at map[string]interface{}) (*diffNode, error) {
 		var err error
 		var c *diffNode
 		if _, ok := ep[k]; !ok {
-			c, err = diffSingle(2, k, at[k])
+			c, err = df.diffSingle(2, subPath(path, k), k, at[k])
 		}
 		if err != nil {
 			return nil, err
@@ -130,16 +141,33 @@ func diffMap(key string, ep, at map[string]interface{}) (*diffNode, error) {
 	return d, nil
 }
 
-func diffArray(key string, ep, at []interface{}) (*diffNode, error) {
+func (df *differ) diffArray(path []string, key string, ep, at []interface{}) (*diffNode, error) {
+	if u := df.rules.unordered(path); u != nil {
+		return df.diffUnordered(path, key, u, ep, at)
+	}
+
+	if len(ep)*len(at) <= maxAlignCells {
+		a := newAligner(df, path, df.rules.alignKey(path), ep, at)
+		if a.affordable() {
+			return df.diffAligned(a, key)
+		}
+	}
+
+	return df.diffIndexed(path, key, ep, at)
+}
+
+// diffIndexed compares elements of the same index.
+func (df *differ) diffIndexed(path []string, key string, ep, at []interface{}) (*diffNode, error) {
 	sz := len(ep)
-	d := &diffNode{key: key, present: 3}
+	d := &diffNode{path: path, key: key, present: 3}
 
 	if sz > len(at) {
 		sz = len(at)
 	}
 
 	for i := 0; i < sz; i++ {
-		c, err := diffAny(fmt.Sprintf("%d", i), ep[i], at[i])
+		k := fmt.Sprintf("%d", i)
+		c, err := df.diffAny(subPath(path, k), k, ep[i], at[i])
 		if err != nil {
 			return nil, err
 		}
@@ -151,7 +179,7 @@ func diffArray(key string, ep, at []interface{}) (*diffNode, error) {
 
 	for i := sz; i < len(ep); i++ {
 		k := fmt.Sprintf("%d", i)
-		c, err := diffSingle(1, k, ep[i])
+		c, err := df.diffSingle(1, subPath(path, k), k, ep[i])
 		if err != nil {
 			return nil, err
 		}
@@ -162,7 +190,7 @@ func diffArray(key string, ep, at []interface{}) (*diffNode, error) {
 
 	for i := sz; i < len(at); i++ {
 		k := fmt.Sprintf("%d", i)
-		c, err := diffSingle(2, k, at[i])
+		c, err := df.diffSingle(2, subPath(path, k), k, at[i])
 		if err != nil {
 			return nil, err
 		}
@@ -178,15 +206,19 @@ func diffArray(key string, ep, at []interface{}) (*diffNode, error) {
 	return nil, nil
 }
 
-func diffSingle(presence byte, key string, n interface{}) (*diffNode, error) {
-	d := &diffNode{key: key, present: presence}
+func (df *differ) diffSingle(presence byte, path []string, key string, n interface{}) (*diffNode, error) {
+	if df.rules.ignored(path) {
+		return nil, nil
+	}
+
+	d := &diffNode{path: path, key: key, present: presence}
 	switch v := n.(type) {
 	case []interface{}:
 		i := 1
 		d.elemType = elemTypeArray
-		for _, vv := range v {
+		for j, vv := range v {
 			id := fmt.Sprintf("%d", i)
-			cd, err := diffSingle(presence, id, vv)
+			cd, err := df.diffSingle(presence, subPath(path, fmt.Sprintf("%d", j)), id, vv)
 			if err != nil {
 				return nil, err
 			}
@@ -203,7 +235,7 @@ func diffSingle(presence byte, key string, n interface{}) (*diffNode, error) {
 		k := getSortedKeys(v)
 		for _, v2 := range k {
 			if v3, ok := v[v2]; ok {
-				cd, err := diffSingle(presence, v2, v3)
+				cd, err := df.diffSingle(presence, subPath(path, v2), v2, v3)
 				if err != nil {
 					return nil, err
 				}
@@ -231,7 +263,23 @@ func diffSingle(presence byte, key string, n interface{}) (*diffNode, error) {
 	return d, nil
 }
 
-func diffAny(key string, ep, at interface{}) (*diffNode, error) {
+func (df *differ) diffAny(path []string, key string, ep, at interface{}) (*diffNode, error) {
+	if df.rules.ignored(path) {
+		return nil, nil
+	}
+
+	if ok, matched := df.rules.matched(path, at); ok {
+		if matched {
+			return nil, nil
+		}
+
+		return &diffNode{path: path, key: key, present: 3, expect: fmt.Sprintf("%+v", ep), actual: fmt.Sprintf("%+v", at)}, nil
+	}
+
+	if df.rules.tolerated(path, ep, at) {
+		return nil, nil
+	}
+
 	etype := reflect.TypeOf(ep)
 	atype := reflect.TypeOf(at)
 
@@ -258,13 +306,13 @@ func diffAny(key string, ep, at interface{}) (*diffNode, error) {
 	}
 
 	if etype != atype {
-		d := &diffNode{key: key, present: 3}
+		d := &diffNode{path: path, key: key, present: 3}
 
-		expect, err1 := diffSingle(1, key, ep)
+		expect, err1 := df.diffSingle(1, path, key, ep)
 		if err1 != nil {
 			return nil, err1
 		}
-		actual, err2 := diffSingle(2, key, at)
+		actual, err2 := df.diffSingle(2, path, key, at)
 		if err2 != nil {
 			return nil, err2
 		}
@@ -280,19 +328,19 @@ func diffAny(key string, ep, at interface{}) (*diffNode, error) {
 
 	switch v := ep.(type) {
 	case []interface{}:
-		c, err := diffArray(key, v, at.([]interface{}))
+		c, err := df.diffArray(path, key, v, at.([]interface{}))
 		if err != nil {
 			return nil, err
 		}
 		return c, err
 	case map[string]interface{}:
-		c, err := diffMap(key, v, at.(map[string]interface{}))
+		c, err := df.diffMap(path, key, v, at.(map[string]interface{}))
 		if err != nil {
 			return nil, err
 		}
 		return c, err
 	default:
-		d := &diffNode{key: key, present: 3}
+		d := &diffNode{path: path, key: key, present: 3}
 		d.expect = fmt.Sprintf("%+v", ep)
 		d.actual = fmt.Sprintf("%+v", at)
 		if d.expect != d.actual {
@@ -302,6 +350,103 @@ func diffAny(key string, ep, at interface{}) (*diffNode, error) {
 	}
 }
 
+// diffUnordered pairs elements by value of key field, or by equality if no key is given,
+// elements left unpaired are compared in order.
+func (df *differ) diffUnordered(path []string, key string, u *ArrayRule, ep, at []interface{}) (*diffNode, error) {
+	d := &diffNode{path: path, key: key, present: 3}
+
+	used := make([]bool, len(at))
+	pair := make([]int, len(ep))
+	for i := range ep {
+		pair[i] = -1
+		for j := range at {
+			if used[j] {
+				continue
+			}
+
+			if len(u.Key) > 0 {
+				k1, ok1 := elemKey(ep[i], u.Key)
+				k2, ok2 := elemKey(at[j], u.Key)
+				if !ok1 || !ok2 || k1 != k2 {
+					continue
+				}
+			} else {
+				c, err := df.diffAny(subPath(path, fmt.Sprintf("%d", i)), "", ep[i], at[j])
+				if err != nil {
+					return nil, err
+				}
+				if c != nil {
+					continue
+				}
+			}
+
+			pair[i] = j
+			used[j] = true
+			break
+		}
+	}
+
+	var rest []int
+	for j := range at {
+		if !used[j] {
+			rest = append(rest, j)
+		}
+	}
+
+	for i := range ep {
+		k := fmt.Sprintf("%d", i)
+		j := pair[i]
+		if j < 0 && len(u.Key) == 0 && len(rest) > 0 {
+			j, rest = rest[0], rest[1:]
+		}
+
+		var c *diffNode
+		var err error
+		if j >= 0 {
+			c, err = df.diffAny(subPath(path, k), k, ep[i], at[j])
+		} else {
+			c, err = df.diffSingle(1, subPath(path, k), k, ep[i])
+		}
+		if err != nil {
+			return nil, err
+		}
+		if c != nil {
+			d.child = append(d.child, c)
+		}
+	}
+
+	for _, j := range rest {
+		k := fmt.Sprintf("%d", j)
+		c, err := df.diffSingle(2, subPath(path, k), k, at[j])
+		if err != nil {
+			return nil, err
+		}
+		if c != nil {
+			d.child = append(d.child, c)
+		}
+	}
+
+	if len(d.child) > 0 {
+		return d, nil
+	}
+
+	return nil, nil
+}
+
+func elemKey(v interface{}, key string) (string, bool) {
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		return "", false
+	}
+
+	k, ok := m[key]
+	if !ok {
+		return "", false
+	}
+
+	return fmt.Sprintf("%+v", k), true
+}
+
 func getSortedKeys(m map[string]interface{}) []string {
 	keys := make([]string, 0, len(m))
 	for key := range m {
@@ -0,0 +1,61 @@
+package pbdesc
+
+import (
+	"strings"
+)
+
+// Clear removes field at path from v, a message of type name in jsonpb form as returned by Decode().
+// path is given by proto field names separated by dot, repeated fields and map values are crossed.
+func (r *Registry) Clear(name string, v interface{}, path string) {
+	m, err := r.message(name)
+	if err != nil {
+		return
+	}
+
+	r.clear(m, v, strings.Split(path, "."))
+}
+
+func (r *Registry) clear(m *message, v interface{}, path []string) {
+	obj, ok := v.(map[string]interface{})
+	if !ok {
+		return
+	}
+
+	fd, ok := m.byName[path[0]]
+	if !ok {
+		return
+	}
+
+	key := jsonName(fd)
+	if len(path) == 1 {
+		delete(obj, key)
+		return
+	}
+
+	child, ok := r.messages[trimTypeName(fd.GetTypeName())]
+	if !ok {
+		return
+	}
+
+	if entry, ok := r.isMapEntry(fd); ok {
+		child, ok = r.messages[trimTypeName(entry.byNum[2].GetTypeName())]
+		if !ok {
+			return
+		}
+
+		kv, _ := obj[key].(map[string]interface{})
+		for _, e := range kv {
+			r.clear(child, e, path[1:])
+		}
+		return
+	}
+
+	if list, ok := obj[key].([]interface{}); ok {
+		for _, e := range list {
+			r.clear(child, e, path[1:])
+		}
+		return
+	}
+
+	r.clear(child, obj[key], path[1:])
+}
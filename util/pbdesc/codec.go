@@ -0,0 +1,37 @@
+package pbdesc
+
+import (
+	"fmt"
+)
+
+// RawCodec is a grpc codec passing serialized messages of *[]byte through, so that no generated code is needed.
+// it works as both encoding.Codec and the deprecated grpc.Codec, eg: grpc.ForceCodec(RawCodec{}), grpc.CustomCodec(RawCodec{}).
+type RawCodec struct{}
+
+func (RawCodec) Marshal(v interface{}) ([]byte, error) {
+	d, ok := v.(*[]byte)
+	if !ok {
+		return nil, fmt.Errorf("raw codec, unexpected type:%T", v)
+	}
+
+	return *d, nil
+}
+
+func (RawCodec) Unmarshal(data []byte, v interface{}) error {
+	d, ok := v.(*[]byte)
+	if !ok {
+		return fmt.Errorf("raw codec, unexpected type:%T", v)
+	}
+
+	*d = append([]byte{}, data...)
+	return nil
+}
+
+// Name is content subtype of the codec, messages are protobuf on wire.
+func (RawCodec) Name() string {
+	return "proto"
+}
+
+func (RawCodec) String() string {
+	return "proto"
+}
@@ -0,0 +1,578 @@
+package pbdesc
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	descpb "github.com/golang/protobuf/protoc-gen-go/descriptor"
+)
+
+const (
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+	wireStart   = 3
+	wireEnd     = 4
+	wireFixed32 = 5
+)
+
+// ToJSON converts binary message of type name to jsonpb form.
+func (r *Registry) ToJSON(name string, data []byte) ([]byte, error) {
+	v, err := r.Decode(name, data)
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(v)
+}
+
+// Decode converts binary message to a value as produced by json.Unmarshal() on its jsonpb form,
+// except that numbers are kept as json.Number.
+func (r *Registry) Decode(name string, data []byte) (interface{}, error) {
+	m, err := r.message(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return r.decodeMessage(m, data)
+}
+
+// decoded value of a field, scalars are kept in go types until converted to json.
+type fieldValue struct {
+	desc   *descpb.FieldDescriptorProto
+	single interface{}
+	list   []interface{}
+	kv     map[string]interface{}
+}
+
+func (r *Registry) decodeMessage(m *message, data []byte) (interface{}, error) {
+	fields := make(map[int32]*fieldValue)
+	unknown := make(map[string][]interface{})
+
+	for len(data) > 0 {
+		key, n := proto.DecodeVarint(data)
+		if n == 0 {
+			return nil, fmt.Errorf("invalid field key in message:%s", m.name)
+		}
+		data = data[n:]
+
+		num := int32(key >> 3)
+		wt := int(key & 7)
+
+		raw, rest, err := readRaw(wt, data)
+		if err != nil {
+			return nil, fmt.Errorf("invalid field:%d in message:%s, err:%s", num, m.name, err)
+		}
+		data = rest
+
+		fd, ok := m.byNum[num]
+		if !ok {
+			// unknown fields are ignored by default.
+			if r.KeepUnknown {
+				k := fmt.Sprintf("[%d]", num)
+				unknown[k] = append(unknown[k], base64.StdEncoding.EncodeToString(raw))
+			}
+			continue
+		}
+
+		fv := fields[num]
+		if fv == nil {
+			fv = &fieldValue{desc: fd}
+			fields[num] = fv
+		}
+
+		err = r.decodeField(fv, wt, raw)
+		if err != nil {
+			return nil, fmt.Errorf("decode field:%s of message:%s failed, err:%s", fd.GetName(), m.name, err)
+		}
+	}
+
+	if conv, ok := wktDecoders[m.name]; ok {
+		return conv(m, fields)
+	}
+
+	ret := make(map[string]interface{}, len(fields)+len(unknown))
+	for _, fv := range fields {
+		ret[jsonName(fv.desc)] = r.fieldJSON(fv)
+	}
+
+	for k, v := range unknown {
+		ret[k] = v
+	}
+
+	return ret, nil
+}
+
+func readRaw(wt int, data []byte) ([]byte, []byte, error) {
+	switch wt {
+	case wireVarint:
+		_, n := proto.DecodeVarint(data)
+		if n == 0 {
+			return nil, nil, fmt.Errorf("invalid varint")
+		}
+		return data[:n], data[n:], nil
+	case wireFixed64:
+		if len(data) < 8 {
+			return nil, nil, fmt.Errorf("invalid fixed64")
+		}
+		return data[:8], data[8:], nil
+	case wireFixed32:
+		if len(data) < 4 {
+			return nil, nil, fmt.Errorf("invalid fixed32")
+		}
+		return data[:4], data[4:], nil
+	case wireBytes:
+		l, n := proto.DecodeVarint(data)
+		if n == 0 || uint64(len(data)-n) < l {
+			return nil, nil, fmt.Errorf("invalid length delimited data")
+		}
+		return data[n : n+int(l)], data[n+int(l):], nil
+	case wireStart:
+		// groups are skipped as a whole.
+		depth := 1
+		start := data
+		for depth > 0 {
+			key, n := proto.DecodeVarint(data)
+			if n == 0 {
+				return nil, nil, fmt.Errorf("invalid group")
+			}
+			data = data[n:]
+
+			t := int(key & 7)
+			if t == wireStart {
+				depth++
+				continue
+			}
+
+			if t == wireEnd {
+				depth--
+				continue
+			}
+
+			var err error
+			_, data, err = readRaw(t, data)
+			if err != nil {
+				return nil, nil, err
+			}
+		}
+		return start[:len(start)-len(data)], data, nil
+	}
+
+	return nil, nil, fmt.Errorf("unsupported wire type:%d", wt)
+}
+
+func isPackable(t descpb.FieldDescriptorProto_Type) bool {
+	switch t {
+	case descpb.FieldDescriptorProto_TYPE_STRING, descpb.FieldDescriptorProto_TYPE_BYTES,
+		descpb.FieldDescriptorProto_TYPE_MESSAGE, descpb.FieldDescriptorProto_TYPE_GROUP:
+		return false
+	}
+
+	return true
+}
+
+func (r *Registry) isMapEntry(fd *descpb.FieldDescriptorProto) (*message, bool) {
+	if fd.GetType() != descpb.FieldDescriptorProto_TYPE_MESSAGE || fd.GetLabel() != descpb.FieldDescriptorProto_LABEL_REPEATED {
+		return nil, false
+	}
+
+	m, err := r.message(fd.GetTypeName())
+	if err != nil || !m.desc.GetOptions().GetMapEntry() {
+		return nil, false
+	}
+
+	return m, true
+}
+
+func (r *Registry) decodeField(fv *fieldValue, wt int, raw []byte) error {
+	fd := fv.desc
+	repeated := fd.GetLabel() == descpb.FieldDescriptorProto_LABEL_REPEATED
+
+	if entry, ok := r.isMapEntry(fd); ok {
+		k, v, err := r.decodeMapEntry(entry, raw)
+		if err != nil {
+			return err
+		}
+
+		if fv.kv == nil {
+			fv.kv = make(map[string]interface{})
+		}
+		fv.kv[k] = v
+		return nil
+	}
+
+	// packed repeated scalars.
+	if repeated && wt == wireBytes && isPackable(fd.GetType()) {
+		for len(raw) > 0 {
+			var v interface{}
+			var err error
+			v, raw, err = r.decodePacked(fd, raw)
+			if err != nil {
+				return err
+			}
+			fv.list = append(fv.list, v)
+		}
+		return nil
+	}
+
+	v, err := r.decodeScalar(fd, wt, raw)
+	if err != nil {
+		return err
+	}
+
+	if repeated {
+		fv.list = append(fv.list, v)
+	} else if fd.GetType() == descpb.FieldDescriptorProto_TYPE_MESSAGE && fv.single != nil {
+		// non-repeated message appearing more than once is merged.
+		fv.single = mergeJSON(fv.single, v)
+	} else {
+		fv.single = v
+	}
+
+	return nil
+}
+
+func mergeJSON(a, b interface{}) interface{} {
+	ma, ok1 := a.(map[string]interface{})
+	mb, ok2 := b.(map[string]interface{})
+	if !ok1 || !ok2 {
+		return b
+	}
+
+	for k, v := range mb {
+		if old, ok := ma[k]; ok {
+			if l1, ok := old.([]interface{}); ok {
+				if l2, ok := v.([]interface{}); ok {
+					ma[k] = append(l1, l2...)
+					continue
+				}
+			}
+			ma[k] = mergeJSON(old, v)
+			continue
+		}
+		ma[k] = v
+	}
+
+	return ma
+}
+
+func (r *Registry) decodePacked(fd *descpb.FieldDescriptorProto, data []byte) (interface{}, []byte, error) {
+	wt := wireVarint
+	switch fd.GetType() {
+	case descpb.FieldDescriptorProto_TYPE_DOUBLE, descpb.FieldDescriptorProto_TYPE_FIXED64, descpb.FieldDescriptorProto_TYPE_SFIXED64:
+		wt = wireFixed64
+	case descpb.FieldDescriptorProto_TYPE_FLOAT, descpb.FieldDescriptorProto_TYPE_FIXED32, descpb.FieldDescriptorProto_TYPE_SFIXED32:
+		wt = wireFixed32
+	}
+
+	raw, rest, err := readRaw(wt, data)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	v, err := r.decodeScalar(fd, wt, raw)
+	return v, rest, err
+}
+
+func (r *Registry) decodeScalar(fd *descpb.FieldDescriptorProto, wt int, raw []byte) (interface{}, error) {
+	var u uint64
+	switch wt {
+	case wireVarint:
+		u, _ = proto.DecodeVarint(raw)
+	case wireFixed64:
+		u = binary.LittleEndian.Uint64(raw)
+	case wireFixed32:
+		u = uint64(binary.LittleEndian.Uint32(raw))
+	}
+
+	switch fd.GetType() {
+	case descpb.FieldDescriptorProto_TYPE_DOUBLE:
+		return math.Float64frombits(u), nil
+	case descpb.FieldDescriptorProto_TYPE_FLOAT:
+		return math.Float32frombits(uint32(u)), nil
+	case descpb.FieldDescriptorProto_TYPE_INT64, descpb.FieldDescriptorProto_TYPE_SFIXED64:
+		return int64(u), nil
+	case descpb.FieldDescriptorProto_TYPE_UINT64, descpb.FieldDescriptorProto_TYPE_FIXED64:
+		return u, nil
+	case descpb.FieldDescriptorProto_TYPE_INT32, descpb.FieldDescriptorProto_TYPE_SFIXED32:
+		return int32(u), nil
+	case descpb.FieldDescriptorProto_TYPE_UINT32, descpb.FieldDescriptorProto_TYPE_FIXED32:
+		return uint32(u), nil
+	case descpb.FieldDescriptorProto_TYPE_SINT32:
+		return int32(uint32(u>>1) ^ uint32(-int32(u&1))), nil
+	case descpb.FieldDescriptorProto_TYPE_SINT64:
+		return int64(u>>1) ^ -int64(u&1), nil
+	case descpb.FieldDescriptorProto_TYPE_BOOL:
+		return u != 0, nil
+	case descpb.FieldDescriptorProto_TYPE_ENUM:
+		return r.enumName(fd.GetTypeName(), int32(u)), nil
+	case descpb.FieldDescriptorProto_TYPE_STRING:
+		return string(raw), nil
+	case descpb.FieldDescriptorProto_TYPE_BYTES:
+		return append([]byte{}, raw...), nil
+	case descpb.FieldDescriptorProto_TYPE_MESSAGE:
+		m, err := r.message(fd.GetTypeName())
+		if err != nil {
+			return nil, err
+		}
+		return r.decodeMessage(m, raw)
+	case descpb.FieldDescriptorProto_TYPE_GROUP:
+		return nil, nil
+	}
+
+	return nil, fmt.Errorf("unsupported field type:%s", fd.GetType())
+}
+
+func (r *Registry) enumName(name string, v int32) interface{} {
+	if trimTypeName(name) == "google.protobuf.NullValue" {
+		return nil
+	}
+
+	e, ok := r.enums[trimTypeName(name)]
+	if ok {
+		for _, ev := range e.Value {
+			if ev.GetNumber() == v {
+				return ev.GetName()
+			}
+		}
+	}
+
+	return json.Number(strconv.Itoa(int(v)))
+}
+
+func (r *Registry) decodeMapEntry(entry *message, raw []byte) (string, interface{}, error) {
+	var key, value interface{}
+	hasValue := false
+	kd, vd := entry.byNum[1], entry.byNum[2]
+
+	for len(raw) > 0 {
+		k, n := proto.DecodeVarint(raw)
+		if n == 0 {
+			return "", nil, fmt.Errorf("invalid map entry")
+		}
+		raw = raw[n:]
+
+		wt := int(k & 7)
+		d, rest, err := readRaw(wt, raw)
+		if err != nil {
+			return "", nil, err
+		}
+		raw = rest
+
+		switch k >> 3 {
+		case 1:
+			key, err = r.decodeScalar(kd, wt, d)
+		case 2:
+			value, err = r.decodeScalar(vd, wt, d)
+			hasValue = true
+		}
+
+		if err != nil {
+			return "", nil, err
+		}
+	}
+
+	if key == nil {
+		key = defaultScalar(kd)
+	}
+
+	if !hasValue {
+		value = defaultScalar(vd)
+		if vd.GetType() == descpb.FieldDescriptorProto_TYPE_MESSAGE {
+			value = map[string]interface{}{}
+		}
+	}
+
+	return fmt.Sprintf("%v", key), scalarJSON(vd, value), nil
+}
+
+func defaultScalar(fd *descpb.FieldDescriptorProto) interface{} {
+	switch fd.GetType() {
+	case descpb.FieldDescriptorProto_TYPE_STRING:
+		return ""
+	case descpb.FieldDescriptorProto_TYPE_BYTES:
+		return []byte{}
+	case descpb.FieldDescriptorProto_TYPE_BOOL:
+		return false
+	case descpb.FieldDescriptorProto_TYPE_ENUM:
+		return json.Number("0")
+	case descpb.FieldDescriptorProto_TYPE_DOUBLE:
+		return float64(0)
+	case descpb.FieldDescriptorProto_TYPE_FLOAT:
+		return float32(0)
+	case descpb.FieldDescriptorProto_TYPE_INT64, descpb.FieldDescriptorProto_TYPE_SFIXED64, descpb.FieldDescriptorProto_TYPE_SINT64:
+		return int64(0)
+	case descpb.FieldDescriptorProto_TYPE_UINT64, descpb.FieldDescriptorProto_TYPE_FIXED64:
+		return uint64(0)
+	case descpb.FieldDescriptorProto_TYPE_UINT32, descpb.FieldDescriptorProto_TYPE_FIXED32:
+		return uint32(0)
+	}
+
+	return int32(0)
+}
+
+func (r *Registry) fieldJSON(fv *fieldValue) interface{} {
+	if fv.kv != nil {
+		return fv.kv
+	}
+
+	if fv.desc.GetLabel() == descpb.FieldDescriptorProto_LABEL_REPEATED {
+		ret := make([]interface{}, 0, len(fv.list))
+		for _, v := range fv.list {
+			ret = append(ret, scalarJSON(fv.desc, v))
+		}
+		return ret
+	}
+
+	return scalarJSON(fv.desc, fv.single)
+}
+
+// scalarJSON converts decoded go value to jsonpb representation.
+func scalarJSON(fd *descpb.FieldDescriptorProto, v interface{}) interface{} {
+	switch x := v.(type) {
+	case float64:
+		return floatJSON(x, 64)
+	case float32:
+		return floatJSON(float64(x), 32)
+	case int64:
+		return strconv.FormatInt(x, 10)
+	case uint64:
+		return strconv.FormatUint(x, 10)
+	case int32:
+		return json.Number(strconv.FormatInt(int64(x), 10))
+	case uint32:
+		return json.Number(strconv.FormatUint(uint64(x), 10))
+	case []byte:
+		return base64.StdEncoding.EncodeToString(x)
+	}
+
+	return v
+}
+
+func floatJSON(f float64, bits int) interface{} {
+	switch {
+	case math.IsNaN(f):
+		return "NaN"
+	case math.IsInf(f, 1):
+		return "Infinity"
+	case math.IsInf(f, -1):
+		return "-Infinity"
+	}
+
+	return json.Number(strconv.FormatFloat(f, 'g', -1, bits))
+}
+
+// well known types with special jsonpb representation.
+var wktDecoders = map[string]func(*message, map[int32]*fieldValue) (interface{}, error){
+	"google.protobuf.Timestamp":   decodeTimestamp,
+	"google.protobuf.Duration":    decodeDuration,
+	"google.protobuf.Struct":      decodeStruct,
+	"google.protobuf.Value":       decodeValue,
+	"google.protobuf.ListValue":   decodeListValue,
+	"google.protobuf.DoubleValue": decodeWrapper,
+	"google.protobuf.FloatValue":  decodeWrapper,
+	"google.protobuf.Int64Value":  decodeWrapper,
+	"google.protobuf.UInt64Value": decodeWrapper,
+	"google.protobuf.Int32Value":  decodeWrapper,
+	"google.protobuf.UInt32Value": decodeWrapper,
+	"google.protobuf.BoolValue":   decodeWrapper,
+	"google.protobuf.StringValue": decodeWrapper,
+	"google.protobuf.BytesValue":  decodeWrapper,
+}
+
+func secondsAndNanos(fields map[int32]*fieldValue) (int64, int32) {
+	var s int64
+	var n int32
+	if f, ok := fields[1]; ok {
+		s, _ = f.single.(int64)
+	}
+
+	if f, ok := fields[2]; ok {
+		n, _ = f.single.(int32)
+	}
+
+	return s, n
+}
+
+func formatNanos(n int32) string {
+	if n == 0 {
+		return ""
+	}
+
+	s := fmt.Sprintf("%09d", n)
+	switch {
+	case strings.HasSuffix(s, "000000"):
+		s = s[:3]
+	case strings.HasSuffix(s, "000"):
+		s = s[:6]
+	}
+
+	return "." + s
+}
+
+func decodeTimestamp(m *message, fields map[int32]*fieldValue) (interface{}, error) {
+	s, n := secondsAndNanos(fields)
+	t := time.Unix(s, 0).UTC()
+	return t.Format("2006-01-02T15:04:05") + formatNanos(n) + "Z", nil
+}
+
+func decodeDuration(m *message, fields map[int32]*fieldValue) (interface{}, error) {
+	s, n := secondsAndNanos(fields)
+	sign := ""
+	if s < 0 || n < 0 {
+		sign = "-"
+		s, n = -s, -n
+	}
+
+	return fmt.Sprintf("%s%d%ss", sign, s, formatNanos(n)), nil
+}
+
+func decodeStruct(m *message, fields map[int32]*fieldValue) (interface{}, error) {
+	if f, ok := fields[1]; ok && f.kv != nil {
+		return f.kv, nil
+	}
+
+	return map[string]interface{}{}, nil
+}
+
+func decodeValue(m *message, fields map[int32]*fieldValue) (interface{}, error) {
+	nums := make([]int, 0, len(fields))
+	for k := range fields {
+		nums = append(nums, int(k))
+	}
+	sort.Ints(nums)
+
+	// the last one wins for oneof.
+	if len(nums) == 0 || nums[len(nums)-1] == 1 {
+		return nil, nil
+	}
+
+	f := fields[int32(nums[len(nums)-1])]
+	return scalarJSON(f.desc, f.single), nil
+}
+
+func decodeListValue(m *message, fields map[int32]*fieldValue) (interface{}, error) {
+	ret := make([]interface{}, 0)
+	if f, ok := fields[1]; ok {
+		ret = append(ret, f.list...)
+	}
+
+	return ret, nil
+}
+
+func decodeWrapper(m *message, fields map[int32]*fieldValue) (interface{}, error) {
+	f, ok := fields[1]
+	if !ok {
+		return scalarJSON(m.byNum[1], defaultScalar(m.byNum[1])), nil
+	}
+
+	return scalarJSON(f.desc, f.single), nil
+}
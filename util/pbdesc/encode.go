@@ -0,0 +1,593 @@
+package pbdesc
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	descpb "github.com/golang/protobuf/protoc-gen-go/descriptor"
+)
+
+// FromJSON converts jsonpb form of message type name to binary.
+func (r *Registry) FromJSON(name string, data []byte) ([]byte, error) {
+	d := json.NewDecoder(bytes.NewReader(data))
+	d.UseNumber()
+
+	var v interface{}
+	err := d.Decode(&v)
+	if err != nil {
+		return nil, fmt.Errorf("invalid json for message:%s, err:%s", name, err)
+	}
+
+	return r.Encode(name, v)
+}
+
+// Encode converts a value in jsonpb form, as produced by json.Unmarshal(), to binary message.
+// output is the same as deterministic marshaling of golang/protobuf: fields are serialized in field number order,
+// with oneof fields after all others, and map entries are in key order, integer keys are ordered by value.
+func (r *Registry) Encode(name string, v interface{}) ([]byte, error) {
+	m, err := r.message(name)
+	if err != nil {
+		return nil, err
+	}
+
+	b := proto.NewBuffer(nil)
+	err = r.encodeMessage(b, m, v)
+	if err != nil {
+		return nil, err
+	}
+
+	return b.Bytes(), nil
+}
+
+func (r *Registry) encodeMessage(b *proto.Buffer, m *message, v interface{}) error {
+	obj, ok := v.(textMessage)
+	if !ok {
+		if conv, ok := wktEncoders[m.name]; ok {
+			var err error
+			v, err = conv(v)
+			if err != nil {
+				return fmt.Errorf("invalid value for %s, err:%s", m.name, err)
+			}
+		}
+
+		obj, ok = v.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("json object expected for message:%s, got:%T", m.name, v)
+		}
+	}
+
+	fields := make([]*descpb.FieldDescriptorProto, 0, len(obj))
+	for k, fv := range obj {
+		fd, ok := m.byName[k]
+		if !ok {
+			return fmt.Errorf("unknown field:%s for message:%s", k, m.name)
+		}
+
+		if fv == nil && trimTypeName(fd.GetTypeName()) != "google.protobuf.Value" {
+			continue
+		}
+
+		fields = append(fields, fd)
+	}
+
+	// golang/protobuf marshals oneof fields last, in order of their oneofs.
+	order := func(fd *descpb.FieldDescriptorProto) (int32, int32) {
+		if fd.OneofIndex != nil {
+			return math.MaxInt32, fd.GetOneofIndex()
+		}
+		return fd.GetNumber(), 0
+	}
+
+	sort.SliceStable(fields, func(i, j int) bool {
+		n1, o1 := order(fields[i])
+		n2, o2 := order(fields[j])
+		return n1 < n2 || (n1 == n2 && o1 < o2)
+	})
+
+	for _, fd := range fields {
+		fv, ok := obj[jsonName(fd)]
+		if !ok {
+			fv = obj[fd.GetName()]
+		}
+
+		err := r.encodeField(b, m, fd, fv)
+		if err != nil {
+			return fmt.Errorf("encode field:%s of message:%s failed, err:%s", fd.GetName(), m.name, err)
+		}
+	}
+
+	return nil
+}
+
+func isPacked(m *message, fd *descpb.FieldDescriptorProto) bool {
+	if !isPackable(fd.GetType()) {
+		return false
+	}
+
+	if fd.GetOptions() != nil && fd.GetOptions().Packed != nil {
+		return fd.GetOptions().GetPacked()
+	}
+
+	return m.proto3
+}
+
+func (r *Registry) encodeField(b *proto.Buffer, m *message, fd *descpb.FieldDescriptorProto, v interface{}) error {
+	if entry, ok := r.isMapEntry(fd); ok {
+		obj, ok := v.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("json object expected for map, got:%T", v)
+		}
+
+		keys := make([]string, 0, len(obj))
+		for k := range obj {
+			keys = append(keys, k)
+		}
+		sortMapKeys(entry.byNum[1], keys)
+
+		for _, k := range keys {
+			eb := proto.NewBuffer(nil)
+			err := r.encodeValue(eb, entry.byNum[1], k, true)
+			if err != nil {
+				return fmt.Errorf("invalid map key:%s, err:%s", k, err)
+			}
+
+			err = r.encodeValue(eb, entry.byNum[2], obj[k], true)
+			if err != nil {
+				return fmt.Errorf("invalid map value for key:%s, err:%s", k, err)
+			}
+
+			b.EncodeVarint(uint64(fd.GetNumber())<<3 | wireBytes)
+			b.EncodeRawBytes(eb.Bytes())
+		}
+
+		return nil
+	}
+
+	if fd.GetLabel() != descpb.FieldDescriptorProto_LABEL_REPEATED {
+		if m.proto3 && fd.OneofIndex == nil && fd.GetType() != descpb.FieldDescriptorProto_TYPE_MESSAGE {
+			return r.encodeProto3Scalar(b, fd, v)
+		}
+		return r.encodeValue(b, fd, v, true)
+	}
+
+	list, ok := v.([]interface{})
+	if !ok {
+		return fmt.Errorf("json array expected for repeated field, got:%T", v)
+	}
+
+	if isPacked(m, fd) {
+		if len(list) == 0 {
+			return nil
+		}
+
+		pb := proto.NewBuffer(nil)
+		for _, e := range list {
+			err := r.encodeValue(pb, fd, e, false)
+			if err != nil {
+				return err
+			}
+		}
+
+		b.EncodeVarint(uint64(fd.GetNumber())<<3 | wireBytes)
+		b.EncodeRawBytes(pb.Bytes())
+		return nil
+	}
+
+	for _, e := range list {
+		err := r.encodeValue(b, fd, e, true)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// sortMapKeys sorts keys in json form by value of key type, as golang/protobuf does.
+func sortMapKeys(fd *descpb.FieldDescriptorProto, keys []string) {
+	less := func(a, b string) bool { return a < b }
+
+	switch fd.GetType() {
+	case descpb.FieldDescriptorProto_TYPE_INT32, descpb.FieldDescriptorProto_TYPE_INT64,
+		descpb.FieldDescriptorProto_TYPE_SINT32, descpb.FieldDescriptorProto_TYPE_SINT64,
+		descpb.FieldDescriptorProto_TYPE_SFIXED32, descpb.FieldDescriptorProto_TYPE_SFIXED64:
+		less = func(a, b string) bool {
+			x, _ := strconv.ParseInt(a, 10, 64)
+			y, _ := strconv.ParseInt(b, 10, 64)
+			return x < y
+		}
+	case descpb.FieldDescriptorProto_TYPE_UINT32, descpb.FieldDescriptorProto_TYPE_UINT64,
+		descpb.FieldDescriptorProto_TYPE_FIXED32, descpb.FieldDescriptorProto_TYPE_FIXED64:
+		less = func(a, b string) bool {
+			x, _ := strconv.ParseUint(a, 10, 64)
+			y, _ := strconv.ParseUint(b, 10, 64)
+			return x < y
+		}
+	case descpb.FieldDescriptorProto_TYPE_BOOL:
+		less = func(a, b string) bool { return a == "false" && b == "true" }
+	}
+
+	sort.Slice(keys, func(i, j int) bool { return less(keys[i], keys[j]) })
+}
+
+// encodeProto3Scalar skips default values as proto.Marshal() does, all encoded bytes of a default value are zero.
+func (r *Registry) encodeProto3Scalar(b *proto.Buffer, fd *descpb.FieldDescriptorProto, v interface{}) error {
+	vb := proto.NewBuffer(nil)
+	err := r.encodeValue(vb, fd, v, false)
+	if err != nil {
+		return err
+	}
+
+	for _, c := range vb.Bytes() {
+		if c != 0 {
+			b.EncodeVarint(uint64(fd.GetNumber())<<3 | wireType(fd.GetType()))
+			b.SetBuf(append(b.Bytes(), vb.Bytes()...))
+			return nil
+		}
+	}
+
+	return nil
+}
+
+func wireType(t descpb.FieldDescriptorProto_Type) uint64 {
+	switch t {
+	case descpb.FieldDescriptorProto_TYPE_DOUBLE, descpb.FieldDescriptorProto_TYPE_FIXED64, descpb.FieldDescriptorProto_TYPE_SFIXED64:
+		return wireFixed64
+	case descpb.FieldDescriptorProto_TYPE_FLOAT, descpb.FieldDescriptorProto_TYPE_FIXED32, descpb.FieldDescriptorProto_TYPE_SFIXED32:
+		return wireFixed32
+	case descpb.FieldDescriptorProto_TYPE_STRING, descpb.FieldDescriptorProto_TYPE_BYTES, descpb.FieldDescriptorProto_TYPE_MESSAGE:
+		return wireBytes
+	}
+
+	return wireVarint
+}
+
+// encodeValue encodes a single value, with field key if tag is true.
+func (r *Registry) encodeValue(b *proto.Buffer, fd *descpb.FieldDescriptorProto, v interface{}, tag bool) error {
+	if tag {
+		b.EncodeVarint(uint64(fd.GetNumber())<<3 | wireType(fd.GetType()))
+	}
+
+	switch fd.GetType() {
+	case descpb.FieldDescriptorProto_TYPE_DOUBLE:
+		f, err := toFloat(v)
+		if err != nil {
+			return err
+		}
+		return b.EncodeFixed64(math.Float64bits(f))
+	case descpb.FieldDescriptorProto_TYPE_FLOAT:
+		f, err := toFloat(v)
+		if err != nil {
+			return err
+		}
+		return b.EncodeFixed32(uint64(math.Float32bits(float32(f))))
+	case descpb.FieldDescriptorProto_TYPE_INT64, descpb.FieldDescriptorProto_TYPE_INT32:
+		i, err := toInt(v)
+		if err != nil {
+			return err
+		}
+		return b.EncodeVarint(uint64(i))
+	case descpb.FieldDescriptorProto_TYPE_UINT64, descpb.FieldDescriptorProto_TYPE_UINT32:
+		u, err := toUint(v)
+		if err != nil {
+			return err
+		}
+		return b.EncodeVarint(u)
+	case descpb.FieldDescriptorProto_TYPE_SINT64, descpb.FieldDescriptorProto_TYPE_SINT32:
+		i, err := toInt(v)
+		if err != nil {
+			return err
+		}
+		return b.EncodeZigzag64(uint64(i))
+	case descpb.FieldDescriptorProto_TYPE_FIXED64:
+		u, err := toUint(v)
+		if err != nil {
+			return err
+		}
+		return b.EncodeFixed64(u)
+	case descpb.FieldDescriptorProto_TYPE_SFIXED64:
+		i, err := toInt(v)
+		if err != nil {
+			return err
+		}
+		return b.EncodeFixed64(uint64(i))
+	case descpb.FieldDescriptorProto_TYPE_FIXED32:
+		u, err := toUint(v)
+		if err != nil {
+			return err
+		}
+		return b.EncodeFixed32(u)
+	case descpb.FieldDescriptorProto_TYPE_SFIXED32:
+		i, err := toInt(v)
+		if err != nil {
+			return err
+		}
+		return b.EncodeFixed32(uint64(uint32(i)))
+	case descpb.FieldDescriptorProto_TYPE_BOOL:
+		x, err := toBool(v)
+		if err != nil {
+			return err
+		}
+		if x {
+			return b.EncodeVarint(1)
+		}
+		return b.EncodeVarint(0)
+	case descpb.FieldDescriptorProto_TYPE_ENUM:
+		n, err := r.enumNumber(fd.GetTypeName(), v)
+		if err != nil {
+			return err
+		}
+		return b.EncodeVarint(uint64(n))
+	case descpb.FieldDescriptorProto_TYPE_STRING:
+		s, ok := v.(string)
+		if !ok {
+			return fmt.Errorf("string expected, got:%T", v)
+		}
+		return b.EncodeStringBytes(s)
+	case descpb.FieldDescriptorProto_TYPE_BYTES:
+		d, err := toBytes(v)
+		if err != nil {
+			return err
+		}
+		return b.EncodeRawBytes(d)
+	case descpb.FieldDescriptorProto_TYPE_MESSAGE:
+		m, err := r.message(fd.GetTypeName())
+		if err != nil {
+			return err
+		}
+
+		mb := proto.NewBuffer(nil)
+		err = r.encodeMessage(mb, m, v)
+		if err != nil {
+			return err
+		}
+		return b.EncodeRawBytes(mb.Bytes())
+	}
+
+	return fmt.Errorf("unsupported field type:%s", fd.GetType())
+}
+
+func (r *Registry) enumNumber(name string, v interface{}) (int32, error) {
+	if trimTypeName(name) == "google.protobuf.NullValue" {
+		return 0, nil
+	}
+
+	if s, ok := v.(string); ok {
+		e, ok := r.enums[trimTypeName(name)]
+		if ok {
+			for _, ev := range e.Value {
+				if ev.GetName() == s {
+					return ev.GetNumber(), nil
+				}
+			}
+		}
+	}
+
+	i, err := toInt(v)
+	if err != nil {
+		return 0, fmt.Errorf("invalid value for enum:%s, value:%v", name, v)
+	}
+
+	return int32(i), nil
+}
+
+func numberString(v interface{}) (string, error) {
+	switch x := v.(type) {
+	case json.Number:
+		return string(x), nil
+	case string:
+		return x, nil
+	case float64:
+		return strconv.FormatFloat(x, 'g', -1, 64), nil
+	case int:
+		return strconv.Itoa(x), nil
+	case int32:
+		return strconv.FormatInt(int64(x), 10), nil
+	case int64:
+		return strconv.FormatInt(x, 10), nil
+	case uint32:
+		return strconv.FormatUint(uint64(x), 10), nil
+	case uint64:
+		return strconv.FormatUint(x, 10), nil
+	}
+
+	return "", fmt.Errorf("number expected, got:%T", v)
+}
+
+func toFloat(v interface{}) (float64, error) {
+	s, err := numberString(v)
+	if err != nil {
+		return 0, err
+	}
+
+	switch s {
+	case "NaN":
+		return math.NaN(), nil
+	case "Infinity":
+		return math.Inf(1), nil
+	case "-Infinity":
+		return math.Inf(-1), nil
+	}
+
+	return strconv.ParseFloat(s, 64)
+}
+
+func toInt(v interface{}) (int64, error) {
+	s, err := numberString(v)
+	if err != nil {
+		return 0, err
+	}
+
+	i, err := strconv.ParseInt(s, 10, 64)
+	if err == nil {
+		return i, nil
+	}
+
+	// jsonpb accepts exponent notation for integers, eg: 1e3
+	f, err2 := strconv.ParseFloat(s, 64)
+	if err2 != nil || f != math.Trunc(f) {
+		return 0, err
+	}
+
+	return int64(f), nil
+}
+
+func toUint(v interface{}) (uint64, error) {
+	s, err := numberString(v)
+	if err != nil {
+		return 0, err
+	}
+
+	u, err := strconv.ParseUint(s, 10, 64)
+	if err == nil {
+		return u, nil
+	}
+
+	f, err2 := strconv.ParseFloat(s, 64)
+	if err2 != nil || f != math.Trunc(f) || f < 0 {
+		return 0, err
+	}
+
+	return uint64(f), nil
+}
+
+func toBool(v interface{}) (bool, error) {
+	switch x := v.(type) {
+	case bool:
+		return x, nil
+	case string:
+		// map keys are always strings.
+		return strconv.ParseBool(x)
+	}
+
+	return false, fmt.Errorf("bool expected, got:%T", v)
+}
+
+func toBytes(v interface{}) ([]byte, error) {
+	s, ok := v.(string)
+	if !ok {
+		return nil, fmt.Errorf("base64 string expected, got:%T", v)
+	}
+
+	enc := base64.StdEncoding
+	if strings.ContainsAny(s, "-_") {
+		enc = base64.URLEncoding
+	}
+
+	if len(s)%4 != 0 {
+		enc = enc.WithPadding(base64.NoPadding)
+	}
+
+	return enc.DecodeString(s)
+}
+
+// well known types are converted to their plain message form before encoding.
+var wktEncoders = map[string]func(interface{}) (interface{}, error){
+	"google.protobuf.Timestamp":   encodeTimestamp,
+	"google.protobuf.Duration":    encodeDuration,
+	"google.protobuf.Struct":      encodeStruct,
+	"google.protobuf.Value":       encodeValue,
+	"google.protobuf.ListValue":   encodeListValue,
+	"google.protobuf.DoubleValue": encodeWrapper,
+	"google.protobuf.FloatValue":  encodeWrapper,
+	"google.protobuf.Int64Value":  encodeWrapper,
+	"google.protobuf.UInt64Value": encodeWrapper,
+	"google.protobuf.Int32Value":  encodeWrapper,
+	"google.protobuf.UInt32Value": encodeWrapper,
+	"google.protobuf.BoolValue":   encodeWrapper,
+	"google.protobuf.StringValue": encodeWrapper,
+	"google.protobuf.BytesValue":  encodeWrapper,
+}
+
+func encodeTimestamp(v interface{}) (interface{}, error) {
+	s, ok := v.(string)
+	if !ok {
+		return nil, fmt.Errorf("timestamp string expected, got:%T", v)
+	}
+
+	t, err := time.Parse(time.RFC3339Nano, s)
+	if err != nil {
+		return nil, err
+	}
+
+	return map[string]interface{}{"seconds": t.Unix(), "nanos": int64(t.Nanosecond())}, nil
+}
+
+func encodeDuration(v interface{}) (interface{}, error) {
+	s, ok := v.(string)
+	if !ok || !strings.HasSuffix(s, "s") {
+		return nil, fmt.Errorf("duration string expected, got:%v", v)
+	}
+
+	s = strings.TrimSuffix(s, "s")
+	neg := strings.HasPrefix(s, "-")
+	s = strings.TrimPrefix(s, "-")
+
+	parts := strings.SplitN(s, ".", 2)
+	sec, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return nil, err
+	}
+
+	var nanos int64
+	if len(parts) == 2 {
+		frac := (parts[1] + "000000000")[:9]
+		nanos, err = strconv.ParseInt(frac, 10, 64)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if neg {
+		sec, nanos = -sec, -nanos
+	}
+
+	return map[string]interface{}{"seconds": sec, "nanos": nanos}, nil
+}
+
+func encodeStruct(v interface{}) (interface{}, error) {
+	if _, ok := v.(map[string]interface{}); !ok {
+		return nil, fmt.Errorf("json object expected, got:%T", v)
+	}
+
+	return map[string]interface{}{"fields": v}, nil
+}
+
+func encodeValue(v interface{}) (interface{}, error) {
+	switch x := v.(type) {
+	case nil:
+		return map[string]interface{}{"null_value": "NULL_VALUE"}, nil
+	case bool:
+		return map[string]interface{}{"bool_value": x}, nil
+	case string:
+		return map[string]interface{}{"string_value": x}, nil
+	case json.Number, float64:
+		return map[string]interface{}{"number_value": x}, nil
+	case map[string]interface{}:
+		return map[string]interface{}{"struct_value": x}, nil
+	case []interface{}:
+		return map[string]interface{}{"list_value": x}, nil
+	}
+
+	return nil, fmt.Errorf("unsupported value type:%T", v)
+}
+
+func encodeListValue(v interface{}) (interface{}, error) {
+	if _, ok := v.([]interface{}); !ok {
+		return nil, fmt.Errorf("json array expected, got:%T", v)
+	}
+
+	return map[string]interface{}{"values": v}, nil
+}
+
+func encodeWrapper(v interface{}) (interface{}, error) {
+	return map[string]interface{}{"value": v}, nil
+}
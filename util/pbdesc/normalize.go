@@ -0,0 +1,200 @@
+package pbdesc
+
+import (
+	"encoding/json"
+	"sort"
+
+	descpb "github.com/golang/protobuf/protoc-gen-go/descriptor"
+)
+
+// TrimDefaults removes fields holding default values from v, a message of type name in jsonpb form,
+// so that a field set to its default compares equal to an absent one. messages left empty are removed as well.
+// oneof members and well known types are kept, their presence is meaningful.
+func (r *Registry) TrimDefaults(name string, v interface{}) {
+	m, err := r.message(name)
+	if err != nil {
+		return
+	}
+
+	r.trimDefaults(m, v)
+}
+
+// trimDefaults returns whether v is empty after trimming.
+func (r *Registry) trimDefaults(m *message, v interface{}) bool {
+	if _, ok := wktDecoders[m.name]; ok {
+		return false
+	}
+
+	obj, ok := v.(map[string]interface{})
+	if !ok {
+		return false
+	}
+
+	for k, fv := range obj {
+		fd, ok := m.byName[k]
+		if ok && r.isDefault(fd, fv) {
+			delete(obj, k)
+		}
+	}
+
+	return len(obj) == 0
+}
+
+func (r *Registry) isDefault(fd *descpb.FieldDescriptorProto, v interface{}) bool {
+	if fd.OneofIndex != nil {
+		return false
+	}
+
+	child := r.messages[trimTypeName(fd.GetTypeName())]
+
+	if entry, ok := r.isMapEntry(fd); ok {
+		kv, _ := v.(map[string]interface{})
+		if vm, ok := r.messages[trimTypeName(entry.byNum[2].GetTypeName())]; ok {
+			for _, e := range kv {
+				r.trimDefaults(vm, e)
+			}
+		}
+		return len(kv) == 0
+	}
+
+	if fd.GetLabel() == descpb.FieldDescriptorProto_LABEL_REPEATED {
+		list, _ := v.([]interface{})
+		if child != nil {
+			for _, e := range list {
+				r.trimDefaults(child, e)
+			}
+		}
+		return len(list) == 0
+	}
+
+	if v == nil {
+		return child == nil || child.name != "google.protobuf.Value"
+	}
+
+	if fd.GetType() == descpb.FieldDescriptorProto_TYPE_MESSAGE {
+		return child != nil && r.trimDefaults(child, v)
+	}
+
+	if fd.DefaultValue != nil {
+		return r.equalScalar(fd, v, fd.GetDefaultValue())
+	}
+
+	switch fd.GetType() {
+	case descpb.FieldDescriptorProto_TYPE_STRING, descpb.FieldDescriptorProto_TYPE_BYTES:
+		return v == ""
+	case descpb.FieldDescriptorProto_TYPE_BOOL:
+		return v == false
+	case descpb.FieldDescriptorProto_TYPE_ENUM:
+		if s, ok := v.(string); ok {
+			return s == r.enumName(fd.GetTypeName(), 0)
+		}
+	}
+
+	f, err := toFloat(v)
+	return err == nil && f == 0
+}
+
+// equalScalar compares v in jsonpb form with default value given in descriptor.
+func (r *Registry) equalScalar(fd *descpb.FieldDescriptorProto, v interface{}, def string) bool {
+	switch fd.GetType() {
+	case descpb.FieldDescriptorProto_TYPE_STRING:
+		return v == def
+	case descpb.FieldDescriptorProto_TYPE_BYTES:
+		d, err := toBytes(v)
+		return err == nil && string(d) == def
+	case descpb.FieldDescriptorProto_TYPE_BOOL:
+		return v == (def == "true")
+	case descpb.FieldDescriptorProto_TYPE_ENUM:
+		if s, ok := v.(string); ok {
+			return s == def
+		}
+		return false
+	}
+
+	switch def {
+	case "inf":
+		def = "Infinity"
+	case "-inf":
+		def = "-Infinity"
+	case "nan":
+		def = "NaN"
+	}
+
+	f1, err1 := toFloat(v)
+	f2, err2 := toFloat(def)
+	return err1 == nil && err2 == nil && f1 == f2
+}
+
+// SortRepeated sorts elements of repeated fields in v, a message of type name in jsonpb form,
+// so that repeated fields compare as multisets. map fields and elements are sorted recursively.
+func (r *Registry) SortRepeated(name string, v interface{}) {
+	m, err := r.message(name)
+	if err != nil {
+		return
+	}
+
+	r.sortRepeated(m, v)
+}
+
+func (r *Registry) sortRepeated(m *message, v interface{}) {
+	obj, ok := v.(map[string]interface{})
+	if !ok {
+		return
+	}
+
+	for k, fv := range obj {
+		fd, ok := m.byName[k]
+		if !ok {
+			continue
+		}
+
+		child := r.messages[trimTypeName(fd.GetTypeName())]
+
+		if entry, ok := r.isMapEntry(fd); ok {
+			kv, _ := fv.(map[string]interface{})
+			if vm, ok := r.messages[trimTypeName(entry.byNum[2].GetTypeName())]; ok {
+				for _, e := range kv {
+					r.sortRepeated(vm, e)
+				}
+			}
+			continue
+		}
+
+		if fd.GetLabel() != descpb.FieldDescriptorProto_LABEL_REPEATED {
+			if child != nil {
+				r.sortRepeated(child, fv)
+			}
+			continue
+		}
+
+		list, ok := fv.([]interface{})
+		if !ok {
+			continue
+		}
+
+		keys := make([]string, len(list))
+		for i, e := range list {
+			if child != nil {
+				r.sortRepeated(child, e)
+			}
+
+			// map keys are sorted by json.Marshal(), so equal values have equal keys.
+			d, _ := json.Marshal(e)
+			keys[i] = string(d)
+		}
+
+		sort.Sort(&keyedList{keys: keys, list: list})
+	}
+}
+
+type keyedList struct {
+	keys []string
+	list []interface{}
+}
+
+func (l *keyedList) Len() int           { return len(l.list) }
+func (l *keyedList) Less(i, j int) bool { return l.keys[i] < l.keys[j] }
+func (l *keyedList) Swap(i, j int) {
+	l.keys[i], l.keys[j] = l.keys[j], l.keys[i]
+	l.list[i], l.list[j] = l.list[j], l.list[i]
+}
@@ -0,0 +1,373 @@
+package pbdesc
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+
+	"github.com/golang/protobuf/jsonpb"
+	"github.com/golang/protobuf/proto"
+	descpb "github.com/golang/protobuf/protoc-gen-go/descriptor"
+	"github.com/golang/protobuf/ptypes/duration"
+	structpb "github.com/golang/protobuf/ptypes/struct"
+	"github.com/golang/protobuf/ptypes/timestamp"
+	"github.com/golang/protobuf/ptypes/wrappers"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestRegistry(t *testing.T) *Registry {
+	r := NewRegistry()
+	for _, f := range []string{
+		"google/protobuf/descriptor.proto",
+		"google/protobuf/struct.proto",
+		"google/protobuf/timestamp.proto",
+		"google/protobuf/duration.proto",
+		"google/protobuf/wrappers.proto",
+	} {
+		assert.Nil(t, r.AddRegisteredFile(f))
+	}
+
+	return r
+}
+
+func jsonValue(t *testing.T, data []byte) interface{} {
+	var v interface{}
+	assert.Nil(t, json.Unmarshal(data, &v))
+	return v
+}
+
+func checkRoundTrip(t *testing.T, r *Registry, name string, msg proto.Message, empty proto.Message) {
+	data, err := proto.Marshal(msg)
+	assert.Nil(t, err)
+
+	actual, err := r.ToJSON(name, data)
+	assert.Nil(t, err)
+
+	expect, err := (&jsonpb.Marshaler{}).MarshalToString(msg)
+	assert.Nil(t, err)
+	assert.Equal(t, jsonValue(t, []byte(expect)), jsonValue(t, actual), name)
+
+	bin, err := r.FromJSON(name, []byte(expect))
+	assert.Nil(t, err)
+	assert.Nil(t, proto.Unmarshal(bin, empty))
+	assert.True(t, proto.Equal(msg, empty), name)
+}
+
+func TestConvert(t *testing.T) {
+	r := newTestRegistry(t)
+
+	fd := &descpb.FileDescriptorProto{
+		Name:       proto.String("test.proto"),
+		Package:    proto.String("gorr.test"),
+		Dependency: []string{"a.proto", "b.proto"},
+		MessageType: []*descpb.DescriptorProto{
+			{
+				Name: proto.String("Msg"),
+				Field: []*descpb.FieldDescriptorProto{
+					{
+						Name:     proto.String("id"),
+						Number:   proto.Int32(1),
+						Label:    descpb.FieldDescriptorProto_LABEL_REPEATED.Enum(),
+						Type:     descpb.FieldDescriptorProto_TYPE_INT64.Enum(),
+						JsonName: proto.String("id"),
+						Options:  &descpb.FieldOptions{Packed: proto.Bool(true)},
+					},
+				},
+				ReservedRange: []*descpb.DescriptorProto_ReservedRange{{Start: proto.Int32(-3), End: proto.Int32(5)}},
+			},
+		},
+		Options: &descpb.FileOptions{
+			JavaPackage:    proto.String("com.gorr"),
+			OptimizeFor:    descpb.FileOptions_LITE_RUNTIME.Enum(),
+			CcEnableArenas: proto.Bool(false),
+			UninterpretedOption: []*descpb.UninterpretedOption{
+				{
+					PositiveIntValue: proto.Uint64(math.MaxUint64),
+					NegativeIntValue: proto.Int64(math.MinInt64),
+					DoubleValue:      proto.Float64(0.1),
+					StringValue:      []byte("raw\x00bytes"),
+				},
+			},
+		},
+	}
+
+	checkRoundTrip(t, r, "google.protobuf.FileDescriptorProto", fd, &descpb.FileDescriptorProto{})
+
+	st := &structpb.Struct{
+		Fields: map[string]*structpb.Value{
+			"name":  {Kind: &structpb.Value_StringValue{StringValue: "miliao"}},
+			"num":   {Kind: &structpb.Value_NumberValue{NumberValue: 2.5}},
+			"ok":    {Kind: &structpb.Value_BoolValue{BoolValue: true}},
+			"none":  {Kind: &structpb.Value_NullValue{}},
+			"inner": {Kind: &structpb.Value_StructValue{StructValue: &structpb.Struct{Fields: map[string]*structpb.Value{"a": {Kind: &structpb.Value_NumberValue{NumberValue: 1}}}}}},
+			"list":  {Kind: &structpb.Value_ListValue{ListValue: &structpb.ListValue{Values: []*structpb.Value{{Kind: &structpb.Value_StringValue{StringValue: "x"}}}}}},
+		},
+	}
+
+	checkRoundTrip(t, r, "google.protobuf.Struct", st, &structpb.Struct{})
+	checkRoundTrip(t, r, "google.protobuf.Timestamp", &timestamp.Timestamp{Seconds: 1571000000, Nanos: 23000000}, &timestamp.Timestamp{})
+	checkRoundTrip(t, r, "google.protobuf.Duration", &duration.Duration{Seconds: -3, Nanos: -500}, &duration.Duration{})
+	checkRoundTrip(t, r, "google.protobuf.Int64Value", &wrappers.Int64Value{Value: 23}, &wrappers.Int64Value{})
+	checkRoundTrip(t, r, "google.protobuf.FloatValue", &wrappers.FloatValue{Value: 0.1}, &wrappers.FloatValue{})
+}
+
+func TestRegistry(t *testing.T) {
+	r := newTestRegistry(t)
+
+	assert.True(t, r.HasMessage(".google.protobuf.DescriptorProto.ExtensionRange"))
+	assert.False(t, r.HasMessage("google.protobuf.None"))
+
+	data, err := proto.Marshal(r.Files())
+	assert.Nil(t, err)
+
+	r2, err := ParseFileDescriptorSet(data)
+	assert.Nil(t, err)
+	assert.True(t, r2.HasMessage("google.protobuf.Timestamp"))
+
+	_, err = r.ToJSON("google.protobuf.None", nil)
+	assert.NotNil(t, err)
+
+	_, err = r.FromJSON("google.protobuf.Timestamp", []byte(`{"unknown":1}`))
+	assert.NotNil(t, err)
+
+	// proto3 default values are not serialized.
+	bin, err := r.FromJSON("google.protobuf.Int64Value", []byte(`"0"`))
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(bin))
+}
+
+func TestClear(t *testing.T) {
+	r := newTestRegistry(t)
+
+	fd := &descpb.FileDescriptorProto{
+		Name:        proto.String("a.proto"),
+		MessageType: []*descpb.DescriptorProto{{Name: proto.String("Msg"), Field: []*descpb.FieldDescriptorProto{{Name: proto.String("id"), Number: proto.Int32(1)}}}},
+		Options:     &descpb.FileOptions{JavaPackage: proto.String("com.gorr")},
+	}
+
+	data, err := proto.Marshal(fd)
+	assert.Nil(t, err)
+
+	v, err := r.Decode("google.protobuf.FileDescriptorProto", data)
+	assert.Nil(t, err)
+
+	r.Clear("google.protobuf.FileDescriptorProto", v, "name")
+	r.Clear("google.protobuf.FileDescriptorProto", v, "message_type.field.number")
+	r.Clear("google.protobuf.FileDescriptorProto", v, "options.javaPackage")
+	r.Clear("google.protobuf.FileDescriptorProto", v, "none.field")
+
+	bin, err := r.Encode("google.protobuf.FileDescriptorProto", v)
+	assert.Nil(t, err)
+
+	var out descpb.FileDescriptorProto
+	assert.Nil(t, proto.Unmarshal(bin, &out))
+	assert.Nil(t, out.Name)
+	assert.Nil(t, out.MessageType[0].Field[0].Number)
+	assert.Equal(t, "id", out.MessageType[0].Field[0].GetName())
+	assert.Nil(t, out.Options.JavaPackage)
+}
+
+func TestFromText(t *testing.T) {
+	r := newTestRegistry(t)
+
+	fd := &descpb.FileDescriptorProto{
+		Name:       proto.String("te\"st\n.proto"),
+		Dependency: []string{"a.proto", "b.proto"},
+		MessageType: []*descpb.DescriptorProto{
+			{
+				Name: proto.String("Msg"),
+				Field: []*descpb.FieldDescriptorProto{
+					{Name: proto.String("id"), Number: proto.Int32(-1), Label: descpb.FieldDescriptorProto_LABEL_REPEATED.Enum()},
+				},
+			},
+		},
+		Options: &descpb.FileOptions{
+			OptimizeFor: descpb.FileOptions_CODE_SIZE.Enum(),
+			UninterpretedOption: []*descpb.UninterpretedOption{
+				{
+					PositiveIntValue: proto.Uint64(math.MaxUint64),
+					DoubleValue:      proto.Float64(-0.25),
+					StringValue:      []byte("raw\x00\xffbytes"),
+				},
+			},
+		},
+	}
+
+	bin, err := r.FromText("google.protobuf.FileDescriptorProto", []byte(proto.MarshalTextString(fd)))
+	assert.Nil(t, err)
+
+	var out descpb.FileDescriptorProto
+	assert.Nil(t, proto.Unmarshal(bin, &out))
+	assert.True(t, proto.Equal(fd, &out))
+
+	st := &structpb.Struct{
+		Fields: map[string]*structpb.Value{
+			"name": {Kind: &structpb.Value_StringValue{StringValue: "miliao"}},
+			"list": {Kind: &structpb.Value_ListValue{ListValue: &structpb.ListValue{Values: []*structpb.Value{{Kind: &structpb.Value_NumberValue{NumberValue: 1}}}}}},
+		},
+	}
+
+	bin, err = r.FromText("google.protobuf.Struct", []byte(proto.CompactTextString(st)))
+	assert.Nil(t, err)
+
+	var st2 structpb.Struct
+	assert.Nil(t, proto.Unmarshal(bin, &st2))
+	assert.True(t, proto.Equal(st, &st2))
+
+	// short forms and comments.
+	bin, err = r.FromText("google.protobuf.Timestamp", []byte("# comment\nseconds: 0x10, nanos: 2;"))
+	assert.Nil(t, err)
+
+	var ts timestamp.Timestamp
+	assert.Nil(t, proto.Unmarshal(bin, &ts))
+	assert.Equal(t, int64(16), ts.Seconds)
+	assert.Equal(t, int32(2), ts.Nanos)
+
+	_, err = r.FromText("google.protobuf.Timestamp", []byte("none: 1"))
+	assert.NotNil(t, err)
+
+	_, err = r.FromText("google.protobuf.FileDescriptorProto", []byte("options { java_package: 'a'"))
+	assert.NotNil(t, err)
+}
+
+func jsonMessage(t *testing.T, r *Registry, name string, msg proto.Message) interface{} {
+	data, err := proto.Marshal(msg)
+	assert.Nil(t, err)
+
+	d, err := r.ToJSON(name, data)
+	assert.Nil(t, err)
+	return jsonValue(t, d)
+}
+
+func TestNormalize(t *testing.T) {
+	r := newTestRegistry(t)
+
+	name := "google.protobuf.FileDescriptorProto"
+	v1 := jsonMessage(t, r, name, &descpb.FileDescriptorProto{
+		Name:       proto.String("a.proto"),
+		Package:    proto.String(""),
+		Dependency: []string{"b.proto", "a.proto"},
+		Options:    &descpb.FileOptions{OptimizeFor: descpb.FileOptions_SPEED.Enum(), CcEnableArenas: proto.Bool(false)},
+	})
+	v2 := jsonMessage(t, r, name, &descpb.FileDescriptorProto{
+		Name:       proto.String("a.proto"),
+		Dependency: []string{"a.proto", "b.proto"},
+	})
+
+	assert.NotEqual(t, v1, v2)
+
+	// optimize_for defaults to SPEED.
+	r.TrimDefaults(name, v1)
+	r.TrimDefaults(name, v2)
+	assert.Nil(t, v1.(map[string]interface{})["options"])
+
+	r.SortRepeated(name, v1)
+	r.SortRepeated(name, v2)
+	assert.Equal(t, v1, v2)
+
+	data, err := proto.Marshal(&descpb.FileDescriptorProto{Name: proto.String("a.proto")})
+	assert.Nil(t, err)
+	data = append(data, proto.EncodeVarint(99<<3)...)
+	data = append(data, 1)
+
+	d, err := r.ToJSON(name, data)
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]interface{}{"name": "a.proto"}, jsonValue(t, d))
+
+	r.KeepUnknown = true
+	d, err = r.ToJSON(name, data)
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]interface{}{"name": "a.proto", "[99]": []interface{}{"AQ=="}}, jsonValue(t, d))
+}
+
+func TestRawCodec(t *testing.T) {
+	in := []byte{0x08, 0x17}
+	data, err := RawCodec{}.Marshal(&in)
+	assert.Nil(t, err)
+	assert.Equal(t, in, data)
+
+	var out []byte
+	assert.Nil(t, RawCodec{}.Unmarshal(data, &out))
+	assert.Equal(t, in, out)
+
+	_, err = RawCodec{}.Marshal(in)
+	assert.NotNil(t, err)
+	assert.Equal(t, "proto", RawCodec{}.Name())
+}
+
+// orderMsg is a hand written message with oneof and int keyed map, marshaled by golang/protobuf.
+type orderMsg struct {
+	Id    int32            `protobuf:"varint,1,opt,name=id,proto3" json:"id,omitempty"`
+	Items map[int32]string `protobuf:"bytes,2,rep,name=items,proto3" json:"items,omitempty" protobuf_key:"varint,1,opt,name=key,proto3" protobuf_val:"bytes,2,opt,name=value,proto3"`
+	Kind  isOrderMsgKind   `protobuf_oneof:"kind"`
+	Tail  string           `protobuf:"bytes,5,opt,name=tail,proto3" json:"tail,omitempty"`
+}
+
+type isOrderMsgKind interface{ isOrderMsgKind() }
+
+type orderMsgName struct {
+	Name string `protobuf:"bytes,3,opt,name=name,proto3,oneof"`
+}
+
+func (*orderMsgName) isOrderMsgKind() {}
+
+func (m *orderMsg) Reset()         { *m = orderMsg{} }
+func (m *orderMsg) String() string { return proto.CompactTextString(m) }
+func (*orderMsg) ProtoMessage()    {}
+func (*orderMsg) XXX_OneofWrappers() []interface{} {
+	return []interface{}{(*orderMsgName)(nil)}
+}
+
+func TestEncodeOrder(t *testing.T) {
+	field := func(name string, num int32, label descpb.FieldDescriptorProto_Label, typ descpb.FieldDescriptorProto_Type) *descpb.FieldDescriptorProto {
+		return &descpb.FieldDescriptorProto{Name: proto.String(name), Number: proto.Int32(num), Label: label.Enum(), Type: typ.Enum(), JsonName: proto.String(name)}
+	}
+
+	opt := descpb.FieldDescriptorProto_LABEL_OPTIONAL
+	items := field("items", 2, descpb.FieldDescriptorProto_LABEL_REPEATED, descpb.FieldDescriptorProto_TYPE_MESSAGE)
+	items.TypeName = proto.String(".gorr.test.OrderMsg.ItemsEntry")
+	name := field("name", 3, opt, descpb.FieldDescriptorProto_TYPE_STRING)
+	name.OneofIndex = proto.Int32(0)
+
+	r := NewRegistry()
+	r.AddFile(&descpb.FileDescriptorProto{
+		Name:    proto.String("order.proto"),
+		Package: proto.String("gorr.test"),
+		Syntax:  proto.String("proto3"),
+		MessageType: []*descpb.DescriptorProto{
+			{
+				Name: proto.String("OrderMsg"),
+				Field: []*descpb.FieldDescriptorProto{
+					field("id", 1, opt, descpb.FieldDescriptorProto_TYPE_INT32),
+					items,
+					name,
+					field("tail", 5, opt, descpb.FieldDescriptorProto_TYPE_STRING),
+				},
+				NestedType: []*descpb.DescriptorProto{
+					{
+						Name: proto.String("ItemsEntry"),
+						Field: []*descpb.FieldDescriptorProto{
+							field("key", 1, opt, descpb.FieldDescriptorProto_TYPE_INT32),
+							field("value", 2, opt, descpb.FieldDescriptorProto_TYPE_STRING),
+						},
+						Options: &descpb.MessageOptions{MapEntry: proto.Bool(true)},
+					},
+				},
+				OneofDecl: []*descpb.OneofDescriptorProto{{Name: proto.String("kind")}},
+			},
+		},
+	})
+
+	msg := &orderMsg{Id: 23, Items: map[int32]string{9: "a", 10: "b", -1: "c"}, Kind: &orderMsgName{Name: "miliao"}, Tail: "t"}
+
+	b := proto.NewBuffer(nil)
+	b.SetDeterministic(true)
+	assert.Nil(t, b.Marshal(msg))
+
+	v, err := r.Decode("gorr.test.OrderMsg", b.Bytes())
+	assert.Nil(t, err)
+
+	data, err := r.Encode("gorr.test.OrderMsg", v)
+	assert.Nil(t, err)
+	assert.Equal(t, b.Bytes(), data)
+}
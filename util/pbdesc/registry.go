@@ -0,0 +1,295 @@
+// Package pbdesc converts protobuf messages between binary and jsonpb form using descriptors only,
+// so that tools are able to handle messages of any service without generated code.
+//
+// descriptors are read from a FileDescriptorSet, eg:
+//
+//	protoc --include_imports --descriptor_set_out=service.desc service.proto
+package pbdesc
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+
+	"github.com/golang/protobuf/proto"
+	descpb "github.com/golang/protobuf/protoc-gen-go/descriptor"
+)
+
+// Method describes a rpc method.
+type Method struct {
+	Name            string `json:"name"` // full method name: /package.Service/Method
+	Input           string `json:"input"`
+	Output          string `json:"output"`
+	ClientStreaming bool   `json:"client_streaming"`
+	ServerStreaming bool   `json:"server_streaming"`
+}
+
+type message struct {
+	name   string
+	desc   *descpb.DescriptorProto
+	proto3 bool
+	byNum  map[int32]*descpb.FieldDescriptorProto
+	byName map[string]*descpb.FieldDescriptorProto
+}
+
+// Registry indexes messages, enums and methods of a FileDescriptorSet.
+type Registry struct {
+	// KeepUnknown keeps unknown fields in decoded messages as "[<number>]": [<base64 of raw value>, ...],
+	// messages decoded this way can not be encoded again.
+	KeepUnknown bool
+
+	files    map[string]*descpb.FileDescriptorProto
+	messages map[string]*message
+	enums    map[string]*descpb.EnumDescriptorProto
+	methods  map[string]*Method
+}
+
+// NewRegistry creates an empty registry.
+func NewRegistry() *Registry {
+	return &Registry{
+		files:    make(map[string]*descpb.FileDescriptorProto),
+		messages: make(map[string]*message),
+		enums:    make(map[string]*descpb.EnumDescriptorProto),
+		methods:  make(map[string]*Method),
+	}
+}
+
+// ParseFileDescriptorSet creates a registry from serialized FileDescriptorSet.
+func ParseFileDescriptorSet(data []byte) (*Registry, error) {
+	var set descpb.FileDescriptorSet
+	err := proto.Unmarshal(data, &set)
+	if err != nil {
+		return nil, fmt.Errorf("unmarshal file descriptor set failed, err:%s", err)
+	}
+
+	r := NewRegistry()
+	r.AddFileSet(&set)
+	return r, nil
+}
+
+// ReadFileDescriptorSet creates a registry from one or more FileDescriptorSet files.
+func ReadFileDescriptorSet(files ...string) (*Registry, error) {
+	r := NewRegistry()
+	for _, f := range files {
+		data, err := ioutil.ReadFile(f)
+		if err != nil {
+			return nil, fmt.Errorf("read file descriptor set failed, file:%s, err:%s", f, err)
+		}
+
+		var set descpb.FileDescriptorSet
+		err = proto.Unmarshal(data, &set)
+		if err != nil {
+			return nil, fmt.Errorf("unmarshal file descriptor set failed, file:%s, err:%s", f, err)
+		}
+
+		r.AddFileSet(&set)
+	}
+
+	return r, nil
+}
+
+// AddFileSet adds all files of set, files already added are skipped.
+func (r *Registry) AddFileSet(set *descpb.FileDescriptorSet) {
+	for _, f := range set.File {
+		r.AddFile(f)
+	}
+}
+
+// AddFile adds a file, file already added is skipped.
+func (r *Registry) AddFile(f *descpb.FileDescriptorProto) {
+	if _, ok := r.files[f.GetName()]; ok {
+		return
+	}
+
+	r.files[f.GetName()] = f
+
+	prefix := ""
+	if len(f.GetPackage()) > 0 {
+		prefix = f.GetPackage() + "."
+	}
+
+	proto3 := f.GetSyntax() == "proto3"
+	for _, m := range f.MessageType {
+		r.addMessage(prefix, m, proto3)
+	}
+
+	for _, e := range f.EnumType {
+		r.enums[prefix+e.GetName()] = e
+	}
+
+	for _, s := range f.Service {
+		for _, m := range s.Method {
+			name := fmt.Sprintf("/%s%s/%s", prefix, s.GetName(), m.GetName())
+			r.methods[name] = &Method{
+				Name:            name,
+				Input:           trimTypeName(m.GetInputType()),
+				Output:          trimTypeName(m.GetOutputType()),
+				ClientStreaming: m.GetClientStreaming(),
+				ServerStreaming: m.GetServerStreaming(),
+			}
+		}
+	}
+}
+
+// AddRegisteredFile adds a file compiled into current binary, and all its dependencies.
+// name is the path passed to protoc, eg: google/protobuf/timestamp.proto
+func (r *Registry) AddRegisteredFile(name string) error {
+	if _, ok := r.files[name]; ok {
+		return nil
+	}
+
+	gz := proto.FileDescriptor(name)
+	if gz == nil {
+		return fmt.Errorf("file descriptor not registered:%s", name)
+	}
+
+	reader, err := gzip.NewReader(bytes.NewReader(gz))
+	if err != nil {
+		return fmt.Errorf("invalid file descriptor:%s, err:%s", name, err)
+	}
+	defer reader.Close()
+
+	data, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return fmt.Errorf("invalid file descriptor:%s, err:%s", name, err)
+	}
+
+	var f descpb.FileDescriptorProto
+	err = proto.Unmarshal(data, &f)
+	if err != nil {
+		return fmt.Errorf("unmarshal file descriptor failed, file:%s, err:%s", name, err)
+	}
+
+	r.AddFile(&f)
+
+	for _, dep := range f.Dependency {
+		err = r.AddRegisteredFile(dep)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (r *Registry) addMessage(prefix string, m *descpb.DescriptorProto, proto3 bool) {
+	name := prefix + m.GetName()
+	msg := &message{
+		name:   name,
+		desc:   m,
+		proto3: proto3,
+		byNum:  make(map[int32]*descpb.FieldDescriptorProto),
+		byName: make(map[string]*descpb.FieldDescriptorProto),
+	}
+
+	for _, f := range m.Field {
+		msg.byNum[f.GetNumber()] = f
+		msg.byName[f.GetName()] = f
+		msg.byName[jsonName(f)] = f
+	}
+
+	r.messages[name] = msg
+
+	for _, n := range m.NestedType {
+		r.addMessage(name+".", n, proto3)
+	}
+
+	for _, e := range m.EnumType {
+		r.enums[name+"."+e.GetName()] = e
+	}
+}
+
+// Files returns the FileDescriptorSet of all files added.
+func (r *Registry) Files() *descpb.FileDescriptorSet {
+	names := make([]string, 0, len(r.files))
+	for n := range r.files {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+
+	set := &descpb.FileDescriptorSet{}
+	for _, n := range names {
+		set.File = append(set.File, r.files[n])
+	}
+
+	return set
+}
+
+// Method returns method by full name, eg: /package.Service/Method.
+func (r *Registry) Method(name string) (*Method, bool) {
+	m, ok := r.methods[name]
+	return m, ok
+}
+
+// Methods returns all methods sorted by name.
+func (r *Registry) Methods() []*Method {
+	ret := make([]*Method, 0, len(r.methods))
+	for _, m := range r.methods {
+		ret = append(ret, m)
+	}
+
+	sort.Slice(ret, func(i, j int) bool { return ret[i].Name < ret[j].Name })
+	return ret
+}
+
+// HasMessage checks whether message type is known, name is the full name without leading dot.
+func (r *Registry) HasMessage(name string) bool {
+	_, ok := r.messages[trimTypeName(name)]
+	return ok
+}
+
+// Fields returns fields of message, in declaration order.
+func (r *Registry) Fields(name string) ([]*descpb.FieldDescriptorProto, error) {
+	m, err := r.message(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return m.desc.Field, nil
+}
+
+func (r *Registry) message(name string) (*message, error) {
+	m, ok := r.messages[trimTypeName(name)]
+	if !ok {
+		return nil, fmt.Errorf("unknown message type:%s", name)
+	}
+
+	return m, nil
+}
+
+func trimTypeName(name string) string {
+	return strings.TrimPrefix(name, ".")
+}
+
+// jsonName returns json name of field, protoc always fills it, lower camel case name is used as fallback.
+func jsonName(f *descpb.FieldDescriptorProto) string {
+	if len(f.GetJsonName()) > 0 {
+		return f.GetJsonName()
+	}
+
+	var b strings.Builder
+	upper := false
+	for _, c := range f.GetName() {
+		if c == '_' {
+			upper = true
+			continue
+		}
+
+		if upper && c >= 'a' && c <= 'z' {
+			c = c - 'a' + 'A'
+		}
+
+		upper = false
+		b.WriteRune(c)
+	}
+
+	return b.String()
+}
+
+// JSONName returns the name used for field in jsonpb form.
+func JSONName(f *descpb.FieldDescriptorProto) string {
+	return jsonName(f)
+}
@@ -0,0 +1,408 @@
+package pbdesc
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	descpb "github.com/golang/protobuf/protoc-gen-go/descriptor"
+)
+
+// textMessage is a message parsed from text format, well known types are kept in plain message form.
+type textMessage map[string]interface{}
+
+// FromText converts a message in protobuf text format, as produced by proto.MarshalTextString(), to binary message.
+// extensions and expanded Any are not supported.
+func (r *Registry) FromText(name string, data []byte) ([]byte, error) {
+	m, err := r.message(name)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &textParser{s: string(data)}
+	v, err := p.parseMessage(r, m, "")
+	if err != nil {
+		return nil, fmt.Errorf("invalid text for message:%s, err:%s", name, err)
+	}
+
+	return r.Encode(name, v)
+}
+
+type textParser struct {
+	s   string
+	pos int
+}
+
+func (p *textParser) skip() {
+	for p.pos < len(p.s) {
+		c := p.s[p.pos]
+		if c == '#' {
+			for p.pos < len(p.s) && p.s[p.pos] != '\n' {
+				p.pos++
+			}
+			continue
+		}
+
+		if c != ' ' && c != '\t' && c != '\n' && c != '\r' {
+			return
+		}
+		p.pos++
+	}
+}
+
+func (p *textParser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("offset:%d, %s", p.pos, fmt.Sprintf(format, args...))
+}
+
+// peek returns next char after spaces and comments, 0 at end.
+func (p *textParser) peek() byte {
+	p.skip()
+	if p.pos >= len(p.s) {
+		return 0
+	}
+
+	return p.s[p.pos]
+}
+
+func (p *textParser) consume(c byte) bool {
+	if p.peek() == c {
+		p.pos++
+		return true
+	}
+
+	return false
+}
+
+func isTextWordChar(c byte) bool {
+	return c == '_' || c == '.' || c == '-' || c == '+' || (c >= '0' && c <= '9') || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+// word reads an identifier or a number.
+func (p *textParser) word() string {
+	p.skip()
+	start := p.pos
+	for p.pos < len(p.s) && isTextWordChar(p.s[p.pos]) {
+		p.pos++
+	}
+
+	return p.s[start:p.pos]
+}
+
+func (p *textParser) parseMessage(r *Registry, m *message, end string) (textMessage, error) {
+	ret := make(textMessage)
+	for {
+		c := p.peek()
+		if c == 0 {
+			if len(end) > 0 {
+				return nil, p.errorf("%s expected", end)
+			}
+			return ret, nil
+		}
+
+		if len(end) > 0 && c == end[0] {
+			p.pos++
+			return ret, nil
+		}
+
+		if c == '[' {
+			return nil, p.errorf("extension and Any are not supported")
+		}
+
+		name := p.word()
+		if len(name) == 0 {
+			return nil, p.errorf("field name expected")
+		}
+
+		fd, ok := m.byName[name]
+		if !ok {
+			return nil, p.errorf("unknown field:%s for message:%s", name, m.name)
+		}
+
+		err := p.parseField(r, fd, ret)
+		if err != nil {
+			return nil, err
+		}
+
+		if !p.consume(',') {
+			p.consume(';')
+		}
+	}
+}
+
+func (p *textParser) parseField(r *Registry, fd *descpb.FieldDescriptorProto, ret textMessage) error {
+	colon := p.consume(':')
+	isMsg := fd.GetType() == descpb.FieldDescriptorProto_TYPE_MESSAGE || fd.GetType() == descpb.FieldDescriptorProto_TYPE_GROUP
+	if !colon && !isMsg {
+		return p.errorf("':' expected after field:%s", fd.GetName())
+	}
+
+	var values []interface{}
+	if p.consume('[') {
+		for !p.consume(']') {
+			v, err := p.parseValue(r, fd)
+			if err != nil {
+				return err
+			}
+			values = append(values, v)
+
+			if !p.consume(',') && p.peek() != ']' {
+				return p.errorf("',' or ']' expected")
+			}
+		}
+	} else {
+		v, err := p.parseValue(r, fd)
+		if err != nil {
+			return err
+		}
+		values = append(values, v)
+	}
+
+	key := fd.GetName()
+
+	if entry, ok := r.isMapEntry(fd); ok {
+		kv, _ := ret[key].(map[string]interface{})
+		if kv == nil {
+			kv = make(map[string]interface{})
+			ret[key] = kv
+		}
+
+		for _, v := range values {
+			e := v.(textMessage)
+			k, err := numberString(e[entry.byNum[1].GetName()])
+			if err != nil {
+				k = fmt.Sprint(e[entry.byNum[1].GetName()])
+			}
+
+			val, ok := e[entry.byNum[2].GetName()]
+			if !ok {
+				val = textDefault(entry.byNum[2])
+			}
+			kv[k] = val
+		}
+		return nil
+	}
+
+	if fd.GetLabel() == descpb.FieldDescriptorProto_LABEL_REPEATED {
+		list, _ := ret[key].([]interface{})
+		ret[key] = append(list, values...)
+		return nil
+	}
+
+	if len(values) != 1 {
+		return p.errorf("list is not allowed for singular field:%s", fd.GetName())
+	}
+
+	ret[key] = values[0]
+	return nil
+}
+
+// textDefault is the value of map entry not given in text.
+func textDefault(fd *descpb.FieldDescriptorProto) interface{} {
+	switch fd.GetType() {
+	case descpb.FieldDescriptorProto_TYPE_MESSAGE:
+		return textMessage{}
+	case descpb.FieldDescriptorProto_TYPE_STRING, descpb.FieldDescriptorProto_TYPE_BYTES:
+		return ""
+	case descpb.FieldDescriptorProto_TYPE_BOOL:
+		return false
+	}
+
+	return json.Number("0")
+}
+
+func (p *textParser) parseValue(r *Registry, fd *descpb.FieldDescriptorProto) (interface{}, error) {
+	switch fd.GetType() {
+	case descpb.FieldDescriptorProto_TYPE_MESSAGE, descpb.FieldDescriptorProto_TYPE_GROUP:
+		m, err := r.message(fd.GetTypeName())
+		if err != nil {
+			return nil, err
+		}
+
+		end := "}"
+		if p.consume('<') {
+			end = ">"
+		} else if !p.consume('{') {
+			return nil, p.errorf("'{' expected for field:%s", fd.GetName())
+		}
+		return p.parseMessage(r, m, end)
+	case descpb.FieldDescriptorProto_TYPE_STRING:
+		s, err := p.parseString()
+		if err != nil {
+			return nil, err
+		}
+		return string(s), nil
+	case descpb.FieldDescriptorProto_TYPE_BYTES:
+		s, err := p.parseString()
+		if err != nil {
+			return nil, err
+		}
+		return base64.StdEncoding.EncodeToString(s), nil
+	case descpb.FieldDescriptorProto_TYPE_BOOL:
+		switch w := p.word(); w {
+		case "true", "t", "True", "1":
+			return true, nil
+		case "false", "f", "False", "0":
+			return false, nil
+		default:
+			return nil, p.errorf("invalid bool:%s", w)
+		}
+	case descpb.FieldDescriptorProto_TYPE_ENUM:
+		w := p.word()
+		if len(w) == 0 {
+			return nil, p.errorf("enum value expected for field:%s", fd.GetName())
+		}
+
+		if _, err := strconv.ParseInt(w, 0, 32); err == nil {
+			return json.Number(w), nil
+		}
+		return w, nil
+	case descpb.FieldDescriptorProto_TYPE_DOUBLE, descpb.FieldDescriptorProto_TYPE_FLOAT:
+		w := strings.ToLower(p.word())
+		switch strings.TrimPrefix(w, "-") {
+		case "inf", "infinity":
+			if w[0] == '-' {
+				return "-Infinity", nil
+			}
+			return "Infinity", nil
+		case "nan":
+			return "NaN", nil
+		}
+
+		w = strings.TrimSuffix(w, "f")
+		if _, err := strconv.ParseFloat(w, 64); err != nil {
+			return nil, p.errorf("invalid number:%s", w)
+		}
+		return json.Number(w), nil
+	}
+
+	w := p.word()
+	if strings.HasPrefix(w, "-") {
+		i, err := strconv.ParseInt(w, 0, 64)
+		if err != nil {
+			return nil, p.errorf("invalid number:%s", w)
+		}
+		return json.Number(strconv.FormatInt(i, 10)), nil
+	}
+
+	u, err := strconv.ParseUint(w, 0, 64)
+	if err != nil {
+		return nil, p.errorf("invalid number:%s", w)
+	}
+	return json.Number(strconv.FormatUint(u, 10)), nil
+}
+
+// parseString reads one or more adjacent quoted strings.
+func (p *textParser) parseString() ([]byte, error) {
+	var ret []byte
+	for {
+		q := p.peek()
+		if q != '"' && q != '\'' {
+			if ret == nil {
+				return nil, p.errorf("quoted string expected")
+			}
+			return ret, nil
+		}
+
+		p.pos++
+		for {
+			if p.pos >= len(p.s) || p.s[p.pos] == '\n' {
+				return nil, p.errorf("unterminated string")
+			}
+
+			c := p.s[p.pos]
+			p.pos++
+			if c == q {
+				break
+			}
+
+			if c != '\\' {
+				ret = append(ret, c)
+				continue
+			}
+
+			d, err := p.parseEscape()
+			if err != nil {
+				return nil, err
+			}
+			ret = append(ret, d...)
+		}
+
+		if ret == nil {
+			ret = []byte{}
+		}
+	}
+}
+
+func (p *textParser) parseEscape() ([]byte, error) {
+	if p.pos >= len(p.s) {
+		return nil, p.errorf("invalid escape")
+	}
+
+	c := p.s[p.pos]
+	p.pos++
+
+	switch c {
+	case 'n':
+		return []byte{'\n'}, nil
+	case 'r':
+		return []byte{'\r'}, nil
+	case 't':
+		return []byte{'\t'}, nil
+	case 'a':
+		return []byte{'\a'}, nil
+	case 'b':
+		return []byte{'\b'}, nil
+	case 'f':
+		return []byte{'\f'}, nil
+	case 'v':
+		return []byte{'\v'}, nil
+	case '\\', '\'', '"', '?':
+		return []byte{c}, nil
+	case 'x', 'X':
+		n := 0
+		for n < 2 && p.pos+n < len(p.s) && strings.IndexByte("0123456789abcdefABCDEF", p.s[p.pos+n]) >= 0 {
+			n++
+		}
+
+		v, err := strconv.ParseUint(p.s[p.pos:p.pos+n], 16, 8)
+		if err != nil {
+			return nil, p.errorf("invalid hex escape")
+		}
+		p.pos += n
+		return []byte{byte(v)}, nil
+	case 'u', 'U':
+		n := 4
+		if c == 'U' {
+			n = 8
+		}
+
+		if p.pos+n > len(p.s) {
+			return nil, p.errorf("invalid unicode escape")
+		}
+
+		v, err := strconv.ParseUint(p.s[p.pos:p.pos+n], 16, 32)
+		if err != nil {
+			return nil, p.errorf("invalid unicode escape")
+		}
+		p.pos += n
+		return []byte(string(rune(v))), nil
+	}
+
+	if c >= '0' && c <= '7' {
+		n := 1
+		for n < 3 && p.pos-1+n < len(p.s) && p.s[p.pos-1+n] >= '0' && p.s[p.pos-1+n] <= '7' {
+			n++
+		}
+
+		v, err := strconv.ParseUint(p.s[p.pos-1:p.pos-1+n], 8, 8)
+		if err != nil {
+			return nil, p.errorf("invalid octal escape")
+		}
+		p.pos += n - 1
+		return []byte{byte(v)}, nil
+	}
+
+	return nil, p.errorf("invalid escape:\\%c", c)
+}